@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/archive"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/console"
+	"github.com/benfiola/single-player-tarkov/pkg/download"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+)
+
+// AdminConfig is loaded from the environment and configures the admin api (and the clients calling it)
+type AdminConfig struct {
+	Addr  string `env:"ADMIN_API_ADDR"`
+	Token string `env:"ADMIN_API_TOKEN"`
+	Url   string `env:"ADMIN_API_URL" envDefault:"http://localhost:8080"`
+}
+
+// adminUploadLimit is the largest mod archive accepted by the admin api
+const adminUploadLimit = 1 << 30
+
+// adminReadHeaderTimeout is the time the admin api waits for a request's headers
+const adminReadHeaderTimeout = 10 * time.Second
+
+// uploadNameRegexp matches the file names accepted for uploaded mod archives
+var uploadNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Returns the staging directory holding mod archives uploaded through the admin api.
+// The directory lives in the data directory so that uploads survive container restarts (and are persisted to storage, if configured).
+func getUploadsDir(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "uploads")
+}
+
+// Validates the file name of an uploaded mod archive.
+// Returns an error if the name is not a plain file name or is not a supported archive.
+func validateUploadName(name string) error {
+	if !uploadNameRegexp.MatchString(name) || !isArchive(name) {
+		return fmt.Errorf("invalid upload name %s (expected a file name ending in one of %s)", name, strings.Join(archive.Extensions, ", "))
+	}
+	return nil
+}
+
+// Returns the mods uploaded through the admin api - one local archive mod (named after the archive) per uploaded file.
+// Returns an error if the uploads directory cannot be read.
+func GetModsFromUploads(ctx context.Context) ([]Mod, error) {
+	entries, err := os.ReadDir(getUploadsDir(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return []Mod{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || validateUploadName(entry.Name()) != nil {
+			continue
+		}
+		paths = append(paths, filepath.Join(getUploadsDir(ctx), entry.Name()))
+	}
+	return GetModsFromUrls(paths...)
+}
+
+// adminApi serves the admin api - reconciliations are serialized as they modify the spt path
+type adminApi struct {
+	config EntrypointConfig
+	ctx    context.Context
+	lock   sync.Mutex
+	token  string
+}
+
+// adminResponse is the body of every admin api response
+type adminResponse struct {
+	Error   string        `json:"error,omitempty"`
+	History []RunRecord   `json:"history,omitempty"`
+	Message string        `json:"message,omitempty"`
+	Mods    InstalledMods `json:"mods,omitempty"`
+}
+
+// Writes a json response
+func (aa *adminApi) respond(writer http.ResponseWriter, status int, response adminResponse) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("X-Run-Id", GetRunId())
+	writer.WriteHeader(status)
+	err := json.NewEncoder(writer).Encode(response)
+	if err != nil {
+		helper.Logger(aa.ctx).Warn("write admin api response failed", "error", err.Error())
+	}
+}
+
+// Wraps a handler - rejecting requests without the configured bearer token
+func (aa *adminApi) authenticate(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(aa.token)) != 1 {
+			aa.respond(writer, http.StatusUnauthorized, adminResponse{Error: "unauthorized"})
+			return
+		}
+		helper.Logger(aa.ctx).Info("admin api request", "method", request.Method, "path", request.URL.Path)
+		handler(writer, request)
+	}
+}
+
+// Determines whether mods can be reconciled.
+// Mods aren't reconciled in run mode (which leaves setup to an init container) or while the server process is up (as its mods would change underneath it).
+func (aa *adminApi) canReconcile() bool {
+	return aa.config.Mode != "run" && !serverRunning.Load()
+}
+
+// Reconciles mods (if possible, see [adminApi.canReconcile]) and responds with the installed mods.
+// Mods are loaded by the server at startup - the server must be restarted for changes to take effect.
+// Staged changes that can't be reconciled are installed by the next setup.
+func (aa *adminApi) reconcile(writer http.ResponseWriter, message string) {
+	aa.lock.Lock()
+	defer aa.lock.Unlock()
+	if !aa.canReconcile() {
+		aa.respond(writer, http.StatusAccepted, adminResponse{Message: fmt.Sprintf("%s - restart the server to install", message)})
+		return
+	}
+	err := ReconcileMods(aa.ctx, aa.config)
+	if err != nil {
+		helper.Logger(aa.ctx).Error("reconcile mods failed", "error", err.Error())
+		aa.respond(writer, http.StatusInternalServerError, adminResponse{Error: err.Error()})
+		return
+	}
+	installed, err := LoadInstalledMods(aa.ctx)
+	if err != nil {
+		aa.respond(writer, http.StatusInternalServerError, adminResponse{Error: err.Error()})
+		return
+	}
+	aa.respond(writer, http.StatusOK, adminResponse{Message: fmt.Sprintf("%s - restart the server to apply", message), Mods: installed})
+}
+
+// Handles 'GET /api/mods' - listing the installed mods
+func (aa *adminApi) listMods(writer http.ResponseWriter, request *http.Request) {
+	installed, err := LoadInstalledMods(aa.ctx)
+	if err != nil {
+		aa.respond(writer, http.StatusInternalServerError, adminResponse{Error: err.Error()})
+		return
+	}
+	aa.respond(writer, http.StatusOK, adminResponse{Mods: installed})
+}
+
+// Handles 'GET /api/history' - listing the runs recorded in the run history (see [RecordRunWhile])
+// Runs can be filtered by their outcome ('?outcome=') and limited to the most recent runs ('?limit=')
+func (aa *adminApi) getHistory(writer http.ResponseWriter, request *http.Request) {
+	limit := 0
+	if request.URL.Query().Has("limit") {
+		var err error
+		limit, err = strconv.Atoi(request.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			aa.respond(writer, http.StatusBadRequest, adminResponse{Error: fmt.Sprintf("invalid limit %s", request.URL.Query().Get("limit"))})
+			return
+		}
+	}
+	records, err := LoadRunHistory(aa.ctx)
+	if err != nil {
+		aa.respond(writer, http.StatusInternalServerError, adminResponse{Error: err.Error()})
+		return
+	}
+	aa.respond(writer, http.StatusOK, adminResponse{History: filterRunHistory(records, request.URL.Query().Get("outcome"), limit)})
+}
+
+// Handles 'PUT /api/uploads/{name}' - staging the request body as an uploaded mod archive and reconciling mods
+func (aa *adminApi) putUpload(writer http.ResponseWriter, request *http.Request) {
+	name := request.PathValue("name")
+	err := validateUploadName(name)
+	if err != nil {
+		aa.respond(writer, http.StatusBadRequest, adminResponse{Error: err.Error()})
+		return
+	}
+	uploadsDir := getUploadsDir(aa.ctx)
+	err = os.MkdirAll(uploadsDir, 0755)
+	if err != nil {
+		aa.respond(writer, http.StatusInternalServerError, adminResponse{Error: err.Error()})
+		return
+	}
+	// uploads are written to a hidden temporary file and renamed into place so that a partial upload is never installed
+	handle, err := os.CreateTemp(uploadsDir, fmt.Sprintf(".%s.*", name))
+	if err != nil {
+		aa.respond(writer, http.StatusInternalServerError, adminResponse{Error: err.Error()})
+		return
+	}
+	defer os.Remove(handle.Name())
+	_, err = io.Copy(handle, http.MaxBytesReader(writer, request.Body, adminUploadLimit))
+	err = errors.Join(err, handle.Close())
+	if err == nil {
+		err = os.Rename(handle.Name(), filepath.Join(uploadsDir, name))
+	}
+	maxBytesErr := &http.MaxBytesError{}
+	if errors.As(err, &maxBytesErr) {
+		aa.respond(writer, http.StatusRequestEntityTooLarge, adminResponse{Error: fmt.Sprintf("upload %s exceeds %d bytes", name, maxBytesErr.Limit)})
+		return
+	}
+	if err != nil {
+		aa.respond(writer, http.StatusInternalServerError, adminResponse{Error: err.Error()})
+		return
+	}
+	aa.reconcile(writer, fmt.Sprintf("uploaded %s", name))
+}
+
+// Handles 'DELETE /api/uploads/{name}' - removing an uploaded mod archive and reconciling mods
+func (aa *adminApi) deleteUpload(writer http.ResponseWriter, request *http.Request) {
+	name := request.PathValue("name")
+	err := validateUploadName(name)
+	if err != nil {
+		aa.respond(writer, http.StatusBadRequest, adminResponse{Error: err.Error()})
+		return
+	}
+	err = os.Remove(filepath.Join(getUploadsDir(aa.ctx), name))
+	if errors.Is(err, os.ErrNotExist) {
+		aa.respond(writer, http.StatusNotFound, adminResponse{Error: fmt.Sprintf("upload %s not found", name)})
+		return
+	}
+	if err != nil {
+		aa.respond(writer, http.StatusInternalServerError, adminResponse{Error: err.Error()})
+		return
+	}
+	aa.reconcile(writer, fmt.Sprintf("deleted %s", name))
+}
+
+// Handles 'POST /api/reconcile' - reconciling mods (e.g., after changing a mounted mod directory).
+// Responds with a conflict if mods can't be reconciled (see [adminApi.canReconcile]).
+func (aa *adminApi) postReconcile(writer http.ResponseWriter, request *http.Request) {
+	if !aa.canReconcile() {
+		aa.respond(writer, http.StatusConflict, adminResponse{Error: "mods can't be reconciled while the server runs or in run mode - restart the server to install mods"})
+		return
+	}
+	aa.reconcile(writer, "reconciled mods")
+}
+
+// Handles 'POST /api/sequences/{name}' - starting a console sequence (which continues to run in the background)
+func (aa *adminApi) postSequence(writer http.ResponseWriter, request *http.Request) {
+	name := request.PathValue("name")
+	sequence, ok := aa.config.ConsoleSequences[name]
+	if !ok {
+		aa.respond(writer, http.StatusNotFound, adminResponse{Error: fmt.Sprintf("console sequence %s not found", name)})
+		return
+	}
+	if console.Get(aa.ctx) == nil {
+		aa.respond(writer, http.StatusConflict, adminResponse{Error: "server console unavailable"})
+		return
+	}
+	go func() {
+		err := console.RunSequence(aa.ctx, name, sequence)
+		if err != nil {
+			helper.Logger(aa.ctx).Warn("console sequence failed", "name", name, "error", err.Error())
+		}
+	}()
+	aa.respond(writer, http.StatusAccepted, adminResponse{Message: fmt.Sprintf("started console sequence %s", name)})
+}
+
+// Handles 'GET /metrics' - mod log line counts and log cleanup totals, in the prometheus text format
+func (aa *adminApi) getMetrics(writer http.ResponseWriter, request *http.Request) {
+	counts := map[string]map[string]int64{}
+	modLogs := GetModLogs(aa.ctx)
+	if modLogs != nil {
+		counts = modLogs.Counts()
+	}
+	mods := helper.Map[string, map[string]int64](counts).Keys()
+	slices.Sort(mods)
+	builder := strings.Builder{}
+	builder.WriteString("# HELP spt_mod_log_lines_total Lines logged to the server console by a mod.\n")
+	builder.WriteString("# TYPE spt_mod_log_lines_total counter\n")
+	for _, mod := range mods {
+		for _, level := range modLogLevels {
+			fmt.Fprintf(&builder, "spt_mod_log_lines_total{mod=%q,level=%q} %d\n", mod, level, counts[mod][level])
+		}
+	}
+	cleanup, err := LoadLogCleanupState(aa.ctx)
+	if err != nil {
+		helper.Logger(aa.ctx).Warn("log cleanup state unavailable", "error", err.Error())
+	}
+	builder.WriteString("# HELP spt_log_cleanup_bytes Size of the files managed by the log cleanup after its last run.\n")
+	builder.WriteString("# TYPE spt_log_cleanup_bytes gauge\n")
+	fmt.Fprintf(&builder, "spt_log_cleanup_bytes %d\n", cleanup.Bytes)
+	builder.WriteString("# HELP spt_log_cleanup_files Number of files managed by the log cleanup after its last run.\n")
+	builder.WriteString("# TYPE spt_log_cleanup_files gauge\n")
+	fmt.Fprintf(&builder, "spt_log_cleanup_files %d\n", cleanup.Files)
+	builder.WriteString("# HELP spt_log_cleanup_removed_bytes_total Bytes removed by the log cleanup.\n")
+	builder.WriteString("# TYPE spt_log_cleanup_removed_bytes_total counter\n")
+	fmt.Fprintf(&builder, "spt_log_cleanup_removed_bytes_total %d\n", cleanup.RemovedBytes)
+	builder.WriteString("# HELP spt_log_cleanup_removed_files_total Files removed by the log cleanup.\n")
+	builder.WriteString("# TYPE spt_log_cleanup_removed_files_total counter\n")
+	fmt.Fprintf(&builder, "spt_log_cleanup_removed_files_total %d\n", cleanup.RemovedFiles)
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writer.Header().Set("X-Run-Id", GetRunId())
+	_, err = io.WriteString(writer, builder.String())
+	if err != nil {
+		helper.Logger(aa.ctx).Warn("write admin api response failed", "error", err.Error())
+	}
+}
+
+// Responds with the outcome of the health probes (see [MonitorHealthWhile]) of a kind (liveness or readiness) - or every probe if no kind is given.
+// Health checks are unauthenticated - so that orchestrators can probe the server without a token.
+func (aa *adminApi) getHealth(writer http.ResponseWriter, request *http.Request) {
+	kind := request.PathValue("kind")
+	if !slices.Contains(healthProbeKinds, kind) {
+		aa.respond(writer, http.StatusNotFound, adminResponse{Error: fmt.Sprintf("unknown health probe kind %s", kind)})
+		return
+	}
+	monitor := GetHealthMonitor(aa.ctx)
+	if monitor == nil {
+		aa.respond(writer, http.StatusServiceUnavailable, adminResponse{Error: "health probes are not running"})
+		return
+	}
+	err := monitor.Status().Check(kind, clock.Get(aa.ctx).Now())
+	if err != nil {
+		aa.respond(writer, http.StatusServiceUnavailable, adminResponse{Error: err.Error()})
+		return
+	}
+	aa.respond(writer, http.StatusOK, adminResponse{Message: "healthy"})
+}
+
+// Creates the handler serving the admin api - and the mirror (see [mirror]) of the configured files
+func newAdminHandler(ctx context.Context, config EntrypointConfig, token string, mirrorFiles MirrorFiles) http.Handler {
+	api := &adminApi{config: config, ctx: ctx, token: token}
+	mux := http.NewServeMux()
+	if len(mirrorFiles) > 0 {
+		mux.HandleFunc("GET /mirror/{name}", newMirror(ctx, mirrorFiles).serve)
+	}
+	mux.HandleFunc("GET /api/history", api.authenticate(api.getHistory))
+	mux.HandleFunc("GET /api/mods", api.authenticate(api.listMods))
+	mux.HandleFunc("PUT /api/uploads/{name}", api.authenticate(api.putUpload))
+	mux.HandleFunc("DELETE /api/uploads/{name}", api.authenticate(api.deleteUpload))
+	mux.HandleFunc("POST /api/reconcile", api.authenticate(api.postReconcile))
+	mux.HandleFunc("POST /api/sequences/{name}", api.authenticate(api.postSequence))
+	mux.HandleFunc("GET /metrics", api.authenticate(api.getMetrics))
+	mux.HandleFunc("GET /health", api.getHealth)
+	mux.HandleFunc("GET /health/{kind}", api.getHealth)
+	return mux
+}
+
+// Runs a function while serving the admin api (and the mirror) on ADMIN_API_ADDR - and stops serving once the function returns.
+// Runs the function alone if ADMIN_API_ADDR is unset.
+// Returns an error if the admin api is configured without a token or cannot listen on its address.
+// Returns an error if the function fails.
+func ServeAdminApiWhile(ctx context.Context, config EntrypointConfig, run func() error) error {
+	adminConfig := AdminConfig{}
+	err := helper.ParseEnv(ctx, &adminConfig)
+	if err != nil {
+		return err
+	}
+	mirrorConfig := MirrorConfig{}
+	err = helper.ParseEnv(ctx, &mirrorConfig)
+	if err != nil {
+		return err
+	}
+	if adminConfig.Addr == "" {
+		if len(mirrorConfig.Files) > 0 {
+			helper.Logger(ctx).Warn("MIRROR_FILES is set but the admin api is disabled - set ADMIN_API_ADDR to serve the mirror")
+		}
+		return run()
+	}
+	if adminConfig.Token == "" {
+		return &UserError{
+			Hint:    "set ADMIN_API_TOKEN to a secret shared with admin api clients",
+			Message: "admin api requires a token",
+		}
+	}
+	listener, err := net.Listen("tcp", adminConfig.Addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: newAdminHandler(ctx, config, adminConfig.Token, mirrorConfig.Files), ReadHeaderTimeout: adminReadHeaderTimeout}
+	served := make(chan error, 1)
+	go func() {
+		helper.Logger(ctx).Info("serve admin api", "addr", listener.Addr().String())
+		served <- server.Serve(listener)
+	}()
+
+	runErr := run()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	shutdownErr := server.Shutdown(shutdownCtx)
+	serveErr := <-served
+	if errors.Is(serveErr, http.ErrServerClosed) {
+		serveErr = nil
+	}
+	return errors.Join(runErr, shutdownErr, serveErr)
+}
+
+// Uploads mod archives to a running server through the admin api (at ADMIN_API_URL, authenticated with ADMIN_API_TOKEN).
+// Each upload is staged on the server - the server must be restarted for the mod to be installed and loaded.
+// Returns an error if an archive cannot be read or the admin api rejects an upload.
+func Upload(ctx context.Context, args ...string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: upload <archive> [<archive>...]")
+	}
+	config := AdminConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	if config.Token == "" {
+		return fmt.Errorf("upload requires ADMIN_API_TOKEN")
+	}
+	for _, path := range args {
+		name := filepath.Base(path)
+		err := validateUploadName(name)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		uploadUrl := fmt.Sprintf("%s/api/uploads/%s", strings.TrimSuffix(config.Url, "/"), url.PathEscape(name))
+		request, err := http.NewRequestWithContext(outbound.Declare(ctx, "upload mod"), http.MethodPut, uploadUrl, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", config.Token))
+		helper.Logger(ctx).Info("upload mod", "path", path, "url", uploadUrl)
+		response, err := outbound.Client.Do(request)
+		if err != nil {
+			return err
+		}
+		body := adminResponse{}
+		err = json.NewDecoder(response.Body).Decode(&body)
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusAccepted {
+			if body.Error != "" {
+				return fmt.Errorf("upload %s failed: %s", name, body.Error)
+			}
+			return &download.StatusError{Method: http.MethodPut, StatusCode: response.StatusCode, Url: uploadUrl}
+		}
+		if err != nil {
+			return err
+		}
+		mods := helper.Map[string, InstalledMod](body.Mods).Keys()
+		slices.Sort(mods)
+		helper.Logger(ctx).Info(body.Message, "mods", mods)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// sptCoreConfig holds the fields of an spt installation's core.json identifying its version
+type sptCoreConfig struct {
+	AkiVersion string `json:"akiVersion"`
+	SptVersion string `json:"sptVersion"`
+}
+
+// Detects the version of an existing spt installation from its core config - falling back to the layout used by older (AKI) releases.
+// Returns an error if the directory is not an spt installation.
+func detectSptVersion(ctx context.Context, dir string) (string, error) {
+	for _, dataDir := range []string{"SPT_Data", "Aki_Data"} {
+		path := filepath.Join(dir, dataDir, "Server", "configs", "core.json")
+		_, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		config := sptCoreConfig{}
+		err = helper.UnmarshalFile(ctx, path, &config)
+		if err != nil {
+			return "", err
+		}
+		version := config.SptVersion
+		if version == "" {
+			version = config.AkiVersion
+		}
+		if version == "" {
+			return "", fmt.Errorf("%s does not specify an spt version", path)
+		}
+		return version, nil
+	}
+	return "", fmt.Errorf("%s is not an spt installation (core config not found)", dir)
+}
+
+// Copies the server mods of an existing spt installation into the given directory - so that they can be installed via MOD_DIRS.
+// Returns the names of the copied mods.
+// Returns an error if a mod cannot be copied.
+func adoptMods(ctx context.Context, dir string, dest string) ([]string, error) {
+	modsDir := filepath.Join(dir, "user", "mods")
+	entries, err := os.ReadDir(modsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		_, err := fsutil.CopyTree(ctx, filepath.Join(modsDir, entry.Name()), filepath.Join(dest, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+// Copies the profiles of an existing spt installation into the data directory (where profiles are persisted).
+// Profiles already present in the data directory are kept (and logged).
+// Returns the number of copied profiles.
+// Returns an error if a profile cannot be copied.
+func adoptProfiles(ctx context.Context, dir string) (int, error) {
+	profilesDir := filepath.Join(dir, "user", "profiles")
+	entries, err := os.ReadDir(profilesDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		dest := filepath.Join(helper.Dirs(ctx)["data"], "user", "profiles", entry.Name())
+		_, err := os.Lstat(dest)
+		if err == nil {
+			helper.Logger(ctx).Warn("profile already exists - skipping", "profile", entry.Name(), "path", dest)
+			continue
+		}
+		err = fsutil.CopyFile(filepath.Join(profilesDir, entry.Name()), dest, 0644)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Imports an existing (e.g., manually installed) spt installation into the entrypoint's managed layout.
+// Detects the installation's spt version, then copies its server mods and profiles into the data directory.
+// Prints the environment that starts the adopted installation (which is rebuilt from source - and cached - rather than copied).
+// Returns an error if the directory is not an spt installation.
+// Returns an error if mods or profiles cannot be copied.
+func Adopt(ctx context.Context, args ...string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: adopt <spt-dir>")
+	}
+	dir := args[0]
+	version, err := detectSptVersion(ctx, dir)
+	if err != nil {
+		return err
+	}
+	helper.Logger(ctx).Info("adopt spt installation", "path", dir, "version", version)
+
+	packages, err := loadModPackagesFrom(filepath.Join(dir, "user", "mods"))
+	if err != nil {
+		return err
+	}
+	for _, modPackage := range packages {
+		helper.Logger(ctx).Info("found mod", "dir", modPackage.Dir, "name", modPackage.Name, "version", modPackage.Version)
+	}
+	modsDest := filepath.Join(helper.Dirs(ctx)["data"], "adopted-mods")
+	mods, err := adoptMods(ctx, dir, modsDest)
+	if err != nil {
+		return err
+	}
+
+	profiles, err := adoptProfiles(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "BepInEx"))
+	if err == nil {
+		helper.Logger(ctx).Warn("client plugins (BepInEx) are not adopted - only server mods are installed by the entrypoint", "path", filepath.Join(dir, "BepInEx"))
+	}
+
+	fmt.Fprintf(os.Stderr, "adopted spt %s (%d mods, %d profiles) - start the server with the following environment:\n", version, len(mods), profiles)
+	fmt.Printf("SPT_VERSION=%s\n", version)
+	if len(mods) > 0 {
+		fmt.Printf("MOD_DIRS=%s\n", modsDest)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// Bootstraps the entrypoint in place of the helper's bootstrap.
+// Taking ownership of the entrypoint's directories is handled by the 'chown' step policy (see [runStep]).
+// When run as root, takes ownership of the entrypoint's directories and relaunches the entrypoint as the non-root user.
+// When run as non-root, relaunches the entrypoint as the current user.
+// In both cases, files within the directories owned by other users are reported - and repaired if requested (see [CheckOwnership]).
+// Returns an error if the non-root user cannot be determined or updated.
+// Returns an error if ownership of the directories cannot be taken.
+// Returns an error if the relaunched entrypoint fails.
+func Bootstrap(ctx context.Context) error {
+	config := OwnershipConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	runAsUser := helper.GetCurrentUser(ctx)
+	if runAsUser.Uid == 0 {
+		runAsUser, err = helper.GetEnvUser(ctx)
+		if err != nil {
+			return err
+		}
+		err = helper.UpdateUser(ctx, "server", runAsUser)
+		if err != nil {
+			return err
+		}
+		err = runStep(ctx, "chown", func() error {
+			dirs := helper.Dirs(ctx).Values()
+			err := helper.CreateDirs(ctx, dirs...)
+			if err != nil {
+				return err
+			}
+			for _, dir := range dirs {
+				helper.Logger(ctx).Info("set owner", "owner", runAsUser, "path", dir)
+				err = os.Chown(dir, runAsUser.Uid, runAsUser.Gid)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil && !ignoreStepError(ctx, err, "user", runAsUser) {
+			return err
+		}
+	}
+	err = CheckOwnership(ctx, runAsUser, config.Repair)
+	if err != nil && !ignoreStepError(ctx, err, "user", runAsUser) {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	_, err = helper.Command(ctx, []string{executable, "entrypoint"}, helper.CmdOpts{Attach: true, Env: os.Environ(), User: runAsUser}).Run()
+	return err
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"path"
+
+	"github.com/benfiola/single-player-tarkov/pkg/patch"
+)
+
+// BrandingConfig is loaded from the environment and configures the server's branding
+type BrandingConfig struct {
+	Description string `env:"SERVER_DESCRIPTION"`
+	Motd        string `env:"SERVER_MOTD"`
+	Name        string `env:"SERVER_NAME"`
+}
+
+// Returns the config patches applying the server's branding to the config locations of the given spt version.
+// The server name is shown by the launcher and in the server console.
+// The description and message of the day are delivered by the image info mod (see [WriteImageInfoMod]).
+// Returns an error if the spt version is not covered by a data directory.
+func getBrandingPatches(sptVersion string, config BrandingConfig) (patch.ConfigPatches, error) {
+	if config.Name == "" {
+		return patch.ConfigPatches{}, nil
+	}
+	dataDir, err := getSptDataDir(sptVersion)
+	if err != nil {
+		return nil, err
+	}
+	return patch.ConfigPatches{
+		path.Join(dataDir, "Server/configs/core.json"): []patch.Patch{{Op: "replace", Path: "/serverName", Value: config.Name}},
+	}, nil
+}
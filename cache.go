@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/benfiola/single-player-tarkov/pkg/filecache"
+	"github.com/benfiola/single-player-tarkov/pkg/limits"
+)
+
+// Implements the 'cache' subcommand - listing, pruning or verifying the items of the file cache.
+// Pruning defaults to CACHE_SIZE_LIMIT - '0' empties the file cache.
+// Returns an error if the arguments are invalid.
+// Returns an error if no size is given and CACHE_SIZE_LIMIT is unset.
+// Returns an error if the file cache cannot be read, pruned or verified.
+// Returns an error if corrupt items were found (and removed).
+func Cache(ctx context.Context, args ...string) error {
+	usage := fmt.Errorf("usage: cache list | cache prune [max-size] | cache verify")
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		items, err := filecache.List(ctx)
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "KEY\tSIZE\tLAST ACCESSED")
+		total := int64(0)
+		for _, item := range items {
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", item.Key, formatMebibytes(item.Size), item.LastAccessed.Local().Format(time.RFC3339))
+			total += item.Size
+		}
+		err = writer.Flush()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "\n%d item(s), %s total\n", len(items), formatMebibytes(total))
+		return nil
+	case args[0] == "prune" && len(args) <= 2:
+		maxSize := filecache.GetMaxSize(ctx)
+		if len(args) == 2 {
+			maxSize = 0
+			if args[1] != "0" {
+				parsed, err := limits.ParseMemory(args[1])
+				if err != nil {
+					return fmt.Errorf("invalid max size %s: %w", args[1], err)
+				}
+				maxSize = parsed
+			}
+		} else if maxSize == 0 {
+			return fmt.Errorf("no max size given and CACHE_SIZE_LIMIT is unset")
+		}
+		evicted, err := filecache.Prune(ctx, maxSize)
+		if err != nil {
+			return err
+		}
+		freed := int64(0)
+		for _, item := range evicted {
+			fmt.Fprintf(os.Stdout, "evicted %s (%s, last accessed %s)\n", item.Key, formatMebibytes(item.Size), item.LastAccessed.Local().Format(time.RFC3339))
+			freed += item.Size
+		}
+		fmt.Fprintf(os.Stdout, "evicted %d item(s), freeing %s\n", len(evicted), formatMebibytes(freed))
+		return nil
+	case args[0] == "verify" && len(args) == 1:
+		results, err := filecache.Verify(ctx)
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "KEY\tSIZE\tSTATUS")
+		corrupt := 0
+		for _, result := range results {
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", result.Item.Key, formatMebibytes(result.Item.Size), result.Status)
+			if result.Status == filecache.VerifyCorrupt {
+				corrupt += 1
+			}
+		}
+		err = writer.Flush()
+		if err != nil {
+			return err
+		}
+		if corrupt > 0 {
+			return fmt.Errorf("removed %d corrupt item(s) - they're re-fetched on next start", corrupt)
+		}
+		return nil
+	default:
+		return usage
+	}
+}
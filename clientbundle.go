@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// Returns the client-side files (i.e., BepInEx plugins - relative to the spt path) of each installed mod - omitting mods without client-side files.
+func getClientModFiles(ctx context.Context, installed InstalledMods) (map[string][]string, error) {
+	clientFiles := map[string][]string{}
+	for name, installedMod := range installed {
+		for _, file := range installedMod.Files {
+			if !strings.HasPrefix(file, "BepInEx"+string(filepath.Separator)) {
+				continue
+			}
+			info, err := os.Lstat(filepath.Join(helper.Dirs(ctx)["spt"], file))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !info.Mode().IsRegular() {
+				continue
+			}
+			clientFiles[name] = append(clientFiles[name], file)
+		}
+	}
+	return clientFiles, nil
+}
+
+// Zips the contents of a directory into an archive at the given path - written atomically.
+// Returns an error if the archive cannot be written.
+func zipDir(dir string, path string) error {
+	tempPath := path + ".tmp"
+	handle, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempPath)
+	defer handle.Close()
+	writer := zip.NewWriter(handle)
+	err = filepath.WalkDir(dir, func(current string, entry os.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, current)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(current)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		fileWriter, err := writer.CreateHeader(&zip.FileHeader{Name: filepath.ToSlash(relPath), Method: zip.Deflate, Modified: info.ModTime()})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fileWriter, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	err = handle.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+// Collects the client-side components (BepInEx plugins) of installed mods into the data directory (client-mods) - optionally zipped (client-mods.zip).
+// Players copy the bundle into their game directory so that their client matches the server's mods.
+// The bundle is rebuilt from scratch - and removed if no installed mod has client-side components.
+// Returns an error if installed mods cannot be read.
+// Returns an error if the bundle cannot be written.
+func WriteClientBundle(ctx context.Context, zipped bool) error {
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return err
+	}
+	clientFiles, err := getClientModFiles(ctx, installed)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(helper.Dirs(ctx)["data"], "client-mods")
+	zipPath := dir + ".zip"
+	err = helper.RemovePaths(ctx, dir, zipPath)
+	if err != nil {
+		return err
+	}
+	if len(clientFiles) == 0 {
+		return nil
+	}
+
+	names := helper.Map[string, []string](clientFiles).Keys()
+	slices.Sort(names)
+	for _, name := range names {
+		helper.Logger(ctx).Info("bundle client mod", "name", name, "files", len(clientFiles[name]))
+		for _, file := range clientFiles[name] {
+			err := fsutil.CopyFile(filepath.Join(helper.Dirs(ctx)["spt"], file), filepath.Join(dir, file), 0644)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	helper.Logger(ctx).Info("write client bundle", "path", dir, "mods", len(names))
+	if !zipped {
+		return nil
+	}
+	helper.Logger(ctx).Info("zip client bundle", "path", zipPath)
+	return zipDir(dir, zipPath)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/patch"
+)
+
+// ConfigBundleConfig is loaded from the environment and configures the signing and verification of config bundles (see [Config])
+type ConfigBundleConfig struct {
+	SigningKey  string   `env:"CONFIG_BUNDLE_SIGNING_KEY"`
+	TrustedKeys []string `env:"CONFIG_BUNDLE_TRUSTED_KEYS"`
+}
+
+// ConfigBundleManifest describes the contents of a config bundle - signed as a whole, with the checksum of every other file of the bundle
+type ConfigBundleManifest struct {
+	Created    time.Time         `json:"created"`
+	Entrypoint string            `json:"entrypoint"`
+	Files      map[string]string `json:"files"`
+	Name       string            `json:"name"`
+	SptVersion string            `json:"sptVersion"`
+}
+
+// ConfigBundleSignature is the signature of a config bundle's manifest - alongside the public key verifying it
+type ConfigBundleSignature struct {
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+const (
+	// configBundleManifest is the name of the manifest (see [ConfigBundleManifest]) within a config bundle
+	configBundleManifest = "bundle.json"
+	// configBundlePatches is the name of the config patches within a config bundle
+	configBundlePatches = "patches.json"
+	// configBundleSignature is the name of the signature (see [ConfigBundleSignature]) within a config bundle
+	configBundleSignature = "bundle.sig"
+	// configBundleFiles is the directory (within a config bundle) holding the config files generated by the patches - for review
+	configBundleFiles = "files/"
+)
+
+// Returns the path to the key signing exported config bundles - CONFIG_BUNDLE_SIGNING_KEY, or a key kept in the data directory.
+// The default key is hidden, so that it's never synced with storage (see [listStorableFiles]).
+func getConfigBundleKeyPath(ctx context.Context, config ConfigBundleConfig) string {
+	if config.SigningKey != "" {
+		return config.SigningKey
+	}
+	return filepath.Join(helper.Dirs(ctx)["data"], ".config-bundle.key")
+}
+
+// Loads the (base64-encoded ed25519 seed) key signing exported config bundles - generating and writing a new key if none exists.
+// Returns an error if the key cannot be read, generated or written.
+// Returns an error if the key is malformed.
+func loadConfigBundleKey(ctx context.Context, config ConfigBundleConfig) (ed25519.PrivateKey, error) {
+	keyPath := getConfigBundleKeyPath(ctx, config)
+	data, err := os.ReadFile(keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		helper.Logger(ctx).Info("generate config bundle signing key", "path", keyPath)
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		err = os.MkdirAll(filepath.Dir(keyPath), 0755)
+		if err != nil {
+			return nil, err
+		}
+		err = fsutil.WriteFileAtomic(keyPath, []byte(base64.StdEncoding.EncodeToString(key.Seed())+"\n"))
+		if err != nil {
+			return nil, err
+		}
+		return key, os.Chmod(keyPath, 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid config bundle signing key %s (expected a base64-encoded ed25519 seed)", keyPath)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// Returns the checksum of a file within a config bundle
+func getConfigBundleChecksum(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
+
+// Writes a config bundle of the operator's config patches (and the config files they generated) to the given path.
+// The bundle's manifest is signed with the signing key (see [loadConfigBundleKey]).
+// Returns an error if no config patches are configured.
+// Returns an error if the signing key cannot be loaded.
+// Returns an error if the bundle cannot be written.
+func exportConfigBundle(ctx context.Context, config EntrypointConfig, bundleConfig ConfigBundleConfig, output string) error {
+	if len(config.ConfigPatches) == 0 {
+		return fmt.Errorf("no config patches to export (are CONFIG_PATCHES, CONFIG_PATCHES_DIR or CONFIG_PATCHES_FILES set?)")
+	}
+	key, err := loadConfigBundleKey(ctx, bundleConfig)
+	if err != nil {
+		return err
+	}
+
+	files := map[string][]byte{}
+	data, err := json.MarshalIndent(config.ConfigPatches, "", "  ")
+	if err != nil {
+		return err
+	}
+	files[configBundlePatches] = data
+	expanded, err := patch.Expand(ctx, helper.Dirs(ctx)["spt"], config.ConfigPatches)
+	if err != nil {
+		return err
+	}
+	relPaths := helper.Map[string, []patch.Patch](expanded).Keys()
+	slices.Sort(relPaths)
+	for _, relPath := range relPaths {
+		data, err := os.ReadFile(filepath.Join(helper.Dirs(ctx)["spt"], relPath))
+		if errors.Is(err, os.ErrNotExist) {
+			helper.Logger(ctx).Warn("generated config file unavailable - omitted from bundle (has the server been set up?)", "path", relPath)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		files[configBundleFiles+filepath.ToSlash(relPath)] = data
+	}
+
+	created := clock.Get(ctx).Now()
+	manifest := ConfigBundleManifest{
+		Created:    created,
+		Entrypoint: strings.TrimSpace(helper.Version(ctx)),
+		Files:      map[string]string{},
+		Name:       strings.TrimSuffix(filepath.Base(output), filepath.Ext(output)),
+		SptVersion: config.SptVersion,
+	}
+	for name, data := range files {
+		manifest.Files[name] = getConfigBundleChecksum(data)
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	files[configBundleManifest] = manifestData
+	signature := ConfigBundleSignature{
+		PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifestData)),
+	}
+	files[configBundleSignature], err = json.MarshalIndent(signature, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	buffer := bytes.Buffer{}
+	writer := zip.NewWriter(&buffer)
+	names := helper.Map[string, []byte](files).Keys()
+	slices.Sort(names)
+	for _, name := range names {
+		fileWriter, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: created})
+		if err != nil {
+			return err
+		}
+		_, err = fileWriter.Write(files[name])
+		if err != nil {
+			return err
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	err = fsutil.WriteFileAtomic(output, buffer.Bytes())
+	if err != nil {
+		return err
+	}
+	helper.Logger(ctx).Info("exported config bundle", "path", output, "files", len(relPaths), "key", signature.PublicKey)
+	return nil
+}
+
+// ConfigBundle is a verified config bundle (see [readConfigBundle])
+type ConfigBundle struct {
+	Manifest  ConfigBundleManifest
+	Patches   patch.ConfigPatches
+	PublicKey string
+}
+
+// Reads and verifies a config bundle.
+// The manifest must be signed by the accompanying public key, and every file must match its recorded checksum.
+// Returns an error if the bundle cannot be read or is malformed.
+// Returns an error if the signature or a checksum doesn't match, or the bundle contains files missing from its manifest.
+func readConfigBundle(bundlePath string) (ConfigBundle, error) {
+	bundle := ConfigBundle{}
+	reader, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		return bundle, fmt.Errorf("read config bundle %s: %w", bundlePath, err)
+	}
+	defer reader.Close()
+	files := map[string][]byte{}
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		handle, err := file.Open()
+		if err != nil {
+			return bundle, err
+		}
+		data, err := io.ReadAll(handle)
+		handle.Close()
+		if err != nil {
+			return bundle, err
+		}
+		name := path.Clean(file.Name)
+		_, ok := files[name]
+		if ok {
+			return bundle, fmt.Errorf("config bundle %s contains %s more than once", bundlePath, name)
+		}
+		files[name] = data
+	}
+
+	signature := ConfigBundleSignature{}
+	err = json.Unmarshal(files[configBundleSignature], &signature)
+	if err != nil {
+		return bundle, fmt.Errorf("config bundle %s is unsigned or its signature is malformed", bundlePath)
+	}
+	publicKey, keyErr := base64.StdEncoding.DecodeString(signature.PublicKey)
+	signatureData, signatureErr := base64.StdEncoding.DecodeString(signature.Signature)
+	if keyErr != nil || signatureErr != nil || len(publicKey) != ed25519.PublicKeySize || !ed25519.Verify(publicKey, files[configBundleManifest], signatureData) {
+		return bundle, fmt.Errorf("config bundle %s has an invalid signature (has it been modified?)", bundlePath)
+	}
+	bundle.PublicKey = signature.PublicKey
+	err = json.Unmarshal(files[configBundleManifest], &bundle.Manifest)
+	if err != nil {
+		return bundle, fmt.Errorf("config bundle %s has a malformed manifest: %w", bundlePath, err)
+	}
+	for name, data := range files {
+		if name == configBundleManifest || name == configBundleSignature {
+			continue
+		}
+		checksum, ok := bundle.Manifest.Files[name]
+		if !ok {
+			return bundle, fmt.Errorf("config bundle %s contains %s - which is missing from its manifest", bundlePath, name)
+		}
+		if checksum != getConfigBundleChecksum(data) {
+			return bundle, fmt.Errorf("config bundle %s contains a modified %s", bundlePath, name)
+		}
+	}
+	for name := range bundle.Manifest.Files {
+		_, ok := files[name]
+		if !ok {
+			return bundle, fmt.Errorf("config bundle %s is missing %s", bundlePath, name)
+		}
+	}
+	err = bundle.Patches.UnmarshalText(files[configBundlePatches])
+	if err != nil {
+		return bundle, fmt.Errorf("config bundle %s has malformed config patches: %w", bundlePath, err)
+	}
+	return bundle, nil
+}
+
+// Verifies a config bundle signed by a trusted key (CONFIG_BUNDLE_TRUSTED_KEYS).
+// Writes the operator's config patches followed by the bundle's patches to config-patches.json in the output directory.
+// Returns an error if the bundle is invalid or its signer isn't trusted.
+// Returns an error if the output file already exists.
+func importConfigBundle(ctx context.Context, config EntrypointConfig, bundleConfig ConfigBundleConfig, bundlePath string, outputDir string) error {
+	bundle, err := readConfigBundle(bundlePath)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(bundleConfig.TrustedKeys, bundle.PublicKey) {
+		return fmt.Errorf("config bundle %s is signed by an untrusted key - verify the key with the bundle's author and add it to CONFIG_BUNDLE_TRUSTED_KEYS: %s", bundlePath, bundle.PublicKey)
+	}
+	helper.Logger(ctx).Info("verified config bundle", "name", bundle.Manifest.Name, "created", bundle.Manifest.Created.Format(time.RFC3339), "spt", bundle.Manifest.SptVersion, "key", bundle.PublicKey)
+	if bundle.Manifest.SptVersion != "" && config.SptVersion != "" && bundle.Manifest.SptVersion != config.SptVersion {
+		helper.Logger(ctx).Warn("config bundle was exported for a different spt version - review its patches before applying them", "bundle", bundle.Manifest.SptVersion, "spt", config.SptVersion)
+	}
+	relPaths := helper.Map[string, []patch.Patch](bundle.Patches).Keys()
+	slices.Sort(relPaths)
+	for _, relPath := range relPaths {
+		helper.Logger(ctx).Info("config bundle patches", "path", relPath, "count", len(bundle.Patches[relPath]))
+	}
+
+	merged := patch.Merge(config.ConfigPatches, bundle.Patches)
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = helper.CreateDirs(ctx, outputDir)
+	if err != nil {
+		return err
+	}
+	output := filepath.Join(outputDir, "config-patches.json")
+	err = writeNewFile(ctx, output, func(writer io.Writer) error {
+		_, err := writer.Write(append(data, '\n'))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "imported config bundle %s - set CONFIG_PATCHES to the contents of %s to apply it\n", bundle.Manifest.Name, output)
+	return nil
+}
+
+// Exports the operator's config patches as a signed, shareable bundle - or imports a bundle shared by another operator.
+// Supports 'config export-bundle <bundle.zip>' and 'config import-bundle <bundle.zip> [output-dir]'.
+// Returns an error if the environment cannot be parsed.
+// Returns an error if the bundle cannot be exported or imported.
+func Config(ctx context.Context, args ...string) error {
+	usage := fmt.Errorf("usage: config export-bundle <bundle.zip> | config import-bundle <bundle.zip> [output-dir]")
+	if len(args) == 0 {
+		return usage
+	}
+	config := EntrypointConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	config, err = LoadConfigPatches(ctx, config)
+	if err != nil {
+		return err
+	}
+	bundleConfig := ConfigBundleConfig{}
+	err = helper.ParseEnv(ctx, &bundleConfig)
+	if err != nil {
+		return err
+	}
+	switch {
+	case args[0] == "export-bundle" && len(args) == 2:
+		return exportConfigBundle(ctx, config, bundleConfig, args[1])
+	case args[0] == "import-bundle" && (len(args) == 2 || len(args) == 3):
+		outputDir := "."
+		if len(args) == 3 {
+			outputDir = args[2]
+		}
+		return importConfigBundle(ctx, config, bundleConfig, args[1], outputDir)
+	default:
+		return usage
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/patch"
+)
+
+// configDiffLimit is the number of config diff reports kept in the data directory (see [writeConfigDiffs])
+const configDiffLimit = 30
+
+// Returns the directory holding the config diff reports (see [writeConfigDiffs])
+func getConfigDiffsDir(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "config-diffs")
+}
+
+// Compares a patched config file (relative to the spt path) against its stock snapshot (see [getStockConfigPath]).
+// Returns an error if the snapshot or the config file cannot be read.
+func diffConfigFile(ctx context.Context, relPath string) ([]configDiff, error) {
+	stock := map[string]any{}
+	err := patch.UnmarshalFile(ctx, getStockConfigPath(ctx, relPath), &stock)
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]any{}
+	err = patch.UnmarshalFile(ctx, filepath.Join(helper.Dirs(ctx)["spt"], relPath), &current)
+	if err != nil {
+		return nil, err
+	}
+	return diffJson("", stock, current), nil
+}
+
+// Redacts the values of differences set by patches referencing environment variables, as these often hold secrets.
+// A difference is redacted if it lies at (or beneath) the path of such a patch.
+func redactConfigDiffs(diffs []configDiff, patches []patch.Patch) []configDiff {
+	sensitive := []string{}
+	for _, configPatch := range patches {
+		if configPatch.ReferencesVariables() {
+			sensitive = append(sensitive, configPatch.Path)
+		}
+	}
+	redacted := []configDiff{}
+	for _, diff := range diffs {
+		isSensitive := slices.ContainsFunc(sensitive, func(path string) bool {
+			return diff.Path == path || strings.HasPrefix(diff.Path, fmt.Sprintf("%s/", path))
+		})
+		if isSensitive {
+			if diff.Stock != nil {
+				diff.Stock = "REDACTED"
+			}
+			if diff.Current != nil {
+				diff.Current = "REDACTED"
+			}
+		}
+		redacted = append(redacted, diff)
+	}
+	return redacted
+}
+
+// Reports the changes config patches made to config files (relative to the spt path).
+// Each file is compared against its stock snapshot (see [diffConfigFile]).
+// Each change is logged, and the report is written to the config diffs directory (see [getConfigDiffsDir]).
+// Reports beyond the most recent (see [configDiffLimit]) are removed.
+// Values set from environment variables are redacted (see [redactConfigDiffs]).
+// Returns an error if a file cannot be compared.
+// Returns an error if the report cannot be written.
+func writeConfigDiffs(ctx context.Context, configPatches patch.ConfigPatches, relPaths []string) error {
+	builder := strings.Builder{}
+	for _, relPath := range relPaths {
+		diffs, err := diffConfigFile(ctx, relPath)
+		if err != nil {
+			return err
+		}
+		diffs = redactConfigDiffs(diffs, configPatches[relPath])
+		if len(diffs) == 0 {
+			helper.Logger(ctx).Info("config file unchanged by patches", "path", relPath)
+		}
+		fmt.Fprintf(&builder, "--- %s\n", filepath.ToSlash(relPath))
+		for _, diff := range diffs {
+			helper.Logger(ctx).Info("config change", "path", relPath, "change", diff.String())
+			fmt.Fprintf(&builder, "%s\n", diff)
+		}
+		fmt.Fprintln(&builder)
+	}
+
+	dir := getConfigDiffsDir(ctx)
+	name := fmt.Sprintf("%s-%s.diff", clock.Get(ctx).Now().Format("20060102-150405"), GetRunId())
+	err := fsutil.WriteFileAtomic(filepath.Join(dir, name), []byte(builder.String()))
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	reports := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".diff" {
+			reports = append(reports, entry.Name())
+		}
+	}
+	slices.Sort(reports)
+	for len(reports) > configDiffLimit {
+		err := os.Remove(filepath.Join(dir, reports[0]))
+		if err != nil {
+			return err
+		}
+		reports = reports[1:]
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// CoreManifest is a map of spt core file (relative to the spt path) -> checksum, recorded when spt is built
+type CoreManifest map[string]string
+
+// Returns the path to the core manifest of the spt installation.
+// The manifest lives alongside the files it describes so that it is cached (and restored) with the spt build.
+func getCoreManifestPath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["spt"], ".core-files.json")
+}
+
+// Builds a [CoreManifest] from the regular files within a directory - skipping the given (relative) files.
+// Returns an error if the directory cannot be walked or a file cannot be read.
+func buildCoreManifest(dir string, skip map[string]bool) (CoreManifest, error) {
+	files := []string{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if skip[relPath] {
+			return nil
+		}
+		files = append(files, relPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := fsutil.HashFiles(dir, files)
+	return CoreManifest(checksums), err
+}
+
+// Records the core manifest of a freshly built spt installation (see [installSpt]).
+// Returns an error if the manifest cannot be built or written.
+func writeCoreManifest(ctx context.Context, buildPath string, dest string) error {
+	manifest, err := buildCoreManifest(buildPath, map[string]bool{})
+	if err != nil {
+		return err
+	}
+	helper.Logger(ctx).Info("record spt core files", "count", len(manifest))
+	return helper.MarshalFile(ctx, manifest, filepath.Join(dest, filepath.Base(getCoreManifestPath(ctx))))
+}
+
+// Ensures the spt installation has a core manifest.
+// spt builds cached before core manifests were recorded lack one.
+// Their manifest is built from the spt path, excluding files owned by installed mods.
+// Returns an error if the manifest cannot be built or written.
+func EnsureCoreManifest(ctx context.Context) error {
+	path := getCoreManifestPath(ctx)
+	_, err := os.Lstat(path)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return err
+	}
+	skip := installed.filesExcluding("")
+	skip[filepath.Base(getInstalledModsPath(ctx))] = true
+	helper.Logger(ctx).Info("spt core manifest not found - building from spt path", "path", path)
+	manifest, err := buildCoreManifest(helper.Dirs(ctx)["spt"], skip)
+	if err != nil {
+		return err
+	}
+	return helper.MarshalFile(ctx, manifest, path)
+}
+
+// Loads the core manifest of the spt installation.
+// Returns nil if the spt installation has no core manifest.
+// Returns an error if the manifest exists but cannot be read.
+func LoadCoreManifest(ctx context.Context) (CoreManifest, error) {
+	path := getCoreManifestPath(ctx)
+	_, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	manifest := CoreManifest{}
+	err = helper.UnmarshalFile(ctx, path, &manifest)
+	return manifest, err
+}
+
+// Finds spt core files replaced by installed mods - comparing the files each mod installed against the core manifest (in parallel).
+// Returns a sorted list of problems (one per replaced core file) naming the mod that replaced it.
+// Returns an error if the core manifest, installed mods or replaced files cannot be read.
+func CheckCoreFiles(ctx context.Context) ([]string, error) {
+	manifest, err := LoadCoreManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		helper.Logger(ctx).Warn("spt core manifest not found - skipping core file verification")
+		return []string{}, nil
+	}
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	owners := map[string][]string{}
+	for name, installedMod := range installed {
+		for _, file := range installedMod.Files {
+			_, ok := manifest[file]
+			if ok {
+				owners[file] = append(owners[file], name)
+			}
+		}
+	}
+	checksums, err := fsutil.HashFiles(helper.Dirs(ctx)["spt"], helper.Map[string, []string](owners).Keys())
+	if err != nil {
+		return nil, err
+	}
+	problems := []string{}
+	for file, names := range owners {
+		checksum, ok := checksums[file]
+		if !ok || checksum == manifest[file] {
+			continue
+		}
+		slices.Sort(names)
+		problems = append(problems, fmt.Sprintf("core file %s replaced by mod(s) %v", file, names))
+	}
+	slices.Sort(problems)
+	return problems, nil
+}
+
+// Verifies that installed mods have not replaced spt core files.
+// When policy is 'warn' (the default), replaced core files are logged and setup continues.
+// Returns an error if the policy is unknown.
+// Returns an error if the policy is 'strict' and core files were replaced.
+func VerifyCoreFiles(ctx context.Context, policy string) error {
+	if policy != "" && policy != "strict" && policy != "warn" {
+		return fmt.Errorf("unknown mod core file policy %s", policy)
+	}
+	problems, err := CheckCoreFiles(ctx)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		helper.Logger(ctx).Warn("mod replaced spt core file", "problem", problem)
+	}
+	if len(problems) == 0 || policy != "strict" {
+		return nil
+	}
+	return &UserError{
+		Hint:    "remove (or update) the mods replacing spt core files, or set MOD_CORE_FILES=warn to start anyway",
+		Message: fmt.Sprintf("%d spt core file(s) replaced by mods (first: %s)", len(problems), problems[0]),
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/patch"
+)
+
+// Converts the differences between a pristine config file and its edited copy into config patches (see [diffJson])
+func getDiffPatches(stock any, edited any) []patch.Patch {
+	patches := []patch.Patch{}
+	for _, diff := range diffJson("", stock, edited) {
+		if diff.Op == "remove" {
+			patches = append(patches, patch.Patch{Op: diff.Op, Path: diff.Path})
+			continue
+		}
+		patches = append(patches, patch.Patch{Op: diff.Op, Path: diff.Path, Value: diff.Current})
+	}
+	return patches
+}
+
+// Implements the 'diff-configs' subcommand - writing the config patches turning pristine configs into edited configs to stdout.
+// The edited directory mirrors the spt server path - or, if given, the directory beneath the spt server path it was copied from.
+// Hidden files are skipped, as are files whose contents are unchanged.
+// Returns an error if the arguments are invalid.
+// Returns an error if an edited file has no counterpart in the spt server path.
+// Returns an error if a file cannot be read or parsed.
+func DiffConfigs(ctx context.Context, args ...string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: diff-configs <edited-dir> [spt-subdir]")
+	}
+	dir := args[0]
+	prefix := ""
+	if len(args) == 2 {
+		prefix = filepath.ToSlash(filepath.Clean(args[1]))
+	}
+	root := helper.Dirs(ctx)["spt"]
+
+	configPatches := patch.ConfigPatches{}
+	err := filepath.WalkDir(dir, func(editedPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if editedPath != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, editedPath)
+		if err != nil {
+			return err
+		}
+		relPath = path.Join(prefix, filepath.ToSlash(relPath))
+		_, err = os.Stat(filepath.Join(root, relPath))
+		if errors.Is(err, os.ErrNotExist) {
+			return &UserError{
+				Cause:   err,
+				Hint:    "ensure the edited directory mirrors the spt server path - or pass the directory it was copied from (e.g., 'SPT_Data/Server/configs')",
+				Message: fmt.Sprintf("edited file %s has no counterpart in the spt server path", relPath),
+			}
+		}
+		if err != nil {
+			return err
+		}
+		var stock any
+		err = patch.ReadPristine(ctx, root, getStockConfigPath(ctx, ""), relPath, &stock)
+		if err != nil {
+			return fmt.Errorf("%s: %w", relPath, err)
+		}
+		var edited any
+		err = patch.UnmarshalFile(ctx, editedPath, &edited)
+		if err != nil {
+			return fmt.Errorf("%s: %w", editedPath, err)
+		}
+		patches := getDiffPatches(stock, edited)
+		if len(patches) == 0 {
+			return nil
+		}
+		helper.Logger(ctx).Info("config file edited", "path", relPath, "patches", len(patches))
+		configPatches[relPath] = patches
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(configPatches, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(data))
+	return err
+}
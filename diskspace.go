@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/limits"
+)
+
+// DiskSpaceConfig is loaded from the environment and configures the disk space preflight checks (see [CheckDiskSpace])
+type DiskSpaceConfig struct {
+	Check      bool   `env:"DISK_SPACE_CHECK" envDefault:"true"`
+	Mod        string `env:"DISK_SPACE_MOD" envDefault:"512M"`
+	SptBuild   string `env:"DISK_SPACE_SPT_BUILD" envDefault:"5G"`
+	SptInstall string `env:"DISK_SPACE_SPT_INSTALL" envDefault:"1G"`
+}
+
+// Returns the estimated size (and the environment variable configuring it) of an estimate - 'mod', 'spt-build' or 'spt-install'.
+// Returns an error if the estimate is unknown or malformed.
+func (dsc DiskSpaceConfig) estimate(name string) (int64, string, error) {
+	estimates := map[string][2]string{
+		"mod":         {dsc.Mod, "DISK_SPACE_MOD"},
+		"spt-build":   {dsc.SptBuild, "DISK_SPACE_SPT_BUILD"},
+		"spt-install": {dsc.SptInstall, "DISK_SPACE_SPT_INSTALL"},
+	}
+	estimate, ok := estimates[name]
+	if !ok {
+		return 0, "", fmt.Errorf("unknown disk space estimate %s", name)
+	}
+	size, err := limits.ParseMemory(estimate[0])
+	if err != nil {
+		return 0, estimate[1], fmt.Errorf("invalid %s: %w", estimate[1], err)
+	}
+	return size, estimate[1], nil
+}
+
+// Formats a number of bytes in mebibytes
+func formatMebibytes(bytes int64) string {
+	return fmt.Sprintf("%dMiB", bytes>>20)
+}
+
+// Checks that the volumes holding the given paths have enough free space for an operation before it starts.
+// Needs maps paths to the estimate of the space the operation needs beneath them (see [DiskSpaceConfig.estimate]).
+// Paths on the same volume need the sum of their estimates.
+// Skipped if DISK_SPACE_CHECK is false - volumes that cannot be inspected are logged and skipped.
+// Returns an error if the configuration is invalid.
+// Returns an error if a volume has less free space than needed.
+func CheckDiskSpace(ctx context.Context, operation string, needs map[string]string) error {
+	config := DiskSpaceConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	if !config.Check {
+		return nil
+	}
+	paths := helper.Map[string, string](needs).Keys()
+	slices.Sort(paths)
+	devices := []uint64{}
+	volumes := map[uint64]fsutil.Volume{}
+	needed := map[uint64]int64{}
+	volumePaths := map[uint64][]string{}
+	envNames := map[uint64][]string{}
+	for _, path := range paths {
+		size, envName, err := config.estimate(needs[path])
+		if err != nil {
+			return err
+		}
+		volume, err := fsutil.GetVolume(path)
+		if err != nil {
+			helper.Logger(ctx).Warn("disk space unavailable - skipping check", "path", path, "error", err.Error())
+			continue
+		}
+		if !slices.Contains(devices, volume.Device) {
+			devices = append(devices, volume.Device)
+		}
+		volumes[volume.Device] = volume
+		needed[volume.Device] += size
+		volumePaths[volume.Device] = append(volumePaths[volume.Device], path)
+		if !slices.Contains(envNames[volume.Device], envName) {
+			envNames[volume.Device] = append(envNames[volume.Device], envName)
+		}
+	}
+	for _, device := range devices {
+		volume := volumes[device]
+		helper.Logger(ctx).Debug("check disk space", "operation", operation, "paths", volumePaths[device], "free", formatMebibytes(volume.Free), "needed", formatMebibytes(needed[device]))
+		if volume.Free >= needed[device] {
+			continue
+		}
+		return &UserError{
+			Hint:    fmt.Sprintf("free up space on the volume (e.g., with 'gc'), mount a larger volume or - if the estimate is too large for your setup - lower %s (or set DISK_SPACE_CHECK=false)", strings.Join(envNames[device], " and ")),
+			Message: fmt.Sprintf("insufficient disk space to %s - %s has %s free, but ~%s is needed", operation, strings.Join(volumePaths[device], ", "), formatMebibytes(volume.Free), formatMebibytes(needed[device])),
+		}
+	}
+	return nil
+}
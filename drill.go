@@ -0,0 +1,509 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// DrillConfig is loaded from the environment and configures the disaster recovery drill (see [Drill])
+type DrillConfig struct {
+	Dir     string        `env:"DRILL_DIR"`
+	Timeout time.Duration `env:"DRILL_TIMEOUT" envDefault:"10m"`
+}
+
+// drillMarker is the file marking the root of a drill workspace - scenarios refuse to run outside of one
+const drillMarker = ".drill"
+
+// drillResultFile is the file (within the drill workspace) a scenario writes its result to
+const drillResultFile = ".drill-result.json"
+
+// Drill outcomes
+const (
+	DrillFailed  = "failed"
+	DrillPassed  = "passed"
+	DrillSkipped = "skipped"
+	DrillWarning = "warning"
+)
+
+// DrillResult is the outcome of a drill scenario
+type DrillResult struct {
+	Duration time.Duration `json:"duration"`
+	Notes    string        `json:"notes"`
+	Outcome  string        `json:"outcome"`
+	Scenario string        `json:"scenario"`
+}
+
+// drillScenario implements a drill scenario - run within the drill workspace (see [runDrillScenario])
+type drillScenario func(ctx context.Context, config DrillConfig) (DrillResult, error)
+
+// drillScenarios maps the name of a drill scenario to its implementation
+var drillScenarios = map[string]drillScenario{
+	"kill-server":    drillKillServer,
+	"restore-backup": drillRestoreBackup,
+	"rollback-mods":  drillRollbackMods,
+}
+
+// Copies a directory into the drill workspace.
+// Symlinks pointing into the real data and spt directories are pointed at their copies instead.
+// Does nothing if the directory does not exist.
+// Returns the number of copied files.
+// Returns an error if the directory cannot be copied.
+func copyToDrillWorkspace(ctx context.Context, workspace string, name string) (int, error) {
+	src := helper.Dirs(ctx)[name]
+	dest := filepath.Join(workspace, name)
+	err := os.MkdirAll(dest, 0755)
+	if err != nil {
+		return 0, err
+	}
+	_, err = os.Stat(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	files, err := fsutil.CopyTree(ctx, src, dest)
+	if err != nil {
+		return 0, err
+	}
+	for _, file := range files {
+		path := filepath.Join(dest, file)
+		target, err := os.Readlink(path)
+		if err != nil {
+			// not a symlink
+			continue
+		}
+		for _, real := range []string{"data", "spt"} {
+			relPath, err := filepath.Rel(helper.Dirs(ctx)[real], target)
+			if !filepath.IsAbs(target) || err != nil || relPath == ".." || strings.HasPrefix(relPath, fmt.Sprintf("..%c", filepath.Separator)) {
+				continue
+			}
+			err = os.Remove(path)
+			if err == nil {
+				err = os.Symlink(filepath.Join(workspace, real, relPath), path)
+			}
+			if err != nil {
+				return 0, err
+			}
+			break
+		}
+	}
+	return len(files), nil
+}
+
+// Implements the 'drill' subcommand - rehearsing disaster recovery on a copy of the data and spt directories.
+// Reports how long each recovery took.
+// Runs every scenario unless scenarios are given:
+//   - kill-server: kills the server mid-run, recovers the journal and restarts it
+//   - restore-backup: wipes the data directory and restores it from STORAGE_URL
+//   - rollback-mods: removes the installed mods and restores them from the mod snapshot (see [RollbackMods])
+//
+// Each scenario runs in a child process whose directories point at the workspace ('drill --scenario <name>').
+// Storage is only ever read from - the copy is never pushed.
+// Returns an error if the arguments are invalid.
+// Returns an error if the workspace cannot be created.
+// Returns an error if a scenario failed.
+func Drill(ctx context.Context, args ...string) error {
+	names := helper.Map[string, drillScenario](drillScenarios).Keys()
+	slices.Sort(names)
+	usage := fmt.Errorf("usage: drill [%s ...]", strings.Join(names, "|"))
+	config := DrillConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	if len(args) == 2 && args[0] == "--scenario" {
+		return runDrillScenario(ctx, config, args[1])
+	}
+	scenarios := args
+	for _, scenario := range scenarios {
+		_, ok := drillScenarios[scenario]
+		if !ok {
+			return usage
+		}
+	}
+	if len(scenarios) == 0 {
+		scenarios = names
+	}
+	slices.Sort(scenarios)
+	scenarios = slices.Compact(scenarios)
+
+	parent := config.Dir
+	if parent == "" {
+		parent = os.TempDir()
+	}
+	parent, err = filepath.Abs(parent)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"data", "spt"} {
+		relPath, err := filepath.Rel(helper.Dirs(ctx)[name], parent)
+		if err == nil && relPath != ".." && !strings.HasPrefix(relPath, fmt.Sprintf("..%c", filepath.Separator)) {
+			return fmt.Errorf("DRILL_DIR %s cannot be within the %s directory", parent, name)
+		}
+	}
+	err = os.MkdirAll(parent, 0755)
+	if err != nil {
+		return err
+	}
+	workspace, err := os.MkdirTemp(parent, "drill-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workspace)
+
+	helper.Logger(ctx).Info("prepare drill workspace", "path", workspace)
+	start := time.Now()
+	copied := 0
+	for _, name := range []string{"data", "spt"} {
+		count, err := copyToDrillWorkspace(ctx, workspace, name)
+		if err != nil {
+			return err
+		}
+		copied += count
+	}
+	err = errors.Join(os.MkdirAll(filepath.Join(workspace, "cache"), 0755), os.WriteFile(filepath.Join(workspace, drillMarker), []byte{}, 0644))
+	if err != nil {
+		return err
+	}
+	prepared := time.Since(start)
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	results := []DrillResult{}
+	for _, scenario := range scenarios {
+		helper.Logger(ctx).Info("run drill scenario", "scenario", scenario)
+		resultPath := filepath.Join(workspace, drillResultFile)
+		os.Remove(resultPath)
+		result := DrillResult{Outcome: DrillFailed, Scenario: scenario}
+		start := time.Now()
+		_, err := helper.Command(ctx, []string{executable, "drill", "--scenario", scenario}, helper.CmdOpts{Attach: true, Cwd: workspace, Env: os.Environ()}).Run()
+		if err == nil {
+			data, readErr := os.ReadFile(resultPath)
+			if readErr == nil {
+				readErr = json.Unmarshal(data, &result)
+			}
+			err = readErr
+		}
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Notes = fmt.Sprintf("scenario did not complete: %s", err.Error())
+		}
+		results = append(results, result)
+	}
+
+	fmt.Fprintf(os.Stdout, "prepared workspace (%d files) in %s\n\n", copied, prepared.Round(time.Millisecond))
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "SCENARIO\tOUTCOME\tDURATION\tNOTES")
+	failed := []string{}
+	for _, result := range results {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", result.Scenario, result.Outcome, result.Duration.Round(time.Millisecond), result.Notes)
+		if result.Outcome == DrillFailed {
+			failed = append(failed, result.Scenario)
+		}
+	}
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("drill failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Runs a drill scenario within the drill workspace and writes its result (see [drillResultFile]).
+// Scenario failures are recorded in the result rather than returned.
+// Returns an error if the process isn't running within a drill workspace.
+// Returns an error if the scenario is unknown or the result cannot be written.
+func runDrillScenario(ctx context.Context, config DrillConfig, scenario string) error {
+	workspace := filepath.Dir(helper.Dirs(ctx)["data"])
+	_, err := os.Stat(filepath.Join(workspace, drillMarker))
+	if err != nil {
+		return fmt.Errorf("%s is not a drill workspace: %w", workspace, err)
+	}
+	run, ok := drillScenarios[scenario]
+	if !ok {
+		return fmt.Errorf("unknown drill scenario %s", scenario)
+	}
+	result, err := run(ctx, config)
+	result.Scenario = scenario
+	if err != nil {
+		helper.Logger(ctx).Error("drill scenario failed", "scenario", scenario, "error", err.Error())
+		result.Outcome = DrillFailed
+		result.Notes = err.Error()
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(filepath.Join(workspace, drillResultFile), data)
+}
+
+// drillServer is a server launched by the kill-server scenario
+type drillServer struct {
+	cmd  *exec.Cmd
+	done chan error
+}
+
+// Launches the server in its own process group - so that it can be killed alongside its child processes.
+// Returns an error if the server cannot be started.
+func startDrillServer(ctx context.Context, serverBin string) (*drillServer, error) {
+	helper.Logger(ctx).Info("start drill server")
+	cmd := exec.Command(serverBin)
+	cmd.Dir = helper.Dirs(ctx)["spt"]
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	err := cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	server := &drillServer{cmd: cmd, done: make(chan error, 1)}
+	go func() {
+		server.done <- cmd.Wait()
+	}()
+	return server, nil
+}
+
+// Waits for the server to accept connections on a port.
+// Returns an error if the server exits or isn't ready within the timeout.
+func (ds *drillServer) waitReady(ctx context.Context, port int, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		select {
+		case err := <-ds.done:
+			ds.done <- err
+			return fmt.Errorf("server exited before becoming ready: %v", err)
+		case <-ctx.Done():
+			return fmt.Errorf("server not ready within %s", timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Signals the server's process group and waits for it to exit
+func (ds *drillServer) stop(signal syscall.Signal) {
+	syscall.Kill(-ds.cmd.Process.Pid, signal)
+	<-ds.done
+}
+
+// Implements the 'kill-server' drill scenario - killing the server mid-run and timing its recovery.
+// The server listens on a free port so that the drill can run beside the real server.
+// Returns an error if the server fails to start, or fails to recover.
+// Returns an error if a profile is unreadable after the crash.
+func drillKillServer(ctx context.Context, config DrillConfig) (DrillResult, error) {
+	result := DrillResult{Outcome: DrillPassed}
+	serverBin := getServerBin(helper.Dirs(ctx)["spt"])
+	_, err := os.Stat(serverBin)
+	if errors.Is(err, os.ErrNotExist) {
+		result.Outcome = DrillSkipped
+		result.Notes = "spt is not installed"
+		return result, nil
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return result, err
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	err = setServerPort(ctx, port)
+	if err != nil {
+		return result, err
+	}
+
+	start := time.Now()
+	server, err := startDrillServer(ctx, serverBin)
+	if err != nil {
+		return result, err
+	}
+	err = server.waitReady(ctx, port, config.Timeout)
+	if err != nil {
+		server.stop(syscall.SIGKILL)
+		return result, err
+	}
+	coldStart := time.Since(start)
+
+	helper.Logger(ctx).Info("kill drill server")
+	server.stop(syscall.SIGKILL)
+	start = time.Now()
+	err = RecoverJournal(ctx)
+	if err != nil {
+		return result, fmt.Errorf("recover journal: %w", err)
+	}
+	server, err = startDrillServer(ctx, serverBin)
+	if err != nil {
+		return result, err
+	}
+	err = server.waitReady(ctx, port, config.Timeout)
+	result.Duration = time.Since(start)
+	server.stop(syscall.SIGTERM)
+	if err != nil {
+		return result, fmt.Errorf("restart: %w", err)
+	}
+
+	profiles := 0
+	entries, err := os.ReadDir(getProfilesDir(ctx))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return result, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(getProfilesDir(ctx), entry.Name()))
+		if err == nil && !json.Valid(data) {
+			err = fmt.Errorf("invalid json")
+		}
+		if err != nil {
+			return result, fmt.Errorf("profile %s unreadable after crash: %w", entry.Name(), err)
+		}
+		profiles++
+	}
+	result.Notes = fmt.Sprintf("cold start in %s, %d profile(s) intact", coldStart.Round(time.Millisecond), profiles)
+	return result, nil
+}
+
+// Implements the 'restore-backup' drill scenario - timing the restore of a wiped data directory from storage.
+// The restored files are compared against the lost ones - files missing from or differing in storage are reported.
+// Afterwards, the lost data directory is put back - so that later scenarios run against the original data.
+// Returns an error if storage cannot be read.
+func drillRestoreBackup(ctx context.Context, config DrillConfig) (DrillResult, error) {
+	result := DrillResult{Outcome: DrillPassed}
+	entrypointConfig := EntrypointConfig{}
+	err := helper.ParseEnv(ctx, &entrypointConfig)
+	if err != nil {
+		return result, err
+	}
+	storage, err := NewStorage(ctx, entrypointConfig.StorageUrl)
+	if err != nil {
+		return result, err
+	}
+	if storage == nil {
+		result.Outcome = DrillSkipped
+		result.Notes = "STORAGE_URL is unset"
+		return result, nil
+	}
+
+	dataDir := helper.Dirs(ctx)["data"]
+	lostDir := fmt.Sprintf("%s.lost", dataDir)
+	lost, err := listStorableFiles(ctx)
+	if err != nil {
+		return result, err
+	}
+	lostChecksums, err := fsutil.HashFiles(dataDir, lost)
+	if err != nil {
+		return result, err
+	}
+	err = os.Rename(dataDir, lostDir)
+	if err != nil {
+		return result, err
+	}
+	defer func() {
+		os.RemoveAll(dataDir)
+		os.Rename(lostDir, dataDir)
+	}()
+	err = os.MkdirAll(dataDir, 0755)
+	if err != nil {
+		return result, err
+	}
+
+	start := time.Now()
+	err = PullStorage(ctx, storage)
+	result.Duration = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+	restored, err := listStorableFiles(ctx)
+	if err != nil {
+		return result, err
+	}
+	missing := 0
+	differ := 0
+	for _, key := range lost {
+		if !slices.Contains(restored, key) {
+			missing++
+			continue
+		}
+		checksum, err := fsutil.HashFile(filepath.Join(dataDir, filepath.FromSlash(key)))
+		if err != nil {
+			return result, err
+		}
+		if checksum != lostChecksums[key] {
+			differ++
+		}
+	}
+	result.Notes = fmt.Sprintf("restored %d file(s)", len(restored))
+	if missing > 0 || differ > 0 {
+		result.Outcome = DrillWarning
+		result.Notes = fmt.Sprintf("%s, %d missing and %d outdated in storage", result.Notes, missing, differ)
+	}
+	return result, nil
+}
+
+// Implements the 'rollback-mods' drill scenario - timing the restore of removed mods from the mod snapshot.
+// Returns an error if the mods cannot be rolled back, or differ from the snapshot afterwards.
+func drillRollbackMods(ctx context.Context, config DrillConfig) (DrillResult, error) {
+	result := DrillResult{Outcome: DrillPassed}
+	snapshotDir := getModSnapshotDir(ctx)
+	_, err := os.Stat(filepath.Join(snapshotDir, "snapshot.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		result.Outcome = DrillSkipped
+		result.Notes = "no mod snapshot"
+		return result, nil
+	}
+
+	expected := map[string]string{}
+	for _, path := range modSnapshotPaths {
+		checksum, err := fsutil.HashTree(filepath.Join(snapshotDir, path))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		expected[path] = checksum
+		err = os.RemoveAll(filepath.Join(helper.Dirs(ctx)["spt"], path))
+		if err != nil {
+			return result, err
+		}
+	}
+
+	start := time.Now()
+	err = RollbackMods(ctx)
+	result.Duration = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+	for path, checksum := range expected {
+		actual, err := fsutil.HashTree(filepath.Join(helper.Dirs(ctx)["spt"], path))
+		if err != nil {
+			return result, fmt.Errorf("%s not restored: %w", path, err)
+		}
+		if actual != checksum {
+			return result, fmt.Errorf("%s differs from the snapshot after rollback", path)
+		}
+	}
+	result.Notes = fmt.Sprintf("restored %d path(s) from the snapshot", len(expected))
+	return result, nil
+}
@@ -4,119 +4,281 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sync/atomic"
+	"time"
 
 	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/console"
+	"github.com/benfiola/single-player-tarkov/pkg/filecache"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/jobs"
+	"github.com/benfiola/single-player-tarkov/pkg/limits"
+	"github.com/benfiola/single-player-tarkov/pkg/logstyle"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+	"github.com/benfiola/single-player-tarkov/pkg/patch"
+	"github.com/caarlos0/env/v11"
 	"golang.org/x/mod/semver"
 )
 
-// Installs the given mod urls to the spt path.
-// Raises an error if a url download fails.
-// Raises an error if mod extraction fails.
-func InstallMods(ctx context.Context, modUrls ...string) error {
-	for _, modUrl := range modUrls {
-		helper.Logger(ctx).Info("install mod", "url", modUrl)
-		key := fmt.Sprintf("mod-%s", filepath.Base(modUrl))
-		err := helper.CacheFile(ctx, key, helper.Dirs(ctx)["spt"], func(dest string) error {
-			return helper.CreateTempDir(ctx, func(tempDir string) error {
-				archive := filepath.Join(tempDir, filepath.Base(modUrl))
-				err := helper.Download(ctx, modUrl, archive)
-				if err != nil {
-					return err
-				}
-				err = helper.Extract(ctx, archive, dest)
-				return err
-			})
-		})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 // Initializes the server.
 // Starts the server, waits for it to be connectable, and then shuts it down.
 // This allows the server to generate first-launch files for subsequent modification.
+// Raises an error if the server's port is in use (see [getInitializationPort]).
 // Raises an error if the server fails to start.
 // Raises an error if the server is unconnectable after a set timeout.
 func InitializeServer(ctx context.Context) error {
 	helper.Logger(ctx).Info("initialize server")
+	port, restore, err := getInitializationPort(ctx)
+	if err != nil {
+		return err
+	}
 	cb := func(complete func()) error {
-		response, err := http.Get("http://localhost:6969")
-		if err != nil || response.StatusCode != 200 {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://localhost:%d", port), nil)
+		if err != nil {
+			return err
+		}
+		response, err := outbound.Client.Do(request)
+		if err != nil {
+			return nil
+		}
+		response.Body.Close()
+		if response.StatusCode != 200 {
 			return nil
 		}
 		helper.Logger(ctx).Info("server initialized")
 		complete()
 		return nil
 	}
-	serverBin := filepath.Join(helper.Dirs(ctx)["spt"], "SPT.Server.exe")
-	_, err := helper.Command(ctx, []string{serverBin}, helper.CmdOpts{Cwd: helper.Dirs(ctx)["spt"], Until: cb}).Run()
-	return err
+	serverBin := getServerBin(helper.Dirs(ctx)["spt"])
+	_, err = helper.Command(ctx, []string{serverBin}, helper.CmdOpts{Cwd: helper.Dirs(ctx)["spt"], Until: cb}).Run()
+	return errors.Join(err, restore())
 }
 
+// serverRunning is set while the server process started by [RunServer] is up
+var serverRunning atomic.Bool
+
 // Starts an spt server and blocks until exit.
 // Raises an error if the server exits with a non-zero exit code.
 func RunServer(ctx context.Context) error {
 	helper.Logger(ctx).Info("run server")
-	pathServerBin := filepath.Join(helper.Dirs(ctx)["spt"], "SPT.Server.exe")
+	serverRunning.Store(true)
+	defer serverRunning.Store(false)
+	pathServerBin := getServerBin(helper.Dirs(ctx)["spt"])
 	_, err := helper.Command(ctx, []string{pathServerBin}, helper.CmdOpts{Attach: true, Cwd: helper.Dirs(ctx)["spt"]}).Run()
 	return err
 }
 
-// ConfigPatches are a map of relative file path -> a list of json patches to apply
-type ConfigPatches map[string][]helper.JsonPatch
+// Returns the path of the snapshot of a config file (relative to the spt path) taken before it was patched
+func getStockConfigPath(ctx context.Context, relPath string) string {
+	return filepath.Join(helper.Dirs(ctx)["spt"], ".stock-configs", relPath)
+}
 
-// Parses a string into a [ConfigPatches] object.
-// Used to parse settings from the environment.
-func (cps *ConfigPatches) UnmarshalText(data []byte) error {
-	parsed := map[string][]helper.JsonPatch{}
-	err := json.Unmarshal(data, &parsed)
-	*cps = ConfigPatches(parsed)
-	return err
+// Returns the server config patches are applied to (see [patch.Target]).
+// Installed mods are known by their configured names, package names and 'author-name'.
+// Returns an error if the installed mods cannot be loaded.
+func getPatchTarget(ctx context.Context, sptVersion string) (patch.Target, error) {
+	target := patch.Target{Mods: []string{}, SptVersion: sptVersion}
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return target, err
+	}
+	target.Mods = append(target.Mods, helper.Map[string, InstalledMod](installed).Keys()...)
+	packages, err := LoadModPackages(ctx)
+	if err != nil {
+		return target, err
+	}
+	for _, modPackage := range packages {
+		target.Mods = append(target.Mods, modPackage.Name, fmt.Sprintf("%s-%s", modPackage.Author, modPackage.Name))
+	}
+	return target, nil
 }
 
-// Applies config patches to files located in the spt server path
-func ApplyConfigPatches(ctx context.Context, configPatches ConfigPatches) error {
-	for relPath, patches := range configPatches {
-		helper.Logger(ctx).Info("apply config patch", "count", len(patches), "path", relPath)
-		path := filepath.Join(helper.Dirs(ctx)["spt"], relPath)
-		data := map[string]any{}
-		err := helper.UnmarshalFile(ctx, path, &data)
-		if err != nil {
-			return err
+// Returns the config patches applied during setup.
+// Default, branding, raid time, preset and settings patches come first, followed by the operator's patches (see [LoadConfigPatches]).
+// Returns an error if the branding, raid time, preset or server settings are invalid.
+// Returns an error if the stock values settings are derived from cannot be read.
+func getSetupConfigPatches(ctx context.Context, config EntrypointConfig) (patch.ConfigPatches, error) {
+	branding := BrandingConfig{}
+	err := helper.ParseEnv(ctx, &branding)
+	if err != nil {
+		return nil, err
+	}
+	brandingPatches, err := getBrandingPatches(config.SptVersion, branding)
+	if err != nil {
+		return nil, err
+	}
+	raidTime := RaidTimeConfig{}
+	err = helper.ParseEnv(ctx, &raidTime)
+	if err != nil {
+		return nil, err
+	}
+	raidTimePatches, err := getRaidTimePatches(ctx, config.SptVersion, raidTime)
+	if err != nil {
+		return nil, err
+	}
+	presetsConfig := PresetsConfig{}
+	err = helper.ParseEnv(ctx, &presetsConfig)
+	if err != nil {
+		return nil, err
+	}
+	presetPatches, err := getPresetPatches(ctx, config.SptVersion, presetsConfig)
+	if err != nil {
+		return nil, err
+	}
+	settings := SettingsConfig{}
+	err = helper.ParseEnv(ctx, &settings)
+	if err != nil {
+		return nil, err
+	}
+	settingsPatches, err := getSettingsPatches(ctx, config.SptVersion, settings)
+	if err != nil {
+		return nil, err
+	}
+	defaultPatches := patch.ConfigPatches{
+		"SPT_Data/Server/configs/http.json": []patch.Patch{
+			{Op: "replace", Path: "/ip", Value: "0.0.0.0"},
+			{Op: "replace", Path: "/backendIp", Value: "0.0.0.0"},
+		},
+	}
+	if !config.ConfigPatchesDefaults {
+		helper.Logger(ctx).Warn("default config patches disabled - the server only binds to the interfaces its http config names")
+		defaultPatches = patch.ConfigPatches{}
+	}
+	return patch.Merge(
+		defaultPatches,
+		brandingPatches,
+		raidTimePatches,
+		presetPatches,
+		settingsPatches,
+		config.ConfigPatches,
+	), nil
+}
+
+// Resolves config patches into the patches applied to the files of the spt server path.
+// Filters patches by condition, expands globs, skips optional missing files and orders patches by priority.
+// Returns an error if the conditions of patches cannot be evaluated or a glob cannot be expanded.
+func resolveConfigPatches(ctx context.Context, sptVersion string, configPatches patch.ConfigPatches) (patch.ConfigPatches, error) {
+	target, err := getPatchTarget(ctx, sptVersion)
+	if err != nil {
+		return nil, err
+	}
+	configPatches, err = patch.Filter(ctx, configPatches, target)
+	if err != nil {
+		return nil, err
+	}
+	configPatches, err = patch.Expand(ctx, helper.Dirs(ctx)["spt"], configPatches)
+	if err != nil {
+		return nil, err
+	}
+	configPatches = patch.SkipMissingFiles(ctx, helper.Dirs(ctx)["spt"], configPatches)
+	return patch.Order(configPatches), nil
+}
+
+// Applies resolved config patches (see [resolveConfigPatches]) to files located in the spt server path.
+// Every patch is checked before any file is patched (see [patch.Validate]).
+// Files no longer patched are restored first (see [patch.Restore]).
+// Failures are handled by the 'patch' step policy (see [runStep]).
+// Returns an error if the patches cannot be resolved.
+// Returns an error if previously patched files cannot be restored.
+// Returns an error if problems are found (unless the 'patch' step policy is 'warn').
+// Returns an error if a file fails to be patched.
+func ApplyConfigPatches(ctx context.Context, sptVersion string, configPatches patch.ConfigPatches) error {
+	configPatches, err := resolveConfigPatches(ctx, sptVersion, configPatches)
+	if err != nil {
+		return err
+	}
+	problems := patch.Validate(ctx, helper.Dirs(ctx)["spt"], getStockConfigPath(ctx, ""), configPatches)
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			helper.Logger(ctx).Error("config patch problem", "problem", problem.String())
 		}
-		err = helper.ApplyJsonPatches(ctx, &data, patches...)
+		policies := StepPoliciesConfig{}
+		err := helper.ParseEnv(ctx, &policies)
 		if err != nil {
 			return err
 		}
-		err = helper.MarshalFile(ctx, data, path)
-		if err != nil {
+		if policies.Policies["patch"].Action != "warn" {
+			return &UserError{
+				Hint:    "correct the config patches (run 'validate-patches' to check them without starting the server), or set the 'patch' step policy to 'warn' to skip the files failing to patch",
+				Message: fmt.Sprintf("%d config patch problem(s) (first: %s)", len(problems), problems[0]),
+			}
+		}
+	}
+	relPaths := helper.Map[string, []patch.Patch](configPatches).Keys()
+	slices.Sort(relPaths)
+	err = patch.Restore(ctx, helper.Dirs(ctx)["spt"], getStockConfigPath(ctx, ""), relPaths)
+	if err != nil {
+		return err
+	}
+	patched := []string{}
+	for _, relPath := range relPaths {
+		err := runStep(ctx, "patch", func() error {
+			return patch.Apply(ctx, helper.Dirs(ctx)["spt"], getStockConfigPath(ctx, ""), patch.ConfigPatches{relPath: configPatches[relPath]})
+		})
+		if err != nil && !ignoreStepError(ctx, err, "path", relPath) {
 			return err
 		}
+		if err == nil {
+			patched = append(patched, relPath)
+		}
+	}
+	err = writeConfigDiffs(ctx, configPatches, patched)
+	if err != nil {
+		helper.Logger(ctx).Warn("config diffs unavailable", "error", err.Error())
 	}
-
 	return nil
 }
 
-// Merges several [ConfigPatches] objects into a single one.
-func MergeConfigPatches(maps ...ConfigPatches) ConfigPatches {
-	data := ConfigPatches{}
-	for _, currMap := range maps {
-		for k, v := range currMap {
-			_, ok := data[k]
-			if !ok {
-				data[k] = []helper.JsonPatch{}
-			}
-			data[k] = append(data[k], v...)
+// Loads the config patches of CONFIG_PATCHES_DIR and CONFIG_PATCHES_FILES into the configuration.
+// Patches set in CONFIG_PATCHES are applied last.
+// Returns an error if the directory or a file cannot be loaded.
+func LoadConfigPatches(ctx context.Context, config EntrypointConfig) (EntrypointConfig, error) {
+	merged := []patch.ConfigPatches{}
+	if config.ConfigPatchesDir != "" {
+		loaded, err := patch.LoadDir(ctx, config.ConfigPatchesDir)
+		if err != nil {
+			return config, err
 		}
+		merged = append(merged, loaded)
 	}
-	return data
+	for _, path := range config.ConfigPatchesFiles {
+		loaded, err := patch.Load(ctx, path)
+		if err != nil {
+			return config, err
+		}
+		merged = append(merged, loaded)
+	}
+	config.ConfigPatches = patch.Merge(append(merged, config.ConfigPatches)...)
+	return config, nil
+}
+
+// Determines the server port from the effective configuration.
+// Defaults to the SPT default port if no config patch changes it.
+func getServerPort(config EntrypointConfig) int {
+	port := 6969
+	for _, jsonPatch := range patch.Order(config.ConfigPatches)[httpConfigPath] {
+		value := jsonPatch.Value
+		if jsonPatch.Op == "merge" && jsonPatch.Path == "" {
+			// merge patches of the whole config set the port as a member of their value
+			object, _ := value.(map[string]any)
+			value = object["port"]
+		} else if jsonPatch.Path != "/port" || (jsonPatch.Op != "replace" && jsonPatch.Op != "add" && jsonPatch.Op != "merge") {
+			continue
+		}
+		number, ok := value.(float64)
+		if ok {
+			port = int(number)
+		}
+	}
+	return port
 }
 
 // Merges lists of data directories into a single-deduplicated list
@@ -150,8 +312,14 @@ func SymlinkDataDirs(ctx context.Context, dataDirs []string) error {
 }
 
 // Finds all patch files less than or equal to the provided version
+// Versions that aren't release versions (see [isSptReleaseVersion]) have no patch files.
 // Returns a list of patch files sorted in ascending version order
 func FindPatchFiles(ctx context.Context, version string) ([]string, error) {
+	if !isSptReleaseVersion(version) {
+		helper.Logger(ctx).Warn("spt version is not a release version - no patch files are applied", "version", version)
+		return []string{}, nil
+	}
+
 	wd, err := os.Getwd()
 	if err != nil {
 		return nil, err
@@ -200,127 +368,639 @@ type Command struct {
 }
 
 // Installs spt to the spt directory if spt exists in the cache.  If spt does not exist in the cache, it is checked out, built and copied into the cache.
+// The installation is journaled so that an interrupted installation is cleaned up on the next start.
+// The core files of the installation are recorded (see [EnsureCoreManifest]) so that mods replacing them can be detected.
 // Returns an error if any step in this process fails.
 func InstallSpt(ctx context.Context, version string) error {
-	key := fmt.Sprintf("spt-%s", version)
-	return helper.CacheFile(ctx, key, helper.Dirs(ctx)["spt"], func(dest string) error {
-		return helper.CreateTempDir(ctx, func(tempDir string) error {
-			helper.Logger(ctx).Info("build spt", "version", version)
+	err := Journaled(ctx, "install-spt", sptInstall{Version: version}, func() error {
+		return installSpt(ctx, version)
+	})
+	if err != nil {
+		return err
+	}
+	return EnsureCoreManifest(ctx)
+}
 
-			patchFiles, err := FindPatchFiles(ctx, version)
-			if err != nil {
-				return err
-			}
-			helper.Logger(ctx).Info("found patch files", "count", len(patchFiles))
+// sptInstall is the journaled data describing an spt installation
+type sptInstall struct {
+	Version string `json:"version"`
+}
 
-			projectPath := filepath.Join(tempDir, "project")
-			buildPath := filepath.Join(projectPath, "build")
-			commands := []Command{
-				{Args: []string{"git", "clone", "https://github.com/sp-tarkov/server", tempDir}, Opts: helper.CmdOpts{}},
-				{Args: []string{"git", "checkout", version}, Opts: helper.CmdOpts{Cwd: tempDir}},
-			}
-			for _, patchFile := range patchFiles {
-				commands = append(
-					commands,
-					Command{Args: []string{"git", "apply", patchFile}, Opts: helper.CmdOpts{Cwd: tempDir}},
-				)
-			}
-			commands = append(
-				commands,
-				Command{Args: []string{"git", "lfs", "pull"}, Opts: helper.CmdOpts{Cwd: tempDir}},
-				Command{Args: []string{"npm", "install"}, Opts: helper.CmdOpts{Cwd: projectPath}},
-				Command{Args: []string{"npm", "run", "build:release"}, Opts: helper.CmdOpts{Cwd: projectPath}},
-				Command{Args: []string{"mv", buildPath, dest}, Opts: helper.CmdOpts{}},
-			)
+// Recovers an interrupted spt installation by removing the (partially written) spt directory so that the next installation starts fresh.
+// Implements [journalRecoverFunc].
+func recoverInstallSpt(ctx context.Context, data json.RawMessage) error {
+	err := helper.RemovePaths(ctx, helper.Dirs(ctx)["spt"])
+	if err != nil {
+		return err
+	}
+	return helper.CreateDirs(ctx, helper.Dirs(ctx)["spt"])
+}
+
+// Performs the (unjournaled) spt installation for [InstallSpt].
+// Checks beforehand that there's enough disk space to install spt (see [CheckDiskSpace]).
+// Spt is built from source (see [buildSpt]) or, with SPT_INSTALL_MODE=release, downloaded as a prebuilt release (see [installSptRelease]).
+// Returns an error if the install mode is invalid.
+// Returns an error if the version is a git ref that cannot be resolved (see [SptInstallConfig.getBuildCacheKey]).
+func installSpt(ctx context.Context, version string) error {
+	config := SptInstallConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	mode, err := config.getMode()
+	if err != nil {
+		return err
+	}
+	err = CheckDiskSpace(ctx, "install spt", map[string]string{helper.Dirs(ctx)["spt"]: "spt-install"})
+	if err != nil {
+		return err
+	}
+	if mode == "release" {
+		return filecache.Cache(ctx, config.getReleaseCacheKey(version), helper.Dirs(ctx)["spt"], func(dest string) error {
+			return installSptRelease(ctx, config, version, dest)
+		})
+	}
+	key, ref, err := config.getBuildCacheKey(ctx, version)
+	if err != nil {
+		return err
+	}
+	return filecache.Cache(ctx, key, helper.Dirs(ctx)["spt"], func(dest string) error {
+		return buildSpt(ctx, config.RepoUrl, ref, dest)
+	})
+}
+
+// Checks out a ref of the spt repository (or a fork) and builds spt from source into the destination.
+// Checks beforehand that there's enough disk space to build spt (see [CheckDiskSpace]).
+// The bundled patch files of the checked out version are applied (see [FindPatchFiles]).
+// The version of other refs is detected from the checkout (see [detectSptCheckoutVersion]).
+// Returns an error if the build fails.
+func buildSpt(ctx context.Context, repo string, ref string, dest string) error {
+	err := CheckDiskSpace(ctx, "build spt", map[string]string{os.TempDir(): "spt-build", dest: "spt-install"})
+	if err != nil {
+		return err
+	}
+	return helper.CreateTempDir(ctx, func(tempDir string) error {
+		helper.Logger(ctx).Info("build spt", "repo", repo, "ref", ref)
+		buildCtx, cancel, err := withStepLimits(ctx, "spt-build")
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		run := func(commands ...Command) error {
 			for _, command := range commands {
-				_, err := helper.Command(ctx, command.Args, command.Opts).Run()
+				command.Opts.Env = outbound.CommandEnv(ctx)
+				_, err := limits.Command(buildCtx, command.Args, command.Opts)
 				if err != nil {
 					return err
 				}
 			}
 			return nil
-		})
+		}
+		err = run(
+			Command{Args: []string{"git", "clone", repo, tempDir}, Opts: helper.CmdOpts{}},
+			Command{Args: []string{"git", "checkout", ref}, Opts: helper.CmdOpts{Cwd: tempDir}},
+		)
+		if err != nil {
+			return err
+		}
+
+		version := ref
+		if !isSptReleaseVersion(ref) {
+			version = detectSptCheckoutVersion(ctx, tempDir)
+			helper.Logger(ctx).Info("detected spt version of ref", "ref", ref, "version", version)
+		}
+		patchFiles, err := FindPatchFiles(ctx, version)
+		if err != nil {
+			return err
+		}
+		helper.Logger(ctx).Info("found patch files", "count", len(patchFiles))
 
+		serverType, err := detectSptServerType(tempDir)
+		if err != nil {
+			return err
+		}
+		helper.Logger(ctx).Info("detected spt server type", "type", serverType)
+		commands := []Command{}
+		for _, patchFile := range patchFiles {
+			commands = append(
+				commands,
+				Command{Args: []string{"git", "apply", patchFile}, Opts: helper.CmdOpts{Cwd: tempDir}},
+			)
+		}
+		buildCommands, buildPath := getSptBuildCommands(serverType, tempDir)
+		commands = append(commands, buildCommands...)
+		err = run(commands...)
+		if err != nil {
+			return err
+		}
+		if serverType == "dotnet" {
+			err = normalizeDotnetServerBin(ctx, tempDir, buildPath)
+			if err != nil {
+				return err
+			}
+		}
+		// the build is copied (rather than moved) as the destination is the (existing) spt directory when the file cache is bypassed
+		_, err = fsutil.CopyTree(ctx, buildPath, dest)
+		if err != nil {
+			return err
+		}
+		return writeCoreManifest(ctx, buildPath, dest)
 	})
 }
 
 // EntrypointConfig is loaded from the environment and is used during [Entrypoint]
 type EntrypointConfig struct {
-	ConfigPatches ConfigPatches `env:"CONFIG_PATCHES"`
-	DataDirs      []string      `env:"DATA_DIRS"`
-	ModUrls       []string      `env:"MOD_URLS"`
-	SptVersion    string        `env:"SPT_VERSION"`
+	ClientBundleZip        bool                `env:"CLIENT_BUNDLE_ZIP"`
+	ConfigPatches          patch.ConfigPatches `env:"CONFIG_PATCHES"`
+	ConfigPatchesDefaults  bool                `env:"CONFIG_PATCHES_DEFAULTS" envDefault:"true"`
+	ConfigPatchesDir       string              `env:"CONFIG_PATCHES_DIR"`
+	ConfigPatchesFiles     []string            `env:"CONFIG_PATCHES_FILES"`
+	ConsoleSequences       console.Sequences   `env:"CONSOLE_SEQUENCES"`
+	DataDirs               []string            `env:"DATA_DIRS"`
+	DownloadProxy          string              `env:"DOWNLOAD_PROXY"`
+	ImageInfoMod           bool                `env:"IMAGE_INFO_MOD" envDefault:"true"`
+	Jobs                   JobsConfig          `env:"JOBS"`
+	Mode                   string              `env:"ENTRYPOINT_MODE"`
+	ModCompat              string              `env:"MOD_COMPAT"`
+	ModCoreFiles           string              `env:"MOD_CORE_FILES"`
+	ModDependencies        string              `env:"MOD_DEPENDENCIES"`
+	ModDirs                []string            `env:"MOD_DIRS"`
+	ModDirsMode            string              `env:"MOD_DIRS_MODE" envDefault:"symlink"`
+	ModDownloadConcurrency int                 `env:"MOD_DOWNLOAD_CONCURRENCY" envDefault:"4"`
+	ModInstallPolicy       string              `env:"MOD_INSTALL_POLICY" envDefault:"strict"`
+	ModInstallWebhook      string              `env:"MOD_INSTALL_WEBHOOK"`
+	ModLoadOrder           []string            `env:"MOD_LOAD_ORDER"`
+	ModManifest            string              `env:"MOD_MANIFEST"`
+	ModUrls                []string            `env:"MOD_URLS"`
+	ModsDisabled           []string            `env:"MODS_DISABLED"`
+	ModsFrozen             bool                `env:"MODS_FROZEN"`
+	NoOutbound             string              `env:"NO_OUTBOUND"`
+	ProfileJournal         bool                `env:"PROFILE_JOURNAL" envDefault:"true"`
+	RunId                  string              `env:"RUN_ID"`
+	SptVersion             string              `env:"SPT_VERSION"`
+	SptVersionBump         bool                `env:"SPT_VERSION_BUMP"`
+	StorageInterval        time.Duration       `env:"STORAGE_SYNC_INTERVAL" envDefault:"5m"`
+	StorageUrl             string              `env:"STORAGE_URL"`
+	Timezone               string              `env:"TZ"`
 }
 
-// Performs the pre-launch setup of the server.
-// This includes mod installation, server and mod configuration, server intialization
-// Finally, the server is launched in the foreground and blocks until exit.
+// Returns the configured mods - from the manifest, MOD_URLS, MOD_DIRS, uploads and the ModSync integration (in order of decreasing precedence).
+// Returns an error if the manifest cannot be loaded.
+// Returns an error if a mod url or directory is malformed.
+func GetConfiguredMods(ctx context.Context, config EntrypointConfig) ([]Mod, error) {
+	manifestMods := []Mod{}
+	var err error
+	if config.ModManifest != "" {
+		manifestMods, err = LoadModManifest(ctx, config.ModManifest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	urlMods, err := GetModsFromUrls(config.ModUrls...)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ModDirsMode != "symlink" && config.ModDirsMode != "copy" {
+		return nil, fmt.Errorf("unknown mod dirs mode %s", config.ModDirsMode)
+	}
+	dirMods, err := GetModsFromDirs(config.ModDirsMode == "symlink", config.ModDirs...)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadMods, err := GetModsFromUploads(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	modSyncMods, err := GetModSyncMods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return MergeMods(manifestMods, urlMods, dirMods, uploadMods, modSyncMods), nil
+}
+
+// Reconciles installed mods against the configured mods (from the manifest, MOD_URLS, MOD_DIRS, uploads and the ModSync integration).
+// Mods disabled by MODS_DISABLED are parked (see [ParkDisabledMods]) and the image info mod is generated.
+// Once installed, mods are verified and the load order, license report, mod inventory and client bundle are written.
+// Mods that failed to install under MOD_INSTALL_POLICY=continue are summarized last (see [ReportModFailures]).
 // Returns an error if any step of the process fails.
-func Entrypoint(ctx context.Context) error {
-	config := EntrypointConfig{}
-	err := helper.ParseEnv(ctx, &config)
+func ReconcileMods(ctx context.Context, config EntrypointConfig) error {
+	mods, err := GetConfiguredMods(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	installMods := mods
+	if config.ModsFrozen {
+		installMods, err = LockMods(ctx, mods)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = RestoreParkedMods(ctx)
+	if err != nil {
+		return err
+	}
+
+	failures, err := InstallMods(ctx, config.ModDownloadConcurrency, config.ModInstallPolicy, installMods...)
+	if err != nil {
+		return err
+	}
+
+	// the lockfile isn't written when mods failed to install - as it would pin failed mods to their previously installed versions
+	if !config.ModsFrozen && len(failures) == 0 {
+		err = WriteModLock(ctx, mods)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ParkDisabledMods(ctx, config.ModsDisabled)
+	if err != nil {
+		return err
+	}
+
+	err = WriteImageInfoMod(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	err = ConfigureModSync(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = VerifyCoreFiles(ctx, config.ModCoreFiles)
+	if err != nil {
+		return err
+	}
+
+	err = VerifyModCompat(ctx, config.SptVersion, config.ModCompat)
+	if err != nil {
+		return err
+	}
+
+	err = VerifyModDependencies(ctx, config.ModDependencies)
+	if err != nil {
+		return err
+	}
+
+	err = WriteModOrder(ctx, config.ModLoadOrder)
+	if err != nil {
+		return err
+	}
+
+	err = WriteModLicenseReport(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = WriteModInventory(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = WriteClientBundle(ctx, config.ClientBundleZip)
 	if err != nil {
 		return err
 	}
+
+	ReportModFailures(ctx, config.ModInstallWebhook, failures)
+	return nil
+}
+
+// Performs the pre-launch setup of the server.
+// This includes restoring data from storage, spt and mod installation, server intialization and configuration
+// Finally, profiles are patched and data is persisted.
+// Returns an error if any step of the process fails.
+func Setup(ctx context.Context, config EntrypointConfig) error {
 	if config.SptVersion == "" {
 		return fmt.Errorf("spt version required")
 	}
 
-	err = helper.CreateDirs(ctx, helper.Dirs(ctx).Values()...)
+	err := helper.CreateDirs(ctx, helper.Dirs(ctx).Values()...)
+	if err != nil {
+		return err
+	}
+
+	err = RecoverJournal(ctx)
 	if err != nil {
 		return err
 	}
 
+	storage, err := NewStorage(ctx, config.StorageUrl)
+	if err != nil {
+		return err
+	}
+	if storage != nil {
+		err = PullStorage(ctx, storage)
+		if err != nil {
+			return err
+		}
+	}
+
+	// selectors are pinned after storage is pulled - so that the pin recorded in the data directory is restored alongside it
+	config, err = PinSptVersion(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	logstyle.Phase(ctx, "install spt")
 	err = InstallSpt(ctx, config.SptVersion)
 	if err != nil {
 		return err
 	}
+	config, err = ResolveSptVersion(ctx, config)
+	if err != nil {
+		return err
+	}
 
-	err = InstallMods(ctx, config.ModUrls...)
+	logstyle.Phase(ctx, "install mods")
+	err = ReconcileMods(ctx, config)
 	if err != nil {
 		return err
 	}
 
+	logstyle.Phase(ctx, "initialize server")
+	// patched files are restored first - so that the server initializes (and mods generate their configs) from stock configs, which are patched afterwards
+	err = patch.Reset(ctx, helper.Dirs(ctx)["spt"], getStockConfigPath(ctx, ""))
+	if err != nil {
+		return err
+	}
 	err = InitializeServer(ctx)
 	if err != nil {
 		return err
 	}
 
-	err = ApplyConfigPatches(ctx, MergeConfigPatches(
-		ConfigPatches{
-			"SPT_Data/Server/configs/http.json": []helper.JsonPatch{
-				{Op: "replace", Path: "/ip", Value: "0.0.0.0"},
-				{Op: "replace", Path: "/backendIp", Value: "0.0.0.0"},
-			},
-		},
-		config.ConfigPatches,
-	))
+	logstyle.Phase(ctx, "apply config patches")
+	configPatches, err := getSetupConfigPatches(ctx, config)
+	if err != nil {
+		return err
+	}
+	err = ApplyConfigPatches(ctx, config.SptVersion, configPatches)
+	if err != nil {
+		return err
+	}
+
+	profilePatches := ProfilePatchesConfig{}
+	err = helper.ParseEnv(ctx, &profilePatches)
 	if err != nil {
 		return err
 	}
+	if len(profilePatches.ProfilePatches) > 0 {
+		logstyle.Phase(ctx, "apply profile patches")
+		err = ApplyProfilePatches(ctx, config.SptVersion, profilePatches.ProfilePatches)
+		if err != nil {
+			return err
+		}
+	}
 
-	err = SymlinkDataDirs(ctx, MergeDataDirs(
+	return SymlinkDataDirs(ctx, MergeDataDirs(
 		[]string{"user/profiles"},
 		config.DataDirs,
 	))
+}
+
+// Starts the server and blocks until exit - alongside the services accompanying it.
+// Services include the console, mod log splitting, health probes, the admin api, scheduled jobs, the profile journal and config patch reloading.
+// The data directory is persisted to storage (if configured) once the server exits.
+// Returns an error if a service is misconfigured.
+// Returns an error if the server exits with a non-zero exit code.
+func runServer(ctx context.Context, config EntrypointConfig) error {
+	storage, err := NewStorage(ctx, config.StorageUrl)
+	if err != nil {
+		return err
+	}
+	entrypointJobs, err := GetJobs(ctx, config)
+	if err != nil {
+		return err
+	}
+	RecordRunMods(ctx)
+	return console.AttachWhile(ctx, func(ctx context.Context) error {
+		return SplitModLogsWhile(ctx, func(ctx context.Context) error {
+			return MonitorHealthWhile(ctx, config, func(ctx context.Context) error {
+				return ServeAdminApiWhile(ctx, config, func() error {
+					if storage == nil {
+						return jobs.ScheduleWhile(ctx, entrypointJobs, func() error {
+							return WatchProfilesWhile(ctx, config.ProfileJournal, func() error {
+								return ReloadConfigPatchesWhile(ctx, config, RunServer)
+							})
+						})
+					}
+					return SyncStorageWhile(ctx, storage, func() error {
+						return jobs.ScheduleWhile(ctx, entrypointJobs, func() error {
+							return WatchProfilesWhile(ctx, config.ProfileJournal, func() error {
+								return ReloadConfigPatchesWhile(ctx, config, RunServer)
+							})
+						})
+					})
+				})
+			})
+		})
+	})
+}
+
+// Launches a previously set up server in the foreground and blocks until exit.
+// Performs no setup of its own - allowing the server to be set up by an init container.
+// Returns an error if the server has not been set up.
+// Returns an error if the server exits with a non-zero exit code.
+func Run(ctx context.Context, config EntrypointConfig) error {
+	serverBin := getServerBin(helper.Dirs(ctx)["spt"])
+	_, err := os.Lstat(serverBin)
+	if err != nil {
+		return fmt.Errorf("server binary %s not found (has 'init' been run?): %w", serverBin, err)
+	}
+	config, err = ResolveSptVersion(ctx, config)
+	if err != nil {
+		return err
+	}
+	config, err = ResolveServerPort(ctx, config)
+	if err != nil {
+		return err
+	}
+	logstyle.Phase(ctx, "run server")
+	return runServer(ctx, config)
+}
+
+// Modes maps the supported values of [EntrypointConfig.Mode] to the steps they perform.
+// The default mode ("") sets up and then runs the server.
+var Modes = map[string]func(ctx context.Context, config EntrypointConfig) error{
+	"": func(ctx context.Context, config EntrypointConfig) error {
+		err := Setup(ctx, config)
+		if err != nil {
+			return err
+		}
+		config, err = ResolveSptVersion(ctx, config)
+		if err != nil {
+			return err
+		}
+		config, err = ResolveServerPort(ctx, config)
+		if err != nil {
+			return err
+		}
+		return runServer(ctx, config)
+	},
+	"init": Setup,
+	"run":  Run,
+}
+
+// Parses the entrypoint configuration and runs the configured mode.
+// Returns an error if the mode is unknown.
+// Returns an error if any step of the mode fails.
+func Entrypoint(ctx context.Context) error {
+	config := EntrypointConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	config, err = LoadConfigPatches(ctx, config)
 	if err != nil {
 		return err
 	}
 
-	return RunServer(ctx)
+	mode, ok := Modes[config.Mode]
+	if !ok {
+		return fmt.Errorf("unknown entrypoint mode %s", config.Mode)
+	}
+	ctx, err = WithFeatures(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, err = outbound.WithPolicy(ctx, config.NoOutbound)
+	if err != nil {
+		return err
+	}
+	ctx, err = outbound.WithProxy(ctx, config.DownloadProxy)
+	if err != nil {
+		return err
+	}
+	location, err := clock.SetTimezone(config.Timezone)
+	if err != nil {
+		return err
+	}
+	helper.Logger(ctx).Info("timezone", "name", location.String(), "offset", time.Now().Format("-07:00"))
+	ctx = filecache.Prepare(ctx)
+	helper.Logger(ctx).Info("entrypoint mode", "mode", config.Mode, "run", config.RunId)
+	return RecordRunWhile(ctx, config, func() error {
+		return mode(ctx, config)
+	})
+}
+
+// LogConfig is loaded from the environment and configures the style of the entrypoint's logs
+type LogConfig struct {
+	Style string `env:"LOG_STYLE" envDefault:"text"`
+}
+
+// Styles the entrypoint's logs according to LOG_STYLE (see [logstyle.Configure]).
+// The environment is parsed directly (rather than through [helper.ParseEnv]) so that nothing is logged before the style is applied.
+// Returns an error if the environment cannot be parsed or the style is unknown.
+func InitializeLogging(ctx context.Context) error {
+	config := LogConfig{}
+	err := env.Parse(&config)
+	if err != nil {
+		return err
+	}
+	return logstyle.Configure(ctx, config.Style)
+}
+
+// Subcommand is an entrypoint command that runs in-process (i.e., without re-launching as a non-root user).
+// Receives any arguments following the command name.
+type Subcommand func(ctx context.Context, args ...string) error
+
+// Subcommands maps command names to [Subcommand] implementations
+var Subcommands = map[string]Subcommand{
+	"adopt":            Adopt,
+	"cache":            Cache,
+	"check-updates":    CheckUpdates,
+	"config":           Config,
+	"diff-configs":     DiffConfigs,
+	"drill":            Drill,
+	"gc":               Gc,
+	"generate":         Generate,
+	"health":           Health,
+	"history":          History,
+	"init-config":      InitConfig,
+	"jobs":             Jobs,
+	"loadtest":         Loadtest,
+	"nettest":          Nettest,
+	"profiles":         Profiles,
+	"rollback-mods":    RollbackMods,
+	"support-bundle":   SupportBundle,
+	"upload":           Upload,
+	"validate-patches": ValidatePatches,
 }
 
 //go:embed version.txt
 var Version string
 
+// entrypointFlags maps the flags accepted by the entrypoint to the (boolean) environment variables they set
+var entrypointFlags = map[string]string{
+	"--bump-spt":         "SPT_VERSION_BUMP",
+	"--frozen":           "MODS_FROZEN",
+	"--repair-ownership": "REPAIR_OWNERSHIP",
+}
+
 func main() {
+	initRunId()
+	entrypoint := Entrypoint
+	// flags (optionally following a mode) are passed through the environment alongside the mode (see [entrypointFlags])
+	start := 1
+	if len(os.Args) >= 2 {
+		_, isMode := Modes[os.Args[1]]
+		if isMode {
+			start = 2
+		}
+	}
+	for len(os.Args) > start {
+		name, ok := entrypointFlags[os.Args[start]]
+		if !ok {
+			break
+		}
+		os.Setenv(name, "true")
+		os.Args = slices.Delete(os.Args, start, start+1)
+	}
+	if len(os.Args) >= 2 && os.Args[1] != "" {
+		name := os.Args[1]
+		_, isMode := Modes[name]
+		subcommand, isSubcommand := Subcommands[name]
+		if isMode {
+			// modes are passed through the environment so that they survive the entrypoint re-launching itself as a non-root user
+			os.Setenv("ENTRYPOINT_MODE", name)
+			os.Args = os.Args[:1]
+		} else if isSubcommand {
+			// subcommands are run directly through the helper's 'entrypoint' command
+			args := os.Args[2:]
+			entrypoint = func(ctx context.Context) error {
+				ctx, err := WithFeatures(ctx)
+				if err != nil {
+					return err
+				}
+				return subcommand(ctx, args...)
+			}
+			os.Args = []string{os.Args[0], "entrypoint"}
+		}
+	}
+	if len(os.Args) < 2 {
+		// bootstrapping is run through the helper's 'entrypoint' command so that it is handled by step policies (see [Bootstrap])
+		entrypoint = Bootstrap
+		os.Args = []string{os.Args[0], "entrypoint"}
+	}
+
 	(&helper.Entrypoint{
 		Dirs: map[string]string{
 			"cache": "./cache",
 			"data":  "./data",
 			"spt":   "./spt",
 		},
-		Main:    Entrypoint,
+		Initialize: InitializeLogging,
+		Main: func(ctx context.Context) error {
+			return PresentError(ctx, entrypoint(ctx))
+		},
 		Version: Version,
 	}).Run()
 }
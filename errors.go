@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"syscall"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/archive"
+	"github.com/benfiola/single-player-tarkov/pkg/download"
+	"github.com/benfiola/single-player-tarkov/pkg/limits"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+	"github.com/caarlos0/env/v11"
+	"gopkg.in/yaml.v3"
+)
+
+// UserError is an error presented to users as a concise message alongside a concrete remediation hint - instead of a raw error chain.
+type UserError struct {
+	Cause   error
+	Hint    string
+	Message string
+}
+
+func (e *UserError) Error() string {
+	return fmt.Sprintf("%s (hint: %s)", e.Message, e.Hint)
+}
+
+func (e *UserError) Unwrap() error {
+	return e.Cause
+}
+
+// errorPresenter converts a recognized error into a [UserError] - returning nil if the error is not recognized
+type errorPresenter func(ctx context.Context, err error) *UserError
+
+// errorPresenters are consulted (in order) by [PresentError]
+var errorPresenters = []errorPresenter{
+	presentEnvParseError,
+	presentHttpStatusError,
+	presentAddressInUseError,
+	presentPermissionError,
+	presentNoSpaceError,
+	presentOutboundBlockedError,
+	presentLimitExceededError,
+	presentUnsafeArchiveError,
+}
+
+// Finds the environment variable name declared (via 'env' struct tags) for a field name across [configTypes].
+// Falls back to the field name if no declaration is found.
+func getEnvNameForField(field string) string {
+	for _, configType := range configTypes {
+		structField, ok := reflect.TypeOf(configType).FieldByName(field)
+		if !ok {
+			continue
+		}
+		name, ok := structField.Tag.Lookup("env")
+		if ok {
+			return name
+		}
+	}
+	return field
+}
+
+// Presents errors raised while parsing settings from the environment.
+// Implements [errorPresenter].
+func presentEnvParseError(ctx context.Context, err error) *UserError {
+	parseErr := env.ParseError{}
+	if !errors.As(err, &parseErr) {
+		return nil
+	}
+	name := getEnvNameForField(parseErr.Name)
+	hint := "correct the value of the environment variable (see the README for the expected format)"
+	syntaxErr := &json.SyntaxError{}
+	typeErr := &json.UnmarshalTypeError{}
+	if errors.As(parseErr.Err, &syntaxErr) || errors.As(parseErr.Err, &typeErr) {
+		hint = fmt.Sprintf("%s must be valid JSON - check quoting and commas with a JSON linter", name)
+	}
+	yamlErr := &yaml.TypeError{}
+	if errors.As(parseErr.Err, &yamlErr) || strings.HasPrefix(parseErr.Err.Error(), "yaml: ") {
+		// values accepting yaml (e.g., CONFIG_PATCHES) fall back to yaml when they aren't valid JSON
+		hint = fmt.Sprintf("%s must be valid JSON or YAML - check quoting, commas and indentation with a linter", name)
+	}
+	return &UserError{Cause: err, Hint: hint, Message: fmt.Sprintf("%s is invalid: %s", name, parseErr.Err)}
+}
+
+// Presents unexpected http status codes (e.g., a mod url returning a 404).
+// Implements [errorPresenter].
+func presentHttpStatusError(ctx context.Context, err error) *UserError {
+	statusErr := &download.StatusError{}
+	if !errors.As(err, &statusErr) {
+		return nil
+	}
+	message := fmt.Sprintf("%s returned %d %s", statusErr.Url, statusErr.StatusCode, http.StatusText(statusErr.StatusCode))
+	hint := "the remote host may be temporarily unavailable - try again later"
+	switch statusErr.StatusCode {
+	case http.StatusNotFound:
+		hint = "verify the url (in MOD_URLS, the mod manifest or SPT_RELEASE_URL) is correct and still published"
+	case http.StatusUnauthorized, http.StatusForbidden:
+		hint = "the host requires credentials - configure a token (e.g., GITHUB_TOKEN, FORGE_TOKEN) with access to the resource"
+	case http.StatusTooManyRequests:
+		hint = "the host is rate limiting requests - wait before retrying or configure an api token"
+	}
+	return &UserError{Cause: err, Hint: hint, Message: message}
+}
+
+// Presents errors caused by a port already being bound by another process.
+// Implements [errorPresenter].
+func presentAddressInUseError(ctx context.Context, err error) *UserError {
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		return nil
+	}
+	address := "the server port"
+	opErr := &net.OpError{}
+	if errors.As(err, &opErr) && opErr.Addr != nil {
+		address = opErr.Addr.String()
+	}
+	return &UserError{
+		Cause:   err,
+		Hint:    "stop the process using the port, change the port via CONFIG_PATCHES (SPT_Data/Server/configs/http.json /port) and the container's port mapping, or set SERVER_PORT_FALLBACK=true to use the next free port",
+		Message: fmt.Sprintf("address %s is already in use", address),
+	}
+}
+
+// Presents permission errors (typically caused by volumes owned by a different user).
+// Implements [errorPresenter].
+func presentPermissionError(ctx context.Context, err error) *UserError {
+	if !errors.Is(err, fs.ErrPermission) {
+		return nil
+	}
+	path := "a path"
+	pathErr := &fs.PathError{}
+	if errors.As(err, &pathErr) {
+		path = pathErr.Path
+	}
+	user := helper.GetCurrentUser(ctx)
+	return &UserError{
+		Cause:   err,
+		Hint:    fmt.Sprintf("ensure mounted volumes are writable by %d:%d (e.g., 'chown -R %d:%d <host dir>') or set UID/GID to the volume's owner", user.Uid, user.Gid, user.Uid, user.Gid),
+		Message: fmt.Sprintf("permission denied accessing %s", path),
+	}
+}
+
+// Presents errors caused by a volume running out of space despite the disk space preflight checks (see [CheckDiskSpace]).
+// Implements [errorPresenter].
+func presentNoSpaceError(ctx context.Context, err error) *UserError {
+	if !errors.Is(err, syscall.ENOSPC) {
+		return nil
+	}
+	path := "a volume"
+	pathErr := &fs.PathError{}
+	if errors.As(err, &pathErr) {
+		path = pathErr.Path
+	}
+	return &UserError{
+		Cause:   err,
+		Hint:    "free up space on the volume (e.g., with 'gc') or mount a larger volume - and raise the DISK_SPACE_* estimates so that the preflight checks catch this before the next attempt",
+		Message: fmt.Sprintf("no space left on the volume holding %s", path),
+	}
+}
+
+// Presents outbound requests blocked by NO_OUTBOUND=strict.
+// Implements [errorPresenter].
+func presentOutboundBlockedError(ctx context.Context, err error) *UserError {
+	blockedErr := &outbound.BlockedError{}
+	if !errors.As(err, &blockedErr) {
+		return nil
+	}
+	return &UserError{
+		Cause:   err,
+		Hint:    "disable the feature making the request, or unset NO_OUTBOUND to permit undeclared outbound requests",
+		Message: fmt.Sprintf("undeclared outbound request to %s was blocked", blockedErr.Url),
+	}
+}
+
+// Presents setup phases killed for exceeding their STEP_LIMITS.
+// Implements [errorPresenter].
+func presentLimitExceededError(ctx context.Context, err error) *UserError {
+	exceededErr := &limits.ExceededError{}
+	if !errors.As(err, &exceededErr) {
+		return nil
+	}
+	return &UserError{
+		Cause:   err,
+		Hint:    fmt.Sprintf("raise the %s limit of %s in STEP_LIMITS (or give the container more resources)", exceededErr.Limit, exceededErr.Phase),
+		Message: exceededErr.Error(),
+	}
+}
+
+// Presents archives rejected for containing entries that would be written outside of their destination.
+// Implements [errorPresenter].
+func presentUnsafeArchiveError(ctx context.Context, err error) *UserError {
+	unsafeErr := &archive.UnsafeEntryError{}
+	if !errors.As(err, &unsafeErr) {
+		return nil
+	}
+	return &UserError{
+		Cause:   err,
+		Hint:    "nothing was written outside of the extraction directory - the archive is malformed or malicious, obtain the mod from a trusted source or report it to its author",
+		Message: fmt.Sprintf("archive entry %q was rejected (%s)", unsafeErr.Entry, unsafeErr.Reason),
+	}
+}
+
+// Converts common failures into a concise [UserError] with a remediation hint.
+// The original error chain is logged so that it remains available for debugging.
+// Unrecognized errors are returned unchanged.
+func PresentError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	userErr := &UserError{}
+	if errors.As(err, &userErr) {
+		return err
+	}
+	for _, presenter := range errorPresenters {
+		userErr := presenter(ctx, err)
+		if userErr == nil {
+			continue
+		}
+		helper.Logger(ctx).Info("error cause", "error", err.Error(), "run", GetRunId())
+		return userErr
+	}
+	return err
+}
+
+// Verifies that a tcp port can be bound prior to launching the server - allowing a port conflict to be reported clearly.
+// Returns an error if the port cannot be bound.
+func CheckPortAvailable(ctx context.Context, port int) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	return listener.Close()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// Features maps the names of experimental features to their descriptions.
+// New subsystems register a feature here and check [FeatureEnabled] before running.
+// Features ship disabled until an operator opts in via FEATURES.
+var Features = map[string]string{}
+
+// FeaturesConfig is loaded from the environment and lists the experimental features enabled by the operator (see [Features])
+type FeaturesConfig struct {
+	Features []string `env:"FEATURES"`
+}
+
+// Parses the enabled experimental features (FEATURES) - storing them in the returned context (see [FeatureEnabled]) and logging them.
+// Feature names are case-insensitive - blank names are ignored.
+// Returns an error if the environment cannot be parsed.
+// Returns an error naming every unknown feature.
+func WithFeatures(ctx context.Context) (context.Context, error) {
+	config := FeaturesConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return ctx, err
+	}
+	enabled := []string{}
+	unknown := []string{}
+	for _, name := range config.Features {
+		name = strings.ToLower(strings.TrimSpace(name))
+		_, ok := Features[name]
+		switch {
+		case name == "" || slices.Contains(enabled, name):
+		case !ok:
+			unknown = append(unknown, name)
+		default:
+			enabled = append(enabled, name)
+		}
+	}
+	if len(unknown) > 0 {
+		known := helper.Map[string, string](Features).Keys()
+		slices.Sort(known)
+		if len(known) == 0 {
+			known = []string{"(none)"}
+		}
+		return ctx, fmt.Errorf("unknown feature(s) %s in FEATURES (known features: %s)", strings.Join(unknown, ", "), strings.Join(known, ", "))
+	}
+	slices.Sort(enabled)
+	for _, name := range enabled {
+		helper.Logger(ctx).Warn("experimental feature enabled", "name", name, "description", Features[name])
+	}
+	return context.WithValue(ctx, contextKey("features"), enabled), nil
+}
+
+// Determines whether an experimental feature was enabled via FEATURES (see [WithFeatures]).
+func FeatureEnabled(ctx context.Context, name string) bool {
+	enabled, _ := ctx.Value(contextKey("features")).([]string)
+	return slices.Contains(enabled, name)
+}
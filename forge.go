@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/filecache"
+	"golang.org/x/mod/semver"
+)
+
+// ForgeConfig is loaded from the environment and configures access to the SPT Forge API
+type ForgeConfig struct {
+	ApiUrl string `env:"FORGE_API_URL" envDefault:"https://forge.sp-tarkov.com/api/v0"`
+	Token  string `env:"FORGE_TOKEN"`
+}
+
+// forgeMod is a mod as returned by the SPT Forge API
+type forgeMod struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// forgeModVersion is a mod version as returned by the SPT Forge API
+type forgeModVersion struct {
+	Id      int    `json:"id"`
+	Link    string `json:"link"`
+	Version string `json:"version"`
+}
+
+// forgeResponse wraps all SPT Forge API responses
+type forgeResponse[T any] struct {
+	Data    T    `json:"data"`
+	Success bool `json:"success"`
+}
+
+// ForgeClient is a minimal client for the SPT Forge API
+type ForgeClient struct {
+	ctx    context.Context
+	config ForgeConfig
+}
+
+// Creates a [ForgeClient] configured from the environment.
+// Returns an error if the environment cannot be parsed.
+func NewForgeClient(ctx context.Context) (*ForgeClient, error) {
+	config := ForgeConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return nil, err
+	}
+	return &ForgeClient{ctx: ctx, config: config}, nil
+}
+
+// Performs a GET request against the SPT Forge API and unmarshals the response data.
+// Returns an error if the request fails or if the API reports a failure.
+func (fc *ForgeClient) get(path string, query url.Values, data any) error {
+	headers := map[string]string{}
+	if fc.config.Token != "" {
+		headers["Authorization"] = fmt.Sprintf("Bearer %s", fc.config.Token)
+	}
+	endpoint := fmt.Sprintf("%s%s", strings.TrimSuffix(fc.config.ApiUrl, "/"), path)
+	if len(query) > 0 {
+		endpoint = fmt.Sprintf("%s?%s", endpoint, query.Encode())
+	}
+	response := forgeResponse[json.RawMessage]{}
+	err := GetJson(fc.ctx, endpoint, headers, &response)
+	if err != nil {
+		return err
+	}
+	if !response.Success {
+		return fmt.Errorf("forge api request %s failed", endpoint)
+	}
+	return json.Unmarshal(response.Data, data)
+}
+
+// Finds a mod by name (or slug).
+// Returns an error if no mod matches the provided name.
+func (fc *ForgeClient) FindMod(name string) (forgeMod, error) {
+	mods := []forgeMod{}
+	err := fc.get("/mods", url.Values{"filter[name]": []string{name}}, &mods)
+	if err != nil {
+		return forgeMod{}, err
+	}
+	for _, mod := range mods {
+		if strings.EqualFold(mod.Name, name) || strings.EqualFold(mod.Slug, name) {
+			return mod, nil
+		}
+	}
+	return forgeMod{}, fmt.Errorf("forge mod %s not found", name)
+}
+
+// Lists all published versions of a mod.
+func (fc *ForgeClient) ListModVersions(mod forgeMod) ([]forgeModVersion, error) {
+	versions := []forgeModVersion{}
+	err := fc.get(fmt.Sprintf("/mod/%d/versions", mod.Id), nil, &versions)
+	return versions, err
+}
+
+// Selects the version matching the requested version from a list of versions.
+// An empty (or 'latest') request selects the newest version.
+// A partial request (e.g., '3.1') selects the newest version with a matching prefix.
+// Returns an error if no version matches.
+func selectForgeModVersion(versions []forgeModVersion, requested string) (forgeModVersion, error) {
+	requested = strings.TrimPrefix(requested, "v")
+	if requested == "latest" {
+		requested = ""
+	}
+	var selected *forgeModVersion
+	for index, version := range versions {
+		current := strings.TrimPrefix(version.Version, "v")
+		if requested != "" && current != requested && !strings.HasPrefix(current, fmt.Sprintf("%s.", requested)) {
+			continue
+		}
+		if selected != nil && semver.Compare(fmt.Sprintf("v%s", current), fmt.Sprintf("v%s", strings.TrimPrefix(selected.Version, "v"))) <= 0 {
+			continue
+		}
+		selected = &versions[index]
+	}
+	if selected == nil {
+		return forgeModVersion{}, fmt.Errorf("no version matching '%s' found", requested)
+	}
+	return *selected, nil
+}
+
+// Returns true if the requested version refers to a single, immutable version
+func isExactVersion(version string) bool {
+	return semver.Canonical(fmt.Sprintf("v%s", strings.TrimPrefix(version, "v"))) == fmt.Sprintf("v%s", strings.TrimPrefix(version, "v"))
+}
+
+// Resolves a forge mod (e.g., 'forge:SAIN@3.1.0') into a downloadable [Mod].
+// Exact versions are cached so that subsequent starts do not require the SPT Forge API.
+// Returns an error if the mod or version cannot be found.
+func ResolveForgeMod(ctx context.Context, mod Mod) (Mod, error) {
+	name, version := parseModSpec(mod)
+	resolve := func() (Mod, error) {
+		client, err := NewForgeClient(ctx)
+		if err != nil {
+			return Mod{}, err
+		}
+		forgeMod, err := client.FindMod(name)
+		if err != nil {
+			return Mod{}, err
+		}
+		versions, err := client.ListModVersions(forgeMod)
+		if err != nil {
+			return Mod{}, err
+		}
+		selected, err := selectForgeModVersion(versions, version)
+		if err != nil {
+			return Mod{}, fmt.Errorf("forge mod %s: %w", name, err)
+		}
+		helper.Logger(ctx).Info("resolved forge mod", "name", name, "requested", version, "version", selected.Version, "url", selected.Link)
+		return Mod{Checksum: mod.Checksum, Name: mod.Name, Url: selected.Link, Version: selected.Version}, nil
+	}
+
+	if !isExactVersion(version) {
+		return resolve()
+	}
+
+	resolved := Mod{}
+	err := helper.CreateTempDir(ctx, func(tempDir string) error {
+		path := filepath.Join(tempDir, "resolved.json")
+		key := fmt.Sprintf("forge-%s-%s", cacheKeyRegexp.ReplaceAllString(strings.ToLower(name), "-"), cacheKeyRegexp.ReplaceAllString(version, "-"))
+		err := filecache.Cache(ctx, key, path, func(dest string) error {
+			mod, err := resolve()
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(mod)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(dest, data, 0644)
+		})
+		if err != nil {
+			return err
+		}
+		return helper.UnmarshalFile(ctx, path, &resolved)
+	})
+	return resolved, err
+}
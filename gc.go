@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// gcKeepPaths are paths (relative to the spt path) never collected by 'gc' - files written by the entrypoint and by the running server
+var gcKeepPaths = []string{
+	".core-files.json",
+	".installed-mods.json",
+	".mod-snapshot",
+	".mod-snapshot.new",
+	".stock-configs",
+	"user/cache",
+	"user/logs",
+	"user/mods/order.json",
+	"user/profiles",
+	"user/sptappdata",
+	filepath.Join("user", "mods", imageInfoModDir),
+}
+
+// gcModRoots are the directories (relative to the spt path) beneath which a mod owns the whole directory it installs
+var gcModRoots = []string{"BepInEx/plugins", "user/mods"}
+
+// Returns the owner of a file (relative to the spt path) - 'spt', the name of an installed mod or 'entrypoint'.
+// Returns an empty string if the file is orphaned.
+// Files beneath a directory installed by a mod (see [gcModRoots]) are owned by the mod.
+func getGcOwner(file string, owned map[string]string, keep []string) string {
+	for path := file; path != "." && path != string(filepath.Separator); path = filepath.Dir(path) {
+		owner, ok := owned[path]
+		if ok {
+			return owner
+		}
+		if slices.Contains(keep, path) {
+			return "entrypoint"
+		}
+	}
+	return ""
+}
+
+// Finds orphaned regular files within the spt path - files not owned by spt, an installed mod or the entrypoint.
+// Symlinks (e.g., data directories and linked mod directories) are never collected or followed.
+// Returns a sorted list of orphaned files (relative to the spt path).
+// Returns an error if the spt installation has no core manifest or a mod was installed without recording its files.
+// Returns an error if the spt path cannot be walked.
+func FindOrphanedFiles(ctx context.Context, keep []string) ([]string, error) {
+	manifest, err := LoadCoreManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, &UserError{
+			Hint:    "start the server once to record the spt core files",
+			Message: "spt core manifest not found - orphaned files cannot be identified",
+		}
+	}
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := map[string]string{}
+	for file := range manifest {
+		owned[file] = "spt"
+	}
+	for name, installedMod := range installed {
+		if installedMod.Files == nil {
+			return nil, &UserError{
+				Hint:    "restart the server so that the mod is reinstalled",
+				Message: fmt.Sprintf("installed mod %s did not record its files - orphaned files cannot be identified", name),
+			}
+		}
+		for _, file := range installedMod.Files {
+			owned[file] = name
+			for _, root := range gcModRoots {
+				relPath, ok := strings.CutPrefix(filepath.ToSlash(file), root+"/")
+				if !ok {
+					continue
+				}
+				dir, _, ok := strings.Cut(relPath, "/")
+				if ok {
+					owned[filepath.Join(root, dir)] = name
+				}
+			}
+		}
+	}
+
+	sptDir := helper.Dirs(ctx)["spt"]
+	orphans := []string{}
+	err = filepath.WalkDir(sptDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(sptDir, path)
+		if err != nil {
+			return err
+		}
+		if getGcOwner(relPath, owned, keep) == "" {
+			orphans = append(orphans, relPath)
+		}
+		return nil
+	})
+	slices.Sort(orphans)
+	return orphans, err
+}
+
+// Removes (or quarantines) orphaned files from the spt path (see [FindOrphanedFiles]).
+// The files are listed and confirmed before anything is removed.
+// Quarantined files are moved to a timestamped directory beneath '/data/gc-quarantine' (preserving their paths) rather than deleted.
+// Run with the server stopped.
+// Returns an error if the arguments are invalid.
+// Returns an error if orphaned files cannot be identified or removed.
+func Gc(ctx context.Context, args ...string) error {
+	dryRun, quarantine, yes := false, false, false
+	for _, arg := range args {
+		switch arg {
+		case "--dry-run":
+			dryRun = true
+		case "--quarantine":
+			quarantine = true
+		case "--yes":
+			yes = true
+		default:
+			return fmt.Errorf("usage: gc [--dry-run] [--quarantine] [--yes]")
+		}
+	}
+	config := EntrypointConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	keep := slices.Concat(gcKeepPaths, config.DataDirs)
+	for index := range keep {
+		keep[index] = filepath.Clean(keep[index])
+	}
+	orphans, err := FindOrphanedFiles(ctx, keep)
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		fmt.Fprintln(os.Stderr, "no orphaned files found")
+		return nil
+	}
+
+	sptDir := helper.Dirs(ctx)["spt"]
+	total := int64(0)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "FILE\tSIZE")
+	for _, orphan := range orphans {
+		size := int64(0)
+		info, err := os.Lstat(filepath.Join(sptDir, orphan))
+		if err == nil {
+			size = info.Size()
+		}
+		total += size
+		fmt.Fprintf(writer, "%s\t%d\n", orphan, size)
+	}
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+	action := "delete"
+	if quarantine {
+		action = "quarantine"
+	}
+	summary := fmt.Sprintf("%s %d orphaned file(s) (%d bytes)", action, len(orphans), total)
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "would %s\n", summary)
+		return nil
+	}
+	if !yes {
+		p := prompter{reader: bufio.NewReader(os.Stdin), writer: os.Stderr}
+		confirmed, err := p.confirm(strings.ToUpper(summary[:1])+summary[1:], false)
+		if err != nil {
+			return fmt.Errorf("confirm %s: %w (pass --yes to skip confirmation)", action, err)
+		}
+		if !confirmed {
+			return nil
+		}
+	}
+
+	if quarantine {
+		dir := filepath.Join(helper.Dirs(ctx)["data"], "gc-quarantine", clock.Get(ctx).Now().Format("20060102-150405"))
+		helper.Logger(ctx).Info("quarantine orphaned files", "dest", dir, "count", len(orphans))
+		for _, orphan := range orphans {
+			err := fsutil.MoveTree(ctx, filepath.Join(sptDir, orphan), filepath.Join(dir, orphan))
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		helper.Logger(ctx).Info("delete orphaned files", "count", len(orphans))
+	}
+	// quarantined files are already gone - removing them again prunes the directories they leave empty
+	err = fsutil.RemoveFiles(ctx, sptDir, orphans, modKeepDirs...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%sd %d orphaned file(s)\n", action, len(orphans))
+	return nil
+}
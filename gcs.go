@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/download"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+)
+
+// GcsConfig is loaded from the environment and configures access to Google Cloud Storage
+type GcsConfig struct {
+	AccessToken  string `env:"GOOGLE_OAUTH_ACCESS_TOKEN"`
+	Credentials  string `env:"GOOGLE_APPLICATION_CREDENTIALS"`
+	EmulatorHost string `env:"STORAGE_EMULATOR_HOST"`
+}
+
+// gcsCredentials is a Google credentials file (either a service account key or gcloud user credentials)
+type gcsCredentials struct {
+	ClientEmail  string `json:"client_email"`
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	PrivateKey   string `json:"private_key"`
+	RefreshToken string `json:"refresh_token"`
+	TokenUri     string `json:"token_uri"`
+	Type         string `json:"type"`
+}
+
+// gcsTokenResponse is the response of the Google OAuth token endpoint
+type gcsTokenResponse struct {
+	AccessToken string `json:"access_token"`
+}
+
+// gcsReadOnlyScope is the OAuth scope requested to download objects
+const gcsReadOnlyScope = "https://www.googleapis.com/auth/devstorage.read_only"
+
+// Creates a signed (RS256) JWT asserting a service account's identity - exchanged for an access token.
+// Returns an error if the private key cannot be parsed.
+func createGcsAssertion(ctx context.Context, credentials gcsCredentials) (string, error) {
+	block, _ := pem.Decode([]byte(credentials.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("service account private key is not pem encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("service account private key is not an rsa key")
+	}
+
+	now := clock.Get(ctx).Now().Unix()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"aud":   credentials.TokenUri,
+		"exp":   now + 3600,
+		"iat":   now,
+		"iss":   credentials.ClientEmail,
+		"scope": gcsReadOnlyScope,
+	})
+	if err != nil {
+		return "", err
+	}
+	encoding := base64.RawURLEncoding
+	unsigned := fmt.Sprintf("%s.%s", encoding.EncodeToString(header), encoding.EncodeToString(claims))
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(nil, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s.%s", unsigned, encoding.EncodeToString(signature)), nil
+}
+
+// Obtains an access token for Google Cloud Storage.
+// Uses GOOGLE_OAUTH_ACCESS_TOKEN if set - otherwise exchanges the credentials file referenced by GOOGLE_APPLICATION_CREDENTIALS.
+// Returns an empty token (i.e., anonymous access to public objects) if neither is set.
+// Returns an error if the credentials file cannot be read or exchanged.
+func getGcsAccessToken(ctx context.Context, config GcsConfig) (string, error) {
+	if config.AccessToken != "" || config.Credentials == "" {
+		return config.AccessToken, nil
+	}
+	data, err := os.ReadFile(config.Credentials)
+	if err != nil {
+		return "", err
+	}
+	credentials := gcsCredentials{}
+	err = json.Unmarshal(data, &credentials)
+	if err != nil {
+		return "", err
+	}
+	if credentials.TokenUri == "" {
+		credentials.TokenUri = "https://oauth2.googleapis.com/token"
+	}
+
+	form := url.Values{}
+	switch credentials.Type {
+	case "service_account":
+		assertion, err := createGcsAssertion(ctx, credentials)
+		if err != nil {
+			return "", err
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", credentials.ClientId)
+		form.Set("client_secret", credentials.ClientSecret)
+		form.Set("refresh_token", credentials.RefreshToken)
+	default:
+		return "", fmt.Errorf("unsupported google credentials type %s", credentials.Type)
+	}
+	response := gcsTokenResponse{}
+	err = PostFormJson(ctx, credentials.TokenUri, form, &response)
+	return response.AccessToken, err
+}
+
+// Downloads an object referenced by a 'gs://bucket/object' url.
+// Credentials are read from the standard Google environment variables (see [GcsConfig]).
+// Returns an error if the download fails.
+func downloadGcsObject(ctx context.Context, downloadUrl *url.URL, writer io.Writer) error {
+	config := GcsConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	token, err := getGcsAccessToken(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	endpoint := "https://storage.googleapis.com"
+	if config.EmulatorHost != "" {
+		endpoint = config.EmulatorHost
+		if !strings.Contains(endpoint, "://") {
+			endpoint = fmt.Sprintf("http://%s", endpoint)
+		}
+	}
+	object := strings.TrimPrefix(downloadUrl.Path, "/")
+	objectUrl := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", strings.TrimSuffix(endpoint, "/"), url.PathEscape(downloadUrl.Host), url.PathEscape(object))
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, objectUrl, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	response, err := outbound.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return &download.StatusError{Method: http.MethodGet, StatusCode: response.StatusCode, Url: downloadUrl.String()}
+	}
+	_, err = io.Copy(writer, response.Body)
+	return err
+}
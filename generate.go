@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/download"
+	"gopkg.in/yaml.v3"
+)
+
+// configTypes lists every struct parsed from the environment by the entrypoint (and the helper).
+// Used to discover which environment variables make up the effective configuration.
+var configTypes = []any{
+	AdminConfig{},
+	BrandingConfig{},
+	ConfigBundleConfig{},
+	DiskSpaceConfig{},
+	DrillConfig{},
+	EntrypointConfig{},
+	FeaturesConfig{},
+	ForgeConfig{},
+	GcsConfig{},
+	GithubConfig{},
+	HealthConfig{},
+	HooksConfig{},
+	LoadtestConfig{},
+	LogCleanupConfig{},
+	LogConfig{},
+	MirrorConfig{},
+	ModAuthConfig{},
+	ModLogsConfig{},
+	ModPinningConfig{},
+	ModSyncConfig{},
+	NettestConfig{},
+	OciConfig{},
+	OwnershipConfig{},
+	PatchReloadConfig{},
+	PresetsConfig{},
+	ProfilePatchesConfig{},
+	RaidTimeConfig{},
+	S3Config{},
+	ServerPortConfig{},
+	SettingsConfig{},
+	SptInstallConfig{},
+	StepLimitsConfig{},
+	StepPoliciesConfig{},
+	UpdatesConfig{},
+	download.ProgressConfig{},
+	download.RetryConfig{},
+	helper.Entrypoint{},
+	helper.User{},
+}
+
+// Collects the names of environment variables declared (via 'env' struct tags) on the given struct values.
+func getEnvNames(values ...any) []string {
+	names := []string{}
+	for _, value := range values {
+		valueType := reflect.TypeOf(value)
+		for index := range valueType.NumField() {
+			name, ok := valueType.Field(index).Tag.Lookup("env")
+			if !ok {
+				continue
+			}
+			name, _, _ = strings.Cut(name, ",")
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// Returns the entrypoint-related environment variables currently set - forming the effective configuration.
+func GetEffectiveEnv() map[string]string {
+	effective := map[string]string{}
+	for _, name := range getEnvNames(configTypes...) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		effective[name] = value
+	}
+	return effective
+}
+
+// Returns the docker image reference matching the running entrypoint version.
+// Development builds (whose version carries build metadata) fall back to the 'latest' tag.
+func getImage(ctx context.Context) (string, string) {
+	repository := "docker.io/benfiola/single-player-tarkov"
+	version := strings.TrimSpace(helper.Version(ctx))
+	if version == "" || strings.Contains(version, "+") {
+		version = "latest"
+	}
+	return repository, version
+}
+
+// Creates a docker-compose document containing a single server service.
+// The returned service map can be further customized by the caller.
+func newComposeDocument(ctx context.Context, port int) (map[string]any, map[string]any) {
+	repository, tag := getImage(ctx)
+	service := map[string]any{
+		"image":   fmt.Sprintf("%s:%s", repository, tag),
+		"ports":   []string{fmt.Sprintf("%d:%d/tcp", port, port)},
+		"restart": "unless-stopped",
+		"volumes": []string{"./cache:/cache", "./data:/data"},
+	}
+	document := map[string]any{
+		"services": map[string]any{
+			"spt": service,
+		},
+	}
+	return document, service
+}
+
+// Returns the command checking the health of the server (see [Health]) - for a kind of probe, or every probe if the kind is empty
+func getHealthCommand(kind string) []string {
+	command := []string{"entrypoint", "health"}
+	if kind != "" {
+		command = append(command, kind)
+	}
+	return command
+}
+
+// Generates a docker-compose document running a server with the effective configuration
+func generateCompose(ctx context.Context, config EntrypointConfig) any {
+	document, service := newComposeDocument(ctx, getServerPort(config))
+	service["environment"] = GetEffectiveEnv()
+	service["healthcheck"] = map[string]any{
+		"interval":     "30s",
+		"start_period": "30m",
+		"test":         getHealthCommand(""),
+	}
+	return document
+}
+
+// Generates a Helm values scaffold running a server with the effective configuration
+func generateHelm(ctx context.Context, config EntrypointConfig) any {
+	repository, tag := getImage(ctx)
+	effective := GetEffectiveEnv()
+	env := []map[string]string{}
+	for _, name := range helper.Map[string, string](effective).Keys() {
+		env = append(env, map[string]string{"name": name, "value": effective[name]})
+	}
+	slices.SortFunc(env, func(a map[string]string, b map[string]string) int {
+		return strings.Compare(a["name"], b["name"])
+	})
+	return map[string]any{
+		"env": env,
+		"image": map[string]any{
+			"repository": repository,
+			"tag":        tag,
+		},
+		"livenessProbe": map[string]any{"exec": map[string]any{"command": getHealthCommand("liveness")}, "periodSeconds": 30},
+		"persistence": map[string]any{
+			"cache": map[string]any{"enabled": true, "mountPath": "/cache", "size": "10Gi"},
+			"data":  map[string]any{"enabled": true, "mountPath": "/data", "size": "1Gi"},
+		},
+		"readinessProbe": map[string]any{"exec": map[string]any{"command": getHealthCommand("readiness")}, "periodSeconds": 30},
+		"service": map[string]any{
+			"ports": []map[string]any{{"name": "http", "port": getServerPort(config), "protocol": "TCP"}},
+			"type":  "ClusterIP",
+		},
+		// setup (e.g., building spt) happens before the server starts - the startup probe allows for it before liveness is probed
+		"startupProbe": map[string]any{"exec": map[string]any{"command": getHealthCommand("liveness")}, "failureThreshold": 120, "periodSeconds": 30},
+	}
+}
+
+// generators maps the targets supported by [Generate] to their implementations
+var generators = map[string]func(ctx context.Context, config EntrypointConfig) any{
+	"compose": generateCompose,
+	"helm":    generateHelm,
+}
+
+// Writes a deployment manifest (docker-compose or Helm values) derived from the effective configuration to stdout.
+// Eases migration from 'docker run' one-liners to declarative deployments.
+// Returns an error if the target is unknown.
+// Returns an error if the environment cannot be parsed.
+func Generate(ctx context.Context, args ...string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: generate compose|helm")
+	}
+	generator, ok := generators[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown generate target %s", args[0])
+	}
+	config := EntrypointConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	config, err = LoadConfigPatches(ctx, config)
+	if err != nil {
+		return err
+	}
+	return writeYaml(os.Stdout, generator(ctx, config))
+}
+
+// Encodes data as YAML (with two-space indentation) to the given writer.
+func writeYaml(writer io.Writer, data any) error {
+	encoder := yaml.NewEncoder(writer)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	return encoder.Encode(data)
+}
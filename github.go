@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/archive"
+)
+
+// GithubConfig is loaded from the environment and configures access to the GitHub API
+type GithubConfig struct {
+	ApiUrl string `env:"GITHUB_API_URL" envDefault:"https://api.github.com"`
+	Token  string `env:"GITHUB_TOKEN"`
+}
+
+// githubAsset is a release asset as returned by the GitHub API
+type githubAsset struct {
+	BrowserDownloadUrl string `json:"browser_download_url"`
+	Name               string `json:"name"`
+	Url                string `json:"url"`
+}
+
+// githubRelease is a release as returned by the GitHub API
+type githubRelease struct {
+	Assets  []githubAsset `json:"assets"`
+	TagName string        `json:"tag_name"`
+}
+
+// Parses [GithubConfig] from the environment
+func getGithubConfig(ctx context.Context) (GithubConfig, error) {
+	config := GithubConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	return config, err
+}
+
+// Returns the headers used to authenticate with the GitHub API.
+func (gc GithubConfig) headers() map[string]string {
+	headers := map[string]string{}
+	if gc.Token != "" {
+		headers["Authorization"] = fmt.Sprintf("Bearer %s", gc.Token)
+	}
+	return headers
+}
+
+// Attaches GitHub credentials to downloads of release assets served by the GitHub API.
+// Implements [download.HeaderFunc].
+func getGithubDownloadHeaders(ctx context.Context, downloadUrl *url.URL) (map[string]string, error) {
+	config, err := getGithubConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	apiUrl, err := url.Parse(config.ApiUrl)
+	if err != nil {
+		return nil, err
+	}
+	if downloadUrl.Host != apiUrl.Host || !strings.Contains(downloadUrl.Path, "/releases/assets/") {
+		return nil, nil
+	}
+	headers := config.headers()
+	headers["Accept"] = "application/octet-stream"
+	return headers, nil
+}
+
+// Returns true if the given file name has an archive file extension supported by extraction (see [archive.Extensions])
+func isArchive(name string) bool {
+	for _, suffix := range archive.Extensions {
+		if strings.HasSuffix(strings.ToLower(name), suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Selects the archive asset to install from a release.
+// Releases sometimes attach both client and server archives - archives mentioning 'server' are preferred.
+// Returns an error if the release has no archive assets.
+func selectGithubAsset(release githubRelease) (githubAsset, error) {
+	archives := []githubAsset{}
+	for _, asset := range release.Assets {
+		if isArchive(asset.Name) {
+			archives = append(archives, asset)
+		}
+	}
+	if len(archives) == 0 {
+		return githubAsset{}, fmt.Errorf("release %s has no archive assets", release.TagName)
+	}
+	for _, archive := range archives {
+		if strings.Contains(strings.ToLower(archive.Name), "server") {
+			return archive, nil
+		}
+	}
+	return archives[0], nil
+}
+
+// Resolves a github mod (e.g., 'github:owner/repo@v1.2.3') into a downloadable [Mod].
+// An omitted version (or 'latest') resolves the latest release.
+// When a token is configured, assets are downloaded through the GitHub API so that private repositories are supported.
+// Returns an error if the release or a suitable asset cannot be found.
+func ResolveGithubMod(ctx context.Context, mod Mod) (Mod, error) {
+	repo, version := parseModSpec(mod)
+	if strings.Count(repo, "/") != 1 {
+		return Mod{}, fmt.Errorf("github mod %s must be of the form owner/repo", repo)
+	}
+	config, err := getGithubConfig(ctx)
+	if err != nil {
+		return Mod{}, err
+	}
+
+	endpoint := fmt.Sprintf("%s/repos/%s/releases/tags/%s", strings.TrimSuffix(config.ApiUrl, "/"), repo, url.PathEscape(version))
+	if version == "" || version == "latest" {
+		endpoint = fmt.Sprintf("%s/repos/%s/releases/latest", strings.TrimSuffix(config.ApiUrl, "/"), repo)
+	}
+	release := githubRelease{}
+	err = GetJson(ctx, endpoint, config.headers(), &release)
+	if err != nil {
+		return Mod{}, err
+	}
+
+	asset, err := selectGithubAsset(release)
+	if err != nil {
+		return Mod{}, fmt.Errorf("github mod %s: %w", repo, err)
+	}
+	downloadUrl := asset.BrowserDownloadUrl
+	if config.Token != "" {
+		downloadUrl = asset.Url
+	}
+	helper.Logger(ctx).Info("resolved github mod", "repo", repo, "requested", version, "version", release.TagName, "asset", asset.Name)
+	return Mod{Checksum: mod.Checksum, Name: mod.Name, Url: downloadUrl, Version: release.TagName}, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/filecache"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/limits"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+)
+
+// defaultGitModBuild is the command used to build git mods that don't specify a build command
+const defaultGitModBuild = "npm install && npm run build"
+
+// defaultGitModOutput is the directory (relative to the repository) installed for git mods that don't specify an output directory
+const defaultGitModOutput = "dist"
+
+// gitCommitRegexp matches a full git commit hash
+var gitCommitRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Determines whether a mod is installed from a git repository (e.g., 'git+https://github.com/owner/repo.git@v1.0.0')
+func isGitMod(mod Mod) bool {
+	return strings.HasPrefix(mod.Url, "git+")
+}
+
+// Parses a git mod url into its repository url and ref.
+// The ref defaults to 'HEAD' (i.e., the default branch) if omitted.
+func parseGitModUrl(modUrl string) (string, string) {
+	repo := strings.TrimPrefix(modUrl, "git+")
+	ref := "HEAD"
+	index := strings.LastIndex(repo, "@")
+	if index > strings.LastIndex(repo, "/") {
+		repo, ref = repo[:index], repo[index+1:]
+	}
+	return repo, ref
+}
+
+// Resolves the ref of a git mod into a commit - stored as the mod's version so that a moved branch or tag triggers a reinstall.
+// Implements [modResolver].
+// Returns an error if the mod specifies a checksum.
+// Returns an error if the ref cannot be found.
+func ResolveGitMod(ctx context.Context, mod Mod) (Mod, error) {
+	if mod.Checksum != "" {
+		return Mod{}, fmt.Errorf("git mod %s cannot be verified with a checksum", mod.Name)
+	}
+	repo, ref := parseGitModUrl(mod.Url)
+	if gitCommitRegexp.MatchString(ref) {
+		mod.Version = ref
+		return mod, nil
+	}
+	helper.Logger(ctx).Info("resolve git mod", "repo", repo, "ref", ref)
+	output, err := helper.Command(ctx, []string{"git", "ls-remote", repo, ref, fmt.Sprintf("%s^{}", ref)}, helper.CmdOpts{Env: outbound.CommandEnv(ctx)}).Run()
+	if err != nil {
+		return Mod{}, err
+	}
+	commit := ""
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		hash, name, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		// annotated tags are listed twice - the peeled ('^{}') entry references the tagged commit rather than the tag object
+		if commit == "" || strings.HasSuffix(name, "^{}") {
+			commit = hash
+		}
+	}
+	if commit == "" {
+		return Mod{}, fmt.Errorf("git mod %s: ref %s not found in %s", mod.Name, ref, repo)
+	}
+	mod.Version = commit
+	return mod, nil
+}
+
+// Clones, builds and stages a git mod into the given staging directory.
+// If the build output contains a 'user' or 'BepInEx' directory it is staged as-is - otherwise it is staged as the server mod 'user/mods/<name>'.
+// Builds are cached by commit.
+// Raises an error if the repository cannot be cloned or checked out.
+// Raises an error if the build fails or produces no output.
+func FetchGitMod(ctx context.Context, mod Mod, staging string) error {
+	repo, _ := parseGitModUrl(mod.Url)
+	build := mod.Build
+	if build == "" {
+		build = defaultGitModBuild
+	}
+	output := mod.Output
+	if output == "" {
+		output = defaultGitModOutput
+	}
+	key := fmt.Sprintf("mod-git-%s-%s", cacheKeyRegexp.ReplaceAllString(mod.Name, "-"), cacheKeyRegexp.ReplaceAllString(mod.Version[:min(12, len(mod.Version))], "-"))
+	return filecache.Cache(ctx, key, staging, func(dest string) error {
+		return helper.CreateTempDir(ctx, func(tempDir string) error {
+			helper.Logger(ctx).Info("build git mod", "name", mod.Name, "repo", repo, "commit", mod.Version)
+			commands := []Command{
+				{Args: []string{"git", "clone", "--no-checkout", repo, tempDir}, Opts: helper.CmdOpts{}},
+				{Args: []string{"git", "checkout", mod.Version}, Opts: helper.CmdOpts{Cwd: tempDir}},
+				{Args: []string{"git", "submodule", "update", "--init", "--recursive"}, Opts: helper.CmdOpts{Cwd: tempDir}},
+				{Args: []string{"sh", "-c", build}, Opts: helper.CmdOpts{Cwd: tempDir}},
+			}
+			buildCtx, cancel, err := withStepLimits(ctx, "mod-build")
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			for _, command := range commands {
+				command.Opts.Env = outbound.CommandEnv(ctx)
+				_, err := limits.Command(buildCtx, command.Args, command.Opts)
+				if err != nil {
+					return err
+				}
+			}
+
+			outputPath := filepath.Join(tempDir, output)
+			entries, err := os.ReadDir(outputPath)
+			if err != nil {
+				return fmt.Errorf("git mod %s produced no build output at %s: %w", mod.Name, output, err)
+			}
+			target := filepath.Join(dest, "user", "mods", mod.Name)
+			for _, entry := range entries {
+				if entry.IsDir() && (entry.Name() == "user" || entry.Name() == "BepInEx") {
+					target = dest
+					break
+				}
+			}
+			_, err = fsutil.CopyTree(ctx, outputPath, target)
+			return err
+		})
+	})
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/console"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+)
+
+// HealthProbe checks the liveness and/or readiness of the running server.
+// Fields other than the kind, timeout and type only apply to some probe types (see [healthProbeTypes]).
+type HealthProbe struct {
+	Addr    string `json:"addr,omitempty"`
+	Command string `json:"command,omitempty"`
+	Expect  string `json:"expect,omitempty"`
+	Kind    string `json:"kind,omitempty"`
+	MaxAge  string `json:"maxAge,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+	Type    string `json:"type"`
+	Url     string `json:"url,omitempty"`
+}
+
+// healthProbeTypes are the supported probe types
+var healthProbeTypes = []string{"console", "http", "log", "tcp"}
+
+// healthProbeKinds are the supported probe kinds - an empty kind applies to both
+var healthProbeKinds = []string{"", "liveness", "readiness"}
+
+// HealthProbes is a map of probe name -> [HealthProbe]
+type HealthProbes map[string]HealthProbe
+
+// Parses a string into a [HealthProbes] object - validating types, kinds, durations and the fields each type requires.
+// Used to parse settings from the environment.
+func (hp *HealthProbes) UnmarshalText(data []byte) error {
+	parsed := map[string]HealthProbe{}
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return err
+	}
+	for name, probe := range parsed {
+		if !slices.Contains(healthProbeTypes, probe.Type) {
+			return fmt.Errorf("health probe %s: unknown type %s (expected one of %v)", name, probe.Type, healthProbeTypes)
+		}
+		if !slices.Contains(healthProbeKinds, probe.Kind) {
+			return fmt.Errorf("health probe %s: unknown kind %s (expected liveness or readiness)", name, probe.Kind)
+		}
+		for _, duration := range []string{probe.MaxAge, probe.Timeout} {
+			if duration == "" {
+				continue
+			}
+			_, err := time.ParseDuration(duration)
+			if err != nil {
+				return fmt.Errorf("health probe %s: invalid duration %s", name, duration)
+			}
+		}
+		switch probe.Type {
+		case "console":
+			if probe.Command == "" || probe.Expect == "" {
+				return fmt.Errorf("health probe %s: console probes require a command and an expected output", name)
+			}
+			_, err := regexp.Compile(probe.Expect)
+			if err != nil {
+				return fmt.Errorf("health probe %s: invalid expected output %s: %w", name, probe.Expect, err)
+			}
+		case "http":
+			if probe.Url == "" {
+				continue
+			}
+			_, err := url.Parse(probe.Url)
+			if err != nil {
+				return fmt.Errorf("health probe %s: invalid url %s", name, probe.Url)
+			}
+		case "log":
+			if probe.MaxAge == "" {
+				return fmt.Errorf("health probe %s: log probes require a maximum age", name)
+			}
+		}
+	}
+	*hp = HealthProbes(parsed)
+	return nil
+}
+
+// HealthConfig is loaded from the environment and configures the health probes run while the server runs (see [MonitorHealthWhile])
+type HealthConfig struct {
+	Interval time.Duration `env:"HEALTH_INTERVAL" envDefault:"30s"`
+	Probes   HealthProbes  `env:"HEALTH_PROBES"`
+}
+
+// healthProbeTimeout is the default time a probe may take
+const healthProbeTimeout = 5 * time.Second
+
+// healthLogPath is the default path (relative to the spt path) of the server logs checked by log probes
+const healthLogPath = "user/logs/spt/*.log"
+
+// HealthResult is the outcome of a single health probe
+type HealthResult struct {
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	Kind     string        `json:"kind,omitempty"`
+	Name     string        `json:"name"`
+	Ok       bool          `json:"ok"`
+}
+
+// HealthStatus is the outcome of the most recent round of health probes - written to the data directory (see [getHealthStatusPath])
+type HealthStatus struct {
+	Checked  time.Time      `json:"checked"`
+	Interval time.Duration  `json:"interval"`
+	Results  []HealthResult `json:"results"`
+}
+
+// healthStaleIntervals is the number of probe intervals after which a health status is considered stale (e.g., because the entrypoint is wedged)
+const healthStaleIntervals = 3
+
+// Checks the health status for a kind of probe (an empty kind checks every probe).
+// Returns an error if the probes haven't run yet or the status is stale (see [healthStaleIntervals]).
+// Returns an error naming every failing probe of the kind.
+func (hs HealthStatus) Check(kind string, now time.Time) error {
+	if hs.Checked.IsZero() {
+		return fmt.Errorf("health probes haven't run yet")
+	}
+	age := now.Sub(hs.Checked)
+	if age > healthStaleIntervals*hs.Interval {
+		return fmt.Errorf("health status is stale (last checked %s ago)", age.Round(time.Second))
+	}
+	errs := []error{}
+	for _, result := range hs.Results {
+		if result.Ok || (kind != "" && result.Kind != "" && result.Kind != kind) {
+			continue
+		}
+		errs = append(errs, fmt.Errorf("health probe %s failed: %s", result.Name, result.Error))
+	}
+	return errors.Join(errs...)
+}
+
+// Returns the path to the health status (see [HealthStatus])
+func getHealthStatusPath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "health.json")
+}
+
+// Returns the configured health probes - defaulting to a tcp probe of the server's port if none are configured.
+func getHealthProbes(config HealthConfig) HealthProbes {
+	if len(config.Probes) == 0 {
+		return HealthProbes{"tcp": {Type: "tcp"}}
+	}
+	return config.Probes
+}
+
+// Checks that a tcp connection can be opened - to the server's port unless an address is provided.
+func probeHealthTcp(ctx context.Context, config EntrypointConfig, probe HealthProbe) error {
+	addr := probe.Addr
+	if addr == "" {
+		addr = net.JoinHostPort("127.0.0.1", strconv.Itoa(getServerPort(config)))
+	}
+	connection, err := outbound.Dial(outbound.Declare(ctx, "tcp health probe"), "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return connection.Close()
+}
+
+// Checks that an http request is answered without a server error - to the server's port unless a url is provided.
+// Certificates of loopback addresses aren't verified, as spt serves a self-signed certificate (see [outbound.LocalClient]).
+func probeHealthHttp(ctx context.Context, config EntrypointConfig, probe HealthProbe) error {
+	probeUrl := probe.Url
+	if probeUrl == "" {
+		probeUrl = fmt.Sprintf("http://127.0.0.1:%d", getServerPort(config))
+	}
+	request, err := http.NewRequestWithContext(outbound.Declare(ctx, "http health probe"), http.MethodGet, probeUrl, nil)
+	if err != nil {
+		return err
+	}
+	response, err := outbound.LocalClient.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 500 {
+		return fmt.Errorf("%s responded with status %d", probeUrl, response.StatusCode)
+	}
+	return nil
+}
+
+// Checks that the server answers a console command - by sending the command and waiting for a line of console output matching the expected output.
+// Requires the server console and the per-mod logs (see [SplitModLogsWhile]), which observe the server's output.
+func probeHealthConsole(ctx context.Context, probe HealthProbe) error {
+	serverConsole := console.Get(ctx)
+	modLogs := GetModLogs(ctx)
+	if serverConsole == nil || modLogs == nil {
+		return fmt.Errorf("console probes require the server console and MOD_LOGS")
+	}
+	pattern := regexp.MustCompile(probe.Expect)
+	err := modLogs.WaitForLine(ctx, pattern, func() error {
+		return serverConsole.Send(ctx, probe.Command)
+	})
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("no output matching %s after sending %q", probe.Expect, probe.Command)
+	}
+	return err
+}
+
+// Checks that the most recently modified server log (matching the path, relative to the spt path) was written within the maximum age.
+func probeHealthLog(ctx context.Context, probe HealthProbe) error {
+	pattern := probe.Path
+	if pattern == "" {
+		pattern = healthLogPath
+	}
+	paths, err := filepath.Glob(filepath.Join(helper.Dirs(ctx)["spt"], pattern))
+	if err != nil {
+		return err
+	}
+	latest := time.Time{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	if latest.IsZero() {
+		return fmt.Errorf("no logs match %s", pattern)
+	}
+	maxAge, _ := time.ParseDuration(probe.MaxAge)
+	age := time.Since(latest)
+	if age > maxAge {
+		return fmt.Errorf("logs matching %s were last written %s ago", pattern, age.Round(time.Second))
+	}
+	return nil
+}
+
+// Runs a single health probe - bounded by its timeout.
+func runHealthProbe(ctx context.Context, config EntrypointConfig, name string, probe HealthProbe) HealthResult {
+	timeout := healthProbeTimeout
+	if probe.Timeout != "" {
+		timeout, _ = time.ParseDuration(probe.Timeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	var err error
+	switch probe.Type {
+	case "console":
+		err = probeHealthConsole(ctx, probe)
+	case "http":
+		err = probeHealthHttp(ctx, config, probe)
+	case "log":
+		err = probeHealthLog(ctx, probe)
+	case "tcp":
+		err = probeHealthTcp(ctx, config, probe)
+	}
+	result := HealthResult{Duration: time.Since(start), Kind: probe.Kind, Name: name, Ok: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// HealthMonitor runs health probes periodically and holds the outcome of the most recent round
+type HealthMonitor struct {
+	config   EntrypointConfig
+	interval time.Duration
+	mutex    sync.Mutex
+	probes   HealthProbes
+	status   HealthStatus
+}
+
+// Runs every probe (in parallel) - storing the outcome and writing it to the data directory.
+// Probes changing between passing and failing are logged - probes that haven't passed yet (e.g., while the server starts) aren't reported as failing.
+func (hm *HealthMonitor) check(ctx context.Context) {
+	names := helper.Map[string, HealthProbe](hm.probes).Keys()
+	slices.Sort(names)
+	results := make([]HealthResult, len(names))
+	group := sync.WaitGroup{}
+	for index, name := range names {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			results[index] = runHealthProbe(ctx, hm.config, name, hm.probes[name])
+		}()
+	}
+	group.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	hm.mutex.Lock()
+	previous := map[string]bool{}
+	for _, result := range hm.status.Results {
+		previous[result.Name] = result.Ok
+	}
+	hm.status = HealthStatus{Checked: clock.Get(ctx).Now(), Interval: hm.interval, Results: results}
+	status := hm.status
+	hm.mutex.Unlock()
+
+	for _, result := range results {
+		switch {
+		case !result.Ok && previous[result.Name]:
+			helper.Logger(ctx).Warn("health probe failing", "name", result.Name, "error", result.Error)
+		case result.Ok && !previous[result.Name]:
+			helper.Logger(ctx).Info("health probe passing", "name", result.Name)
+		}
+	}
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err == nil {
+		err = fsutil.WriteFileAtomic(getHealthStatusPath(ctx), data)
+	}
+	if err != nil {
+		helper.Logger(ctx).Warn("write health status failed", "error", err.Error())
+	}
+}
+
+// Returns the outcome of the most recent round of health probes
+func (hm *HealthMonitor) Status() HealthStatus {
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+	return hm.status
+}
+
+// Returns the [HealthMonitor] stored in the context - or nil if health probes aren't running.
+func GetHealthMonitor(ctx context.Context) *HealthMonitor {
+	monitor, _ := ctx.Value(contextKey("health-monitor")).(*HealthMonitor)
+	return monitor
+}
+
+// Runs a function while running health probes (see [HealthProbe]) every HEALTH_INTERVAL.
+// The [HealthMonitor] is stored in the context passed to the function.
+// The outcome of each round is written to the data directory (health.json) - a status left behind by a previous run is removed first.
+// Returns an error if the configuration is invalid.
+// Returns an error if the function fails.
+func MonitorHealthWhile(ctx context.Context, config EntrypointConfig, run func(ctx context.Context) error) error {
+	healthConfig := HealthConfig{}
+	err := helper.ParseEnv(ctx, &healthConfig)
+	if err != nil {
+		return err
+	}
+	if healthConfig.Interval <= 0 {
+		return fmt.Errorf("invalid HEALTH_INTERVAL %s", healthConfig.Interval)
+	}
+	err = os.Remove(getHealthStatusPath(ctx))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	monitor := &HealthMonitor{config: config, interval: healthConfig.Interval, probes: getHealthProbes(healthConfig)}
+	helper.Logger(ctx).Info("monitor health", "probes", len(monitor.probes), "interval", healthConfig.Interval)
+	ctx = context.WithValue(ctx, contextKey("health-monitor"), monitor)
+
+	monitorCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := clock.Get(monitorCtx).NewTicker(healthConfig.Interval)
+		defer ticker.Stop()
+		monitor.check(monitorCtx)
+		for {
+			select {
+			case <-monitorCtx.Done():
+				return
+			case <-ticker.C():
+				monitor.check(monitorCtx)
+			}
+		}
+	}()
+	err = run(ctx)
+	cancel()
+	<-done
+	return err
+}
+
+// Checks the health of a running server - from the health status written by the entrypoint (see [MonitorHealthWhile]).
+// Intended as an exec probe (e.g., 'entrypoint health liveness') - checks every probe unless a kind (liveness or readiness) is given.
+// Returns an error if the status is missing or stale, or a probe of the kind is failing.
+func Health(ctx context.Context, args ...string) error {
+	if len(args) > 1 || (len(args) == 1 && !slices.Contains(healthProbeKinds[1:], args[0])) {
+		return fmt.Errorf("usage: health [liveness|readiness]")
+	}
+	kind := ""
+	if len(args) == 1 {
+		kind = args[0]
+	}
+	data, err := os.ReadFile(getHealthStatusPath(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("health status unavailable (is the server running?)")
+	}
+	if err != nil {
+		return err
+	}
+	status := HealthStatus{}
+	err = json.Unmarshal(data, &status)
+	if err != nil {
+		return err
+	}
+	err = status.Check(kind, clock.Get(ctx).Now())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "healthy (%d probes, checked %s)\n", len(status.Results), status.Checked.Format(time.RFC3339))
+	return nil
+}
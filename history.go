@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// runHistoryLimit is the number of runs kept in the run history - older runs are discarded as new runs are recorded
+const runHistoryLimit = 500
+
+// runHistoryReasonLimit is the maximum length of the reason recorded for a failed run
+const runHistoryReasonLimit = 2000
+
+// Outcomes of a run recorded in the run history (see [RunRecord])
+const (
+	runOutcomeFailed      = "failed"
+	runOutcomeInterrupted = "interrupted"
+	runOutcomeRunning     = "running"
+	runOutcomeSucceeded   = "succeeded"
+)
+
+// RunRecord is an entry of the run history - a single run of the entrypoint (see [RecordRunWhile])
+type RunRecord struct {
+	Archives   map[string]string `json:"archives,omitempty"`
+	Duration   string            `json:"duration,omitempty"`
+	Entrypoint string            `json:"entrypoint"`
+	Finished   *time.Time        `json:"finished,omitempty"`
+	Id         string            `json:"id"`
+	Mode       string            `json:"mode"`
+	ModSetHash string            `json:"modSetHash,omitempty"`
+	Mods       int               `json:"mods"`
+	Outcome    string            `json:"outcome"`
+	Reason     string            `json:"reason,omitempty"`
+	SptVersion string            `json:"sptVersion"`
+	Started    time.Time         `json:"started"`
+}
+
+// runHistoryLock serializes access to the on-disk run history
+var runHistoryLock sync.Mutex
+
+// Returns the path to the run history
+func getRunHistoryPath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "run-history.json")
+}
+
+// Loads the runs recorded in the run history - oldest first.
+// Returns an empty list if the run history does not exist.
+// Returns an error if the run history cannot be read or parsed.
+func LoadRunHistory(ctx context.Context) ([]RunRecord, error) {
+	records := []RunRecord{}
+	data, err := os.ReadFile(getRunHistoryPath(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", getRunHistoryPath(ctx), err)
+	}
+	return records, nil
+}
+
+// Modifies the on-disk run history while holding [runHistoryLock] - keeping only the most recent runs (see [runHistoryLimit]).
+// The run history is written to a temporary file and renamed into place so that a crash never leaves a partially written history.
+// Returns an error if the run history cannot be read or written.
+func updateRunHistory(ctx context.Context, update func(records []RunRecord) []RunRecord) error {
+	runHistoryLock.Lock()
+	defer runHistoryLock.Unlock()
+	records, err := LoadRunHistory(ctx)
+	if err != nil {
+		return err
+	}
+	records = update(records)
+	if len(records) > runHistoryLimit {
+		records = records[len(records)-runHistoryLimit:]
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(getRunHistoryPath(ctx), data)
+}
+
+// Modifies the record of the current run (see [GetRunId]) in the run history - failures are logged rather than stopping the entrypoint.
+func updateRunRecord(ctx context.Context, update func(record *RunRecord)) {
+	err := updateRunHistory(ctx, func(records []RunRecord) []RunRecord {
+		for index := range records {
+			if records[index].Id == GetRunId() {
+				update(&records[index])
+			}
+		}
+		return records
+	})
+	if err != nil {
+		helper.Logger(ctx).Warn("write run history failed", "error", err.Error())
+	}
+}
+
+// Records the set of installed mods in a run record - their number, a hash identifying them and the checksum of each downloaded archive.
+func setRunRecordMods(record *RunRecord, installed InstalledMods) {
+	names := helper.Map[string, InstalledMod](installed).Keys()
+	slices.Sort(names)
+	digest := sha256.New()
+	archives := map[string]string{}
+	for _, name := range names {
+		installedMod := installed[name]
+		fmt.Fprintf(digest, "%s\x00%s\x00%s\x00%s\n", name, installedMod.Version, installedMod.Url, installedMod.ArchiveChecksum)
+		if installedMod.ArchiveChecksum != "" && !isLocalMod(installedMod.Mod) {
+			archives[installedMod.Url] = installedMod.ArchiveChecksum
+		}
+	}
+	record.Archives = archives
+	record.ModSetHash = hex.EncodeToString(digest.Sum(nil))[:12]
+	record.Mods = len(names)
+}
+
+// Records the set of installed mods (see [setRunRecordMods]) in the record of the current run.
+// Called once the server is about to launch - so that runs interrupted while the server runs record the mods they ran with.
+func RecordRunMods(ctx context.Context) {
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		helper.Logger(ctx).Warn("record installed mods failed", "error", err.Error())
+		return
+	}
+	updateRunRecord(ctx, func(record *RunRecord) {
+		setRunRecordMods(record, installed)
+	})
+}
+
+// Runs a function while recording it as a run in the run history (in the data directory).
+// Runs recorded as running by previous entrypoints (e.g., killed alongside their container) are marked as interrupted.
+// Failures to write the run history are logged rather than stopping the entrypoint.
+// Returns an error if the function fails.
+func RecordRunWhile(ctx context.Context, config EntrypointConfig, run func() error) error {
+	record := RunRecord{
+		Entrypoint: strings.TrimSpace(helper.Version(ctx)),
+		Id:         GetRunId(),
+		Mode:       config.Mode,
+		Outcome:    runOutcomeRunning,
+		SptVersion: config.SptVersion,
+		Started:    clock.Get(ctx).Now(),
+	}
+	err := updateRunHistory(ctx, func(records []RunRecord) []RunRecord {
+		for index := range records {
+			if records[index].Outcome == runOutcomeRunning {
+				helper.Logger(ctx).Warn("previous run was interrupted", "run", records[index].Id, "started", records[index].Started)
+				records[index].Outcome = runOutcomeInterrupted
+				records[index].Reason = "the entrypoint stopped without recording an outcome (e.g., it was killed)"
+			}
+		}
+		return append(records, record)
+	})
+	if err != nil {
+		helper.Logger(ctx).Warn("write run history failed", "error", err.Error())
+	}
+
+	runErr := run()
+	finished := clock.Get(ctx).Now()
+	installed, installedErr := LoadInstalledMods(ctx)
+	updateRunRecord(ctx, func(record *RunRecord) {
+		record.Duration = finished.Sub(record.Started).Round(time.Second).String()
+		record.Finished = &finished
+		record.Outcome = runOutcomeSucceeded
+		if installedErr == nil {
+			setRunRecordMods(record, installed)
+		}
+		if runErr != nil {
+			record.Outcome = runOutcomeFailed
+			record.Reason = runErr.Error()
+			if len(record.Reason) > runHistoryReasonLimit {
+				record.Reason = record.Reason[:runHistoryReasonLimit] + "..."
+			}
+		}
+	})
+	return runErr
+}
+
+// Returns the most recent runs of the run history with the given outcome.
+// An empty outcome matches every run, and a limit of zero or less returns every run.
+func filterRunHistory(records []RunRecord, outcome string, limit int) []RunRecord {
+	filtered := []RunRecord{}
+	for _, record := range records {
+		if outcome == "" || record.Outcome == outcome {
+			filtered = append(filtered, record)
+		}
+	}
+	if limit > 0 && len(filtered) > limit {
+		filtered = filtered[len(filtered)-limit:]
+	}
+	return filtered
+}
+
+// Prints the runs recorded in the run history (see [RecordRunWhile]) - oldest first, at most count of the most recent runs (default: 20).
+// If the most recent runs failed, the run that started the streak of failures is reported - answering when the server started failing.
+// Returns an error if the run history cannot be read.
+func History(ctx context.Context, args ...string) error {
+	usage := fmt.Errorf("usage: history [count]")
+	if len(args) > 1 {
+		return usage
+	}
+	count := 20
+	if len(args) == 1 {
+		var err error
+		count, err = strconv.Atoi(args[0])
+		if err != nil || count <= 0 {
+			return usage
+		}
+	}
+	records, err := LoadRunHistory(ctx)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "RUN\tSTARTED\tMODE\tENTRYPOINT\tSPT\tMODS\tOUTCOME\tDURATION\tREASON")
+	for _, record := range filterRunHistory(records, "", count) {
+		mode := record.Mode
+		if mode == "" {
+			mode = "default"
+		}
+		mods := "-"
+		if record.ModSetHash != "" {
+			mods = fmt.Sprintf("%d (%s)", record.Mods, record.ModSetHash)
+		}
+		duration := record.Duration
+		if duration == "" {
+			duration = "-"
+		}
+		reason := strings.ReplaceAll(record.Reason, "\n", " ")
+		if len(reason) > 80 {
+			reason = reason[:77] + "..."
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", record.Id, record.Started.Format(time.RFC3339), mode, record.Entrypoint, record.SptVersion, mods, record.Outcome, duration, reason)
+	}
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	failures := 0
+	for index := len(records) - 1; index >= 0; index-- {
+		if records[index].Outcome == runOutcomeSucceeded || records[index].Outcome == runOutcomeRunning {
+			break
+		}
+		failures += 1
+	}
+	if failures > 0 {
+		first := records[len(records)-failures]
+		fmt.Fprintf(os.Stdout, "\nthe last %d run(s) failed or were interrupted - starting with run %s at %s\n", failures, first.Id, first.Started.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// HooksConfig is loaded from the environment and configures the hook scripts run while installing mods
+type HooksConfig struct {
+	Dir string `env:"HOOKS_DIR" envDefault:"/hooks"`
+}
+
+// hookEvents are the events hook scripts can be run for - each event's scripts live in the '<event>.d' directory of the hooks directory
+var hookEvents = []string{"post-mod-install", "pre-mod-install"}
+
+// Returns the executable hook scripts of an event - sorted by name.
+// Hidden files, directories and files that aren't executable are skipped.
+// Returns an error if the event's directory exists but cannot be read.
+func getHookScripts(ctx context.Context, dir string, event string) ([]string, error) {
+	eventDir := filepath.Join(dir, fmt.Sprintf("%s.d", event))
+	entries, err := os.ReadDir(eventDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	scripts := []string{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(eventDir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode()&0111 == 0 {
+			helper.Logger(ctx).Warn("hook script not executable - skipping", "path", path)
+			continue
+		}
+		scripts = append(scripts, path)
+	}
+	slices.Sort(scripts)
+	return scripts, nil
+}
+
+// Runs the hook scripts of a mod installation event (see [hookEvents]) in order from within the spt path.
+// Scripts receive HOOK_EVENT, MOD_NAME, MOD_URL, MOD_VERSION and SPT_DIR.
+// 'pre-mod-install' scripts of downloaded mods also receive MOD_STAGING_DIR.
+// Returns an error if the event is unknown.
+// Returns an error if a hook script fails.
+func RunModHooks(ctx context.Context, event string, mod Mod, staging string) error {
+	if !slices.Contains(hookEvents, event) {
+		return fmt.Errorf("unknown hook event %s", event)
+	}
+	config := HooksConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	if config.Dir == "" {
+		return nil
+	}
+	scripts, err := getHookScripts(ctx, config.Dir, event)
+	if err != nil {
+		return err
+	}
+	if len(scripts) == 0 {
+		return nil
+	}
+	sptDir, err := filepath.Abs(helper.Dirs(ctx)["spt"])
+	if err != nil {
+		return err
+	}
+	env := append(os.Environ(),
+		fmt.Sprintf("HOOK_EVENT=%s", event),
+		fmt.Sprintf("MOD_NAME=%s", mod.Name),
+		fmt.Sprintf("MOD_STAGING_DIR=%s", staging),
+		fmt.Sprintf("MOD_URL=%s", mod.Url),
+		fmt.Sprintf("MOD_VERSION=%s", mod.Version),
+		fmt.Sprintf("SPT_DIR=%s", sptDir),
+	)
+	for _, script := range scripts {
+		helper.Logger(ctx).Info("run hook", "event", event, "mod", mod.Name, "script", script)
+		_, err := helper.Command(ctx, []string{script}, helper.CmdOpts{Attach: true, Cwd: sptDir, Env: env}).Run()
+		if err != nil {
+			return fmt.Errorf("%s hook %s failed for mod %s: %w", event, script, mod.Name, err)
+		}
+	}
+	return nil
+}
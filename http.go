@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/download"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+)
+
+func init() {
+	download.HeaderFuncs = append(download.HeaderFuncs, getGithubDownloadHeaders)
+	download.Downloaders["gs"] = downloadGcsObject
+	download.Downloaders["s3"] = downloadS3Object
+}
+
+// Performs a POST request with a form-encoded body against a JSON API and unmarshals the response into the provided struct pointer.
+// Returns an error if the request fails.
+// Returns an error if the response has a non-200 status code.
+// Returns an error if the response is not JSON encoded.
+func PostFormJson(ctx context.Context, url string, form url.Values, data any) error {
+	helper.Logger(ctx).Info("post form", "url", url)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := outbound.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return &download.StatusError{Method: http.MethodPost, StatusCode: response.StatusCode, Url: url}
+	}
+	return json.NewDecoder(response.Body).Decode(data)
+}
+
+// Performs a POST request with a JSON-encoded body (e.g., against a webhook).
+// The response body is discarded.
+// Returns an error if the request fails.
+// Returns an error if the response has a non-2xx status code.
+func PostJson(ctx context.Context, url string, data any) error {
+	helper.Logger(ctx).Info("post json", "url", url)
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := outbound.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return &download.StatusError{Method: http.MethodPost, StatusCode: response.StatusCode, Url: url}
+	}
+	return nil
+}
+
+// Performs a GET request against a JSON API and unmarshals the response into the provided struct pointer.
+// Returns an error if the request fails.
+// Returns an error if the response has a non-200 status code.
+// Returns an error if the response is not JSON encoded.
+func GetJson(ctx context.Context, url string, headers map[string]string, data any) error {
+	helper.Logger(ctx).Info("get json", "url", url)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	response, err := outbound.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return &download.StatusError{Method: http.MethodGet, StatusCode: response.StatusCode, Url: url}
+	}
+	return json.NewDecoder(response.Body).Decode(data)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/jobs"
+	"golang.org/x/mod/semver"
+)
+
+// imageInfoModDir is the directory (beneath user/mods) of the generated image info server mod
+const imageInfoModDir = "docker-image-info"
+
+//go:embed imageinfo.js
+var imageInfoModScript string
+
+// ImageInfoMod is a single installed mod listed by the image info mod
+type ImageInfoMod struct {
+	Disabled bool   `json:"disabled,omitempty"`
+	Name     string `json:"name"`
+	Url      string `json:"url"`
+	Version  string `json:"version,omitempty"`
+}
+
+// ImageInfoJob is a single scheduled job listed by the image info mod
+type ImageInfoJob struct {
+	Name     string    `json:"name"`
+	NextRun  time.Time `json:"nextRun"`
+	Schedule string    `json:"schedule"`
+}
+
+// ImageInfo is the information exposed to the server by the image info mod (info.json)
+type ImageInfo struct {
+	Branding struct {
+		Description string `json:"description"`
+		Motd        string `json:"motd"`
+		Name        string `json:"name"`
+	} `json:"branding"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Image       struct {
+		Version string `json:"version"`
+	} `json:"image"`
+	Jobs  []ImageInfoJob `json:"jobs"`
+	Mods  []ImageInfoMod `json:"mods"`
+	RunId string         `json:"runId"`
+	Spt   struct {
+		Version string `json:"version"`
+	} `json:"spt"`
+}
+
+// Collects the image info exposed by the image info mod.
+// Returns an error if the branding cannot be parsed.
+// Returns an error if the installed mods cannot be read.
+// Returns an error if the jobs cannot be determined.
+func getImageInfo(ctx context.Context, config EntrypointConfig) (ImageInfo, error) {
+	now := clock.Get(ctx).Now()
+	info := ImageInfo{GeneratedAt: now, Jobs: []ImageInfoJob{}, Mods: []ImageInfoMod{}, RunId: config.RunId}
+	info.Image.Version = strings.TrimSpace(helper.Version(ctx))
+	info.Spt.Version = config.SptVersion
+
+	branding := BrandingConfig{}
+	err := helper.ParseEnv(ctx, &branding)
+	if err != nil {
+		return info, err
+	}
+	info.Branding.Description = branding.Description
+	info.Branding.Motd = branding.Motd
+	info.Branding.Name = branding.Name
+
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return info, err
+	}
+	for name, installedMod := range installed {
+		info.Mods = append(info.Mods, ImageInfoMod{
+			Disabled: slices.Contains(config.ModsDisabled, name),
+			Name:     name,
+			Url:      installedMod.Url,
+			Version:  installedMod.Version,
+		})
+	}
+	slices.SortFunc(info.Mods, func(a ImageInfoMod, b ImageInfoMod) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	entrypointJobs, err := GetJobs(ctx, config)
+	if err != nil {
+		return info, err
+	}
+	for _, job := range entrypointJobs {
+		next, err := jobs.Next(ctx, job, now)
+		if err != nil {
+			return info, err
+		}
+		if next.IsZero() {
+			continue
+		}
+		info.Jobs = append(info.Jobs, ImageInfoJob{Name: job.Name, NextRun: next, Schedule: job.Schedule})
+	}
+	return info, nil
+}
+
+// Generates the image info server mod (user/mods/docker-image-info).
+// The mod exposes the image info (see [ImageInfo]) in the server log and at the '/docker-image-info' route.
+// The mod also sends the message of the day (SERVER_MOTD) to players as they start a game.
+// The mod is regenerated on every start so that it stays in sync - and is removed if IMAGE_INFO_MOD is disabled.
+// Returns an error if the image info cannot be collected.
+// Returns an error if the mod cannot be written.
+func WriteImageInfoMod(ctx context.Context, config EntrypointConfig) error {
+	dir := filepath.Join(getServerModsDir(ctx), imageInfoModDir)
+	if !config.ImageInfoMod {
+		return os.RemoveAll(dir)
+	}
+	info, err := getImageInfo(ctx, config)
+	if err != nil {
+		return err
+	}
+	// spt requires a valid semantic version (without build metadata)
+	version := semver.Canonical(fmt.Sprintf("v%s", info.Image.Version))
+	if version == "" {
+		version = "v0.0.0"
+	}
+	modPackage := map[string]any{
+		"author":     "benfiola",
+		"main":       "mod.js",
+		"name":       imageInfoModDir,
+		"sptVersion": "*",
+		"version":    strings.TrimPrefix(version, "v"),
+	}
+	files := map[string]any{"info.json": info, "package.json": modPackage}
+	for name, value := range files {
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = fsutil.WriteFileAtomic(filepath.Join(dir, name), data)
+		if err != nil {
+			return err
+		}
+	}
+	helper.Logger(ctx).Info("write image info mod", "path", dir, "mods", len(info.Mods), "jobs", len(info.Jobs))
+	return fsutil.WriteFileAtomic(filepath.Join(dir, "mod.js"), []byte(imageInfoModScript))
+}
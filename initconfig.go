@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// fikaServerSpec is the mod spec used to install the Fika server mod when requested during [InitConfig]
+const fikaServerSpec = "github:project-fika/Fika-Server"
+
+// prompter asks questions over a reader/writer pair (typically stdin/stderr)
+type prompter struct {
+	reader *bufio.Reader
+	writer io.Writer
+}
+
+// Asks a question and returns the (trimmed) answer - or the default if the answer is blank.
+// Returns an error if reading the answer fails.
+func (p *prompter) ask(question string, def string) (string, error) {
+	if def != "" {
+		question = fmt.Sprintf("%s [%s]", question, def)
+	}
+	fmt.Fprintf(p.writer, "%s: ", question)
+	answer, err := p.reader.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && answer != "") {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		answer = def
+	}
+	return answer, nil
+}
+
+// Asks a yes/no question.
+// Returns an error if reading the answer fails.
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	defAnswer := "y/N"
+	if def {
+		defAnswer = "Y/n"
+	}
+	for {
+		answer, err := p.ask(fmt.Sprintf("%s (%s)", question, defAnswer), "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(p.writer, "please answer 'y' or 'n'")
+	}
+}
+
+// Asks for a list of values - one per line, terminated by a blank line.
+// Returns an error if reading an answer fails.
+func (p *prompter) askList(question string) ([]string, error) {
+	fmt.Fprintf(p.writer, "%s (one per line, blank line to finish)\n", question)
+	values := []string{}
+	for {
+		answer, err := p.ask(">", "")
+		if err != nil {
+			return nil, err
+		}
+		if answer == "" {
+			return values, nil
+		}
+		values = append(values, answer)
+	}
+}
+
+// Returns the newest SPT version that the image ships patch files for - or an empty string if none are found.
+func getNewestPatchVersion(ctx context.Context) string {
+	patchFiles, err := FindPatchFiles(ctx, "0.0.0")
+	if err != nil || len(patchFiles) == 0 {
+		return ""
+	}
+	match := regexp.MustCompile(`spt-(.+)\.patch$`).FindStringSubmatch(patchFiles[len(patchFiles)-1])
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// Writes a file, refusing to overwrite an existing file.
+// Returns an error if the file exists or cannot be written.
+func writeNewFile(ctx context.Context, path string, write func(writer io.Writer) error) error {
+	handle, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	helper.Logger(ctx).Info("write file", "path", path)
+	return write(handle)
+}
+
+// Interactively asks a first-time self-hoster a handful of questions and writes a complete configuration.
+// Writes an env file (spt.env), a mod manifest (mods.yaml) and a docker-compose.yaml to the output directory (default: current directory).
+// Returns an error if reading answers fails.
+// Returns an error if any output file already exists.
+func InitConfig(ctx context.Context, args ...string) error {
+	outputDir := "."
+	if len(args) > 1 {
+		return fmt.Errorf("usage: init-config [output-dir]")
+	}
+	if len(args) == 1 {
+		outputDir = args[0]
+	}
+
+	p := prompter{reader: bufio.NewReader(os.Stdin), writer: os.Stderr}
+	sptVersion, err := p.ask("SPT version", getNewestPatchVersion(ctx))
+	if err != nil {
+		return err
+	}
+	if sptVersion == "" {
+		return fmt.Errorf("spt version required")
+	}
+	cacheEnabled, err := p.confirm("Enable the file cache (recommended)", true)
+	if err != nil {
+		return err
+	}
+	fika, err := p.confirm("Install Fika (multiplayer)", false)
+	if err != nil {
+		return err
+	}
+	modUrls, err := p.askList("Mods to install (urls, forge:name@version or github:owner/repo@tag)")
+	if err != nil {
+		return err
+	}
+	if fika {
+		modUrls = append([]string{fikaServerSpec}, modUrls...)
+	}
+	mods, err := GetModsFromUrls(modUrls...)
+	if err != nil {
+		return err
+	}
+
+	env := [][2]string{
+		{"SPT_VERSION", sptVersion},
+		{"CACHE_ENABLED", fmt.Sprintf("%t", cacheEnabled)},
+		{"MOD_MANIFEST", "/config/mods.yaml"},
+	}
+
+	err = helper.CreateDirs(ctx, outputDir)
+	if err != nil {
+		return err
+	}
+	err = writeNewFile(ctx, filepath.Join(outputDir, "spt.env"), func(writer io.Writer) error {
+		for _, item := range env {
+			_, err := fmt.Fprintf(writer, "%s=%s\n", item[0], item[1])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = writeNewFile(ctx, filepath.Join(outputDir, "mods.yaml"), func(writer io.Writer) error {
+		return writeYaml(writer, ModManifest{Mods: mods})
+	})
+	if err != nil {
+		return err
+	}
+	err = writeNewFile(ctx, filepath.Join(outputDir, "docker-compose.yaml"), func(writer io.Writer) error {
+		document, service := newComposeDocument(ctx, 6969)
+		service["env_file"] = []string{"./spt.env"}
+		service["volumes"] = append(service["volumes"].([]string), "./mods.yaml:/config/mods.yaml:ro")
+		return writeYaml(writer, document)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "configuration written to %s - start the server with 'docker compose up -d'\n", outputDir)
+	return nil
+}
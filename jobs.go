@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/console"
+	"github.com/benfiola/single-player-tarkov/pkg/jobs"
+)
+
+// JobConfig overrides the schedule (and jitter) of a job
+type JobConfig struct {
+	Jitter   string `json:"jitter,omitempty"`
+	Schedule string `json:"schedule"`
+}
+
+// JobsConfig is a map of job name -> [JobConfig]
+type JobsConfig map[string]JobConfig
+
+// Parses a string into a [JobsConfig] object - validating jitters and schedules.
+// Used to parse settings from the environment.
+func (jc *JobsConfig) UnmarshalText(data []byte) error {
+	parsed := map[string]JobConfig{}
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return err
+	}
+	for name, jobConfig := range parsed {
+		if jobConfig.Schedule != "" {
+			_, err := jobs.ParseSchedule(jobConfig.Schedule)
+			if err != nil {
+				return fmt.Errorf("job %s: %w", name, err)
+			}
+		}
+		if jobConfig.Jitter != "" {
+			_, err := time.ParseDuration(jobConfig.Jitter)
+			if err != nil {
+				return fmt.Errorf("job %s: invalid jitter %s", name, jobConfig.Jitter)
+			}
+		}
+	}
+	*jc = JobsConfig(parsed)
+	return nil
+}
+
+// Returns the jobs run by the entrypoint.
+// Schedules (and jitters) are overridden by the JOBS setting - an empty schedule only runs the job on demand.
+// Returns an error if the JOBS setting references an unknown job.
+func GetJobs(ctx context.Context, config EntrypointConfig) (jobs.Jobs, error) {
+	entrypointJobs := console.SequenceJobs(config.ConsoleSequences)
+
+	storage, err := NewStorage(ctx, config.StorageUrl)
+	if err != nil {
+		return nil, err
+	}
+	if storage != nil {
+		entrypointJobs = append(entrypointJobs, jobs.Job{
+			Name: "storage-push",
+			Run: func(ctx context.Context) error {
+				return PushStorage(ctx, storage)
+			},
+			Schedule: config.StorageInterval.String(),
+		})
+	}
+
+	entrypointJobs = append(entrypointJobs, jobs.Job{
+		Name: "check-updates",
+		Run: func(ctx context.Context) error {
+			_, err := ReportModUpdates(ctx, config)
+			return err
+		},
+	})
+
+	entrypointJobs = append(entrypointJobs, jobs.Job{
+		Name: "mod-license-report",
+		Run:  WriteModLicenseReport,
+	})
+
+	entrypointJobs = append(entrypointJobs, jobs.Job{
+		Name:     "log-cleanup",
+		Run:      CleanupLogs,
+		Schedule: "1h",
+	})
+
+	for name, jobConfig := range config.Jobs {
+		job := entrypointJobs.Get(name)
+		if job == nil {
+			return nil, fmt.Errorf("unknown job %s", name)
+		}
+		jitter, _ := time.ParseDuration(jobConfig.Jitter)
+		job.Jitter = jitter
+		job.Schedule = jobConfig.Schedule
+	}
+	return entrypointJobs, nil
+}
+
+// Lists the entrypoint's jobs (see [GetJobs]) and their most recent runs - or runs a job immediately.
+// Jobs run immediately are locked like scheduled runs - a job already running (e.g., in the entrypoint) is not run again.
+// Returns an error if the command or job is unknown.
+// Returns an error if the job fails.
+func Jobs(ctx context.Context, args ...string) error {
+	usage := fmt.Errorf("usage: jobs list | jobs run-now <name>")
+	if len(args) == 0 {
+		return usage
+	}
+	config := EntrypointConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	entrypointJobs, err := GetJobs(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAME\tSCHEDULE\tNEXT RUN\tLAST RUN\tDURATION\tERROR")
+		for _, job := range entrypointJobs {
+			next, err := jobs.Next(ctx, job, clock.Get(ctx).Now())
+			if err != nil {
+				return err
+			}
+			state, err := jobs.LoadState(ctx, job.Name)
+			if err != nil {
+				return err
+			}
+			schedule, nextRun, lastRun, duration, runErr := "(on demand)", "-", "-", "-", ""
+			if job.Schedule != "" {
+				schedule = job.Schedule
+				nextRun = next.Format(time.RFC3339)
+			}
+			if state != nil {
+				lastRun = state.LastRun.Local().Format(time.RFC3339)
+				duration = state.Duration.Round(time.Millisecond).String()
+				runErr = state.Error
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", job.Name, schedule, nextRun, lastRun, duration, runErr)
+		}
+		return writer.Flush()
+	case args[0] == "run-now" && len(args) == 2:
+		job := entrypointJobs.Get(args[1])
+		if job == nil {
+			return fmt.Errorf("unknown job %s", args[1])
+		}
+		return jobs.Run(ctx, *job)
+	default:
+		return usage
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/google/uuid"
+)
+
+// JournalEntry records the intent to perform a multi-step mutating operation.
+// An entry is removed from the journal once its operation completes - entries found on start belong to interrupted operations.
+type JournalEntry struct {
+	Data      json.RawMessage `json:"data"`
+	Id        string          `json:"id"`
+	Operation string          `json:"operation"`
+	RunId     string          `json:"runId,omitempty"`
+	Started   time.Time       `json:"started"`
+}
+
+// journalRecoverFunc restores a consistent state after an operation (described by its journaled data) was interrupted
+type journalRecoverFunc func(ctx context.Context, data json.RawMessage) error
+
+// journalRecoverFuncs maps journaled operations to the function that recovers them when interrupted.
+// Populated in init to avoid an initialization cycle with the operations themselves.
+var journalRecoverFuncs = map[string]journalRecoverFunc{}
+
+func init() {
+	journalRecoverFuncs["install-mod"] = recoverInstallMod
+	journalRecoverFuncs["install-spt"] = recoverInstallSpt
+	journalRecoverFuncs["remove-mod"] = recoverRemoveMod
+}
+
+// journalLock serializes access to the on-disk journal
+var journalLock sync.Mutex
+
+// Returns the path to the on-disk journal.
+func getJournalPath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], ".journal.json")
+}
+
+// Loads all entries from the on-disk journal.
+// Returns an error if the journal exists but cannot be read.
+func loadJournal(ctx context.Context) ([]JournalEntry, error) {
+	entries := []JournalEntry{}
+	data, err := os.ReadFile(getJournalPath(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
+
+// Persists all entries to the on-disk journal.
+// The journal is written to a temporary file and renamed into place so that a crash never leaves a partially written journal.
+func saveJournal(ctx context.Context, entries []JournalEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(getJournalPath(ctx), data)
+}
+
+// Modifies the on-disk journal while holding [journalLock].
+func updateJournal(ctx context.Context, update func(entries []JournalEntry) []JournalEntry) error {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	entries, err := loadJournal(ctx)
+	if err != nil {
+		return err
+	}
+	return saveJournal(ctx, update(entries))
+}
+
+// Runs a multi-step mutating operation, recording its intent in the journal beforehand and its completion afterwards.
+// If the operation fails (or the process dies), its entry remains in the journal and is recovered by [RecoverJournal] on the next start.
+// Returns an error if the journal cannot be updated.
+// Returns an error if the operation fails.
+func Journaled(ctx context.Context, operation string, data any, run func() error) error {
+	_, ok := journalRecoverFuncs[operation]
+	if !ok {
+		return fmt.Errorf("journaled operation %s has no recovery function", operation)
+	}
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	entry := JournalEntry{Data: dataBytes, Id: uuid.NewString(), Operation: operation, RunId: GetRunId(), Started: clock.Get(ctx).Now()}
+	err = updateJournal(ctx, func(entries []JournalEntry) []JournalEntry {
+		return append(entries, entry)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = run()
+	if err != nil {
+		return err
+	}
+
+	return updateJournal(ctx, func(entries []JournalEntry) []JournalEntry {
+		remaining := []JournalEntry{}
+		for _, current := range entries {
+			if current.Id != entry.Id {
+				remaining = append(remaining, current)
+			}
+		}
+		return remaining
+	})
+}
+
+// Recovers all operations left incomplete in the journal (i.e., interrupted by a crash or failure) - in the order they were started.
+// Entries are removed from the journal once recovered.
+// Returns an error if an entry has an unknown operation.
+// Returns an error if recovery fails.
+func RecoverJournal(ctx context.Context) error {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	entries, err := loadJournal(ctx)
+	if err != nil {
+		return err
+	}
+	for len(entries) > 0 {
+		entry := entries[0]
+		recoverFunc, ok := journalRecoverFuncs[entry.Operation]
+		if !ok {
+			return fmt.Errorf("journal entry %s has unknown operation %s", entry.Id, entry.Operation)
+		}
+		helper.Logger(ctx).Warn("recover interrupted operation", "operation", entry.Operation, "run", entry.RunId, "started", entry.Started, "data", string(entry.Data))
+		err = recoverFunc(ctx, entry.Data)
+		if err != nil {
+			return err
+		}
+		entries = entries[1:]
+		err = saveJournal(ctx, entries)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// LoadtestConfig is loaded from the environment and configures the load test
+type LoadtestConfig struct {
+	Concurrency int           `env:"LOADTEST_CONCURRENCY" envDefault:"10"`
+	Duration    time.Duration `env:"LOADTEST_DURATION" envDefault:"30s"`
+	Requests    string        `env:"LOADTEST_REQUESTS"`
+	Timeout     time.Duration `env:"LOADTEST_TIMEOUT" envDefault:"10s"`
+}
+
+// LoadtestRequest is a backend request replayed by the load test - requests are picked at random, proportionally to their weight
+type LoadtestRequest struct {
+	Body    any               `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	Path    string            `json:"path"`
+	Weight  int               `json:"weight,omitempty"`
+}
+
+// defaultLoadtestRequests mimic the requests made by the launcher while players browse the server - none of which require a session
+var defaultLoadtestRequests = []LoadtestRequest{
+	{Path: "/launcher/ping", Weight: 4},
+	{Path: "/launcher/server/connect", Weight: 2},
+	{Path: "/launcher/server/version", Weight: 2},
+	{Path: "/launcher/profiles", Weight: 1},
+	{Path: "/launcher/server/loadedServerMods", Weight: 1},
+}
+
+// loadtestSample is the outcome of a single request made by the load test
+type loadtestSample struct {
+	Error   bool
+	Latency time.Duration
+	Path    string
+}
+
+// Loads the requests replayed by the load test from a json file (a list of [LoadtestRequest]) - or returns the default requests if no file is given.
+// Returns an error if the file cannot be parsed or a request lacks a path.
+func loadLoadtestRequests(path string) ([]LoadtestRequest, error) {
+	if path == "" {
+		return defaultLoadtestRequests, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	requests := []LoadtestRequest{}
+	err = json.Unmarshal(data, &requests)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("%s lists no requests", path)
+	}
+	for index, request := range requests {
+		if !strings.HasPrefix(request.Path, "/") {
+			return nil, fmt.Errorf("%s: request %d has an invalid path %q", path, index, request.Path)
+		}
+	}
+	return requests, nil
+}
+
+// Returns the body of a request as sent by the game and launcher - zlib compressed json.
+// Returns an error if the body cannot be encoded.
+func encodeLoadtestBody(body any) ([]byte, error) {
+	if body == nil {
+		body = map[string]any{}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	buffer := bytes.Buffer{}
+	writer := zlib.NewWriter(&buffer)
+	_, err = writer.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	return buffer.Bytes(), err
+}
+
+// Picks the index of a request at random - proportionally to the requests' weights (which default to 1).
+func pickLoadtestRequest(requests []LoadtestRequest) int {
+	total := 0
+	for _, request := range requests {
+		total += max(request.Weight, 1)
+	}
+	pick := rand.IntN(total)
+	for index, request := range requests {
+		pick -= max(request.Weight, 1)
+		if pick < 0 {
+			return index
+		}
+	}
+	return len(requests) - 1
+}
+
+// Sends a single load test request and measures its latency, including the transfer of the response.
+// Requests fail if they cannot be sent or the server responds with an error status.
+func sendLoadtestRequest(ctx context.Context, client *http.Client, baseUrl string, request LoadtestRequest, body []byte) loadtestSample {
+	sample := loadtestSample{Path: request.Path}
+	method := request.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, method, baseUrl+request.Path, bytes.NewReader(body))
+	if err != nil {
+		sample.Error = true
+		return sample
+	}
+	for key, value := range request.Headers {
+		httpRequest.Header.Set(key, value)
+	}
+	start := time.Now()
+	response, err := client.Do(httpRequest)
+	if err == nil {
+		_, err = io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+	}
+	sample.Latency = time.Since(start)
+	sample.Error = err != nil || response.StatusCode >= 400
+	return sample
+}
+
+// Returns the latency at the given percentile (0-100) of a sorted list of latencies - using the nearest-rank method.
+func latencyPercentile(latencies []time.Duration, percentile float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	rank := int(float64(len(latencies))*percentile/100+0.5) - 1
+	return latencies[min(max(rank, 0), len(latencies)-1)]
+}
+
+// Writes a load test report - the latency percentiles of every request path and of all requests.
+func writeLoadtestReport(writer io.Writer, samples []loadtestSample, elapsed time.Duration) {
+	byPath := map[string][]loadtestSample{}
+	for _, sample := range samples {
+		byPath[sample.Path] = append(byPath[sample.Path], sample)
+	}
+	paths := helper.Map[string, []loadtestSample](byPath).Keys()
+	slices.Sort(paths)
+	paths = append(paths, "total")
+	byPath["total"] = samples
+
+	table := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "PATH\tREQUESTS\tERRORS\tP50\tP90\tP99\tMAX")
+	for _, path := range paths {
+		latencies := []time.Duration{}
+		failed := 0
+		for _, sample := range byPath[path] {
+			if sample.Error {
+				failed += 1
+				continue
+			}
+			latencies = append(latencies, sample.Latency)
+		}
+		slices.Sort(latencies)
+		fmt.Fprintf(table, "%s\t%d\t%d", path, len(byPath[path]), failed)
+		for _, percentile := range []float64{50, 90, 99, 100} {
+			if len(latencies) == 0 {
+				fmt.Fprint(table, "\t-")
+				continue
+			}
+			fmt.Fprintf(table, "\t%s", latencyPercentile(latencies, percentile).Round(100*time.Microsecond))
+		}
+		fmt.Fprintln(table)
+	}
+	table.Flush()
+	fmt.Fprintf(writer, "\n%d requests in %s (%.1f requests/s)\n", len(samples), elapsed.Round(time.Millisecond), float64(len(samples))/max(elapsed.Seconds(), 0.001))
+}
+
+// Runs a load test against a running server by replaying backend requests with concurrent clients.
+// Reports latency percentiles once LOADTEST_DURATION has elapsed.
+// The server defaults to the local server's backend port - its self-signed certificate is accepted.
+// The test stops early (and reports) when interrupted.
+// Returns an error if the arguments are invalid or the requests cannot be loaded.
+func Loadtest(ctx context.Context, args ...string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: loadtest [url]")
+	}
+	config := LoadtestConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	if config.Concurrency < 1 {
+		return fmt.Errorf("invalid load test concurrency %d", config.Concurrency)
+	}
+	requests, err := loadLoadtestRequests(config.Requests)
+	if err != nil {
+		return err
+	}
+	bodies := make([][]byte, len(requests))
+	for index, request := range requests {
+		bodies[index], err = encodeLoadtestBody(request.Body)
+		if err != nil {
+			return err
+		}
+	}
+	baseUrl := ""
+	if len(args) == 1 {
+		baseUrl = strings.TrimSuffix(args[0], "/")
+	} else {
+		entrypointConfig := EntrypointConfig{}
+		err = helper.ParseEnv(ctx, &entrypointConfig)
+		if err != nil {
+			return err
+		}
+		baseUrl = fmt.Sprintf("https://127.0.0.1:%d", getServerPort(entrypointConfig))
+	}
+
+	// the load test targets a server chosen by the operator (rather than the internet) - and spt serves a self-signed certificate
+	client := &http.Client{
+		Timeout: config.Timeout,
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: config.Concurrency,
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, config.Duration)
+	defer cancel()
+
+	helper.Logger(ctx).Info("run load test", "url", baseUrl, "concurrency", config.Concurrency, "duration", config.Duration, "requests", len(requests))
+	samples := []loadtestSample{}
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	start := time.Now()
+	for range config.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				index := pickLoadtestRequest(requests)
+				sample := sendLoadtestRequest(ctx, client, baseUrl, requests[index], bodies[index])
+				if ctx.Err() != nil {
+					// requests interrupted by the end of the test are not counted
+					return
+				}
+				lock.Lock()
+				samples = append(samples, sample)
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	writeLoadtestReport(os.Stdout, samples, time.Since(start))
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/limits"
+)
+
+// LogCleanupConfig is loaded from the environment and configures the cleanup of files spt writes without bounds (see [CleanupLogs])
+type LogCleanupConfig struct {
+	MaxAge  time.Duration `env:"LOG_CLEANUP_MAX_AGE" envDefault:"168h"`
+	MaxSize string        `env:"LOG_CLEANUP_MAX_SIZE" envDefault:"1G"`
+	Paths   []string      `env:"LOG_CLEANUP_PATHS" envDefault:"user/logs"`
+}
+
+// LogCleanupState records the files managed by the log cleanup (see [CleanupLogs])
+type LogCleanupState struct {
+	Bytes        int64     `json:"bytes"`
+	Files        int       `json:"files"`
+	LastRun      time.Time `json:"lastRun"`
+	RemovedBytes int64     `json:"removedBytes"`
+	RemovedFiles int       `json:"removedFiles"`
+}
+
+// Returns the path to the log cleanup state (see [LogCleanupState])
+func getLogCleanupStatePath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "log-cleanup.json")
+}
+
+// Loads the log cleanup state.
+// Returns an empty state if the log cleanup has never run.
+// Returns an error if the state exists but cannot be read.
+func LoadLogCleanupState(ctx context.Context) (LogCleanupState, error) {
+	state := LogCleanupState{}
+	data, err := os.ReadFile(getLogCleanupStatePath(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// logCleanupFile is a file managed by the log cleanup
+type logCleanupFile struct {
+	info fs.FileInfo
+	path string
+}
+
+// Collects the regular files beneath the managed paths (relative to the spt path), excluding the per-mod logs.
+// Returns an error if a path escapes the spt path.
+// Returns an error if a path cannot be walked.
+func getLogCleanupFiles(ctx context.Context, paths []string) ([]logCleanupFile, error) {
+	files := []logCleanupFile{}
+	for _, relPath := range paths {
+		if !filepath.IsLocal(relPath) {
+			return nil, fmt.Errorf("invalid LOG_CLEANUP_PATHS entry %s (expected a path relative to the spt directory)", relPath)
+		}
+		root := filepath.Join(helper.Dirs(ctx)["spt"], relPath)
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if errors.Is(err, os.ErrNotExist) && path == root {
+				return filepath.SkipDir
+			}
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() && path == getModLogsDir(ctx) {
+				return filepath.SkipDir
+			}
+			if !entry.Type().IsRegular() {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			files = append(files, logCleanupFile{info: info, path: path})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Removes the files within LOG_CLEANUP_PATHS older than LOG_CLEANUP_MAX_AGE.
+// Afterwards, the oldest files are removed until the remaining files fit within LOG_CLEANUP_MAX_SIZE.
+// The most recently modified file of each directory (i.e., the log spt is currently writing) is never removed to satisfy the size cap.
+// The remaining and removed files are recorded in the log cleanup state (see [LogCleanupState]).
+// Returns an error if the configuration is invalid.
+// Returns an error if files cannot be listed or removed.
+func CleanupLogs(ctx context.Context) error {
+	config := LogCleanupConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	maxSize := int64(0)
+	if config.MaxSize != "" && config.MaxSize != "0" {
+		maxSize, err = limits.ParseMemory(config.MaxSize)
+		if err != nil {
+			return fmt.Errorf("invalid LOG_CLEANUP_MAX_SIZE: %w", err)
+		}
+	}
+	files, err := getLogCleanupFiles(ctx, config.Paths)
+	if err != nil {
+		return err
+	}
+	// files are ordered newest first so that the oldest files are removed first
+	slices.SortFunc(files, func(a logCleanupFile, b logCleanupFile) int {
+		return b.info.ModTime().Compare(a.info.ModTime())
+	})
+
+	now := clock.Get(ctx).Now()
+	active := map[string]bool{}
+	total := int64(0)
+	remove := []logCleanupFile{}
+	for _, file := range files {
+		dir := filepath.Dir(file.path)
+		isActive := !active[dir]
+		active[dir] = true
+		if config.MaxAge > 0 && now.Sub(file.info.ModTime()) > config.MaxAge {
+			remove = append(remove, file)
+			continue
+		}
+		if maxSize > 0 && !isActive && total+file.info.Size() > maxSize {
+			remove = append(remove, file)
+			continue
+		}
+		total += file.info.Size()
+	}
+
+	state, err := LoadLogCleanupState(ctx)
+	if err != nil {
+		return err
+	}
+	for _, file := range remove {
+		helper.Logger(ctx).Info("remove log", "path", file.path, "size", file.info.Size(), "modified", file.info.ModTime().Format(time.RFC3339))
+		err = os.Remove(file.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		state.RemovedBytes += file.info.Size()
+		state.RemovedFiles += 1
+	}
+	state.Bytes = total
+	state.Files = len(files) - len(remove)
+	state.LastRun = now
+	helper.Logger(ctx).Info("cleaned up logs", "removed", len(remove), "remaining", state.Files, "size", total)
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(getLogCleanupStatePath(ctx), data)
+}
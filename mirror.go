@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/download"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+)
+
+// mirrorNameRegexp matches the names files are mirrored under
+var mirrorNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// MirrorFiles is a map of name -> the upstream url of a file served by the mirror (see [mirror])
+type MirrorFiles map[string]string
+
+// Parses a string into a [MirrorFiles] object - validating names and urls.
+// Used to parse settings from the environment.
+func (mf *MirrorFiles) UnmarshalText(data []byte) error {
+	parsed := map[string]string{}
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return err
+	}
+	for name, upstream := range parsed {
+		if !mirrorNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid mirror name %s (expected a plain file name)", name)
+		}
+		parsedUrl, err := url.Parse(upstream)
+		if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Host == "" {
+			return fmt.Errorf("mirror %s: invalid url %s (expected an http(s) url)", name, upstream)
+		}
+	}
+	*mf = MirrorFiles(parsed)
+	return nil
+}
+
+// MirrorConfig is loaded from the environment and configures the files served by the mirror (see [mirror])
+type MirrorConfig struct {
+	Files MirrorFiles `env:"MIRROR_FILES"`
+}
+
+// mirroredFile records the upstream url a mirrored file was fetched from - so that it's re-fetched once its url changes
+type mirroredFile struct {
+	Fetched time.Time `json:"fetched"`
+	Size    int64     `json:"size"`
+	Url     string    `json:"url"`
+}
+
+// mirror is a read-through mirror of large client-side downloads (e.g., client mod bundles)
+type mirror struct {
+	ctx      context.Context
+	fetching map[string]*sync.Mutex
+	files    MirrorFiles
+	lock     sync.Mutex
+}
+
+// Creates a mirror serving the configured files
+func newMirror(ctx context.Context, files MirrorFiles) *mirror {
+	return &mirror{ctx: ctx, fetching: map[string]*sync.Mutex{}, files: files}
+}
+
+// Returns the directory holding mirrored files.
+// The directory is hidden, so that mirrored files aren't synced with storage (see [listStorableFiles]).
+func getMirrorDir(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], ".mirror")
+}
+
+// Returns the path to the record of mirrored files (see [mirroredFile])
+func getMirrorStatePath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], ".mirror.json")
+}
+
+// Loads the record of mirrored files - keyed by name.
+// Returns an error if the record exists but cannot be read.
+func loadMirrorState(ctx context.Context) (map[string]mirroredFile, error) {
+	state := map[string]mirroredFile{}
+	data, err := os.ReadFile(getMirrorStatePath(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// Returns the lock serializing fetches of a mirrored file - so that concurrent requests for a file that isn't mirrored yet share a single fetch
+func (m *mirror) getFetchLock(name string) *sync.Mutex {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	lock, ok := m.fetching[name]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.fetching[name] = lock
+	}
+	return lock
+}
+
+// Fetches a file from upstream into the mirror, unless it was already fetched from its current url.
+// Files of names no longer configured are removed from the mirror.
+// Returns the path to the mirrored file.
+// Returns an error if the file cannot be fetched.
+// Returns an error if the record of mirrored files cannot be read or written.
+func (m *mirror) fetch(name string) (string, error) {
+	lock := m.getFetchLock(name)
+	lock.Lock()
+	defer lock.Unlock()
+	path := filepath.Join(getMirrorDir(m.ctx), name)
+	state, err := loadMirrorState(m.ctx)
+	if err != nil {
+		return "", err
+	}
+	file, ok := state[name]
+	_, statErr := os.Stat(path)
+	if ok && file.Url == m.files[name] && statErr == nil {
+		return path, nil
+	}
+
+	helper.Logger(m.ctx).Info("mirror file", "name", name, "url", m.files[name])
+	err = os.MkdirAll(getMirrorDir(m.ctx), 0755)
+	if err != nil {
+		return "", err
+	}
+	// files are downloaded to a hidden temporary file and renamed into place so that a partial file is never served
+	temp := filepath.Join(getMirrorDir(m.ctx), fmt.Sprintf(".%s.download", name))
+	err = download.Download(outbound.Declare(m.ctx, fmt.Sprintf("mirror %s", name)), m.files[name], temp)
+	if err != nil {
+		os.Remove(temp)
+		return "", err
+	}
+	info, err := os.Stat(temp)
+	if err == nil {
+		err = os.Rename(temp, path)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	state, err = loadMirrorState(m.ctx)
+	if err != nil {
+		return "", err
+	}
+	state[name] = mirroredFile{Fetched: clock.Get(m.ctx).Now(), Size: info.Size(), Url: m.files[name]}
+	for stale := range state {
+		_, ok := m.files[stale]
+		if ok {
+			continue
+		}
+		helper.Logger(m.ctx).Info("remove mirrored file", "name", stale)
+		err = os.RemoveAll(filepath.Join(getMirrorDir(m.ctx), stale))
+		if err != nil {
+			return "", err
+		}
+		delete(state, stale)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, fsutil.WriteFileAtomic(getMirrorStatePath(m.ctx), data)
+}
+
+// Handles 'GET /mirror/{name}' - serving a mirrored file (with support for range requests).
+// The file is fetched from upstream first if it isn't mirrored yet.
+// The mirror is unauthenticated - so that players can download from it without the admin token.
+func (m *mirror) serve(writer http.ResponseWriter, request *http.Request) {
+	name := request.PathValue("name")
+	_, ok := m.files[name]
+	if !ok {
+		http.Error(writer, fmt.Sprintf("unknown mirrored file %s", name), http.StatusNotFound)
+		return
+	}
+	path, err := m.fetch(name)
+	if err != nil {
+		helper.Logger(m.ctx).Error("mirror file failed", "name", name, "error", err.Error())
+		http.Error(writer, fmt.Sprintf("mirror %s failed - see the server logs", name), http.StatusBadGateway)
+		return
+	}
+	handle, err := os.Open(path)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer handle.Close()
+	info, err := handle.Stat()
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helper.Logger(m.ctx).Info("mirror request", "name", name, "range", request.Header.Get("Range"), "remote", request.RemoteAddr)
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(writer, request, name, info.ModTime(), handle)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/download"
+)
+
+func init() {
+	download.HeaderFuncs = append(download.HeaderFuncs, getModAuthHeaders)
+}
+
+// ModAuth is a map of host (e.g., 'mods.example.com') or url prefix (e.g., 'https://example.com/private/') -> headers attached to matching downloads
+type ModAuth map[string]map[string]string
+
+// Parses a string into a [ModAuth] object.
+// Used to parse settings from the environment.
+func (ma *ModAuth) UnmarshalText(data []byte) error {
+	parsed := map[string]map[string]string{}
+	err := json.Unmarshal(data, &parsed)
+	*ma = ModAuth(parsed)
+	return err
+}
+
+// Determines whether a [ModAuth] key (a host or url prefix) matches a download url
+func matchModAuth(key string, downloadUrl *url.URL) bool {
+	if strings.Contains(key, "://") {
+		return strings.HasPrefix(downloadUrl.String(), key)
+	}
+	return downloadUrl.Host == key || downloadUrl.Hostname() == key
+}
+
+// ModAuthConfig is loaded from the environment and configures headers attached to mod downloads
+type ModAuthConfig struct {
+	Auth ModAuth `env:"MOD_AUTH"`
+}
+
+// Attaches the headers configured for matching hosts and url prefixes (see [ModAuth]) to downloads.
+// When several keys match, headers from longer (i.e., more specific) keys take precedence.
+// Implements [download.HeaderFunc].
+func getModAuthHeaders(ctx context.Context, downloadUrl *url.URL) (map[string]string, error) {
+	config := ModAuthConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return nil, err
+	}
+	keys := helper.Map[string, map[string]string](config.Auth).Keys()
+	slices.SortFunc(keys, func(a string, b string) int {
+		return len(a) - len(b)
+	})
+	headers := map[string]string{}
+	for _, key := range keys {
+		if !matchModAuth(key, downloadUrl) {
+			continue
+		}
+		for name, value := range config.Auth[key] {
+			headers[name] = value
+		}
+	}
+	return headers, nil
+}
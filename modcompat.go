@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// ModCompat is the compatibility of an installed server mod with the SPT version - as declared by the mod's package.json
+type ModCompat struct {
+	Constraint string
+	Dir        string
+	Problem    string
+	Version    string
+}
+
+// Checks the declared SPT version range (`sptVersion`, or `akiVersion` for older mods) of every installed server mod against the SPT version.
+// Mods that don't declare a range are assumed compatible.
+// Returns the compatibility of every mod - sorted by directory. Incompatible mods (and mods whose range cannot be parsed) have a problem.
+func CheckModCompat(sptVersion string, packages []ModPackage) []ModCompat {
+	compats := []ModCompat{}
+	for _, modPackage := range packages {
+		compat := ModCompat{Constraint: modPackage.getSptVersion(), Dir: modPackage.Dir, Version: modPackage.Version}
+		if compat.Constraint != "" {
+			ok, err := satisfiesConstraint(sptVersion, compat.Constraint)
+			if err != nil {
+				compat.Problem = err.Error()
+			} else if !ok {
+				compat.Problem = fmt.Sprintf("requires spt %s", compat.Constraint)
+			}
+		}
+		compats = append(compats, compat)
+	}
+	slices.SortFunc(compats, func(a ModCompat, b ModCompat) int {
+		return strings.Compare(a.Dir, b.Dir)
+	})
+	return compats
+}
+
+// Verifies that installed server mods are compatible with the SPT version (see [CheckModCompat]) - logging a report of every mod's compatibility.
+// When policy is 'warn', incompatible mods are logged and setup continues.
+// Returns an error if the policy is unknown.
+// Returns an error if the policy is 'strict' (the default) and incompatible mods are found.
+func VerifyModCompat(ctx context.Context, sptVersion string, policy string) error {
+	if policy != "" && policy != "strict" && policy != "warn" {
+		return fmt.Errorf("unknown mod compatibility policy %s", policy)
+	}
+	packages, err := LoadModPackages(ctx)
+	if err != nil {
+		return err
+	}
+	incompatible := []string{}
+	for _, compat := range CheckModCompat(sptVersion, packages) {
+		switch {
+		case compat.Problem != "":
+			helper.Logger(ctx).Warn("mod incompatible with spt", "mod", compat.Dir, "version", compat.Version, "spt", sptVersion, "problem", compat.Problem)
+			incompatible = append(incompatible, fmt.Sprintf("%s (%s)", compat.Dir, compat.Problem))
+		case compat.Constraint == "":
+			helper.Logger(ctx).Info("mod compatibility undeclared", "mod", compat.Dir, "version", compat.Version)
+		default:
+			helper.Logger(ctx).Info("mod compatible with spt", "mod", compat.Dir, "version", compat.Version, "constraint", compat.Constraint)
+		}
+	}
+	if len(incompatible) == 0 || policy == "warn" {
+		return nil
+	}
+	return &UserError{
+		Hint:    "pick mod versions compatible with SPT_VERSION (or an SPT_VERSION compatible with the mods), disable the mods (see MODS_DISABLED), or set MOD_COMPAT=warn to start anyway",
+		Message: fmt.Sprintf("%d mod(s) incompatible with spt %s: %s", len(incompatible), sptVersion, strings.Join(incompatible, ", ")),
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+
+	"github.com/Masterminds/semver/v3"
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// ModPackage holds the fields of a server mod's package.json relevant to dependency resolution
+type ModPackage struct {
+	AkiVersion      string            `json:"akiVersion"`
+	Author          string            `json:"author"`
+	Dir             string            `json:"-"`
+	License         string            `json:"license"`
+	ModDependencies map[string]string `json:"modDependencies"`
+	Name            string            `json:"name"`
+	SptVersion      string            `json:"sptVersion"`
+	Version         string            `json:"version"`
+}
+
+// Returns the SPT version constraint of the mod - falling back to the constraint used by mods written for older (AKI) releases.
+func (mp ModPackage) getSptVersion() string {
+	if mp.SptVersion != "" {
+		return mp.SptVersion
+	}
+	return mp.AkiVersion
+}
+
+// Loads the package.json of every server mod installed to the spt user/mods directory.
+// Mod directories without a package.json are skipped.
+// Returns an error if a package.json cannot be parsed.
+func LoadModPackages(ctx context.Context) ([]ModPackage, error) {
+	return loadModPackagesFrom(filepath.Join(helper.Dirs(ctx)["spt"], "user", "mods"))
+}
+
+// Loads the package.json of every server mod within the given mods directory (see [LoadModPackages]).
+// Returns an error if a package.json cannot be parsed.
+func loadModPackagesFrom(modsDir string) ([]ModPackage, error) {
+	entries, err := os.ReadDir(modsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []ModPackage{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	packages := []ModPackage{}
+	for _, entry := range entries {
+		path := filepath.Join(modsDir, entry.Name(), "package.json")
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		modPackage := ModPackage{}
+		err = json.Unmarshal(data, &modPackage)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		modPackage.Dir = entry.Name()
+		packages = append(packages, modPackage)
+	}
+	return packages, nil
+}
+
+// Determines whether a version satisfies a (npm-style) version constraint.
+// Returns an error if either the version or the constraint cannot be parsed.
+func satisfiesConstraint(version string, constraint string) (bool, error) {
+	parsedVersion, err := semver.NewVersion(version)
+	if err != nil {
+		return false, fmt.Errorf("invalid version %s: %w", version, err)
+	}
+	parsedConstraint, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false, fmt.Errorf("invalid version constraint %s: %w", constraint, err)
+	}
+	return parsedConstraint.Check(parsedVersion), nil
+}
+
+// Checks installed server mods against each other's declared dependencies.
+// Dependencies are matched by package name (or 'author-name', as used by SPT).
+// SPT version constraints are checked separately (see [CheckModCompat]).
+// Returns a (sorted) list of problems - empty if all constraints are satisfied.
+func CheckModDependencies(packages []ModPackage) []string {
+	installed := map[string]ModPackage{}
+	for _, modPackage := range packages {
+		installed[modPackage.Name] = modPackage
+		installed[fmt.Sprintf("%s-%s", modPackage.Author, modPackage.Name)] = modPackage
+	}
+
+	problems := []string{}
+	for _, modPackage := range packages {
+		for name, constraint := range modPackage.ModDependencies {
+			dependency, ok := installed[name]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("mod %s requires mod %s %s (not installed)", modPackage.Dir, name, constraint))
+				continue
+			}
+			ok, err := satisfiesConstraint(dependency.Version, constraint)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("mod %s: dependency %s: %s", modPackage.Dir, name, err))
+			} else if !ok {
+				problems = append(problems, fmt.Sprintf("mod %s requires mod %s %s (have %s)", modPackage.Dir, name, constraint, dependency.Version))
+			}
+		}
+	}
+	slices.Sort(problems)
+	return problems
+}
+
+// Verifies that the mod dependencies of installed server mods are installed.
+// When policy is 'warn', problems are logged and setup continues.
+// Returns an error if the policy is unknown.
+// Returns an error if the policy is 'strict' (the default) and problems are found.
+func VerifyModDependencies(ctx context.Context, policy string) error {
+	if policy != "" && policy != "strict" && policy != "warn" {
+		return fmt.Errorf("unknown mod dependency policy %s", policy)
+	}
+	packages, err := LoadModPackages(ctx)
+	if err != nil {
+		return err
+	}
+	problems := CheckModDependencies(packages)
+	for _, problem := range problems {
+		helper.Logger(ctx).Warn("mod dependency problem", "problem", problem)
+	}
+	if len(problems) == 0 || policy == "warn" {
+		return nil
+	}
+	return &UserError{
+		Hint:    "install the missing mods, pick mod versions compatible with each other, or set MOD_DEPENDENCIES=warn to start anyway",
+		Message: fmt.Sprintf("%d mod dependency problem(s) found (first: %s)", len(problems), problems[0]),
+	}
+}
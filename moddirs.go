@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// modDirScheme is the mod url scheme referencing a local directory whose contents are server mods (e.g., 'dir:/mods')
+const modDirScheme = "dir"
+
+// Determines whether a mod references a local directory (see [modDirScheme])
+func isModDir(mod Mod) bool {
+	return strings.HasPrefix(mod.Url, fmt.Sprintf("%s:", modDirScheme))
+}
+
+// Converts a list of local directories (i.e., from the environment) into a list of [Mod] objects.
+// When link is true, the contents of each directory are symlinked (rather than copied) into the spt path.
+// Returns an error if a directory is not an absolute path.
+func GetModsFromDirs(link bool, dirs ...string) ([]Mod, error) {
+	mods := []Mod{}
+	for _, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("mod dir %s must be an absolute path", dir)
+		}
+		modUrl := fmt.Sprintf("%s:%s", modDirScheme, filepath.Clean(dir))
+		mods = append(mods, Mod{Link: link, Name: getModName(modUrl), Url: modUrl})
+	}
+	return mods, nil
+}
+
+// Installs the contents of a local mod directory into the spt user/mods directory - each child of the directory being a server mod.
+// Children are symlinked if the mod is linked, and copied otherwise.
+// Raises an error if the directory cannot be read.
+// Raises an error if a child cannot be symlinked or copied.
+func installModDir(ctx context.Context, mod Mod) (InstalledMod, error) {
+	_, dir, _ := strings.Cut(mod.Url, ":")
+	modsDir := filepath.Join(helper.Dirs(ctx)["spt"], "user", "mods")
+	installed := InstalledMod{Mod: mod, Files: []string{}}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return installed, err
+	}
+
+	if !mod.Link {
+		// symlinks from a previously linked installation would otherwise be copied through - overwriting the linked directory's own files
+		for _, entry := range entries {
+			dest := filepath.Join(modsDir, entry.Name())
+			info, err := os.Lstat(dest)
+			if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+				err = os.Remove(dest)
+				if err != nil {
+					return installed, err
+				}
+			}
+		}
+		files, err := fsutil.CopyTree(ctx, dir, modsDir)
+		if err != nil {
+			return installed, err
+		}
+		for _, file := range files {
+			installed.Files = append(installed.Files, filepath.Join("user", "mods", file))
+		}
+		return installed, nil
+	}
+
+	err = os.MkdirAll(modsDir, 0755)
+	if err != nil {
+		return installed, err
+	}
+	for _, entry := range entries {
+		src := filepath.Join(dir, entry.Name())
+		dest := filepath.Join(modsDir, entry.Name())
+		helper.Logger(ctx).Info("symlink mod", "src", src, "dest", dest)
+		err := os.RemoveAll(dest)
+		if err != nil {
+			return installed, err
+		}
+		err = os.Symlink(src, dest)
+		if err != nil {
+			return installed, err
+		}
+		installed.Files = append(installed.Files, filepath.Join("user", "mods", entry.Name()))
+	}
+	return installed, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// ModInventoryEntry is a server mod or client plugin present in the spt path
+type ModInventoryEntry struct {
+	Checksum string `json:"checksum"`
+	Kind     string `json:"kind"`
+	Mod      string `json:"mod,omitempty"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Source   string `json:"source"`
+	Version  string `json:"version,omitempty"`
+}
+
+// Returns the path to the mod inventory (see [WriteModInventory])
+func getModInventoryPath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "mod-inventory.json")
+}
+
+// Returns the installed mod owning a path (relative to the spt path) - i.e., the mod that installed the path or files beneath it.
+// Returns false if no installed mod owns the path.
+func getPathOwner(installed InstalledMods, path string) (InstalledMod, bool) {
+	for _, installedMod := range installed {
+		for _, file := range installedMod.Files {
+			if file == path || strings.HasPrefix(file, path+string(filepath.Separator)) {
+				return installedMod, true
+			}
+		}
+	}
+	return InstalledMod{}, false
+}
+
+// Determines whether a path (relative to the spt path) is - or contains - a file of the spt build (see [CoreManifest]).
+func isCorePath(manifest CoreManifest, path string) bool {
+	for file := range manifest {
+		if file == path || strings.HasPrefix(file, path+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Collects the mod inventory - every entry beneath user/mods and BepInEx/plugins, alongside its version, checksum (see [fsutil.HashTree]) and source.
+// The source is the url of the installed mod owning the entry - or 'spt', 'entrypoint' or 'unknown'.
+// Server mods are named after their package.json, and client plugins after their file.
+// Returns an error if the installed mods or the core manifest cannot be read.
+// Returns an error if an entry cannot be read.
+func GetModInventory(ctx context.Context) ([]ModInventoryEntry, error) {
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := LoadCoreManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	packages, err := LoadModPackages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	packagesByDir := map[string]ModPackage{}
+	for _, modPackage := range packages {
+		packagesByDir[modPackage.Dir] = modPackage
+	}
+
+	sptDir := helper.Dirs(ctx)["spt"]
+	inventory := []ModInventoryEntry{}
+	for _, kind := range []string{"server", "client"} {
+		dir := filepath.Join("user", "mods")
+		if kind == "client" {
+			dir = filepath.Join("BepInEx", "plugins")
+		}
+		entries, err := os.ReadDir(filepath.Join(sptDir, dir))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			info, err := os.Stat(filepath.Join(sptDir, path))
+			if errors.Is(err, os.ErrNotExist) {
+				// a dangling symlink (e.g., to a mod directory that is no longer mounted)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if kind == "server" && !info.IsDir() {
+				// files beside server mods (e.g., order.json) aren't mods
+				continue
+			}
+			inventoryEntry := ModInventoryEntry{Kind: kind, Name: strings.TrimSuffix(entry.Name(), ".dll"), Path: path, Source: "unknown"}
+			owner, owned := getPathOwner(installed, path)
+			switch {
+			case owned:
+				inventoryEntry.Mod = owner.Name
+				inventoryEntry.Source = owner.Url
+				inventoryEntry.Version = owner.Version
+			case isCorePath(manifest, path):
+				inventoryEntry.Source = "spt"
+			case kind == "server" && entry.Name() == imageInfoModDir:
+				inventoryEntry.Source = "entrypoint"
+			}
+			modPackage, ok := packagesByDir[entry.Name()]
+			if kind == "server" && ok {
+				inventoryEntry.Name = modPackage.Name
+				inventoryEntry.Version = modPackage.Version
+			}
+			inventoryEntry.Checksum, err = fsutil.HashTree(filepath.Join(sptDir, path))
+			if err != nil {
+				return nil, err
+			}
+			inventory = append(inventory, inventoryEntry)
+		}
+	}
+	return inventory, nil
+}
+
+// Logs the mod inventory (see [GetModInventory]) and writes it to the data directory (mod-inventory.json).
+// Returns an error if the inventory cannot be collected or written.
+func WriteModInventory(ctx context.Context) error {
+	inventory, err := GetModInventory(ctx)
+	if err != nil {
+		return err
+	}
+	for _, entry := range inventory {
+		helper.Logger(ctx).Info("mod inventory", "kind", entry.Kind, "name", entry.Name, "version", entry.Version, "source", entry.Source, "checksum", entry.Checksum, "path", entry.Path)
+	}
+	data, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := getModInventoryPath(ctx)
+	helper.Logger(ctx).Info("write mod inventory", "path", path, "count", len(inventory))
+	return fsutil.WriteFileAtomic(path, data)
+}
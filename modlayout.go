@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// modLayoutJunk are archive entries ignored when detecting the layout of an extracted mod archive
+var modLayoutJunk = []string{"__MACOSX", ".DS_Store", "Thumbs.db"}
+
+// modLayoutRootDirs are directories that only appear at the root of the spt server directory - archives containing them are installed as-is
+var modLayoutRootDirs = []string{"BepInEx", "SPT_Data", "user"}
+
+// modLayoutBepInExDirs are directories that only appear within the BepInEx directory
+var modLayoutBepInExDirs = []string{"config", "patchers", "plugins"}
+
+// modArchiveExts are archive file extensions stripped from a mod's name when naming its server mod directory
+var modArchiveExts = []string{".7z", ".gz", ".rar", ".tar", ".tgz", ".txz", ".xz", ".zip"}
+
+// Returns the name of the server mod directory created for an archive with a server mod at its root
+func getModLayoutName(mod Mod) string {
+	name := mod.Name
+	for containsFold(modArchiveExts, filepath.Ext(name)) && filepath.Ext(name) != name {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name
+}
+
+// Determines whether a list contains a name (case-insensitively)
+func containsFold(names []string, name string) bool {
+	return slices.ContainsFunc(names, func(current string) bool {
+		return strings.EqualFold(current, name)
+	})
+}
+
+// Lists the directories and files within an extracted archive directory - ignoring junk (see [modLayoutJunk]).
+// Returns an error if the directory cannot be read.
+func listModLayout(dir string) ([]string, []string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	dirs := []string{}
+	files := []string{}
+	for _, entry := range entries {
+		if containsFold(modLayoutJunk, entry.Name()) {
+			continue
+		}
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		} else {
+			files = append(files, entry.Name())
+		}
+	}
+	return dirs, files, nil
+}
+
+// Determines whether a directory is a server mod (i.e., contains a package.json)
+func isServerModDir(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "package.json"))
+	return err == nil
+}
+
+// Relocates the contents of an extracted mod archive (the staging directory) into the spt server directory structure.
+// Handles wrapping top-level directories, server mods at the root or side-by-side, 'mods' directories and BepInEx client plugins.
+// Wrapping directories are descended into until a recognized layout is found - unrecognized layouts are left unchanged (and logged).
+// Returns an error if the staging directory cannot be read or relocated.
+func NormalizeModLayout(ctx context.Context, name string, staging string) error {
+	root := staging
+	// moves maps paths within the staging directory to their destination relative to the normalized staging directory
+	moves := map[string]string{}
+	for len(moves) == 0 {
+		dirs, files, err := listModLayout(root)
+		if err != nil {
+			return err
+		}
+		serverMods := []string{}
+		for _, dir := range dirs {
+			if isServerModDir(filepath.Join(root, dir)) {
+				serverMods = append(serverMods, dir)
+			}
+		}
+		dlls := slices.ContainsFunc(files, func(file string) bool {
+			return strings.EqualFold(filepath.Ext(file), ".dll")
+		})
+		switch {
+		case slices.ContainsFunc(dirs, func(dir string) bool { return containsFold(modLayoutRootDirs, dir) }):
+			moves[root] = "."
+		case slices.Contains(files, "package.json"):
+			moves[root] = filepath.Join("user", "mods", name)
+		case containsFold(dirs, "mods") && len(dirs) == 1:
+			moves[filepath.Join(root, dirs[0])] = filepath.Join("user", "mods")
+		case slices.ContainsFunc(dirs, func(dir string) bool { return containsFold(modLayoutBepInExDirs, dir) }):
+			moves[root] = "BepInEx"
+		case len(serverMods) > 0:
+			for _, serverMod := range serverMods {
+				moves[filepath.Join(root, serverMod)] = filepath.Join("user", "mods", serverMod)
+			}
+		case dlls && len(dirs) == 0:
+			moves[root] = filepath.Join("BepInEx", "plugins")
+		case len(dirs) == 1:
+			// a wrapping directory - named after the mod it contains
+			root = filepath.Join(root, dirs[0])
+			name = dirs[0]
+		default:
+			helper.Logger(ctx).Warn("unrecognized mod archive layout - installing as-is", "mod", name)
+			return nil
+		}
+	}
+	if moves[staging] == "." {
+		return nil
+	}
+
+	normalized := staging + ".layout"
+	for src, dest := range moves {
+		helper.Logger(ctx).Info("relocate mod archive contents", "mod", name, "src", strings.TrimPrefix(src, staging), "dest", dest)
+		err := os.MkdirAll(filepath.Dir(filepath.Join(normalized, dest)), 0755)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(src, filepath.Join(normalized, dest))
+		if err != nil {
+			return err
+		}
+	}
+	err := os.RemoveAll(staging)
+	if err != nil {
+		return err
+	}
+	return os.Rename(normalized, staging)
+}
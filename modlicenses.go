@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// ModLicense is a single entry of the mod license report
+type ModLicense struct {
+	Author       string   `json:"author"`
+	Dir          string   `json:"dir"`
+	License      string   `json:"license"`
+	LicenseFiles []string `json:"licenseFiles"`
+	Name         string   `json:"name"`
+	Source       string   `json:"source"`
+	Version      string   `json:"version"`
+	Warning      string   `json:"warning,omitempty"`
+}
+
+// nonRedistributableLicenses are (lowercase) license values indicating that a mod may not be redistributed
+var nonRedistributableLicenses = []string{"all rights reserved", "proprietary", "unlicensed"}
+
+// Returns a warning if a license does not permit redistribution - or an empty string otherwise.
+// Mods without a license are treated as not redistributable, as no permission has been granted.
+func getLicenseWarning(license string) string {
+	normalized := strings.ToLower(strings.TrimSpace(license))
+	if normalized == "" {
+		return "no license declared - redistribution is not permitted by default"
+	}
+	if slices.Contains(nonRedistributableLicenses, normalized) {
+		return "license forbids redistribution"
+	}
+	if strings.HasPrefix(normalized, "see license in") {
+		return "custom license - review the license file before redistributing"
+	}
+	return ""
+}
+
+// Returns the source (i.e., the configured url) of the installed mod owning the given mod directory - or an empty string if unknown.
+func getModDirSource(installed InstalledMods, dir string) string {
+	installedMod, ok := getPathOwner(installed, filepath.Join("user", "mods", dir))
+	if !ok {
+		return ""
+	}
+	return installedMod.Url
+}
+
+// Collects license metadata from the package.json of every installed server mod.
+// Returns an error if installed mods cannot be read.
+func GetModLicenses(ctx context.Context) ([]ModLicense, error) {
+	packages, err := LoadModPackages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	licenses := []ModLicense{}
+	for _, modPackage := range packages {
+		if modPackage.Dir == imageInfoModDir {
+			// generated by the entrypoint (see [WriteImageInfoMod]) - never redistributed
+			continue
+		}
+		modDir := filepath.Join(helper.Dirs(ctx)["spt"], "user", "mods", modPackage.Dir)
+		licenseFiles := []string{}
+		entries, err := os.ReadDir(modDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := strings.ToLower(entry.Name())
+			if strings.HasPrefix(name, "license") || strings.HasPrefix(name, "licence") {
+				licenseFiles = append(licenseFiles, entry.Name())
+			}
+		}
+		licenses = append(licenses, ModLicense{
+			Author:       modPackage.Author,
+			Dir:          modPackage.Dir,
+			License:      modPackage.License,
+			LicenseFiles: licenseFiles,
+			Name:         modPackage.Name,
+			Source:       getModDirSource(installed, modPackage.Dir),
+			Version:      modPackage.Version,
+			Warning:      getLicenseWarning(modPackage.License),
+		})
+	}
+	return licenses, nil
+}
+
+// Writes a license and attribution report for installed server mods to the data directory (mod-licenses.json).
+// Mods whose license does not permit redistribution are logged as warnings.
+// Returns an error if licenses cannot be collected.
+// Returns an error if the report cannot be written.
+func WriteModLicenseReport(ctx context.Context) error {
+	licenses, err := GetModLicenses(ctx)
+	if err != nil {
+		return err
+	}
+	for _, license := range licenses {
+		if license.Warning != "" {
+			helper.Logger(ctx).Warn("mod may not be redistributable", "mod", license.Dir, "license", license.License, "reason", license.Warning)
+		}
+	}
+	data, err := json.MarshalIndent(licenses, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(helper.Dirs(ctx)["data"], "mod-licenses.json")
+	helper.Logger(ctx).Info("write mod license report", "path", path, "count", len(licenses))
+	return fsutil.WriteFileAtomic(path, data)
+}
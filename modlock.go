@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// LockedMod is a mod pinned by the mod lockfile - its configured source alongside what the source resolved to when installed
+type LockedMod struct {
+	Checksum string `json:"checksum,omitempty"`
+	Name     string `json:"name"`
+	Source   string `json:"source"`
+	Url      string `json:"url"`
+	Version  string `json:"version,omitempty"`
+}
+
+// ModLock is the mod lockfile - the exact set of mods installed by the last (non-frozen) reconciliation
+type ModLock struct {
+	Mods []LockedMod `json:"mods"`
+}
+
+// Returns the path to the mod lockfile
+func getModLockPath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "mods.lock")
+}
+
+// Determines whether a mod can be locked - local archives and mod directories are always installed as configured.
+func isLockableMod(mod Mod) bool {
+	return !isLocalMod(mod)
+}
+
+// Returns the locked form of an installed mod.
+// Git mods are pinned to their installed commit - all other mods to their resolved url and the checksum of their downloaded archive.
+func lockMod(source Mod, installedMod InstalledMod) LockedMod {
+	locked := LockedMod{
+		Checksum: installedMod.ArchiveChecksum,
+		Name:     source.Name,
+		Source:   source.Url,
+		Url:      installedMod.Url,
+		Version:  installedMod.Version,
+	}
+	if isGitMod(installedMod.Mod) {
+		repo, _ := parseGitModUrl(installedMod.Url)
+		locked.Url = fmt.Sprintf("git+%s@%s", repo, installedMod.Version)
+	}
+	return locked
+}
+
+// Loads the mod lockfile (a json document - see [ModLock]).
+// Returns an error if the lockfile does not exist or cannot be parsed.
+func LoadModLock(ctx context.Context) (ModLock, error) {
+	lock := ModLock{}
+	data, err := os.ReadFile(getModLockPath(ctx))
+	if err != nil {
+		return lock, err
+	}
+	err = json.Unmarshal(data, &lock)
+	if err != nil {
+		return lock, fmt.Errorf("parse %s: %w", getModLockPath(ctx), err)
+	}
+	return lock, nil
+}
+
+// Writes the mod lockfile from the installed versions of the configured mods (see [LockedMod]) - in the order the mods are configured.
+// Mods that aren't lockable (see [isLockableMod]) and mods that aren't installed are omitted.
+// Returns an error if the installed mods cannot be read.
+// Returns an error if the lockfile cannot be written.
+func WriteModLock(ctx context.Context, mods []Mod) error {
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return err
+	}
+	lock := ModLock{Mods: []LockedMod{}}
+	for _, mod := range mods {
+		installedMod, ok := installed[mod.Name]
+		if !isLockableMod(mod) || !ok {
+			continue
+		}
+		lockedMod := lockMod(mod, installedMod)
+		if lockedMod.Checksum == "" && !isGitMod(mod) {
+			// mods installed before archive checksums were recorded are locked without one until they're next downloaded
+			helper.Logger(ctx).Warn("locked mod has no checksum", "name", mod.Name)
+		}
+		lock.Mods = append(lock.Mods, lockedMod)
+	}
+	helper.Logger(ctx).Info("write mod lock", "path", getModLockPath(ctx), "mods", len(lock.Mods))
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(getModLockPath(ctx), data)
+}
+
+// Replaces the configured mods with their locked counterparts (see [WriteModLock]).
+// Headers and mirrors (as well as git mod build settings) are taken from the configured mod.
+// Mods that aren't lockable (see [isLockableMod]) are kept as configured.
+// Returns an error if the lockfile does not exist or cannot be read.
+// Returns an error if the configured mods differ from the locked mods.
+func LockMods(ctx context.Context, mods []Mod) ([]Mod, error) {
+	lock, err := LoadModLock(ctx)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, &UserError{
+			Cause:   err,
+			Hint:    fmt.Sprintf("start the server once without --frozen (or MODS_FROZEN) to generate %s - or copy it from another host", getModLockPath(ctx)),
+			Message: "frozen mod install requested but no mod lockfile exists",
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	locked := map[string]LockedMod{}
+	for _, lockedMod := range lock.Mods {
+		locked[lockedMod.Name] = lockedMod
+	}
+
+	problems := []string{}
+	configured := map[string]bool{}
+	frozen := []Mod{}
+	for _, mod := range mods {
+		if !isLockableMod(mod) {
+			frozen = append(frozen, mod)
+			continue
+		}
+		configured[mod.Name] = true
+		lockedMod, ok := locked[mod.Name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s is not locked", mod.Name))
+		case lockedMod.Source != mod.Url:
+			problems = append(problems, fmt.Sprintf("%s is configured as %s but locked as %s", mod.Name, mod.Url, lockedMod.Source))
+		default:
+			mod.Checksum = lockedMod.Checksum
+			mod.Url = lockedMod.Url
+			mod.Version = lockedMod.Version
+			frozen = append(frozen, mod)
+		}
+	}
+	for _, lockedMod := range lock.Mods {
+		if !configured[lockedMod.Name] {
+			problems = append(problems, fmt.Sprintf("%s is locked but not configured", lockedMod.Name))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &UserError{
+			Hint:    "update the mod configuration to match the lockfile - or start the server without --frozen (or MODS_FROZEN) to update the lockfile",
+			Message: fmt.Sprintf("configured mods differ from %s: %s", getModLockPath(ctx), strings.Join(problems, ", ")),
+		}
+	}
+	helper.Logger(ctx).Info("install locked mods", "path", getModLockPath(ctx), "mods", len(lock.Mods))
+	return frozen, nil
+}
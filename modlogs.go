@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/limits"
+)
+
+// ModLogsConfig is loaded from the environment and configures the per-mod server logs (see [SplitModLogsWhile])
+type ModLogsConfig struct {
+	Enabled   bool   `env:"MOD_LOGS" envDefault:"true"`
+	MaxSize   string `env:"MOD_LOGS_MAX_SIZE" envDefault:"10M"`
+	Rotations int    `env:"MOD_LOGS_ROTATIONS" envDefault:"3"`
+}
+
+// contextKey is the type of the context key used to store the [ModLogs]
+type contextKey string
+
+// modLogsLimit is the maximum number of mods given their own log - lines of further mods are only written to the console
+const modLogsLimit = 100
+
+// modLogLineLimit is the maximum length of a line split by mod - longer lines are truncated
+const modLogLineLimit = 64 * 1024
+
+// modLogPrefixRegexp matches the prefix spt (and mods through spt's logger) emit ahead of a mod's log lines - e.g., '[SAIN] ...'
+var modLogPrefixRegexp = regexp.MustCompile(`^\[([A-Za-z][^\[\]]{0,63})\]`)
+
+// ansiRegexp matches the ansi escape sequences spt colors its console output with - capturing the parameters of color sequences
+var ansiRegexp = regexp.MustCompile(`\x1b\[([0-9;]*)[A-Za-z]`)
+
+// unsafeFileNameRegexp matches characters replaced within the names of per-mod log files
+var unsafeFileNameRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// modLogLevels are the levels mod log lines are counted by (see [getModLogLevel])
+var modLogLevels = []string{"info", "warning", "error"}
+
+// Returns the directory holding the per-mod server logs - beside spt's own logs, so that they're included in support bundles
+func getModLogsDir(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["spt"], "user", "logs", "mods")
+}
+
+// Determines the level of a console line - from the color spt writes it in (red for errors, yellow for warnings), or from its text if it is uncolored.
+func getModLogLevel(line string) string {
+	for _, match := range ansiRegexp.FindAllStringSubmatch(line, -1) {
+		for _, param := range strings.Split(match[1], ";") {
+			switch param {
+			case "31", "41", "91":
+				return "error"
+			case "33", "93":
+				return "warning"
+			}
+		}
+	}
+	lower := strings.ToLower(line)
+	switch {
+	case strings.Contains(lower, "error") || strings.Contains(lower, "exception"):
+		return "error"
+	case strings.Contains(lower, "warn"):
+		return "warning"
+	}
+	return "info"
+}
+
+// rotatingFile is a log file rotated once it reaches a maximum size - keeping a number of rotations ('<name>.1' being the most recent)
+type rotatingFile struct {
+	handle    *os.File
+	maxSize   int64
+	path      string
+	rotations int
+	size      int64
+}
+
+// Opens a rotating file - appending to an existing file.
+// Returns an error if the file cannot be opened.
+func openRotatingFile(path string, maxSize int64, rotations int) (*rotatingFile, error) {
+	handle, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := handle.Stat()
+	if err != nil {
+		handle.Close()
+		return nil, err
+	}
+	return &rotatingFile{handle: handle, maxSize: maxSize, path: path, rotations: rotations, size: info.Size()}, nil
+}
+
+// Moves the file to its first rotation (shifting older rotations and discarding the oldest) and reopens it empty.
+// Returns an error if the file cannot be rotated.
+func (rf *rotatingFile) rotate() error {
+	err := rf.handle.Close()
+	if err != nil {
+		return err
+	}
+	for index := rf.rotations; index > 0; index-- {
+		src := rf.path
+		if index > 1 {
+			src = fmt.Sprintf("%s.%d", rf.path, index-1)
+		}
+		err := os.Rename(src, fmt.Sprintf("%s.%d", rf.path, index))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	rf.handle, err = os.OpenFile(rf.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	rf.size = 0
+	return err
+}
+
+// Writes data to the file - rotating the file beforehand if the data would exceed its maximum size.
+// Returns an error if the file cannot be rotated or written.
+func (rf *rotatingFile) Write(data []byte) (int, error) {
+	if rf.size > 0 && rf.size+int64(len(data)) > rf.maxSize {
+		err := rf.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	count, err := rf.handle.Write(data)
+	rf.size += int64(count)
+	return count, err
+}
+
+// ModLogs splits the server's console output by mod - writing each mod's lines to its own rotating file and counting them by level
+type ModLogs struct {
+	config   ModLogsConfig
+	counts   map[string]map[string]int64
+	ctx      context.Context
+	current  string
+	dir      string
+	files    map[string]*rotatingFile
+	limited  bool
+	maxSize  int64
+	mutex    sync.Mutex
+	watchers []*lineWatcher
+}
+
+// lineWatcher is notified (by closing its channel) of the first line of console output matching its pattern (see [ModLogs.WaitForLine])
+type lineWatcher struct {
+	matched chan struct{}
+	pattern *regexp.Regexp
+}
+
+// Returns the file of a mod's log - opening it on first use.
+// Returns nil if the mod's log cannot be opened or too many mods have logged (see [modLogsLimit]).
+func (ml *ModLogs) file(mod string) *rotatingFile {
+	file, ok := ml.files[mod]
+	if ok {
+		return file
+	}
+	if len(ml.files) >= modLogsLimit {
+		if !ml.limited {
+			helper.Logger(ml.ctx).Warn("too many mod logs - further mods are not split", "limit", modLogsLimit)
+			ml.limited = true
+		}
+		return nil
+	}
+	name := fmt.Sprintf("%s.log", unsafeFileNameRegexp.ReplaceAllString(mod, "_"))
+	file, err := openRotatingFile(filepath.Join(ml.dir, name), ml.maxSize, ml.config.Rotations)
+	if err != nil {
+		helper.Logger(ml.ctx).Warn("open mod log failed", "mod", mod, "error", err.Error())
+	}
+	ml.files[mod] = file
+	return file
+}
+
+// Handles a single line of console output.
+// Lines prefixed by a mod (see [modLogPrefixRegexp]) are written to the mod's log and counted.
+// Indented lines that follow (e.g., stack traces) are written to the same log.
+func (ml *ModLogs) handle(line string) {
+	plain := ansiRegexp.ReplaceAllString(line, "")
+	match := modLogPrefixRegexp.FindStringSubmatch(plain)
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	ml.watchers = slices.DeleteFunc(ml.watchers, func(watcher *lineWatcher) bool {
+		if !watcher.pattern.MatchString(plain) {
+			return false
+		}
+		close(watcher.matched)
+		return true
+	})
+	switch {
+	case match != nil:
+		ml.current = match[1]
+		if ml.counts[ml.current] == nil {
+			ml.counts[ml.current] = map[string]int64{}
+		}
+		ml.counts[ml.current][getModLogLevel(line)] += 1
+	case plain == "" || (!strings.HasPrefix(plain, " ") && !strings.HasPrefix(plain, "\t")):
+		ml.current = ""
+	}
+	if ml.current == "" {
+		return
+	}
+	file := ml.file(ml.current)
+	if file == nil {
+		return
+	}
+	_, err := file.Write([]byte(plain + "\n"))
+	if err != nil {
+		helper.Logger(ml.ctx).Warn("write mod log failed", "mod", ml.current, "error", err.Error())
+	}
+}
+
+// Runs a function expected to produce console output and waits for a line of console output matching the pattern.
+// Lines written before the function runs are ignored.
+// Returns an error if the function fails.
+// Returns an error if the context is done before a matching line is written.
+func (ml *ModLogs) WaitForLine(ctx context.Context, pattern *regexp.Regexp, run func() error) error {
+	watcher := &lineWatcher{matched: make(chan struct{}), pattern: pattern}
+	ml.mutex.Lock()
+	ml.watchers = append(ml.watchers, watcher)
+	ml.mutex.Unlock()
+	defer func() {
+		ml.mutex.Lock()
+		defer ml.mutex.Unlock()
+		ml.watchers = slices.DeleteFunc(ml.watchers, func(current *lineWatcher) bool {
+			return current == watcher
+		})
+	}()
+	err := run()
+	if err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-watcher.matched:
+		return nil
+	}
+}
+
+// Returns the number of lines logged by each mod - by level (see [modLogLevels]).
+func (ml *ModLogs) Counts() map[string]map[string]int64 {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	counts := map[string]map[string]int64{}
+	for mod, levels := range ml.counts {
+		counts[mod] = map[string]int64{}
+		for _, level := range modLogLevels {
+			counts[mod][level] = levels[level]
+		}
+	}
+	return counts
+}
+
+// Closes the per-mod log files.
+func (ml *ModLogs) close() {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	for _, file := range ml.files {
+		if file != nil {
+			file.handle.Close()
+		}
+	}
+}
+
+// Copies the console output read from the reader to the writer - passing each line to the per-mod logs as it completes.
+func (ml *ModLogs) copy(reader io.Reader, writer io.Writer) {
+	buffer := make([]byte, 32*1024)
+	line := []byte{}
+	for {
+		count, err := reader.Read(buffer)
+		// output is written through as it is read - so that the console isn't delayed by the splitting of lines
+		writer.Write(buffer[:count])
+		for _, char := range buffer[:count] {
+			if char == '\n' {
+				ml.handle(strings.TrimSuffix(string(line), "\r"))
+				line = line[:0]
+				continue
+			}
+			if len(line) < modLogLineLimit {
+				line = append(line, char)
+			}
+		}
+		if err != nil {
+			if len(line) > 0 {
+				ml.handle(string(line))
+			}
+			return
+		}
+	}
+}
+
+// Returns the [ModLogs] stored in the context - or nil if the server's output isn't split by mod.
+func GetModLogs(ctx context.Context) *ModLogs {
+	modLogs, _ := ctx.Value(contextKey("mod-logs")).(*ModLogs)
+	return modLogs
+}
+
+// Runs a function while splitting the console output of processes it attaches by mod.
+// The [ModLogs] are stored in the context passed to the function.
+// Each mod's lines are written to '<mod>.log' within the per-mod logs directory (see [getModLogsDir]).
+// Output is still written to the console - once the function returns, the number of warnings and errors of each mod is logged.
+// Runs the function alone if MOD_LOGS is false.
+// Returns an error if the configuration is invalid.
+// Returns an error if the function fails.
+func SplitModLogsWhile(ctx context.Context, run func(ctx context.Context) error) error {
+	config := ModLogsConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	if !config.Enabled {
+		return run(ctx)
+	}
+	maxSize, err := limits.ParseMemory(config.MaxSize)
+	if err != nil {
+		return fmt.Errorf("invalid MOD_LOGS_MAX_SIZE: %w", err)
+	}
+	if config.Rotations < 0 {
+		return fmt.Errorf("invalid MOD_LOGS_ROTATIONS %d", config.Rotations)
+	}
+	dir := getModLogsDir(ctx)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	modLogs := &ModLogs{config: config, counts: map[string]map[string]int64{}, ctx: ctx, dir: dir, files: map[string]*rotatingFile{}, maxSize: maxSize}
+	helper.Logger(ctx).Info("split server logs by mod", "dir", dir)
+
+	stdout := os.Stdout
+	// attached processes write to os.Stdout - which is swapped for a pipe while the function runs
+	os.Stdout = writer
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		modLogs.copy(reader, stdout)
+	}()
+	runErr := run(context.WithValue(ctx, contextKey("mod-logs"), modLogs))
+	os.Stdout = stdout
+	writer.Close()
+	<-copied
+	reader.Close()
+	modLogs.close()
+
+	counts := modLogs.Counts()
+	mods := helper.Map[string, map[string]int64](counts).Keys()
+	slices.Sort(mods)
+	for _, mod := range mods {
+		if counts[mod]["warning"] == 0 && counts[mod]["error"] == 0 {
+			continue
+		}
+		helper.Logger(ctx).Warn("mod logged problems", "mod", mod, "warnings", counts[mod]["warning"], "errors", counts[mod]["error"])
+	}
+	return runErr
+}
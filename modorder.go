@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// ModOrder is the structure of SPT's user/mods/order.json file
+type ModOrder struct {
+	Order []string `json:"order"`
+}
+
+// Computes the mod load order from the configured order.
+// Entries may reference a mod by its directory or by its package name.
+// Mods not referenced by the configured order are loaded afterwards, sorted by directory.
+// Unknown entries are logged and ignored.
+func getModOrder(ctx context.Context, order []string, packages []ModPackage) []string {
+	dirs := map[string]string{}
+	for _, modPackage := range packages {
+		dirs[modPackage.Dir] = modPackage.Dir
+		if modPackage.Name != "" {
+			_, ok := dirs[modPackage.Name]
+			if !ok {
+				dirs[modPackage.Name] = modPackage.Dir
+			}
+		}
+	}
+
+	final := []string{}
+	for _, entry := range order {
+		dir, ok := dirs[entry]
+		if !ok {
+			helper.Logger(ctx).Warn("mod load order references unknown mod", "mod", entry)
+			continue
+		}
+		if slices.Contains(final, dir) {
+			continue
+		}
+		final = append(final, dir)
+	}
+
+	remaining := []string{}
+	for _, modPackage := range packages {
+		if !slices.Contains(final, modPackage.Dir) {
+			remaining = append(remaining, modPackage.Dir)
+		}
+	}
+	slices.Sort(remaining)
+	return append(final, remaining...)
+}
+
+// Writes SPT's user/mods/order.json so that installed server mods load in a deterministic order.
+// Does nothing if no order is configured - leaving any existing order.json untouched.
+// Returns an error if the installed mods cannot be read.
+// Returns an error if the order file cannot be written.
+func WriteModOrder(ctx context.Context, order []string) error {
+	if len(order) == 0 {
+		return nil
+	}
+	packages, err := LoadModPackages(ctx)
+	if err != nil {
+		return err
+	}
+	modOrder := ModOrder{Order: getModOrder(ctx, order, packages)}
+	helper.Logger(ctx).Info("write mod load order", "order", modOrder.Order)
+	data, err := json.MarshalIndent(modOrder, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(filepath.Join(helper.Dirs(ctx)["spt"], "user", "mods", "order.json"), data)
+}
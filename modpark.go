@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// Returns the directory that disabled server mods are parked in while disabled
+func getParkedModsDir(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "disabled-mods")
+}
+
+// Returns the spt user/mods directory
+func getServerModsDir(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["spt"], "user", "mods")
+}
+
+// Returns the server mod directories (beneath user/mods) referenced by the disabled mods.
+// Entries may reference an installed mod by its name, or a server mod by its directory or package name.
+// Unknown entries are logged and ignored.
+// Returns an error if the installed mods cannot be read.
+func getDisabledModDirs(ctx context.Context, installed InstalledMods, disabled []string) ([]string, error) {
+	packages, err := LoadModPackages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dirs := []string{}
+	for _, entry := range disabled {
+		matched := []string{}
+		installedMod, ok := installed[entry]
+		if ok {
+			for _, file := range installedMod.Files {
+				parts := strings.Split(filepath.ToSlash(file), "/")
+				if len(parts) >= 3 && parts[0] == "user" && parts[1] == "mods" {
+					matched = append(matched, parts[2])
+				}
+			}
+		}
+		for _, modPackage := range packages {
+			if modPackage.Dir == entry || modPackage.Name == entry {
+				matched = append(matched, modPackage.Dir)
+			}
+		}
+		if len(matched) == 0 {
+			helper.Logger(ctx).Warn("disabled mods reference unknown mod", "mod", entry)
+			continue
+		}
+		for _, dir := range matched {
+			if !slices.Contains(dirs, dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	slices.Sort(dirs)
+	return dirs, nil
+}
+
+// Restores every parked server mod (see [ParkDisabledMods]) to the spt user/mods directory.
+// Returns an error if a parked mod cannot be restored.
+func RestoreParkedMods(ctx context.Context) error {
+	entries, err := os.ReadDir(getParkedModsDir(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			// left over from an interrupted move (see [fsutil.MoveTree])
+			err = os.RemoveAll(filepath.Join(getParkedModsDir(ctx), entry.Name()))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		helper.Logger(ctx).Info("restore parked mod", "dir", entry.Name())
+		// a parked mod is only removed once restored - so anything already at the destination is from an interrupted move
+		err = fsutil.MoveTree(ctx, filepath.Join(getParkedModsDir(ctx), entry.Name()), filepath.Join(getServerModsDir(ctx), entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parks the server mods referenced by MODS_DISABLED (see [getDisabledModDirs]) so that the server doesn't load them.
+// Parked mods remain installed - they are restored on the next start (see [RestoreParkedMods]) and parked again while disabled.
+// Client-side components of parked mods are left in place.
+// Returns an error if a mod cannot be parked.
+func ParkDisabledMods(ctx context.Context, disabled []string) error {
+	if len(disabled) == 0 {
+		return nil
+	}
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return err
+	}
+	dirs, err := getDisabledModDirs(ctx, installed, disabled)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		src := filepath.Join(getServerModsDir(ctx), dir)
+		_, err := os.Lstat(src)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		helper.Logger(ctx).Info("park disabled mod", "dir", dir, "dest", getParkedModsDir(ctx))
+		err = fsutil.MoveTree(ctx, src, filepath.Join(getParkedModsDir(ctx), dir))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
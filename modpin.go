@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// ModPinningConfig is loaded from the environment and configures how mod archives that changed since a previous run are handled (see [VerifyModPins])
+type ModPinningConfig struct {
+	Policy string `env:"MOD_PINNING" envDefault:"warn"`
+}
+
+// modPin is the checksum of the archive a url served to a previous run (see [RunRecord.Archives])
+type modPin struct {
+	Checksum string
+	Run      string
+	Started  time.Time
+}
+
+// Returns the checksum each url served to the most recent run that installed it - keyed by url.
+// Returns an error if the run history cannot be read.
+func getModPins(ctx context.Context) (map[string]modPin, error) {
+	records, err := LoadRunHistory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pins := map[string]modPin{}
+	for _, record := range records {
+		for url, checksum := range record.Archives {
+			pins[url] = modPin{Checksum: checksum, Run: record.Id, Started: record.Started}
+		}
+	}
+	return pins, nil
+}
+
+// Verifies that the archives downloaded for mods match the archives their urls served to previous runs (see [RecordRunWhile]).
+// Mods configured with a checksum are verified against it instead (see [FetchMod]) - as are local mods and mods that weren't downloaded.
+// When policy is 'warn' (the default), changed archives are logged and installed - and are pinned from then on.
+// Returns an error if the policy is unknown.
+// Returns an error if the run history cannot be read.
+// Returns an error if the policy is 'strict' and an archive changed.
+func VerifyModPins(ctx context.Context, prepared []preparedMod) error {
+	config := ModPinningConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	if config.Policy != "strict" && config.Policy != "warn" {
+		return fmt.Errorf("unknown mod pinning policy %s", config.Policy)
+	}
+	pins, err := getModPins(ctx)
+	if err != nil {
+		return err
+	}
+	changed := []string{}
+	for _, preparedMod := range prepared {
+		mod := preparedMod.Mod
+		if preparedMod.Checksum == "" || mod.Checksum != "" || isLocalMod(mod) {
+			continue
+		}
+		pin, ok := pins[mod.redacted().Url]
+		if !ok || pin.Checksum == preparedMod.Checksum {
+			continue
+		}
+		helper.Logger(ctx).Warn("MOD ARCHIVE CHANGED - the mod's url serves different content than it did to a previous run", "name", mod.Name, "url", mod.redacted().Url, "checksum", preparedMod.Checksum, "previous", pin.Checksum, "run", pin.Run, "started", pin.Started.Format(time.RFC3339))
+		changed = append(changed, mod.Name)
+	}
+	if len(changed) == 0 || config.Policy != "strict" {
+		return nil
+	}
+	return &UserError{
+		Hint:    "review the changed archives - then pin their checksums ('checksum' in the mod manifest or '#sha256=' in MOD_URLS) or start once with MOD_PINNING=warn to accept them",
+		Message: fmt.Sprintf("%d mod archive(s) changed since a previous run: %v", len(changed), changed),
+	}
+}
@@ -0,0 +1,809 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/archive"
+	"github.com/benfiola/single-player-tarkov/pkg/download"
+	"github.com/benfiola/single-player-tarkov/pkg/filecache"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/limits"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+)
+
+// Mod describes a single mod archive to be installed into the spt server
+type Mod struct {
+	Build    string            `json:"build,omitempty" yaml:"build,omitempty"`
+	Checksum string            `json:"checksum,omitempty" yaml:"checksum,omitempty"`
+	Exclude  []string          `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Include  []string          `json:"include,omitempty" yaml:"include,omitempty"`
+	Link     bool              `json:"link,omitempty" yaml:"link,omitempty"`
+	Mirrors  []string          `json:"mirrors,omitempty" yaml:"mirrors,omitempty"`
+	Name     string            `json:"name" yaml:"name"`
+	Output   string            `json:"output,omitempty" yaml:"output,omitempty"`
+	Url      string            `json:"url" yaml:"url"`
+	Version  string            `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+// Determines whether two mods install the same content.
+// Mirrors and headers are ignored - as they serve (and authenticate) the same archive as the mod's url.
+func (m Mod) sameAs(other Mod) bool {
+	m.Headers, other.Headers = nil, nil
+	m.Mirrors, other.Mirrors = nil, nil
+	return reflect.DeepEqual(m, other)
+}
+
+// Returns a copy of the mod safe to persist - omitting headers as they may contain credentials
+func (m Mod) redacted() Mod {
+	m.Headers = nil
+	return m
+}
+
+// ModManifest is a declarative list of mods loaded from a mounted mods.yaml/mods.json file
+type ModManifest struct {
+	Mods []Mod `json:"mods" yaml:"mods"`
+}
+
+// Loads a [ModManifest] from the given path and returns its mods.
+// Mods without a name are named after their url.
+// Raises an error if the manifest cannot be parsed.
+// Raises an error if a mod is missing a url.
+func LoadModManifest(ctx context.Context, path string) ([]Mod, error) {
+	helper.Logger(ctx).Info("load mod manifest", "path", path)
+	manifest := ModManifest{}
+	err := UnmarshalFile(ctx, path, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	mods := []Mod{}
+	for index, mod := range manifest.Mods {
+		if mod.Url == "" {
+			return nil, fmt.Errorf("mod manifest %s entry %d has no url", path, index)
+		}
+		if mod.Name == "" {
+			mod.Name = getModName(mod.Url)
+		}
+		if mod.Checksum != "" {
+			mod.Checksum, err = fsutil.NormalizeChecksum(mod.Checksum)
+			if err != nil {
+				return nil, fmt.Errorf("mod manifest %s entry %d: %w", path, index, err)
+			}
+		}
+		err = getModFilter(mod).Validate()
+		if err != nil {
+			return nil, fmt.Errorf("mod manifest %s entry %d: %w", path, index, err)
+		}
+		mods = append(mods, mod)
+	}
+	return mods, nil
+}
+
+// modResolver resolves a mod whose url uses a non-http scheme into a [Mod] with a downloadable url
+type modResolver func(ctx context.Context, mod Mod) (Mod, error)
+
+// modResolvers maps a mod url scheme to the [modResolver] handling it.
+// Mods whose url scheme is not found here are downloaded as-is.
+var modResolvers = map[string]modResolver{
+	"forge":     ResolveForgeMod,
+	"git+file":  ResolveGitMod,
+	"git+http":  ResolveGitMod,
+	"git+https": ResolveGitMod,
+	"git+ssh":   ResolveGitMod,
+	"github":    ResolveGithubMod,
+}
+
+// Returns the [modResolver] for the given mod url - or nil if the url should be downloaded as-is
+func getModResolver(modUrl string) modResolver {
+	scheme, _, ok := strings.Cut(modUrl, ":")
+	if !ok {
+		return nil
+	}
+	return modResolvers[scheme]
+}
+
+// Parses a mod spec of the form 'scheme:name@version' into its name and version.
+// If the spec omits a version, the mod's version field is used instead.
+func parseModSpec(mod Mod) (string, string) {
+	_, spec, _ := strings.Cut(mod.Url, ":")
+	name, version, ok := strings.Cut(spec, "@")
+	if !ok {
+		version = mod.Version
+	}
+	return name, version
+}
+
+// Resolves a mod into a [Mod] with a downloadable url.
+// Mods with plain urls are returned unchanged.
+// Returns an error if resolution fails.
+func ResolveMod(ctx context.Context, mod Mod) (Mod, error) {
+	resolver := getModResolver(mod.Url)
+	if resolver == nil {
+		return mod, nil
+	}
+	resolved, err := resolver(outbound.Declare(ctx, fmt.Sprintf("resolve mod %s", mod.Name)), mod)
+	if err != nil {
+		return Mod{}, err
+	}
+	resolved.Checksum = mod.Checksum
+	resolved.Exclude = mod.Exclude
+	resolved.Headers = mod.Headers
+	resolved.Include = mod.Include
+	resolved.Mirrors = mod.Mirrors
+	resolved.Name = mod.Name
+	return resolved, nil
+}
+
+// Derives a mod name from its url.
+// Resolvable urls (e.g., 'forge:SAIN@3.1.0') are named after the mod they reference.
+func getModName(modUrl string) string {
+	if isGitMod(Mod{Url: modUrl}) {
+		repo, _ := parseGitModUrl(modUrl)
+		return strings.TrimSuffix(filepath.Base(repo), ".git")
+	}
+	if strings.HasPrefix(modUrl, "oci://") {
+		return getOciModName(modUrl)
+	}
+	if getModResolver(modUrl) != nil {
+		name, _ := parseModSpec(Mod{Url: modUrl})
+		return filepath.Base(name)
+	}
+	return filepath.Base(modUrl)
+}
+
+// Parses a mod url (i.e., from the environment) into a [Mod].
+// Url fragments carry per-mod options (e.g., 'https://host/mod.zip#sha256=abc...') - the mirror, include and exclude options may be repeated.
+// Returns an error if the fragment is malformed or contains unknown options.
+// Returns an error if an include or exclude pattern is malformed.
+func parseModUrl(modUrl string) (Mod, error) {
+	modUrl, fragment, _ := strings.Cut(modUrl, "#")
+	mod := Mod{Name: getModName(modUrl), Url: modUrl}
+	options, err := url.ParseQuery(fragment)
+	if err != nil {
+		return Mod{}, fmt.Errorf("mod url %s has malformed options: %w", modUrl, err)
+	}
+	for key := range options {
+		value := options.Get(key)
+		switch key {
+		case "sha256":
+			mod.Checksum, err = fsutil.NormalizeChecksum(fmt.Sprintf("sha256:%s", value))
+			if err != nil {
+				return Mod{}, fmt.Errorf("mod url %s: %w", modUrl, err)
+			}
+		case "build":
+			mod.Build = value
+		case "output":
+			mod.Output = value
+		case "link":
+			mod.Link, err = strconv.ParseBool(value)
+			if err != nil {
+				return Mod{}, fmt.Errorf("mod url %s has invalid link option: %w", modUrl, err)
+			}
+		case "mirror":
+			mod.Mirrors = options[key]
+		case "include":
+			mod.Include = options[key]
+		case "exclude":
+			mod.Exclude = options[key]
+		default:
+			return Mod{}, fmt.Errorf("mod url %s has unknown option %s", modUrl, key)
+		}
+	}
+	err = getModFilter(mod).Validate()
+	if err != nil {
+		return Mod{}, fmt.Errorf("mod url %s: %w", modUrl, err)
+	}
+	return mod, nil
+}
+
+// Converts a list of mod urls (i.e., from the environment) into a list of [Mod] objects.
+// Returns an error if a mod url cannot be parsed.
+func GetModsFromUrls(modUrls ...string) ([]Mod, error) {
+	mods := []Mod{}
+	for _, modUrl := range modUrls {
+		mod, err := parseModUrl(modUrl)
+		if err != nil {
+			return nil, err
+		}
+		mods = append(mods, mod)
+	}
+	return mods, nil
+}
+
+// Merges lists of mods into a single list deduplicated by name.
+// When a name appears more than once, the first occurrence wins.
+func MergeMods(lists ...[]Mod) []Mod {
+	final := []Mod{}
+	exists := map[string]bool{}
+	for _, list := range lists {
+		for _, mod := range list {
+			_, ok := exists[mod.Name]
+			if ok {
+				continue
+			}
+			final = append(final, mod)
+			exists[mod.Name] = true
+		}
+	}
+	return final
+}
+
+// InstalledMod records a mod installed to the spt path alongside the files (relative to the spt path) its archive produced.
+// The checksum of the downloaded archive is recorded for the mod lockfile (see [WriteModLock]).
+type InstalledMod struct {
+	Mod
+	ArchiveChecksum string   `json:"archiveChecksum,omitempty"`
+	Files           []string `json:"files"`
+}
+
+// InstalledMods is a map of mod name -> the [InstalledMod] that was installed under that name
+type InstalledMods map[string]InstalledMod
+
+// Returns the set of files owned by installed mods - excluding the mod with the given name.
+func (im InstalledMods) filesExcluding(name string) map[string]bool {
+	files := map[string]bool{}
+	for current, installedMod := range im {
+		if current == name {
+			continue
+		}
+		for _, file := range installedMod.Files {
+			files[file] = true
+		}
+	}
+	return files
+}
+
+// modKeepDirs are directories in the spt path that are never pruned when removing mod files, even if empty
+var modKeepDirs = []string{"BepInEx", "BepInEx/plugins", "user", "user/mods"}
+
+// Returns the path to the file tracking the mods installed to the spt path.
+// The file lives alongside the mods it describes so that a fresh spt path is never mistaken as having mods installed.
+func getInstalledModsPath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["spt"], ".installed-mods.json")
+}
+
+// Loads the set of mods installed to the spt path.
+// Returns an empty set if no mods have been installed.
+// Raises an error if the file exists but cannot be read.
+func LoadInstalledMods(ctx context.Context) (InstalledMods, error) {
+	installed := InstalledMods{}
+	path := getInstalledModsPath(ctx)
+	_, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return installed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = helper.UnmarshalFile(ctx, path, &installed)
+	return installed, err
+}
+
+// Persists the set of mods installed to the spt path.
+// Mods are redacted (see [Mod.redacted]) prior to being persisted.
+func SaveInstalledMods(ctx context.Context, installed InstalledMods) error {
+	data := InstalledMods{}
+	for name, installedMod := range installed {
+		installedMod.Mod = installedMod.Mod.redacted()
+		data[name] = installedMod
+	}
+	return helper.MarshalFile(ctx, data, getInstalledModsPath(ctx))
+}
+
+// Returns the local path of a mod archive referenced by an absolute path or a file:// url - or an empty string if the mod is not a local archive.
+func getLocalArchivePath(mod Mod) string {
+	if filepath.IsAbs(mod.Url) {
+		return mod.Url
+	}
+	parsed, err := url.Parse(mod.Url)
+	if err != nil || parsed.Scheme != "file" {
+		return ""
+	}
+	return parsed.Path
+}
+
+// Determines whether a mod is installed from the local filesystem (i.e., a local archive or a local mod directory).
+// Local mods are always reinstalled as their contents may change without their url changing.
+func isLocalMod(mod Mod) bool {
+	return isModDir(mod) || getLocalArchivePath(mod) != ""
+}
+
+// Extracts a local mod archive to the given staging directory - bypassing the download (and the file cache).
+// If the mod has a checksum, the archive is verified prior to extraction.
+// Raises an error if the archive does not match the mod's checksum.
+// Raises an error if mod extraction fails.
+func extractLocalMod(ctx context.Context, mod Mod, archive string, staging string) error {
+	err := fsutil.VerifyChecksum(ctx, archive, mod.Checksum)
+	if err != nil {
+		return err
+	}
+	return extractModArchive(ctx, mod, archive, staging)
+}
+
+// Returns the filter selecting the archive entries extracted for a mod (see [archive.Filter])
+func getModFilter(mod Mod) archive.Filter {
+	return archive.Filter{Exclude: mod.Exclude, Include: mod.Include}
+}
+
+// Extracts the entries of a mod archive passing the mod's include and exclude patterns to the given directory.
+// Extraction is limited by the 'mod-extract' setup phase (see [withStepLimits]).
+// Raises an error if the archive format is unrecognized.
+// Raises an error if extraction fails (or exceeds its timeout).
+func extractArchive(ctx context.Context, mod Mod, src string, dest string) error {
+	extractCtx, cancel, err := withStepLimits(ctx, "mod-extract")
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	return limits.Run(extractCtx, func(ctx context.Context) error {
+		return archive.ExtractFiltered(ctx, src, dest, getModFilter(mod))
+	})
+}
+
+// Extracts a mod archive to the given staging directory - relocating its contents into the spt server directory structure (see [NormalizeModLayout]).
+// Failures are handled by the 'extract' step policy (see [runStep]) - the staging directory is cleared before each attempt.
+// Raises an error if mod extraction fails.
+func extractModArchive(ctx context.Context, mod Mod, archive string, staging string) error {
+	return runStep(ctx, "extract", func() error {
+		err := os.RemoveAll(staging)
+		if err != nil {
+			return err
+		}
+		err = extractArchive(ctx, mod, archive, staging)
+		if err != nil {
+			return err
+		}
+		return NormalizeModLayout(ctx, getModLayoutName(mod), staging)
+	})
+}
+
+// Downloads and extracts a single mod to the given staging directory.
+// Local archives (see [getLocalArchivePath]) are extracted directly - git mods are built (see [FetchGitMod]).
+// If the mod has a checksum, the downloaded archive is verified prior to extraction.
+// If the download (or verification) fails, the mod's mirrors are tried in order.
+// Raises an error if the download fails from every url.
+// Raises an error if the archive does not match the mod's checksum.
+// Raises an error if mod extraction fails.
+// Returns the checksum of the downloaded archive - or an empty string if the mod was not downloaded (i.e., local and git mods).
+func FetchMod(ctx context.Context, mod Mod, staging string) (string, error) {
+	if isGitMod(mod) {
+		return "", FetchGitMod(ctx, mod, staging)
+	}
+	localArchive := getLocalArchivePath(mod)
+	if localArchive != "" {
+		return "", extractLocalMod(ctx, mod, localArchive, staging)
+	}
+	urls := append([]string{mod.Url}, mod.Mirrors...)
+	errs := []error{}
+	for index, modUrl := range urls {
+		checksum, err := fetchModArchive(ctx, mod, modUrl, staging)
+		if err == nil || errors.Is(err, context.Canceled) {
+			return checksum, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", modUrl, err))
+		if index < len(urls)-1 {
+			helper.Logger(ctx).Warn("fetch mod failed - trying mirror", "name", mod.Name, "url", modUrl, "mirror", urls[index+1], "error", err.Error())
+			err = os.RemoveAll(staging)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	if len(errs) == 1 {
+		return "", errors.Unwrap(errs[0])
+	}
+	return "", fmt.Errorf("mod %s failed to download from every url: %w", mod.Name, errors.Join(errs...))
+}
+
+// Returns the file name a mod archive downloaded from a url is stored under - the last element of the url's path.
+// Returns 'archive' if the path has no usable last element (e.g., 'https://example.com/?id=1').
+func getModArchiveName(modUrl string) string {
+	parsed, err := url.Parse(modUrl)
+	if err != nil {
+		return "archive"
+	}
+	name := path.Base(parsed.Path)
+	if name == "." || name == ".." || name == "/" {
+		return "archive"
+	}
+	return name
+}
+
+// Downloads a mod archive from the given url (the mod's url or one of its mirrors) and extracts it to the given staging directory.
+// Download failures are handled by the 'download' step policy (see [runStep]).
+// Raises an error if the download fails.
+// Raises an error if the archive does not match the mod's checksum.
+// Raises an error if mod extraction fails.
+// Returns the checksum of the downloaded archive.
+func fetchModArchive(ctx context.Context, mod Mod, modUrl string, staging string) (string, error) {
+	checksum := ""
+	// downloads are revalidated against the file cache (see [download.DownloadCached]) so that changed archives are never served stale
+	err := helper.CreateTempDir(ctx, func(tempDir string) error {
+		archive := filepath.Join(tempDir, getModArchiveName(modUrl))
+		downloadCtx := download.WithHeaders(outbound.Declare(ctx, fmt.Sprintf("download mod %s", mod.Name)), mod.Headers)
+		err := runStep(ctx, "download", func() error {
+			return download.DownloadCached(downloadCtx, modUrl, archive)
+		})
+		if err != nil {
+			return err
+		}
+		err = fsutil.VerifyChecksum(ctx, archive, mod.Checksum)
+		if err != nil {
+			return err
+		}
+		checksum, err = fsutil.HashFile(archive)
+		if err != nil {
+			return err
+		}
+		return extractModArchive(ctx, mod, archive, staging)
+	})
+	return checksum, err
+}
+
+// Installs a single mod to the spt path.
+// The mod has previously been fetched into the staging directory (see [FetchMod]) and is copied into the spt path - recording the files it produced.
+// Local mod directories are instead copied (or symlinked) directly.
+// Hook scripts are run before and after the mod is copied (see [RunModHooks]).
+// Changes made to the staging directory by 'pre-mod-install' scripts are recorded as the mod's files.
+// Raises an error if the mod cannot be copied.
+// Raises an error if a hook script fails.
+func InstallMod(ctx context.Context, mod Mod, staging string) (InstalledMod, error) {
+	helper.Logger(ctx).Info("install mod", "name", mod.Name, "url", mod.Url)
+	if isModDir(mod) {
+		staging = ""
+	}
+	err := RunModHooks(ctx, "pre-mod-install", mod, staging)
+	if err != nil {
+		return InstalledMod{Mod: mod}, err
+	}
+	var installedMod InstalledMod
+	if isModDir(mod) {
+		installedMod, err = installModDir(ctx, mod)
+	} else {
+		var files []string
+		files, err = fsutil.CopyTree(ctx, staging, helper.Dirs(ctx)["spt"])
+		installedMod = InstalledMod{Mod: mod, Files: files}
+	}
+	if err != nil {
+		return installedMod, err
+	}
+	err = RunModHooks(ctx, "post-mod-install", mod, "")
+	return installedMod, err
+}
+
+// Removes files belonging to the named mod from the spt path.
+// Files that are also owned by other installed mods are kept.
+// Raises an error if file removal fails.
+func removeModFiles(ctx context.Context, installed InstalledMods, name string, files []string) error {
+	shared := installed.filesExcluding(name)
+	remove := []string{}
+	for _, file := range files {
+		if !shared[file] {
+			remove = append(remove, file)
+		}
+	}
+	return fsutil.RemoveFiles(ctx, helper.Dirs(ctx)["spt"], remove, modKeepDirs...)
+}
+
+// Removes the files of an installed mod from the spt path.
+// Files that are also owned by other installed mods are kept.
+// Raises an error if file removal fails.
+func RemoveMod(ctx context.Context, installed InstalledMods, name string) error {
+	installedMod := installed[name]
+	helper.Logger(ctx).Info("remove mod", "name", name, "files", len(installedMod.Files))
+	if installedMod.Files == nil {
+		helper.Logger(ctx).Warn("mod has no recorded files - its files must be removed manually", "name", name)
+	}
+	return removeModFiles(ctx, installed, name, installedMod.Files)
+}
+
+// Recovers an interrupted mod installation by ensuring the mod is not recorded as installed - rolling the installation forward on the next reconcile.
+// Implements [journalRecoverFunc].
+func recoverInstallMod(ctx context.Context, data json.RawMessage) error {
+	mod := Mod{}
+	err := json.Unmarshal(data, &mod)
+	if err != nil {
+		return err
+	}
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return err
+	}
+	delete(installed, mod.Name)
+	return SaveInstalledMods(ctx, installed)
+}
+
+// Recovers an interrupted mod removal by completing it.
+// Implements [journalRecoverFunc].
+func recoverRemoveMod(ctx context.Context, data json.RawMessage) error {
+	installedMod := InstalledMod{}
+	err := json.Unmarshal(data, &installedMod)
+	if err != nil {
+		return err
+	}
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return err
+	}
+	installed[installedMod.Name] = installedMod
+	err = RemoveMod(ctx, installed, installedMod.Name)
+	if err != nil {
+		return err
+	}
+	delete(installed, installedMod.Name)
+	return SaveInstalledMods(ctx, installed)
+}
+
+// ModFailure is a configured mod that failed to install (see [InstallMods]) - a previously installed version of the mod (if any) is kept
+type ModFailure struct {
+	Error    string `json:"error"`
+	Name     string `json:"name"`
+	Previous string `json:"previous,omitempty"`
+	Url      string `json:"url"`
+}
+
+// preparedMod is a resolved mod alongside the staging directory it was fetched into (and the checksum of its downloaded archive)
+type preparedMod struct {
+	Checksum string
+	Error    error
+	Ignored  bool
+	Mod      Mod
+	Skip     bool
+	Staging  string
+}
+
+// Resolves a mod and fetches it into the given staging directory.
+// Checks beforehand that there's enough disk space to download and install it (see [CheckDiskSpace]).
+// Mods already installed with identical settings are resolved but not fetched (and are marked to be skipped).
+// Mods whose fetch failed in a pipeline step ignoring failures (see [ignoreStepError]) are marked as ignored.
+// Raises an error if the mod cannot be resolved or fetched.
+// Raises an error if there's not enough disk space to fetch the mod.
+func prepareMod(ctx context.Context, installed InstalledMods, mod Mod, staging string) (preparedMod, error) {
+	mod, err := ResolveMod(ctx, mod)
+	if err != nil {
+		return preparedMod{}, err
+	}
+	previous, ok := installed[mod.Name]
+	if ok && previous.Mod.sameAs(mod) && !isLocalMod(mod) {
+		return preparedMod{Mod: mod, Skip: true}, nil
+	}
+	if isModDir(mod) {
+		return preparedMod{Mod: mod}, nil
+	}
+	needs := map[string]string{staging: "mod", helper.Dirs(ctx)["spt"]: "mod"}
+	if filecache.Enabled(ctx) {
+		needs[helper.Dirs(ctx)["cache"]] = "mod"
+	}
+	err = CheckDiskSpace(ctx, fmt.Sprintf("fetch mod %s", mod.Name), needs)
+	if err != nil {
+		return preparedMod{}, err
+	}
+	helper.Logger(ctx).Info("fetch mod", "name", mod.Name, "url", mod.Url)
+	checksum, err := FetchMod(ctx, mod, staging)
+	if err != nil && ignoreStepError(ctx, err, "mod", mod.Name) {
+		return preparedMod{Error: err, Ignored: true, Mod: mod}, nil
+	}
+	return preparedMod{Checksum: checksum, Mod: mod, Staging: staging}, err
+}
+
+// Prepares mods (see [prepareMod]) using a pool of concurrent workers - staging each mod beneath the given directory.
+// The returned list preserves the order of the provided mods.
+// When policy is 'continue', mods that fail to prepare are marked as ignored (alongside their error) and the remaining mods are prepared.
+// Raises an error if any mod fails to prepare (and policy is 'strict') - in which case outstanding work is cancelled.
+func prepareMods(ctx context.Context, installed InstalledMods, mods []Mod, concurrency int, policy string, dir string) ([]preparedMod, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	prepared := make([]preparedMod, len(mods))
+	errs := make([]error, len(mods))
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for range max(concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				prepared[index], errs[index] = prepareMod(ctx, installed, mods[index], filepath.Join(dir, strconv.Itoa(index)))
+				if errs[index] != nil && policy == "continue" && ctx.Err() == nil {
+					helper.Logger(ctx).Warn("mod failed - continuing", "name", mods[index].Name, "error", errs[index].Error())
+					prepared[index], errs[index] = preparedMod{Error: errs[index], Ignored: true, Mod: mods[index]}, nil
+				}
+				if errs[index] != nil {
+					cancel()
+				}
+			}
+		}()
+	}
+enqueue:
+	for index := range mods {
+		select {
+		case indexes <- index:
+		case <-ctx.Done():
+			break enqueue
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	// failures caused by cancellation are only reported if nothing else failed
+	var cancelled error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		cancelled = err
+	}
+	if cancelled == nil {
+		cancelled = ctx.Err()
+	}
+	return prepared, cancelled
+}
+
+// Determines whether installing the prepared mods changes the installed mods.
+// Local mods (see [isLocalMod]) are reinstalled on every reconcile and are not considered changes.
+func modsChanged(installed InstalledMods, prepared []preparedMod) bool {
+	configured := map[string]bool{}
+	for _, preparedMod := range prepared {
+		configured[preparedMod.Mod.Name] = true
+		if !preparedMod.Skip && !preparedMod.Ignored && !isLocalMod(preparedMod.Mod) {
+			return true
+		}
+	}
+	for name := range installed {
+		if !configured[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// Reconciles the mods installed to the spt path against the provided list of mods.
+// Mods are resolved and fetched concurrently (with at most the given number of mods fetched at once) - but are installed one at a time, in order.
+// Mods already installed with identical settings are skipped - all others are (re)installed.
+// Files left over from a previous version of a reinstalled mod are removed.
+// Installed mods that are no longer configured are removed.
+// Mods that failed to fetch in a step ignoring failures (see [StepPolicy]) keep their previously installed version.
+// Downloaded archives are verified against the archives their urls served to previous runs (see [VerifyModPins]) before anything is installed.
+// The installed mods are snapshotted before they're changed (see [SnapshotMods]).
+// When policy is 'continue', mods that fail to resolve or fetch are not installed (like mods ignored by a step policy) rather than failing the install.
+// Returns the mods that failed to install without failing the install.
+// Raises an error if the policy is unknown.
+// Raises an error if a mod fails to install or be removed.
+func InstallMods(ctx context.Context, concurrency int, policy string, mods ...Mod) ([]ModFailure, error) {
+	if policy != "" && policy != "strict" && policy != "continue" {
+		return nil, fmt.Errorf("unknown mod install policy %s", policy)
+	}
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	failures := []ModFailure{}
+	wanted := map[string]bool{}
+	err = helper.CreateTempDir(ctx, func(tempDir string) error {
+		prepared, err := prepareMods(ctx, installed, mods, concurrency, policy, tempDir)
+		if err != nil {
+			return err
+		}
+		err = VerifyModPins(ctx, prepared)
+		if err != nil {
+			return err
+		}
+		if modsChanged(installed, prepared) {
+			// the installed mods are snapshotted before they change - so that the change can be rolled back (see [RollbackMods])
+			err = SnapshotMods(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		for _, preparedMod := range prepared {
+			mod := preparedMod.Mod
+			wanted[mod.Name] = true
+			if preparedMod.Skip {
+				helper.Logger(ctx).Info("mod already installed", "name", mod.Name, "version", mod.Version)
+				continue
+			}
+			if preparedMod.Ignored {
+				// a previously installed version of the mod is kept
+				helper.Logger(ctx).Warn("mod not installed", "name", mod.Name, "previous", installed[mod.Name].Mod.Version)
+				failures = append(failures, ModFailure{Error: preparedMod.Error.Error(), Name: mod.Name, Previous: installed[mod.Name].Mod.Version, Url: mod.redacted().Url})
+				continue
+			}
+			previous := installed[mod.Name]
+			err := Journaled(ctx, "install-mod", mod.redacted(), func() error {
+				delete(installed, mod.Name)
+				err := SaveInstalledMods(ctx, installed)
+				if err != nil {
+					return err
+				}
+				installedMod, err := InstallMod(ctx, mod, preparedMod.Staging)
+				if err != nil {
+					return err
+				}
+				installedMod.ArchiveChecksum = preparedMod.Checksum
+				installed[mod.Name] = installedMod
+				current := map[string]bool{}
+				for _, file := range installedMod.Files {
+					current[file] = true
+				}
+				stale := []string{}
+				for _, file := range previous.Files {
+					if !current[file] {
+						stale = append(stale, file)
+					}
+				}
+				err = removeModFiles(ctx, installed, mod.Name, stale)
+				if err != nil {
+					return err
+				}
+				return SaveInstalledMods(ctx, installed)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range installed {
+		if wanted[name] {
+			continue
+		}
+		helper.Logger(ctx).Info("installed mod no longer configured", "name", name)
+		installedMod := installed[name]
+		err = Journaled(ctx, "remove-mod", installedMod, func() error {
+			err := RemoveMod(ctx, installed, name)
+			if err != nil {
+				return err
+			}
+			delete(installed, name)
+			return SaveInstalledMods(ctx, installed)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return failures, nil
+}
+
+// Summarizes the mods that failed to install (see [InstallMods]) - logging each failure and posting a summary to the webhook (if set).
+// The webhook receives a json object with the summary (as both 'content' and 'text' - as expected by Discord and Slack) and the list of failures.
+// Failures to post to the webhook are logged rather than stopping the server.
+func ReportModFailures(ctx context.Context, webhook string, failures []ModFailure) {
+	if len(failures) == 0 {
+		return
+	}
+	names := []string{}
+	for _, failure := range failures {
+		helper.Logger(ctx).Warn("mod failed to install", "name", failure.Name, "url", failure.Url, "previous", failure.Previous, "error", failure.Error)
+		names = append(names, failure.Name)
+	}
+	summary := fmt.Sprintf("%d mod(s) failed to install: %s", len(failures), strings.Join(names, ", "))
+	helper.Logger(ctx).Warn(summary)
+	if webhook == "" {
+		return
+	}
+	payload := map[string]any{"content": summary, "text": summary, "failures": failures}
+	err := PostJson(outbound.Declare(ctx, "post mod failures to webhook"), webhook, payload)
+	if err != nil {
+		helper.Logger(ctx).Warn("post mod failures to webhook failed", "error", err.Error())
+	}
+}
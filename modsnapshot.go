@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// modSnapshotPaths are the paths (relative to the spt path) captured by a mod snapshot - the installed mods and the record of their installation
+var modSnapshotPaths = []string{".installed-mods.json", "BepInEx", "user/mods"}
+
+// ModSnapshot describes the mod snapshot (see [SnapshotMods])
+type ModSnapshot struct {
+	Created time.Time `json:"created"`
+	RunId   string    `json:"runId"`
+}
+
+// Returns the directory holding the mod snapshot.
+// The snapshot lives within the spt path so that it can be hard linked to the installed mods (which requires the same filesystem).
+func getModSnapshotDir(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["spt"], ".mod-snapshot")
+}
+
+// Duplicates a path captured by the mod snapshot.
+// Directories are hard linked (see [fsutil.LinkTree]), while files are copied as they're rewritten in place.
+// Does nothing if the path does not exist.
+// Returns an error if the path cannot be duplicated.
+func snapshotPath(ctx context.Context, src string, dest string) error {
+	info, err := os.Lstat(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fsutil.CopyFile(src, dest, info.Mode())
+	}
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+	return fsutil.LinkTree(ctx, src, dest)
+}
+
+// Snapshots the installed mods (see [modSnapshotPaths]) so that they can be restored by 'rollback-mods' (see [RollbackMods]).
+// The snapshot hard links the installed files rather than copying them (see [fsutil.LinkTree]).
+// It is assembled beside the previous snapshot and renamed into place.
+// Returns an error if the snapshot cannot be taken.
+func SnapshotMods(ctx context.Context) error {
+	dir := getModSnapshotDir(ctx)
+	staging := fmt.Sprintf("%s.new", dir)
+	err := os.RemoveAll(staging)
+	if err != nil {
+		return err
+	}
+	helper.Logger(ctx).Info("snapshot mods", "dest", dir)
+	for _, path := range modSnapshotPaths {
+		err := snapshotPath(ctx, filepath.Join(helper.Dirs(ctx)["spt"], path), filepath.Join(staging, path))
+		if err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(ModSnapshot{Created: clock.Get(ctx).Now(), RunId: GetRunId()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = fsutil.WriteFileAtomic(filepath.Join(staging, "snapshot.json"), data)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+	return os.Rename(staging, dir)
+}
+
+// Restores the installed mods captured by the mod snapshot (see [SnapshotMods]).
+// The snapshot is kept - so that the rollback can be repeated.
+// Returns an error if no snapshot exists.
+// Returns an error if the snapshot cannot be restored.
+func RollbackMods(ctx context.Context, args ...string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: rollback-mods")
+	}
+	dir := getModSnapshotDir(ctx)
+	snapshot := ModSnapshot{}
+	data, err := os.ReadFile(filepath.Join(dir, "snapshot.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return &UserError{
+			Cause:   err,
+			Hint:    "a snapshot is taken whenever mods are installed, updated or removed",
+			Message: "no mod snapshot to roll back to",
+		}
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &snapshot)
+	}
+	if err != nil {
+		return err
+	}
+	helper.Logger(ctx).Info("rollback mods", "snapshot", dir, "created", snapshot.Created, "runId", snapshot.RunId)
+	for _, path := range modSnapshotPaths {
+		dest := filepath.Join(helper.Dirs(ctx)["spt"], path)
+		err := os.RemoveAll(dest)
+		if err != nil {
+			return err
+		}
+		err = snapshotPath(ctx, filepath.Join(dir, path), dest)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "rolled back mods to the snapshot taken at %s - revert the mod configuration before starting the server, otherwise the change is applied again\n", snapshot.Created.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// modSyncDefaultExclusions are paths never synced to clients - spt's own client plugins and files opted out of syncing by their mods
+var modSyncDefaultExclusions = []string{"BepInEx/plugins/spt", "**/*.nosync", "**/*.nosync.txt"}
+
+// modSyncPath is a single entry of the ModSync config's sync paths
+type modSyncPath struct {
+	Enabled         bool   `json:"enabled"`
+	Enforced        bool   `json:"enforced"`
+	Path            string `json:"path"`
+	RestartRequired bool   `json:"restartRequired"`
+	Silent          bool   `json:"silent"`
+}
+
+// modSyncConfig is the ModSync server component's config (config.jsonc)
+type modSyncConfig struct {
+	Exclusions []string      `json:"exclusions"`
+	SyncPaths  []modSyncPath `json:"syncPaths"`
+}
+
+// ModSyncConfig is loaded from the environment and configures the ModSync integration
+type ModSyncConfig struct {
+	Enabled    bool     `env:"MODSYNC"`
+	Exclusions []string `env:"MODSYNC_EXCLUSIONS"`
+	Url        string   `env:"MODSYNC_URL" envDefault:"github:c-orter/modsync"`
+}
+
+// Converts a ModSync exclusion (a glob where '**' matches across directories) into a regular expression.
+// Returns an error if the exclusion cannot be converted.
+func getModSyncExclusionRegexp(exclusion string) (*regexp.Regexp, error) {
+	pattern := strings.Builder{}
+	for index := 0; index < len(exclusion); index++ {
+		switch {
+		case strings.HasPrefix(exclusion[index:], "**/"):
+			pattern.WriteString("(.*/)?")
+			index += 2
+		case strings.HasPrefix(exclusion[index:], "**"):
+			pattern.WriteString(".*")
+			index++
+		case exclusion[index] == '*':
+			pattern.WriteString("[^/]*")
+		case exclusion[index] == '?':
+			pattern.WriteString("[^/]")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(exclusion[index])))
+		}
+	}
+	return regexp.Compile(fmt.Sprintf("^%s(/.*)?$", pattern.String()))
+}
+
+// Returns the sync paths of the installed mods' client-side components beneath BepInEx.
+func getModSyncPaths(clientFiles map[string][]string) []string {
+	paths := []string{}
+	for _, files := range clientFiles {
+		for _, file := range files {
+			parts := strings.Split(filepath.ToSlash(file), "/")
+			if len(parts) < 3 {
+				continue
+			}
+			path := strings.Join(parts[:3], "/")
+			if !slices.Contains(paths, path) {
+				paths = append(paths, path)
+			}
+		}
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// Returns the directory (relative to the spt path) of the installed ModSync server component.
+// Returns an error if ModSync is not installed.
+func getModSyncDir(ctx context.Context) (string, error) {
+	packages, err := LoadModPackages(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, modPackage := range packages {
+		if strings.EqualFold(modPackage.Name, "corter-modsync") || strings.EqualFold(modPackage.Dir, "corter-modsync") {
+			return filepath.Join("user", "mods", modPackage.Dir), nil
+		}
+	}
+	return "", &UserError{
+		Hint:    "check that MODSYNC_URL references a ModSync release containing its server component",
+		Message: "ModSync server component (Corter-ModSync) not installed",
+	}
+}
+
+// Returns the ModSync server component to install alongside the configured mods - or no mods if the integration is disabled.
+// Returns an error if MODSYNC_URL is malformed.
+func GetModSyncMods(ctx context.Context) ([]Mod, error) {
+	config := ModSyncConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil || !config.Enabled {
+		return []Mod{}, err
+	}
+	return GetModsFromUrls(config.Url)
+}
+
+// Generates the ModSync server component's config from the installed mods - so that clients sync the client-side components of every installed mod.
+// Exclusions from MODSYNC_EXCLUSIONS are verified - exclusions preventing clients from syncing an installed mod's files are logged.
+// Does nothing if the integration is disabled.
+// Returns an error if ModSync is not installed.
+// Returns an error if an exclusion is malformed.
+// Returns an error if the config cannot be written.
+func ConfigureModSync(ctx context.Context) error {
+	config := ModSyncConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil || !config.Enabled {
+		return err
+	}
+	modSyncDir, err := getModSyncDir(ctx)
+	if err != nil {
+		return err
+	}
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return err
+	}
+	clientFiles, err := getClientModFiles(ctx, installed)
+	if err != nil {
+		return err
+	}
+
+	exclusions := append(slices.Clone(modSyncDefaultExclusions), config.Exclusions...)
+	for _, exclusion := range config.Exclusions {
+		exclusionRegexp, err := getModSyncExclusionRegexp(exclusion)
+		if err != nil {
+			return fmt.Errorf("invalid ModSync exclusion %s: %w", exclusion, err)
+		}
+		for name, files := range clientFiles {
+			excluded := slices.ContainsFunc(files, func(file string) bool {
+				return exclusionRegexp.MatchString(filepath.ToSlash(file))
+			})
+			if excluded {
+				helper.Logger(ctx).Warn("ModSync exclusion prevents clients from syncing mod files", "exclusion", exclusion, "mod", name)
+			}
+		}
+	}
+
+	modSyncConfig := modSyncConfig{Exclusions: exclusions, SyncPaths: []modSyncPath{}}
+	for _, path := range getModSyncPaths(clientFiles) {
+		modSyncConfig.SyncPaths = append(modSyncConfig.SyncPaths, modSyncPath{Enabled: true, Path: path, RestartRequired: true})
+	}
+	data, err := json.MarshalIndent(modSyncConfig, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(helper.Dirs(ctx)["spt"], modSyncDir, "config.jsonc")
+	helper.Logger(ctx).Info("write ModSync config", "path", path, "syncPaths", len(modSyncConfig.SyncPaths), "exclusions", len(exclusions))
+	return fsutil.WriteFileAtomic(path, data)
+}
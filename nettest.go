@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/download"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+)
+
+// NettestConfig is loaded from the environment and configures the connection test
+type NettestConfig struct {
+	IpUrl   string        `env:"NETTEST_IP_URL" envDefault:"https://api.ipify.org"`
+	Timeout time.Duration `env:"NETTEST_TIMEOUT" envDefault:"5s"`
+}
+
+// nettestHeader is the response header identifying the connection test listener (rather than the server) as the responder
+const nettestHeader = "X-Spt-Nettest"
+
+// nettestPayload prefixes the datagrams exchanged when probing udp ports
+const nettestPayload = "spt-nettest"
+
+// nettestPort is a port checked by the connection test
+type nettestPort struct {
+	Network string
+	Port    int
+}
+
+func (np nettestPort) String() string {
+	return fmt.Sprintf("%d/%s", np.Port, np.Network)
+}
+
+// nettestResult is the outcome of checking a single item during the connection test
+type nettestResult struct {
+	Check  string
+	Detail string
+	Status string
+}
+
+// Parses a port spec (e.g., '6969', '6969/tcp' or '25565/udp') - ports default to tcp.
+// Returns an error if the spec is malformed.
+func parseNettestPort(spec string) (nettestPort, error) {
+	portString, network, found := strings.Cut(spec, "/")
+	if !found {
+		network = "tcp"
+	}
+	if network != "tcp" && network != "udp" {
+		return nettestPort{}, fmt.Errorf("invalid port %s (expected tcp or udp)", spec)
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil || port < 1 || port > 65535 {
+		return nettestPort{}, fmt.Errorf("invalid port %s", spec)
+	}
+	return nettestPort{Network: network, Port: port}, nil
+}
+
+// Parses the ports checked by the connection test - defaulting to the server's backend port.
+// Returns an error if the entrypoint configuration cannot be parsed or a port spec is malformed.
+func getNettestPorts(ctx context.Context, specs []string) ([]nettestPort, error) {
+	if len(specs) == 0 {
+		config := EntrypointConfig{}
+		err := helper.ParseEnv(ctx, &config)
+		if err != nil {
+			return nil, err
+		}
+		return []nettestPort{{Network: "tcp", Port: getServerPort(config)}}, nil
+	}
+	ports := []nettestPort{}
+	for _, spec := range specs {
+		port, err := parseNettestPort(spec)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// Writes a connection test report - formatted so that it can be shared (e.g., pasted into a support thread) as-is.
+func writeNettestReport(writer io.Writer, title string, results []nettestResult) {
+	fmt.Fprintf(writer, "\n%s\n\n", title)
+	table := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	for _, result := range results {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", result.Check, result.Status, result.Detail)
+	}
+	table.Flush()
+	fmt.Fprintln(writer)
+}
+
+// Diagnoses a failed connection attempt - translating the error into a likely cause.
+func diagnoseNettestError(err error) nettestResult {
+	dnsErr := &net.DNSError{}
+	netErr := (net.Error)(nil)
+	switch {
+	case errors.As(err, &dnsErr):
+		return nettestResult{Status: "unresolved", Detail: "the host name could not be resolved - check the address shared by the host"}
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return nettestResult{Status: "refused", Detail: "the host is reachable but nothing accepts connections on this port - check that the port forward targets the server's machine and that the server (or 'nettest listen') is running"}
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return nettestResult{Status: "timed out", Detail: "no response - the port is likely not forwarded by the host's router or is blocked by a firewall"}
+	default:
+		return nettestResult{Status: "failed", Detail: err.Error()}
+	}
+}
+
+// Probes a tcp port by issuing an http request - any http response proves the port is reachable.
+func probeNettestTcp(ctx context.Context, host string, port nettestPort, timeout time.Duration) nettestResult {
+	result := nettestResult{Check: port.String()}
+	ctx, cancel := context.WithTimeout(outbound.Declare(ctx, "nettest probe"), timeout)
+	defer cancel()
+	probeUrl := fmt.Sprintf("http://%s/nettest", net.JoinHostPort(host, strconv.Itoa(port.Port)))
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, probeUrl, nil)
+	if err != nil {
+		result.Status, result.Detail = "failed", err.Error()
+		return result
+	}
+	start := time.Now()
+	response, err := outbound.Client.Do(request)
+	if err != nil {
+		diagnosis := diagnoseNettestError(err)
+		result.Status, result.Detail = diagnosis.Status, diagnosis.Detail
+		return result
+	}
+	response.Body.Close()
+	latency := time.Since(start).Round(time.Millisecond)
+	result.Status = "reachable"
+	result.Detail = fmt.Sprintf("the server responded in %s (status %d)", latency, response.StatusCode)
+	if response.Header.Get(nettestHeader) != "" {
+		result.Detail = fmt.Sprintf("the connection test listener responded in %s", latency)
+	}
+	return result
+}
+
+// Probes a udp port by sending a datagram and waiting for it to be echoed by 'nettest listen'.
+// As udp is connectionless, a missing echo cannot distinguish a blocked port from a port with no listener.
+func probeNettestUdp(ctx context.Context, host string, port nettestPort, timeout time.Duration) nettestResult {
+	result := nettestResult{Check: port.String()}
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(host, strconv.Itoa(port.Port)))
+	if err != nil {
+		diagnosis := diagnoseNettestError(err)
+		result.Status, result.Detail = diagnosis.Status, diagnosis.Detail
+		return result
+	}
+	defer conn.Close()
+	payload := fmt.Sprintf("%s %d", nettestPayload, time.Now().UnixNano())
+	start := time.Now()
+	err = conn.SetDeadline(start.Add(timeout))
+	if err == nil {
+		_, err = conn.Write([]byte(payload))
+	}
+	buffer := make([]byte, 512)
+	count := 0
+	if err == nil {
+		count, err = conn.Read(buffer)
+	}
+	if err != nil {
+		result.Status = "no echo"
+		result.Detail = "no reply - the port is likely not forwarded (as udp) or is blocked by a firewall - or 'nettest listen' is not running on the host"
+		return result
+	}
+	if string(buffer[:count]) != payload {
+		result.Status, result.Detail = "unexpected", "a reply was received that was not sent by 'nettest listen'"
+		return result
+	}
+	result.Status = "reachable"
+	result.Detail = fmt.Sprintf("the connection test listener echoed in %s", time.Since(start).Round(time.Millisecond))
+	return result
+}
+
+// Looks up the public ip address of this machine using the ip echo service at NETTEST_IP_URL.
+// Returns an error if the service cannot be reached.
+func getPublicIp(ctx context.Context, config NettestConfig) (string, error) {
+	ctx, cancel := context.WithTimeout(outbound.Declare(ctx, "nettest public ip"), config.Timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, config.IpUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	response, err := outbound.Client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", &download.StatusError{Method: http.MethodGet, StatusCode: response.StatusCode, Url: config.IpUrl}
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, 256))
+	return strings.TrimSpace(string(data)), err
+}
+
+// Diagnoses how this machine is addressed from the internet - comparing its public ip address against its local addresses.
+func diagnoseNettestAddress(ctx context.Context, config NettestConfig) []nettestResult {
+	publicIp, err := getPublicIp(ctx, config)
+	if err != nil {
+		return []nettestResult{{Check: "public ip", Status: "unknown", Detail: fmt.Sprintf("lookup failed (%s)", err.Error())}}
+	}
+	results := []nettestResult{{Check: "public ip", Status: publicIp, Detail: "the address players outside of the local network connect to"}}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return results
+	}
+	local := []string{}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() {
+			continue
+		}
+		if ipNet.IP.String() == publicIp {
+			return append(results, nettestResult{Check: "nat", Status: "none", Detail: "the public ip is assigned to this machine - no port forwarding is required (firewalls may still block ports)"})
+		}
+		local = append(local, ipNet.IP.String())
+	}
+	return append(results, nettestResult{Check: "nat", Status: "detected", Detail: fmt.Sprintf("this machine (%s) is behind nat - the router must forward the checked ports to it (when running in docker, to the docker host)", strings.Join(local, ", "))})
+}
+
+// Listens on the given ports until interrupted - answering probes sent by 'nettest probe'.
+// Tcp ports already in use (e.g., by a running server) are skipped, as the server itself answers probes.
+// Returns an error if a port cannot be listened on.
+func listenNettest(ctx context.Context, config NettestConfig, ports []nettestPort) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	results := diagnoseNettestAddress(ctx, config)
+	closers := []io.Closer{}
+	defer func() {
+		for _, closer := range closers {
+			closer.Close()
+		}
+	}()
+	for _, port := range ports {
+		address := fmt.Sprintf(":%d", port.Port)
+		if port.Network == "udp" {
+			conn, err := net.ListenPacket("udp", address)
+			if err != nil {
+				return err
+			}
+			closers = append(closers, conn)
+			go serveNettestUdp(ctx, port, conn)
+			results = append(results, nettestResult{Check: port.String(), Status: "listening", Detail: "echoing probes"})
+			continue
+		}
+		listener, err := net.Listen("tcp", address)
+		if errors.Is(err, syscall.EADDRINUSE) {
+			results = append(results, nettestResult{Check: port.String(), Status: "in use", Detail: "the port is in use (is the server running?) - probes will be answered by whatever is listening"})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		server := &http.Server{Handler: http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			helper.Logger(ctx).Info("received probe", "port", port.String(), "from", request.RemoteAddr)
+			writer.Header().Set(nettestHeader, "1")
+			fmt.Fprintf(writer, "%s: reached %s\n", nettestPayload, port.String())
+		})}
+		closers = append(closers, server)
+		go server.Serve(listener)
+		results = append(results, nettestResult{Check: port.String(), Status: "listening", Detail: "answering probes"})
+	}
+	writeNettestReport(os.Stdout, "SPT connection test (host)", results)
+	fmt.Fprintln(os.Stdout, "Ask a player outside of your network to run 'nettest probe <your public ip>' with the same ports. Press Ctrl+C to stop.")
+	<-ctx.Done()
+	return nil
+}
+
+// Echoes datagrams sent by 'nettest probe' until the connection is closed.
+func serveNettestUdp(ctx context.Context, port nettestPort, conn net.PacketConn) {
+	buffer := make([]byte, 512)
+	for {
+		count, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		if !strings.HasPrefix(string(buffer[:count]), nettestPayload) {
+			continue
+		}
+		helper.Logger(ctx).Info("received probe", "port", port.String(), "from", addr.String())
+		conn.WriteTo(buffer[:count], addr)
+	}
+}
+
+// Runs a connection test - validating that a server's ports are reachable by players outside of the host's network.
+// 'nettest listen [port...]' runs on the host, reporting its nat situation and answering probes until interrupted.
+// 'nettest probe <host> [port...]' runs on a player's machine, probing the host and reporting a diagnosis for each port.
+// Ports are specified as '<port>[/tcp|/udp]' and default to the server's backend port.
+// Returns an error if the arguments are invalid or a port cannot be listened on.
+func Nettest(ctx context.Context, args ...string) error {
+	usage := fmt.Errorf("usage: nettest listen [port...] | nettest probe <host> [port...]")
+	if len(args) == 0 {
+		return usage
+	}
+	config := NettestConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	switch {
+	case args[0] == "listen":
+		ports, err := getNettestPorts(ctx, args[1:])
+		if err != nil {
+			return err
+		}
+		return listenNettest(ctx, config, ports)
+	case args[0] == "probe" && len(args) >= 2:
+		host := args[1]
+		ports, err := getNettestPorts(ctx, args[2:])
+		if err != nil {
+			return err
+		}
+		results := []nettestResult{}
+		for _, port := range ports {
+			probe := probeNettestTcp
+			if port.Network == "udp" {
+				probe = probeNettestUdp
+			}
+			results = append(results, probe(ctx, host, port, config.Timeout))
+		}
+		writeNettestReport(os.Stdout, fmt.Sprintf("SPT connection test (probe of %s)", host), results)
+		return nil
+	default:
+		return usage
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/download"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+)
+
+func init() {
+	download.Downloaders["oci"] = downloadOciArtifact
+}
+
+// OciConfig is loaded from the environment and configures access to OCI registries (for 'oci://' mods)
+type OciConfig struct {
+	AuthFile     string   `env:"REGISTRY_AUTH_FILE"`
+	DockerConfig string   `env:"DOCKER_CONFIG"`
+	PlainHttp    []string `env:"OCI_PLAIN_HTTP"`
+}
+
+// ociAccept lists the manifest media types accepted from registries - image manifests and indexes (OCI and docker)
+var ociAccept = strings.Join([]string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+}, ", ")
+
+// ociTitleAnnotation is the annotation naming the file a layer was pushed from (e.g., by oras)
+const ociTitleAnnotation = "org.opencontainers.image.title"
+
+// ociDescriptor references a blob (or manifest) within a repository
+type ociDescriptor struct {
+	Annotations map[string]string `json:"annotations"`
+	Digest      string            `json:"digest"`
+	MediaType   string            `json:"mediaType"`
+	Size        int64             `json:"size"`
+}
+
+// ociManifest is an image manifest (listing layers) or an image index (listing manifests)
+type ociManifest struct {
+	Layers    []ociDescriptor `json:"layers"`
+	Manifests []ociDescriptor `json:"manifests"`
+	MediaType string          `json:"mediaType"`
+}
+
+// ociReference is a parsed 'oci://registry/repository[:tag|@digest]' url
+type ociReference struct {
+	Reference  string
+	Registry   string
+	Repository string
+}
+
+// Parses an 'oci://registry/repository[:tag|@digest]' url - the tag defaults to 'latest'.
+// Docker hub references ('docker.io') are directed to its registry - and single-component repositories to its 'library' namespace.
+// Returns an error if the url has no registry or repository.
+func parseOciReference(ociUrl *url.URL) (ociReference, error) {
+	reference := ociReference{Reference: "latest", Registry: ociUrl.Host}
+	repository := strings.Trim(ociUrl.Path, "/")
+	if name, digest, ok := strings.Cut(repository, "@"); ok {
+		repository, reference.Reference = name, digest
+	} else if index := strings.LastIndex(repository, ":"); index > strings.LastIndex(repository, "/") {
+		repository, reference.Reference = repository[:index], repository[index+1:]
+	}
+	if reference.Registry == "" || repository == "" || reference.Reference == "" {
+		return reference, fmt.Errorf("invalid oci url %s (expected oci://registry/repository[:tag|@digest])", ociUrl.String())
+	}
+	if reference.Registry == "docker.io" {
+		reference.Registry = "registry-1.docker.io"
+		if !strings.Contains(repository, "/") {
+			repository = fmt.Sprintf("library/%s", repository)
+		}
+	}
+	reference.Repository = repository
+	return reference, nil
+}
+
+// Returns the name of a mod installed from an 'oci://' url - the last component of its repository
+func getOciModName(modUrl string) string {
+	parsed, err := url.Parse(modUrl)
+	if err != nil {
+		return filepath.Base(modUrl)
+	}
+	reference, err := parseOciReference(parsed)
+	if err != nil {
+		return filepath.Base(modUrl)
+	}
+	return filepath.Base(reference.Repository)
+}
+
+// dockerConfig is a docker config file - holding credentials (as written by 'docker login') keyed by registry
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth     string `json:"auth"`
+		Password string `json:"password"`
+		Username string `json:"username"`
+	} `json:"auths"`
+}
+
+// Returns the path to the docker config file holding registry credentials
+func getDockerConfigPath(config OciConfig) string {
+	if config.AuthFile != "" {
+		return config.AuthFile
+	}
+	if config.DockerConfig != "" {
+		return filepath.Join(config.DockerConfig, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// Returns the credentials (username and password) stored for a registry in the docker config file (see [getDockerConfigPath]).
+// Credential helpers ('credsStore' and 'credHelpers') are not supported.
+// Returns empty credentials (i.e., anonymous access) if the registry has no stored credentials.
+// Returns an error if the docker config file cannot be read or parsed.
+func getOciCredentials(config OciConfig, registry string) (string, string, error) {
+	path := getDockerConfigPath(config)
+	if path == "" {
+		return "", "", nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	parsed := dockerConfig{}
+	err = json.Unmarshal(data, &parsed)
+	if err != nil {
+		return "", "", fmt.Errorf("parse %s: %w", path, err)
+	}
+	keys := []string{registry, fmt.Sprintf("https://%s", registry), fmt.Sprintf("http://%s", registry)}
+	if registry == "registry-1.docker.io" {
+		keys = append(keys, "docker.io", "https://index.docker.io/v1/")
+	}
+	for _, key := range keys {
+		auth, ok := parsed.Auths[key]
+		if !ok {
+			continue
+		}
+		if auth.Auth == "" {
+			return auth.Username, auth.Password, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return "", "", fmt.Errorf("parse %s: invalid auth for %s: %w", path, key, err)
+		}
+		username, password, _ := strings.Cut(string(decoded), ":")
+		return username, password, nil
+	}
+	return "", "", nil
+}
+
+// ociChallengeRegexp matches the parameters of a WWW-Authenticate challenge
+var ociChallengeRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// ociClient performs requests against the repository of an OCI registry - authenticating once the registry challenges a request
+type ociClient struct {
+	authorization string
+	baseUrl       string
+	config        OciConfig
+	reference     ociReference
+}
+
+// Creates a client for the registry (and repository) of a reference
+func newOciClient(config OciConfig, reference ociReference) *ociClient {
+	scheme := "https"
+	if slices.Contains(config.PlainHttp, reference.Registry) {
+		scheme = "http"
+	}
+	return &ociClient{baseUrl: fmt.Sprintf("%s://%s/v2/%s", scheme, reference.Registry, reference.Repository), config: config, reference: reference}
+}
+
+// Answers a registry's authentication challenge (see [ociChallengeRegexp]) with a bearer token or basic authentication.
+// Returns an error if the challenge cannot be answered.
+func (oc *ociClient) authenticate(ctx context.Context, challenge string) error {
+	username, password, err := getOciCredentials(oc.config, oc.reference.Registry)
+	if err != nil {
+		return err
+	}
+	scheme, _, _ := strings.Cut(challenge, " ")
+	if strings.EqualFold(scheme, "basic") {
+		if username == "" {
+			return fmt.Errorf("registry %s requires credentials (log in with 'docker login')", oc.reference.Registry)
+		}
+		oc.authorization = fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", username, password))))
+		return nil
+	}
+	params := map[string]string{}
+	for _, match := range ociChallengeRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	if !strings.EqualFold(scheme, "bearer") || params["realm"] == "" {
+		return fmt.Errorf("registry %s sent an unsupported authentication challenge %s", oc.reference.Registry, challenge)
+	}
+	tokenUrl, err := url.Parse(params["realm"])
+	if err != nil {
+		return err
+	}
+	query := tokenUrl.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", oc.reference.Repository))
+	tokenUrl.RawQuery = query.Encode()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenUrl.String(), nil)
+	if err != nil {
+		return err
+	}
+	if username != "" {
+		request.SetBasicAuth(username, password)
+	}
+	response, err := outbound.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return &download.StatusError{Method: http.MethodGet, StatusCode: response.StatusCode, Url: tokenUrl.String()}
+	}
+	token := struct {
+		AccessToken string `json:"access_token"`
+		Token       string `json:"token"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&token)
+	if err != nil {
+		return err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	oc.authorization = fmt.Sprintf("Bearer %s", token.Token)
+	return nil
+}
+
+// Performs a GET request against a path of the repository (e.g., 'manifests/latest').
+// Authenticates and retries once if the registry challenges the request.
+// The caller must close the response body.
+// Returns an error if the request fails or the response has a non-200 status code.
+func (oc *ociClient) get(ctx context.Context, path string, accept string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/%s", oc.baseUrl, path), nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		if oc.authorization != "" {
+			request.Header.Set("Authorization", oc.authorization)
+		}
+		response, err := outbound.Client.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode == http.StatusOK {
+			return response, nil
+		}
+		response.Body.Close()
+		challenge := response.Header.Get("WWW-Authenticate")
+		if response.StatusCode != http.StatusUnauthorized || challenge == "" || attempt > 0 {
+			return nil, &download.StatusError{Method: http.MethodGet, StatusCode: response.StatusCode, Url: request.URL.String()}
+		}
+		err = oc.authenticate(ctx, challenge)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Fetches a manifest by reference (a tag or digest).
+// Returns an error if the manifest cannot be fetched or parsed.
+func (oc *ociClient) getManifest(ctx context.Context, reference string) (ociManifest, error) {
+	manifest := ociManifest{}
+	response, err := oc.get(ctx, fmt.Sprintf("manifests/%s", reference), ociAccept)
+	if err != nil {
+		return manifest, err
+	}
+	defer response.Body.Close()
+	err = json.NewDecoder(response.Body).Decode(&manifest)
+	return manifest, err
+}
+
+// Selects the layer holding the mod archive - the artifact's only layer, or its only layer named (see [ociTitleAnnotation]) like an archive.
+// Returns an error if no single layer holds an archive.
+func selectOciLayer(manifest ociManifest) (ociDescriptor, error) {
+	if len(manifest.Layers) == 1 {
+		return manifest.Layers[0], nil
+	}
+	titles := []string{}
+	archives := []ociDescriptor{}
+	for _, layer := range manifest.Layers {
+		title := layer.Annotations[ociTitleAnnotation]
+		titles = append(titles, title)
+		if isArchive(title) {
+			archives = append(archives, layer)
+		}
+	}
+	if len(archives) != 1 {
+		return ociDescriptor{}, fmt.Errorf("expected a single archive layer - found %d layer(s) %v", len(manifest.Layers), titles)
+	}
+	return archives[0], nil
+}
+
+// Downloads the mod archive published as an OCI artifact referenced by an 'oci://registry/repository[:tag|@digest]' url.
+// Image indexes resolve to their first manifest.
+// Registries are authenticated with the credentials stored by 'docker login' (see [getOciCredentials]) - public repositories are pulled anonymously.
+// Returns an error if the download fails.
+// Returns an error if the artifact holds no single archive layer or the archive does not match its digest.
+func downloadOciArtifact(ctx context.Context, downloadUrl *url.URL, writer io.Writer) error {
+	config := OciConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	reference, err := parseOciReference(downloadUrl)
+	if err != nil {
+		return err
+	}
+	client := newOciClient(config, reference)
+	manifest, err := client.getManifest(ctx, reference.Reference)
+	if err != nil {
+		return err
+	}
+	if len(manifest.Manifests) > 0 {
+		helper.Logger(ctx).Info("oci image index - using first manifest", "url", downloadUrl.String(), "digest", manifest.Manifests[0].Digest)
+		manifest, err = client.getManifest(ctx, manifest.Manifests[0].Digest)
+		if err != nil {
+			return err
+		}
+	}
+	layer, err := selectOciLayer(manifest)
+	if err != nil {
+		return fmt.Errorf("oci artifact %s: %w", downloadUrl.String(), err)
+	}
+	algorithm, expected, _ := strings.Cut(layer.Digest, ":")
+	if algorithm != "sha256" {
+		return fmt.Errorf("oci artifact %s: unsupported layer digest %s", downloadUrl.String(), layer.Digest)
+	}
+	helper.Logger(ctx).Info("download oci layer", "url", downloadUrl.String(), "digest", layer.Digest, "title", layer.Annotations[ociTitleAnnotation], "size", layer.Size)
+	response, err := client.get(ctx, fmt.Sprintf("blobs/%s", layer.Digest), "")
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(writer, hash), response.Body)
+	if err != nil {
+		return err
+	}
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != expected {
+		return fmt.Errorf("oci artifact %s: layer digest mismatch (expected sha256:%s, got sha256:%s)", downloadUrl.String(), expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// OwnershipConfig is loaded from the environment and configures the ownership checks performed when bootstrapping
+type OwnershipConfig struct {
+	Repair bool `env:"REPAIR_OWNERSHIP"`
+}
+
+// ForeignFile is a file (or directory) owned by neither root nor the user the server runs as - typically left behind by a previous change of UID
+type ForeignFile struct {
+	Gid  int
+	Path string
+	Uid  int
+}
+
+// foreignFileSamples is the number of foreign files listed (per directory) when reporting foreign files
+const foreignFileSamples = 5
+
+// Walks the given directory and returns every file (and directory) owned by neither root nor the given user - symlinks are not followed.
+// Returns an error if the directory cannot be walked.
+func FindForeignFiles(dir string, owner helper.User) ([]ForeignFile, error) {
+	foreign := []ForeignFile{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		uid := int(stat.Uid)
+		if uid != 0 && uid != owner.Uid {
+			foreign = append(foreign, ForeignFile{Gid: int(stat.Gid), Path: path, Uid: uid})
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return foreign, nil
+	}
+	return foreign, err
+}
+
+// Logs a summary of the foreign files found within a directory (see [FindForeignFiles]) - the number of files per owner and a sample of the files.
+func reportForeignFiles(ctx context.Context, dir string, foreign []ForeignFile) {
+	counts := map[string]int{}
+	for _, file := range foreign {
+		counts[fmt.Sprintf("%d:%d", file.Uid, file.Gid)] += 1
+	}
+	owners := []string{}
+	for owner, count := range counts {
+		owners = append(owners, fmt.Sprintf("%s (%d)", owner, count))
+	}
+	slices.Sort(owners)
+	samples := []string{}
+	for _, file := range foreign[:min(len(foreign), foreignFileSamples)] {
+		samples = append(samples, file.Path)
+	}
+	helper.Logger(ctx).Warn("files owned by other users", "dir", dir, "files", len(foreign), "owners", strings.Join(owners, ", "), "samples", strings.Join(samples, ", "))
+}
+
+// Checks the entrypoint's directories for foreign files (see [FindForeignFiles]) - reporting a summary of every directory containing them.
+// When repair is true, ownership of only the foreign files is taken by the given user - avoiding a recursive change of ownership of every file.
+// Failures to take ownership are handled by the 'chown' step policy (see [runStep]).
+// Returns an error if a directory cannot be walked.
+// Returns an error if repair is true and ownership cannot be taken.
+func CheckOwnership(ctx context.Context, owner helper.User, repair bool) error {
+	dirs := helper.Dirs(ctx).Values()
+	slices.Sort(dirs)
+	foreign := []ForeignFile{}
+	for _, dir := range dirs {
+		found, err := FindForeignFiles(dir, owner)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			continue
+		}
+		reportForeignFiles(ctx, dir, found)
+		foreign = append(foreign, found...)
+	}
+	if len(foreign) == 0 {
+		return nil
+	}
+	if !repair {
+		helper.Logger(ctx).Warn("server may fail to modify files owned by other users", "files", len(foreign), "uid", owner.Uid, "hint", "start the container with --repair-ownership (or REPAIR_OWNERSHIP=true) to take ownership of them")
+		return nil
+	}
+	if helper.GetCurrentUser(ctx).Uid != 0 {
+		helper.Logger(ctx).Warn("ownership can only be repaired when the container is launched as root", "files", len(foreign))
+		return nil
+	}
+	helper.Logger(ctx).Info("repair ownership", "files", len(foreign), "uid", owner.Uid, "gid", owner.Gid)
+	return runStep(ctx, "chown", func() error {
+		for _, file := range foreign {
+			err := os.Lchown(file.Path, owner.Uid, owner.Gid)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+// Returns true if the given file path has a YAML file extension
+func isYamlFile(file string) bool {
+	return strings.HasSuffix(file, ".yaml") || strings.HasSuffix(file, ".yml")
+}
+
+// Unmarshals a file into the provided struct pointer.
+// Extends [helper.UnmarshalFile] with support for YAML files.
+// Returns an error if unmarshalling fails.
+// Returns an error if the file type is not recognized.
+func UnmarshalFile(ctx context.Context, file string, data any) error {
+	if !isYamlFile(file) {
+		return helper.UnmarshalFile(ctx, file, data)
+	}
+	helper.Logger(ctx).Info("unmarshal file", "path", file)
+	fileBytes, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(fileBytes, data)
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/logstyle"
+	"github.com/benfiola/single-player-tarkov/pkg/patch"
+)
+
+// PatchReloadConfig is loaded from the environment and configures the reloading of config patches (see [ReloadConfigPatchesWhile])
+type PatchReloadConfig struct {
+	Policy string `env:"CONFIG_PATCHES_RELOAD" envDefault:"off"`
+}
+
+// patchReloadPolicies are the supported values of CONFIG_PATCHES_RELOAD
+var patchReloadPolicies = []string{"off", "immediate", "empty"}
+
+// patchReloadDebounce is how long changes to patch files settle before they're reloaded
+const patchReloadDebounce = 2 * time.Second
+
+// patchReloadEmptyInterval is how often the server is checked for connected players while a reload waits for the server to empty
+const patchReloadEmptyInterval = 30 * time.Second
+
+// patchReloadStopTimeout is how long the server is given to exit once signalled - after which it is killed
+const patchReloadStopTimeout = 30 * time.Second
+
+// Returns the sorted, deduplicated directories holding mounted config patch files.
+// Files are watched through their directories, so that files replaced (rather than written to) are noticed.
+func getPatchSourceDirs(config EntrypointConfig) []string {
+	dirs := []string{}
+	if config.ConfigPatchesDir != "" {
+		dirs = append(dirs, filepath.Clean(config.ConfigPatchesDir))
+	}
+	for _, path := range config.ConfigPatchesFiles {
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	slices.Sort(dirs)
+	return slices.Compact(dirs)
+}
+
+// Loads the operator's config patches (see [LoadConfigPatches]) alongside their checksum.
+// Returns an error if the environment cannot be parsed or the patch files cannot be loaded.
+func loadReloadedConfigPatches(ctx context.Context) (patch.ConfigPatches, string, error) {
+	config := EntrypointConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return nil, "", err
+	}
+	config, err = LoadConfigPatches(ctx, config)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := json.Marshal(config.ConfigPatches)
+	if err != nil {
+		return nil, "", err
+	}
+	return config.ConfigPatches, string(data), nil
+}
+
+// Counts the established tcp connections (ipv4 and ipv6) to a local port - i.e., the clients connected to the server listening on it.
+// Returns an error if the connection tables cannot be read.
+func countPortConnections(port int) (int, error) {
+	count := 0
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		for _, line := range strings.Split(string(data), "\n")[1:] {
+			fields := strings.Fields(line)
+			// 'st' 01 is TCP_ESTABLISHED
+			if len(fields) < 4 || fields[3] != "01" {
+				continue
+			}
+			_, localPort, ok := strings.Cut(fields[1], ":")
+			if !ok {
+				continue
+			}
+			value, err := strconv.ParseInt(localPort, 16, 32)
+			if err == nil && int(value) == port {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// Returns the pid of the running server - a child of the entrypoint running the server binary - or 0 if the server isn't running.
+func findServerPid(ctx context.Context) int {
+	serverBin, err := filepath.EvalSymlinks(getServerBin(helper.Dirs(ctx)["spt"]))
+	if err != nil {
+		return 0
+	}
+	paths, _ := filepath.Glob("/proc/[0-9]*/stat")
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// fields following the (parenthesized) command name - starting with the process state (field 3)
+		_, stat, ok := strings.Cut(string(data), ") ")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(stat)
+		if len(fields) < 2 || fields[1] != strconv.Itoa(os.Getpid()) {
+			continue
+		}
+		exe, err := os.Readlink(filepath.Join(filepath.Dir(path), "exe"))
+		if err != nil || exe != serverBin {
+			continue
+		}
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+		if err == nil {
+			return pid
+		}
+	}
+	return 0
+}
+
+// Stops the server gracefully with SIGTERM.
+// The server is killed if it hasn't exited within [patchReloadStopTimeout].
+// The server's exit error is discarded, as the server exiting is expected.
+func stopReloadedServer(ctx context.Context, cancel func(), done chan error) {
+	helper.Logger(ctx).Info("stop server to reload config patches")
+	pid := findServerPid(ctx)
+	if pid != 0 {
+		err := syscall.Kill(pid, syscall.SIGTERM)
+		if err != nil {
+			helper.Logger(ctx).Warn("signal server failed", "pid", pid, "error", err.Error())
+		}
+	}
+	select {
+	case <-done:
+		cancel()
+		return
+	case <-clock.Get(ctx).After(patchReloadStopTimeout):
+	}
+	helper.Logger(ctx).Warn("server did not exit in time - killing it", "timeout", patchReloadStopTimeout.String())
+	cancel()
+	<-done
+}
+
+// Waits until no players are connected to the server (see [countPortConnections]) - checking every [patchReloadEmptyInterval].
+// Returns false if the patch files change again or the context is done while waiting.
+// Returns false (and the server's exit error, via the done channel) if the server exits while waiting.
+func waitForEmptyServer(ctx context.Context, port int, changed chan struct{}, done chan error) bool {
+	logged := false
+	for {
+		count, err := countPortConnections(port)
+		if err != nil {
+			helper.Logger(ctx).Warn("count server connections failed - reloading config patches now", "error", err.Error())
+			return true
+		}
+		if count == 0 {
+			return true
+		}
+		if !logged {
+			helper.Logger(ctx).Info("wait for players to disconnect before reloading config patches", "connections", count)
+			logged = true
+		}
+		select {
+		case err := <-done:
+			done <- err
+			return false
+		case <-changed:
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+			return false
+		case <-ctx.Done():
+			return false
+		case <-clock.Get(ctx).After(patchReloadEmptyInterval):
+		}
+	}
+}
+
+// Runs a function (e.g., the server) while watching the mounted config patch files for changes.
+// Changed patches are checked first - patches with problems are logged and not applied until corrected.
+// Otherwise, the function is stopped per CONFIG_PATCHES_RELOAD, the patches are applied and the function is started again.
+// Runs the function alone if CONFIG_PATCHES_RELOAD is 'off', if no patch files are mounted or in 'run' mode.
+// Returns an error if CONFIG_PATCHES_RELOAD is unknown.
+// Returns an error if the changed patches fail to apply.
+// Returns an error if the function fails.
+func ReloadConfigPatchesWhile(ctx context.Context, config EntrypointConfig, run func(ctx context.Context) error) error {
+	reloadConfig := PatchReloadConfig{}
+	err := helper.ParseEnv(ctx, &reloadConfig)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(patchReloadPolicies, reloadConfig.Policy) {
+		return &UserError{
+			Hint:    fmt.Sprintf("set CONFIG_PATCHES_RELOAD to one of %s", strings.Join(patchReloadPolicies, ", ")),
+			Message: fmt.Sprintf("unknown config patches reload policy %s", reloadConfig.Policy),
+		}
+	}
+	if reloadConfig.Policy == "off" {
+		return run(ctx)
+	}
+	if config.Mode == "run" {
+		helper.Logger(ctx).Warn("CONFIG_PATCHES_RELOAD is ignored in run mode - the server directory is not modified")
+		return run(ctx)
+	}
+	dirs := getPatchSourceDirs(config)
+	if len(dirs) == 0 {
+		helper.Logger(ctx).Warn("CONFIG_PATCHES_RELOAD is set but no patch files are mounted - set CONFIG_PATCHES_DIR or CONFIG_PATCHES_FILES")
+		return run(ctx)
+	}
+	_, current, err := loadReloadedConfigPatches(ctx)
+	if err != nil {
+		return err
+	}
+
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	defer cancelWatch()
+	changed := make(chan struct{}, 1)
+	for _, dir := range dirs {
+		go func() {
+			err := fsutil.WatchDir(watchCtx, dir, func(event fsutil.WatchEvent) {
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			})
+			if err != nil {
+				helper.Logger(ctx).Warn("watch config patches failed", "path", dir, "error", err.Error())
+			}
+		}()
+	}
+
+	for {
+		serverCtx, cancelServer := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- run(serverCtx)
+		}()
+
+		for {
+			select {
+			case err := <-done:
+				cancelServer()
+				return err
+			case <-changed:
+			}
+			err := clock.Sleep(ctx, patchReloadDebounce)
+			if err != nil {
+				continue
+			}
+			select {
+			case <-changed:
+			default:
+			}
+
+			reloaded := config
+			configPatches, checksum, err := loadReloadedConfigPatches(ctx)
+			if err != nil {
+				helper.Logger(ctx).Warn("load changed config patches failed - keeping the applied patches", "error", err.Error())
+				continue
+			}
+			if checksum == current {
+				helper.Logger(ctx).Info("config patch files changed but config patches are unchanged")
+				continue
+			}
+			reloaded.ConfigPatches = configPatches
+			setupPatches, err := getSetupConfigPatches(ctx, reloaded)
+			if err == nil {
+				setupPatches, err = resolveConfigPatches(ctx, reloaded.SptVersion, setupPatches)
+			}
+			if err != nil {
+				helper.Logger(ctx).Error("resolve changed config patches failed - keeping the applied patches", "error", err.Error())
+				continue
+			}
+			problems := patch.Validate(ctx, helper.Dirs(ctx)["spt"], getStockConfigPath(ctx, ""), setupPatches)
+			if len(problems) > 0 {
+				for _, problem := range problems {
+					helper.Logger(ctx).Error("config patch problem", "problem", problem.String())
+				}
+				helper.Logger(ctx).Error("changed config patches have problems - keeping the applied patches until they're corrected", "problems", len(problems))
+				continue
+			}
+			if reloadConfig.Policy == "empty" {
+				if !waitForEmptyServer(ctx, getServerPort(config), changed, done) {
+					continue
+				}
+			}
+			break
+		}
+
+		stopReloadedServer(ctx, cancelServer, done)
+		if ctx.Err() != nil {
+			return nil
+		}
+		logstyle.Phase(ctx, "reload config patches")
+		reloaded := config
+		configPatches, checksum, err := loadReloadedConfigPatches(ctx)
+		if err != nil {
+			return err
+		}
+		reloaded.ConfigPatches = configPatches
+		setupPatches, err := getSetupConfigPatches(ctx, reloaded)
+		if err != nil {
+			return err
+		}
+		err = ApplyConfigPatches(ctx, reloaded.SptVersion, setupPatches)
+		if err != nil {
+			return err
+		}
+		reloaded, err = ResolveServerPort(ctx, reloaded)
+		if err != nil {
+			return err
+		}
+		if getServerPort(reloaded) != getServerPort(config) {
+			helper.Logger(ctx).Warn("server port changed - restart the container so that services (e.g., health probes) follow it", "previous", getServerPort(config), "port", getServerPort(reloaded))
+		}
+		config = reloaded
+		current = checksum
+		logstyle.Phase(ctx, "run server")
+	}
+}
@@ -0,0 +1,535 @@
+// Package archive extracts 7z, rar, tar (optionally gzip or xz compressed) and zip archives in-process.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/bodgit/sevenzip"
+	"github.com/nwaples/rardecode/v2"
+	"github.com/ulikunitz/xz"
+)
+
+// progressInterval is the interval at which the progress of an extraction is logged
+const progressInterval = 5 * time.Second
+
+// extractor writes the entries of a single archive to a destination directory
+type extractor struct {
+	ctx     context.Context
+	dest    string
+	files   int
+	filter  Filter
+	last    time.Time
+	skipped int
+	src     string
+	start   time.Time
+	total   int64
+	written int64
+}
+
+// Logs the progress of the extraction - at most once per [progressInterval].
+// The percentage extracted is included when the archive declares the total size of its entries.
+func (x *extractor) progress(written int) {
+	x.written += int64(written)
+	now := time.Now()
+	if now.Sub(x.last) < progressInterval {
+		return
+	}
+	x.last = now
+	attrs := []any{"src", filepath.Base(x.src), "files", x.files, "bytes", x.written}
+	if x.total > 0 {
+		attrs = append(attrs, "percent", min(100, x.written*100/x.total))
+	}
+	helper.Logger(x.ctx).Info("extract progress", attrs...)
+}
+
+// UnsafeEntryError is returned when an archive entry would be written outside of the destination
+type UnsafeEntryError struct {
+	Entry  string
+	Reason string
+}
+
+func (e *UnsafeEntryError) Error() string {
+	return fmt.Sprintf("unsafe entry (%s)", e.Reason)
+}
+
+// Normalizes an archive path - treating backslashes as separators (as written by some windows archivers).
+func normalize(name string) string {
+	return strings.TrimPrefix(strings.TrimRight(strings.ReplaceAll(name, "\\", "/"), "/"), "./")
+}
+
+// Filter selects the entries extracted from an archive by case-insensitive glob patterns (see [path.Match]).
+// Patterns without a '/' match any component of a path (e.g., '*.md' at any depth).
+// Other patterns match a path and its leading directories (e.g., 'BepInEx/config' matches everything beneath it).
+// If include patterns are given, only entries matching one of them are extracted - entries matching an exclude pattern are never extracted.
+type Filter struct {
+	Exclude []string
+	Include []string
+}
+
+// Returns an error if a pattern of the filter is malformed.
+func (f Filter) Validate() error {
+	for _, pattern := range append(slices.Clone(f.Include), f.Exclude...) {
+		_, err := path.Match(strings.ToLower(pattern), "")
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Determines whether a (normalized) entry path matches a pattern (see [Filter]).
+func matchPattern(pattern string, name string) bool {
+	pattern = strings.ToLower(strings.Trim(strings.ReplaceAll(pattern, "\\", "/"), "/"))
+	parts := strings.Split(strings.ToLower(name), "/")
+	if !strings.Contains(pattern, "/") {
+		for _, part := range parts {
+			ok, _ := path.Match(pattern, part)
+			if ok {
+				return true
+			}
+		}
+		return false
+	}
+	for index := range parts {
+		ok, _ := path.Match(pattern, strings.Join(parts[:index+1], "/"))
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Determines whether an entry (at a normalized path) passes the filter - and should be extracted.
+func (f Filter) Matches(name string) bool {
+	matches := func(patterns []string) bool {
+		return slices.ContainsFunc(patterns, func(pattern string) bool {
+			return matchPattern(pattern, name)
+		})
+	}
+	if len(f.Include) > 0 && !matches(f.Include) {
+		return false
+	}
+	return !matches(f.Exclude)
+}
+
+// Resolves the path an archive entry is extracted to - the archive's root itself resolves to an empty string.
+// Returns an [UnsafeEntryError] if the entry would be written outside of the destination.
+// Returns an [UnsafeEntryError] if the entry would be written beneath a symlink written by an earlier entry.
+func (x *extractor) resolve(name string) (string, error) {
+	normalized := normalize(name)
+	if normalized == "" || normalized == "." {
+		return "", nil
+	}
+	if len(normalized) >= 2 && normalized[1] == ':' {
+		return "", &UnsafeEntryError{Entry: name, Reason: "absolute path"}
+	}
+	local := filepath.FromSlash(normalized)
+	if !filepath.IsLocal(local) {
+		return "", &UnsafeEntryError{Entry: name, Reason: "path leads outside of the destination"}
+	}
+	// entries are never written through symlinks placed by earlier entries, as these could be chained to escape the destination
+	parent := x.dest
+	for _, part := range strings.Split(filepath.Dir(local), string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		parent = filepath.Join(parent, part)
+		info, err := os.Lstat(parent)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", &UnsafeEntryError{Entry: name, Reason: "path leads through a symlink"}
+		}
+	}
+	return filepath.Join(x.dest, local), nil
+}
+
+// Checks that a symlink entry (extracted to a path within the destination) points within the destination.
+// Returns an [UnsafeEntryError] if the target is absolute or leads outside of the destination.
+func (x *extractor) checkLink(name string, path string, link string) error {
+	target := normalize(link)
+	if filepath.IsAbs(target) || strings.HasPrefix(target, "/") || (len(target) >= 2 && target[1] == ':') {
+		return &UnsafeEntryError{Entry: name, Reason: fmt.Sprintf("symlink to absolute path %s", link)}
+	}
+	rel, err := filepath.Rel(x.dest, filepath.Join(filepath.Dir(path), filepath.FromSlash(target)))
+	if err != nil || (rel != "." && !filepath.IsLocal(rel)) {
+		return &UnsafeEntryError{Entry: name, Reason: fmt.Sprintf("symlink to %s leads outside of the destination", link)}
+	}
+	return nil
+}
+
+// contextReader is a reader that fails once its context is done - and reports what it reads to the extractor
+type contextReader struct {
+	extractor *extractor
+	reader    io.Reader
+}
+
+func (cr *contextReader) Read(data []byte) (int, error) {
+	err := cr.extractor.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+	count, err := cr.reader.Read(data)
+	cr.extractor.progress(count)
+	return count, err
+}
+
+// Writes a single archive entry to the destination - a directory, a symlink (to link) or a file (read from the reader).
+// Existing files are overwritten. Files are always writable by their owner. Entries not passing the filter (see [Filter]) are skipped.
+// Returns an error if the entry's path (or a symlink's target) is unsafe (see [extractor.resolve] and [extractor.checkLink]).
+// Returns an error if the entry cannot be written.
+func (x *extractor) write(name string, mode fs.FileMode, link string, reader io.Reader) error {
+	err := x.ctx.Err()
+	if err != nil {
+		return err
+	}
+	path, err := x.resolve(name)
+	if err != nil || path == "" {
+		return err
+	}
+	if !x.filter.Matches(normalize(name)) {
+		x.skipped += 1
+		return nil
+	}
+	if mode&fs.ModeSymlink != 0 {
+		err = x.checkLink(name, path, link)
+		if err != nil {
+			return err
+		}
+	}
+	if mode.IsDir() {
+		return os.MkdirAll(path, 0755)
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	info, err := os.Lstat(path)
+	if err == nil && !info.IsDir() {
+		// replaced rather than written through - existing files may be symlinks
+		err = os.Remove(path)
+		if err != nil {
+			return err
+		}
+	}
+	x.files += 1
+	if mode&fs.ModeSymlink != 0 {
+		return os.Symlink(link, path)
+	}
+	handle, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(handle, &contextReader{extractor: x, reader: reader})
+	return errors.Join(err, handle.Close())
+}
+
+// Writes an entry whose contents are opened on demand (see [extractor.write]) - symlinks store their target as their contents.
+// Returns an error if the entry cannot be opened or written.
+func (x *extractor) writeOpened(name string, mode fs.FileMode, open func() (io.ReadCloser, error)) error {
+	if mode.IsDir() {
+		return x.write(name, mode, "", nil)
+	}
+	reader, err := open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	link := ""
+	if mode&fs.ModeSymlink != 0 {
+		target, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		link = string(target)
+	}
+	return x.write(name, mode, link, reader)
+}
+
+// Extracts a zip archive.
+// Returns an error if the archive is corrupt or an entry cannot be written.
+func (x *extractor) extractZip() error {
+	reader, err := zip.OpenReader(x.src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	for _, file := range reader.File {
+		x.total += int64(file.UncompressedSize64)
+	}
+	for _, file := range reader.File {
+		mode := file.Mode()
+		if strings.HasSuffix(file.Name, "/") {
+			mode |= fs.ModeDir
+		}
+		err := x.writeOpened(file.Name, mode, file.Open)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Name, err)
+		}
+	}
+	return nil
+}
+
+// Replaces the (opaque) decoding errors of encrypted 7z archives with a clear error
+func get7zError(err error) error {
+	readErr := &sevenzip.ReadError{}
+	if errors.As(err, &readErr) && readErr.Encrypted {
+		return fmt.Errorf("password protected archives are not supported")
+	}
+	return err
+}
+
+// Extracts a 7z archive.
+// Returns an error if the archive is corrupt (or encrypted) or an entry cannot be written.
+func (x *extractor) extract7z() error {
+	reader, err := sevenzip.OpenReader(x.src)
+	if err != nil {
+		return get7zError(err)
+	}
+	defer reader.Close()
+	for _, file := range reader.File {
+		x.total += int64(file.UncompressedSize)
+	}
+	for _, file := range reader.File {
+		err := x.writeOpened(file.Name, file.FileInfo().Mode(), file.Open)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Name, get7zError(err))
+		}
+	}
+	return nil
+}
+
+// Extracts a (possibly multi-volume) rar archive.
+// File copies (identical files stored once) are extracted as hard links - junctions (e.g., to absolute windows paths) are skipped.
+// Returns an error if the archive is corrupt (or encrypted) or an entry cannot be written.
+func (x *extractor) extractRar() error {
+	reader, err := rardecode.OpenReader(x.src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Encrypted {
+			return fmt.Errorf("%s: password protected archives are not supported", header.Name)
+		}
+		switch header.LinkType {
+		case rardecode.LinkTypeNone:
+			err = x.write(header.Name, header.Mode(), "", reader)
+		case rardecode.LinkTypeUnixSymlink, rardecode.LinkTypeWindowsSymlink:
+			err = x.write(header.Name, fs.ModeSymlink, header.LinkTarget, nil)
+		case rardecode.LinkTypeHardLink, rardecode.LinkTypeFileCopy:
+			err = x.link(header.Name, header.LinkTarget)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", header.Name, err)
+		}
+	}
+}
+
+// Extracts a tar archive - decompressed by the given function (e.g., for gzip or xz compressed archives).
+// Entries other than directories, files, symlinks and hard links (e.g., devices) are skipped.
+// Returns an error if the archive is corrupt or an entry cannot be written.
+func (x *extractor) extractTar(decompress func(reader io.Reader) (io.Reader, error)) error {
+	handle, err := os.Open(x.src)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	decompressed, err := decompress(bufio.NewReader(handle))
+	if err != nil {
+		return err
+	}
+	reader := tar.NewReader(decompressed)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.write(header.Name, fs.ModeDir, "", nil)
+		case tar.TypeReg:
+			err = x.write(header.Name, header.FileInfo().Mode(), "", reader)
+		case tar.TypeSymlink:
+			err = x.write(header.Name, fs.ModeSymlink, header.Linkname, nil)
+		case tar.TypeLink:
+			err = x.link(header.Name, header.Linkname)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", header.Name, err)
+		}
+	}
+}
+
+// Writes a hard link to a previously extracted entry - skipped if either entry doesn't pass the filter (see [Filter]).
+// Returns an error if either path is unsafe (see [extractor.resolve]) or the link cannot be created.
+func (x *extractor) link(name string, target string) error {
+	path, err := x.resolve(name)
+	if err != nil {
+		return err
+	}
+	targetPath, err := x.resolve(target)
+	unsafeErr := &UnsafeEntryError{}
+	if errors.As(err, &unsafeErr) {
+		return &UnsafeEntryError{Entry: name, Reason: fmt.Sprintf("hard link to %s: %s", target, unsafeErr.Reason)}
+	}
+	if err != nil {
+		return err
+	}
+	// links to filtered entries are filtered alongside them
+	if !x.filter.Matches(normalize(name)) || !x.filter.Matches(normalize(target)) {
+		x.skipped += 1
+		return nil
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	x.files += 1
+	return os.Link(targetPath, path)
+}
+
+// Extensions are the file extensions of the archive formats supported by [Extract].
+// Extraction detects the format from the archive's contents (see [Detect]) - extensions only help to recognize archives by name (e.g., release assets).
+var Extensions = []string{".7z", ".rar", ".tar", ".tar.gz", ".tar.xz", ".tgz", ".txz", ".zip"}
+
+// format is an archive format recognized by its magic bytes (at an offset into the file)
+type format struct {
+	magic  string
+	name   string
+	offset int
+}
+
+// formats are the archive formats recognized by [Detect].
+// Gzip and xz streams are assumed to hold a tar archive - mods are never distributed as single compressed files.
+var formats = []format{
+	{magic: "7z\xbc\xaf\x27\x1c", name: "7z"},
+	{magic: "Rar!\x1a\x07", name: "rar"},
+	{magic: "\x1f\x8b", name: "tar.gz"},
+	{magic: "\xfd7zXZ\x00", name: "tar.xz"},
+	{magic: "PK\x03\x04", name: "zip"},
+	// an empty zip archive consists of its end of central directory record alone
+	{magic: "PK\x05\x06", name: "zip"},
+	{magic: "ustar", name: "tar", offset: 257},
+}
+
+// Detects the format of an archive from its leading (magic) bytes rather than its extension - one of '7z', 'rar', 'tar', 'tar.gz', 'tar.xz' or 'zip'.
+// Returns an error if the file cannot be read.
+// Returns an error if the format is unrecognized - noting when the file looks like a web page (e.g., a download link leading to an html page).
+func Detect(path string) (string, error) {
+	handle, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer handle.Close()
+	header := make([]byte, 512)
+	count, err := io.ReadFull(handle, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	header = header[:count]
+	for _, candidate := range formats {
+		end := candidate.offset + len(candidate.magic)
+		if end <= len(header) && string(header[candidate.offset:end]) == candidate.magic {
+			return candidate.name, nil
+		}
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(header), []byte("<")) {
+		return "", fmt.Errorf("unrecognized archive format (the file looks like a web page - is the url a direct download link?)")
+	}
+	return "", fmt.Errorf("unrecognized archive format (expected 7z, rar, tar, tar.gz, tar.xz or zip)")
+}
+
+// Extracts an archive (7z, rar, tar - optionally gzip or xz compressed - or zip) into a directory (created as needed) - overwriting existing files.
+// The format is detected from the archive's contents (see [Detect]), so archives needn't carry a matching extension.
+// Progress is logged periodically. Extraction stops once the context is done.
+// Returns an error if the archive format is unrecognized.
+// Returns an [UnsafeEntryError] if an entry would be written outside of the directory (see [extractor.resolve]).
+// Returns an error (naming the archive and entry) if the archive is corrupt or an entry cannot be written.
+func Extract(ctx context.Context, src string, dest string) error {
+	return ExtractFiltered(ctx, src, dest, Filter{})
+}
+
+// Extracts the entries of an archive passing the filter (see [Filter]) into a directory - otherwise behaving like [Extract].
+// Returns an error if a pattern of the filter is malformed.
+// Returns an error if the archive cannot be extracted (see [Extract]).
+func ExtractFiltered(ctx context.Context, src string, dest string, filter Filter) error {
+	err := filter.Validate()
+	if err != nil {
+		return err
+	}
+	name, err := Detect(src)
+	if err != nil {
+		return fmt.Errorf("extract %s: %w", filepath.Base(src), err)
+	}
+	helper.Logger(ctx).Info("extract", "src", src, "dest", dest, "format", name)
+	x := &extractor{ctx: ctx, dest: dest, filter: filter, last: time.Now(), src: src, start: time.Now()}
+	extract := map[string]func() error{
+		"7z":  x.extract7z,
+		"rar": x.extractRar,
+		"tar": func() error {
+			return x.extractTar(func(reader io.Reader) (io.Reader, error) {
+				return reader, nil
+			})
+		},
+		"tar.gz": func() error {
+			return x.extractTar(func(reader io.Reader) (io.Reader, error) {
+				return gzip.NewReader(reader)
+			})
+		},
+		"tar.xz": func() error {
+			return x.extractTar(func(reader io.Reader) (io.Reader, error) {
+				return xz.NewReader(reader)
+			})
+		},
+		"zip": x.extractZip,
+	}[name]
+	err = os.MkdirAll(dest, 0755)
+	if err != nil {
+		return err
+	}
+	err = extract()
+	if err != nil {
+		return fmt.Errorf("extract %s: %w", filepath.Base(src), err)
+	}
+	attrs := []any{"src", filepath.Base(src), "files", x.files, "bytes", x.written, "duration", time.Since(x.start).Round(time.Millisecond)}
+	if x.skipped > 0 {
+		attrs = append(attrs, "skipped", x.skipped)
+	}
+	helper.Logger(ctx).Info("extracted", attrs...)
+	return nil
+}
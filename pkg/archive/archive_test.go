@@ -0,0 +1,301 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// entry is a file, directory or symlink written to a test archive
+type entry struct {
+	dir     bool
+	link    string
+	name    string
+	content string
+}
+
+// Writes a zip archive holding the entries.
+func writeZip(t *testing.T, path string, entries []entry) {
+	t.Helper()
+	buffer := bytes.Buffer{}
+	writer := zip.NewWriter(&buffer)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		content := e.content
+		switch {
+		case e.dir:
+			header.SetMode(os.ModeDir | 0755)
+		case e.link != "":
+			header.SetMode(os.ModeSymlink | 0777)
+			content = e.link
+		default:
+			header.SetMode(0644)
+		}
+		file, err := writer.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = file.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, buffer.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Writes a gzip compressed tar archive holding the entries.
+func writeTarGz(t *testing.T, path string, entries []entry) {
+	t.Helper()
+	buffer := bytes.Buffer{}
+	compressed := gzip.NewWriter(&buffer)
+	writer := tar.NewWriter(compressed)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		switch {
+		case e.dir:
+			header = &tar.Header{Name: e.name, Mode: 0755, Typeflag: tar.TypeDir}
+		case e.link != "":
+			header = &tar.Header{Name: e.name, Linkname: e.link, Mode: 0777, Typeflag: tar.TypeSymlink}
+		}
+		err := writer.WriteHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = writer.Write([]byte(e.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := errors.Join(writer.Close(), compressed.Close())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, buffer.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Appends a rar (1.5 - 4.x format) block - prefixed by the low 16 bits of the crc32 of the block's header.
+func appendRarBlock(data []byte, header []byte) []byte {
+	data = binary.LittleEndian.AppendUint16(data, uint16(crc32.ChecksumIEEE(header)))
+	return append(data, header...)
+}
+
+// Writes a rar (1.5 - 4.x format) archive holding the (stored, uncompressed) files - rar archives cannot be written with the standard library.
+func writeRar(t *testing.T, path string, entries []entry) {
+	t.Helper()
+	data := []byte("Rar!\x1a\x07\x00")
+	// archive header
+	data = appendRarBlock(data, []byte{0x73, 0x00, 0x00, 13, 0x00, 0, 0, 0, 0, 0, 0})
+	for _, e := range entries {
+		header := []byte{0x74}
+		// long block (the header is followed by the file's data)
+		header = binary.LittleEndian.AppendUint16(header, 0x8000)
+		header = binary.LittleEndian.AppendUint16(header, uint16(32+len(e.name)))
+		header = binary.LittleEndian.AppendUint32(header, uint32(len(e.content)))
+		header = binary.LittleEndian.AppendUint32(header, uint32(len(e.content)))
+		// host os (ms-dos)
+		header = append(header, 0)
+		header = binary.LittleEndian.AppendUint32(header, crc32.ChecksumIEEE([]byte(e.content)))
+		// modification time (2020-01-01 00:00 in ms-dos format)
+		header = binary.LittleEndian.AppendUint32(header, 0x50210000)
+		// version (2.9) and method (stored)
+		header = append(header, 29, 0x30)
+		header = binary.LittleEndian.AppendUint16(header, uint16(len(e.name)))
+		// attributes (archive)
+		header = binary.LittleEndian.AppendUint32(header, 0x20)
+		header = append(header, e.name...)
+		data = appendRarBlock(data, header)
+		data = append(data, e.content...)
+	}
+	// end of archive
+	data = appendRarBlock(data, []byte{0x7b, 0x00, 0x40, 7, 0x00})
+	err := os.WriteFile(path, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Lists the files (and their contents) within a directory - symlinks are listed with their target.
+func listFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if d.Type()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			files[filepath.ToSlash(rel)] = "-> " + target
+			return err
+		}
+		data, err := os.ReadFile(path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExtract(t *testing.T) {
+	entries := []entry{
+		{name: "mod/", dir: true},
+		{name: "mod/package.json", content: `{"name":"mod"}`},
+		{name: "mod/src/mod.js", content: "module.exports = {}"},
+	}
+	expected := map[string]string{
+		"mod/package.json": `{"name":"mod"}`,
+		"mod/src/mod.js":   "module.exports = {}",
+	}
+	tests := []struct {
+		name   string
+		format string
+		write  func(t *testing.T, path string, entries []entry)
+	}{
+		{name: "zip", format: "zip", write: writeZip},
+		{name: "tar.gz", format: "tar.gz", write: writeTarGz},
+		{name: "rar", format: "rar", write: func(t *testing.T, path string, entries []entry) {
+			files := slices.DeleteFunc(slices.Clone(entries), func(e entry) bool { return e.dir })
+			writeRar(t, path, files)
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			// archives are detected by their contents - not their extension
+			src := filepath.Join(t.TempDir(), "archive.bin")
+			test.write(t, src, entries)
+			format, err := Detect(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != test.format {
+				t.Fatalf("detected %s, expected %s", format, test.format)
+			}
+			dest := t.TempDir()
+			err = Extract(ctx, src, dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files := listFiles(t, dest)
+			for name, content := range expected {
+				if files[name] != content {
+					t.Errorf("%s: got %q, expected %q", name, files[name], content)
+				}
+			}
+			if len(files) != len(expected) {
+				t.Errorf("extracted %v, expected %v", files, expected)
+			}
+		})
+	}
+}
+
+func TestExtractUnsafe(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+		write   func(t *testing.T, path string, entries []entry)
+	}{
+		{name: "zip slip", write: writeZip, entries: []entry{{name: "../escaped.txt", content: "x"}}},
+		{name: "zip absolute path", write: writeZip, entries: []entry{{name: "/escaped.txt", content: "x"}}},
+		{name: "zip drive path", write: writeZip, entries: []entry{{name: "C:\\escaped.txt", content: "x"}}},
+		{name: "zip backslash slip", write: writeZip, entries: []entry{{name: "mod\\..\\..\\escaped.txt", content: "x"}}},
+		{name: "tar slip", write: writeTarGz, entries: []entry{{name: "mod/../../escaped.txt", content: "x"}}},
+		{name: "rar slip", write: writeRar, entries: []entry{{name: "..\\escaped.txt", content: "x"}}},
+		{name: "symlink escape", write: writeTarGz, entries: []entry{{name: "link", link: "../outside"}}},
+		{name: "absolute symlink", write: writeTarGz, entries: []entry{{name: "link", link: "/etc"}}},
+		{name: "zip symlink escape", write: writeZip, entries: []entry{{name: "link", link: "../../outside"}}},
+		{name: "write through symlink", write: writeTarGz, entries: []entry{
+			{name: "link", link: "."},
+			{name: "link/escaped.txt", content: "x"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			root := t.TempDir()
+			src := filepath.Join(root, "archive")
+			test.write(t, src, test.entries)
+			dest := filepath.Join(root, "dest", "nested")
+			err := Extract(ctx, src, dest)
+			unsafeErr := &UnsafeEntryError{}
+			if !errors.As(err, &unsafeErr) {
+				t.Fatalf("expected an unsafe entry error, got %v", err)
+			}
+			for _, path := range []string{filepath.Join(root, "escaped.txt"), filepath.Join(root, "dest", "escaped.txt")} {
+				_, err := os.Lstat(path)
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("%s was written outside of the destination", path)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractFiltered(t *testing.T) {
+	entries := []entry{
+		{name: "BepInEx/plugins/mod.dll", content: "dll"},
+		{name: "BepInEx/config/mod.cfg", content: "cfg"},
+		{name: "README.md", content: "readme"},
+		{name: "docs/CHANGELOG.MD", content: "changelog"},
+	}
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{name: "no filter", filter: Filter{}, expected: []string{"BepInEx/config/mod.cfg", "BepInEx/plugins/mod.dll", "README.md", "docs/CHANGELOG.MD"}},
+		{name: "include directory", filter: Filter{Include: []string{"BepInEx/plugins"}}, expected: []string{"BepInEx/plugins/mod.dll"}},
+		{name: "exclude component at any depth", filter: Filter{Exclude: []string{"*.md"}}, expected: []string{"BepInEx/config/mod.cfg", "BepInEx/plugins/mod.dll"}},
+		{name: "exclude within include", filter: Filter{Include: []string{"bepinex"}, Exclude: []string{"bepinex/config"}}, expected: []string{"BepInEx/plugins/mod.dll"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			src := filepath.Join(t.TempDir(), "archive.zip")
+			writeZip(t, src, entries)
+			dest := t.TempDir()
+			err := ExtractFiltered(ctx, src, dest, test.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files := []string{}
+			for name := range listFiles(t, dest) {
+				files = append(files, name)
+			}
+			slices.Sort(files)
+			if !slices.Equal(files, test.expected) {
+				t.Errorf("extracted %v, expected %v", files, test.expected)
+			}
+		})
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	err := Filter{Include: []string{"["}}.Validate()
+	if err == nil {
+		t.Error("expected malformed pattern to fail validation")
+	}
+}
@@ -0,0 +1,49 @@
+package archive
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"reflect"
+	"testing"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// testContext carries the values the game server helper stores in the context it passes to its callbacks (see [helper.Entrypoint])
+type testContext struct {
+	context.Context
+	values map[string]any
+}
+
+// The helper's context keys are unexported - its values are matched by the name of the key's type.
+func (tc testContext) Value(key any) any {
+	keyType := reflect.TypeOf(key)
+	if keyType.PkgPath() == "github.com/benfiola/game-server-helper/pkg" {
+		value, ok := tc.values[keyType.Name()]
+		if ok {
+			return value
+		}
+	}
+	return tc.Context.Value(key)
+}
+
+// Returns a context carrying the helper's values - with 'cache', 'data' and 'spt' directories in fresh temporary directories.
+// The context is cancelled once the test finishes.
+func newTestContext(t testing.TB) context.Context {
+	t.Helper()
+	dirs := helper.Map[string, string]{}
+	for _, name := range []string{"cache", "data", "spt"} {
+		dirs[name] = t.TempDir()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return testContext{Context: ctx, values: map[string]any{
+		"ctxKeyDirs":               dirs,
+		"ctxKeyFileCacheEnabled":   false,
+		"ctxKeyFileCacheSizeLimit": 0,
+		"ctxKeyLogger":             slog.New(slog.NewTextHandler(os.Stderr, nil)),
+		"ctxKeyUuid":               "test",
+		"ctxKeyVersion":            "test",
+	}}
+}
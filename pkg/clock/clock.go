@@ -0,0 +1,102 @@
+// Package clock provides the source of time used by time-driven subsystems - allowing a fake clock (see [Fake]) to be substituted in tests.
+// Times are reported in the local timezone (see [SetTimezone]).
+package clock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+// Clock is the source of time for time-driven subsystems (e.g., schedulers).
+// Subsystems obtain the clock via [Get] so that a fake clock (see [Fake]) can be substituted in tests.
+type Clock interface {
+	// Returns the current time
+	Now() time.Time
+	// Returns a channel receiving the current time once the duration has elapsed
+	After(d time.Duration) <-chan time.Time
+	// Returns a ticker firing every duration
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals (see [Clock.NewTicker])
+type Ticker interface {
+	// Returns the channel the ticks are delivered on
+	C() <-chan time.Time
+	// Stops the ticker - no more ticks are delivered
+	Stop()
+}
+
+// contextKey is the type of the context key used to store the [Clock]
+type contextKey string
+
+// realClock implements [Clock] using the system clock
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{ticker: time.NewTicker(d)}
+}
+
+// realTicker implements [Ticker] using a [time.Ticker]
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (rt realTicker) C() <-chan time.Time {
+	return rt.ticker.C
+}
+
+func (rt realTicker) Stop() {
+	rt.ticker.Stop()
+}
+
+// Sets the local timezone (i.e., [time.Local]) to an IANA timezone name (e.g., 'America/New_York').
+// An empty name keeps the local timezone of the process.
+// Returns an error if the timezone is unknown.
+func SetTimezone(name string) (*time.Location, error) {
+	name = strings.TrimPrefix(name, ":")
+	if name == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %s (expected an IANA timezone like 'America/New_York' or 'UTC')", name)
+	}
+	time.Local = location
+	return location, nil
+}
+
+// Stores a [Clock] in the context.
+func With(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, contextKey("clock"), clock)
+}
+
+// Returns the [Clock] stored in the context - defaulting to the system clock.
+func Get(ctx context.Context) Clock {
+	clock, ok := ctx.Value(contextKey("clock")).(Clock)
+	if !ok {
+		return realClock{}
+	}
+	return clock
+}
+
+// Waits for a duration to pass on the context's [Clock].
+// Returns an error if the context is cancelled first.
+func Sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-Get(ctx).After(d):
+		return nil
+	}
+}
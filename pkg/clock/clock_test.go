@@ -0,0 +1,140 @@
+package clock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSetTimezone(t *testing.T) {
+	local := time.Local
+	t.Cleanup(func() {
+		time.Local = local
+	})
+	tests := []struct {
+		name        string
+		timezone    string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "iana name", timezone: "America/New_York", expected: "America/New_York"},
+		{name: "leading colon", timezone: ":Europe/Berlin", expected: "Europe/Berlin"},
+		{name: "utc", timezone: "UTC", expected: "UTC"},
+		{name: "unknown", timezone: "Mars/Olympus_Mons", expectedErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			location, err := SetTimezone(test.timezone)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if location.String() != test.expected || time.Local.String() != test.expected {
+				t.Errorf("got %s (local %s), expected %s", location, time.Local, test.expected)
+			}
+		})
+	}
+}
+
+func TestSleep(t *testing.T) {
+	tests := []struct {
+		name        string
+		duration    time.Duration
+		cancel      bool
+		expectedErr error
+	}{
+		{name: "elapsed", duration: time.Millisecond},
+		{name: "cancelled", duration: time.Hour, cancel: true, expectedErr: context.Canceled},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancel {
+				cancel()
+			}
+			err := Sleep(ctx, test.duration)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("got %v, expected %v", err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestFake(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	after := fake.After(time.Minute)
+	ticker := fake.NewTicker(40 * time.Second)
+	defer ticker.Stop()
+	received := func(channel <-chan time.Time) (time.Time, bool) {
+		select {
+		case value := <-channel:
+			return value, true
+		default:
+			return time.Time{}, false
+		}
+	}
+
+	fake.Advance(30 * time.Second)
+	if !fake.Now().Equal(start.Add(30 * time.Second)) {
+		t.Errorf("got %s, expected %s", fake.Now(), start.Add(30*time.Second))
+	}
+	_, ok := received(after)
+	if ok {
+		t.Error("timer fired early")
+	}
+	_, ok = received(ticker.C())
+	if ok {
+		t.Error("ticker fired early")
+	}
+
+	fake.Advance(50 * time.Second)
+	tick, ok := received(ticker.C())
+	if !ok || !tick.Equal(start.Add(40*time.Second)) {
+		t.Errorf("got tick %s (%t), expected %s", tick, ok, start.Add(40*time.Second))
+	}
+	fired, ok := received(after)
+	if !ok || !fired.Equal(start.Add(time.Minute)) {
+		t.Errorf("got timer %s (%t), expected %s", fired, ok, start.Add(time.Minute))
+	}
+
+	// ticks are dropped while the previous tick is unreceived
+	fake.Advance(2 * time.Minute)
+	tick, ok = received(ticker.C())
+	if !ok || !tick.Equal(start.Add(120*time.Second)) {
+		t.Errorf("got tick %s (%t), expected %s", tick, ok, start.Add(120*time.Second))
+	}
+	_, ok = received(ticker.C())
+	if ok {
+		t.Error("ticker delivered dropped ticks")
+	}
+
+	ticker.Stop()
+	fake.Advance(time.Hour)
+	_, ok = received(ticker.C())
+	if ok {
+		t.Error("stopped ticker fired")
+	}
+}
+
+func TestFakeSleep(t *testing.T) {
+	fake := NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx := With(context.Background(), fake)
+	done := make(chan error)
+	go func() {
+		done <- Sleep(ctx, time.Hour)
+	}()
+	fake.BlockUntil(1)
+	fake.Advance(time.Hour)
+	err := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+}
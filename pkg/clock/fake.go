@@ -0,0 +1,124 @@
+package clock
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// fakeTimer is a pending timer (see [Fake.After]) or ticker (see [Fake.NewTicker]) of a [Fake] clock
+type fakeTimer struct {
+	at       time.Time
+	channel  chan time.Time
+	interval time.Duration
+}
+
+// Fake implements [Clock] with a time that only changes when advanced (see [Fake.Advance]).
+// Timers and tickers fire as the time is advanced past them.
+type Fake struct {
+	cond   *sync.Cond
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// Creates a [Fake] clock starting at a time.
+func NewFake(start time.Time) *Fake {
+	fake := &Fake{now: start}
+	fake.cond = sync.NewCond(&fake.mutex)
+	return fake
+}
+
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// Adds a timer firing once the time is advanced past the duration - timers with an interval fire repeatedly.
+func (f *Fake) add(d time.Duration, interval time.Duration) *fakeTimer {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	timer := &fakeTimer{at: f.now.Add(d), channel: make(chan time.Time, 1), interval: interval}
+	if d <= 0 && interval == 0 {
+		timer.channel <- f.now
+		return timer
+	}
+	f.timers = append(f.timers, timer)
+	f.cond.Broadcast()
+	return timer
+}
+
+// Removes a timer - it no longer fires.
+func (f *Fake) remove(timer *fakeTimer) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.timers = slices.DeleteFunc(f.timers, func(current *fakeTimer) bool {
+		return current == timer
+	})
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.add(d, 0).channel
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return &fakeTicker{fake: f, timer: f.add(d, d)}
+}
+
+// Advances the time by a duration - firing the timers and tickers due along the way (in order).
+// Like [time.Ticker], ticks are dropped while a ticker's previous tick has not been received.
+func (f *Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	target := f.now.Add(d)
+	for {
+		index := -1
+		for current, timer := range f.timers {
+			if !timer.at.After(target) && (index == -1 || timer.at.Before(f.timers[index].at)) {
+				index = current
+			}
+		}
+		if index == -1 {
+			break
+		}
+		timer := f.timers[index]
+		f.now = timer.at
+		select {
+		case timer.channel <- f.now:
+		default:
+		}
+		if timer.interval > 0 {
+			timer.at = timer.at.Add(timer.interval)
+		} else {
+			f.timers = slices.Delete(f.timers, index, index+1)
+		}
+	}
+	f.now = target
+}
+
+// Blocks until at least a number of timers and tickers are pending.
+func (f *Fake) BlockUntil(count int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for len(f.timers) < count {
+		f.cond.Wait()
+	}
+}
+
+// fakeTicker implements [Ticker] for a [Fake] clock
+type fakeTicker struct {
+	fake  *Fake
+	timer *fakeTimer
+}
+
+func (ft *fakeTicker) C() <-chan time.Time {
+	return ft.timer.channel
+}
+
+func (ft *fakeTicker) Stop() {
+	ft.fake.remove(ft.timer)
+}
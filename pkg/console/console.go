@@ -0,0 +1,163 @@
+// Package console sends commands (and scheduled sequences of commands) to the standard input of a server process.
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/jobs"
+)
+
+// Step is a single server console command sent as part of a [Sequence]
+type Step struct {
+	Command string `json:"command"`
+	Delay   string `json:"delay,omitempty"`
+}
+
+// Sequence is a named list of server console commands - optionally run on a schedule (with an optional jitter).
+// Schedules are an interval (e.g., '6h'), a daily time (e.g., '04:00') or a cron expression (see [jobs.ParseSchedule]).
+type Sequence struct {
+	Jitter   string `json:"jitter,omitempty"`
+	Schedule string `json:"schedule,omitempty"`
+	Steps    []Step `json:"steps"`
+}
+
+// Sequences is a map of sequence name -> [Sequence]
+type Sequences map[string]Sequence
+
+// Parses a string into a [Sequences] object - validating delays, jitters and schedules.
+// Used to parse settings from the environment.
+func (ss *Sequences) UnmarshalText(data []byte) error {
+	parsed := map[string]Sequence{}
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return err
+	}
+	for name, sequence := range parsed {
+		if sequence.Schedule != "" {
+			_, err := jobs.ParseSchedule(sequence.Schedule)
+			if err != nil {
+				return fmt.Errorf("console sequence %s: %w", name, err)
+			}
+		}
+		if sequence.Jitter != "" {
+			_, err := time.ParseDuration(sequence.Jitter)
+			if err != nil {
+				return fmt.Errorf("console sequence %s: invalid jitter %s", name, sequence.Jitter)
+			}
+		}
+		for _, step := range sequence.Steps {
+			if step.Delay == "" {
+				continue
+			}
+			_, err := time.ParseDuration(step.Delay)
+			if err != nil {
+				return fmt.Errorf("console sequence %s: invalid delay %s", name, step.Delay)
+			}
+		}
+	}
+	*ss = Sequences(parsed)
+	return nil
+}
+
+// Console sends commands to the standard input of the server process.
+// The entrypoint's own standard input continues to be forwarded to the server - so that the console remains interactive.
+type Console struct {
+	lock   sync.Mutex
+	writer io.Writer
+}
+
+// contextKey is the type of the context key used to store the [Console]
+type contextKey string
+
+// Sends a single command to the server console.
+// Returns an error if the command cannot be written.
+func (c *Console) Send(ctx context.Context, command string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	helper.Logger(ctx).Info("send console command", "command", command)
+	_, err := fmt.Fprintf(c.writer, "%s\n", command)
+	return err
+}
+
+// Runs a function with a [Console] attached to the standard input of processes it attaches.
+// The console is stored in the context passed to the function.
+// Returns an error if the console cannot be created.
+// Returns an error if the function fails.
+func AttachWhile(ctx context.Context, run func(ctx context.Context) error) error {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	stdin := os.Stdin
+	// attached processes read from os.Stdin - which is swapped for the console's pipe while the function runs
+	os.Stdin = reader
+	defer func() {
+		os.Stdin = stdin
+		writer.Close()
+		reader.Close()
+	}()
+	go io.Copy(writer, stdin)
+	return run(context.WithValue(ctx, contextKey("console"), &Console{writer: writer}))
+}
+
+// Returns the [Console] stored in the context - or nil if the server console is unavailable.
+func Get(ctx context.Context) *Console {
+	console, _ := ctx.Value(contextKey("console")).(*Console)
+	return console
+}
+
+// Runs a console sequence - waiting for each step's delay before sending its command.
+// Returns an error if the server console is unavailable.
+// Returns an error if the context is cancelled or a command cannot be sent.
+func RunSequence(ctx context.Context, name string, sequence Sequence) error {
+	console := Get(ctx)
+	if console == nil {
+		return fmt.Errorf("console sequence %s: server console unavailable", name)
+	}
+	helper.Logger(ctx).Info("run console sequence", "name", name, "steps", len(sequence.Steps))
+	for _, step := range sequence.Steps {
+		delay, _ := time.ParseDuration(step.Delay)
+		err := clock.Sleep(ctx, delay)
+		if err != nil {
+			return err
+		}
+		err = console.Send(ctx, step.Command)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns a job (named 'console-<name>') for each scheduled console sequence - run by the job scheduler (see [jobs.ScheduleWhile]).
+// The jobs require the server console (see [AttachWhile]) - and fail when run without it.
+func SequenceJobs(sequences Sequences) jobs.Jobs {
+	sequenceJobs := jobs.Jobs{}
+	names := helper.Map[string, Sequence](sequences).Keys()
+	slices.Sort(names)
+	for _, name := range names {
+		sequence := sequences[name]
+		if sequence.Schedule == "" {
+			continue
+		}
+		jitter, _ := time.ParseDuration(sequence.Jitter)
+		sequenceJobs = append(sequenceJobs, jobs.Job{
+			Jitter: jitter,
+			Name:   fmt.Sprintf("console-%s", name),
+			Run: func(ctx context.Context) error {
+				return RunSequence(ctx, name, sequence)
+			},
+			Schedule: sequence.Schedule,
+		})
+	}
+	return sequenceJobs
+}
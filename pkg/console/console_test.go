@@ -0,0 +1,76 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestSequencesUnmarshalText(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		expectedErr bool
+	}{
+		{name: "valid", data: `{"restart": {"schedule": "04:00", "jitter": "5m", "steps": [{"command": "say restarting", "delay": "1m"}]}}`},
+		{name: "malformed", data: `{`, expectedErr: true},
+		{name: "invalid schedule", data: `{"restart": {"schedule": "tomorrow", "steps": []}}`, expectedErr: true},
+		{name: "invalid jitter", data: `{"restart": {"jitter": "soon", "steps": []}}`, expectedErr: true},
+		{name: "invalid delay", data: `{"restart": {"steps": [{"command": "say hi", "delay": "later"}]}}`, expectedErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sequences := Sequences{}
+			err := sequences.UnmarshalText([]byte(test.data))
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("got error %v, expected error: %t", err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestRunSequence(t *testing.T) {
+	sequence := Sequence{Steps: []Step{{Command: "say restarting"}, {Command: "restart", Delay: "0s"}}}
+	tests := []struct {
+		name        string
+		attached    bool
+		expected    string
+		expectedErr bool
+	}{
+		{name: "attached", attached: true, expected: "say restarting\nrestart\n"},
+		{name: "unavailable", expectedErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			buffer := bytes.Buffer{}
+			if test.attached {
+				ctx = context.WithValue(ctx, contextKey("console"), &Console{writer: &buffer})
+			}
+			err := RunSequence(ctx, "test", sequence)
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("got error %v, expected error: %t", err, test.expectedErr)
+			}
+			if buffer.String() != test.expected {
+				t.Errorf("sent %q, expected %q", buffer.String(), test.expected)
+			}
+		})
+	}
+}
+
+func TestSequenceJobs(t *testing.T) {
+	sequences := Sequences{
+		"wipe":    {Schedule: "0 4 * * 1", Steps: []Step{{Command: "wipe"}}},
+		"manual":  {Steps: []Step{{Command: "say hi"}}},
+		"restart": {Schedule: "6h", Steps: []Step{{Command: "restart"}}},
+	}
+	names := []string{}
+	for _, job := range SequenceJobs(sequences) {
+		names = append(names, job.Name)
+	}
+	expected := []string{"console-restart", "console-wipe"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("got jobs %v, expected %v", names, expected)
+	}
+}
@@ -0,0 +1,144 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/filecache"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// errNotModified is returned by conditional downloads when the content matches the provided validator
+var errNotModified = errors.New("not modified")
+
+// cachedDownload records the validator of a url's most recently downloaded content - and the file cache key it is stored under
+type cachedDownload struct {
+	Checksum  string `json:"checksum"`
+	Key       string `json:"key"`
+	Validator string `json:"validator"`
+}
+
+// cachedDownloadsLock serializes access to the on-disk index of cached downloads
+var cachedDownloadsLock sync.Mutex
+
+// Returns the path to the index of cached downloads (a map of url -> [cachedDownload]).
+// The index is kept in the data directory - as the file cache removes files it doesn't track from the cache directory.
+func getCachedDownloadsPath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "download-cache.json")
+}
+
+// Reads the index of cached downloads - returning an empty index if it doesn't exist.
+// Returns an error if the index cannot be read.
+func readCachedDownloads(ctx context.Context) (map[string]cachedDownload, error) {
+	index := map[string]cachedDownload{}
+	data, err := os.ReadFile(getCachedDownloadsPath(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return index, json.Unmarshal(data, &index)
+}
+
+// Modifies the entry for a url in the index of cached downloads - removing the entry if the update returns nil.
+// Returns an error if the index cannot be read or written.
+func updateCachedDownload(ctx context.Context, downloadUrl string, entry *cachedDownload) error {
+	cachedDownloadsLock.Lock()
+	defer cachedDownloadsLock.Unlock()
+	index, err := readCachedDownloads(ctx)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		delete(index, downloadUrl)
+	} else {
+		index[downloadUrl] = *entry
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(getCachedDownloadsPath(ctx), data)
+}
+
+// Returns the file cache key of a url's content with the given validator
+func getCachedDownloadKey(downloadUrl string, validator string) string {
+	urlDigest := sha256.Sum256([]byte(downloadUrl))
+	validatorDigest := sha256.Sum256([]byte(validator))
+	return fmt.Sprintf("download-%s-%s", hex.EncodeToString(urlDigest[:])[:16], hex.EncodeToString(validatorDigest[:])[:12])
+}
+
+// Downloads a url to the target path like [Download] - but keeps the downloaded content in the file cache (keyed by url and ETag/Last-Modified).
+// Subsequent downloads of the url are conditional - and are served from the file cache if the server reports the content is unchanged.
+// Urls downloaded by [Downloaders] (and responses without a validator) are downloaded without caching.
+// Falls back to [Download] if the file cache is disabled (or unusable).
+// Returns an error if the download fails.
+// Returns an error if any file cache operation fails.
+func DownloadCached(ctx context.Context, downloadUrl string, dest string) error {
+	parsed, err := url.Parse(downloadUrl)
+	if err != nil {
+		return err
+	}
+	_, custom := Downloaders[parsed.Scheme]
+	if !filecache.Enabled(ctx) || custom {
+		return Download(ctx, downloadUrl, dest)
+	}
+
+	cachedDownloadsLock.Lock()
+	index, err := readCachedDownloads(ctx)
+	cachedDownloadsLock.Unlock()
+	if err != nil {
+		return err
+	}
+	validator := ""
+	entry, ok := index[downloadUrl]
+	if ok {
+		cached, err := filecache.Lookup(ctx, entry.Key, dest)
+		if err != nil {
+			return err
+		}
+		if cached {
+			validator = entry.Validator
+		} else {
+			helper.Logger(ctx).Info("cached download missing from file cache", "url", downloadUrl, "key", entry.Key)
+		}
+	}
+
+	return helper.CreateTempDir(ctx, func(tempDir string) error {
+		downloaded := filepath.Join(tempDir, filepath.Base(dest))
+		current, err := download(ctx, downloadUrl, downloaded, validator)
+		if errors.Is(err, errNotModified) {
+			helper.Logger(ctx).Info("download not modified - using cached copy", "url", downloadUrl, "key", entry.Key)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if current == "" {
+			helper.Logger(ctx).Info("download cannot be revalidated - skipping cache", "url", downloadUrl)
+			return errors.Join(fsutil.CopyFile(downloaded, dest, 0644), updateCachedDownload(ctx, downloadUrl, nil))
+		}
+		checksum, err := fsutil.HashFile(downloaded)
+		if err != nil {
+			return err
+		}
+		key := getCachedDownloadKey(downloadUrl, current)
+		err = filecache.Cache(ctx, key, dest, func(path string) error {
+			return fsutil.CopyFile(downloaded, path, 0644)
+		})
+		if err != nil {
+			return err
+		}
+		return updateCachedDownload(ctx, downloadUrl, &cachedDownload{Checksum: checksum, Key: key, Validator: current})
+	})
+}
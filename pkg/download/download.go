@@ -0,0 +1,316 @@
+// Package download downloads urls to files - retrying transient failures, resuming interrupted http downloads and reporting their progress.
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+)
+
+// StatusError is returned when an http request receives an unexpected status code
+type StatusError struct {
+	Method     string
+	StatusCode int
+	Url        string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s sent non-200 status code: %d", e.Method, e.Url, e.StatusCode)
+}
+
+// HeaderFunc returns headers to attach to a download from the given url
+type HeaderFunc func(ctx context.Context, downloadUrl *url.URL) (map[string]string, error)
+
+// HeaderFuncs are consulted for every download - allowing mod sources to attach credentials to their downloads
+var HeaderFuncs = []HeaderFunc{}
+
+// contextKey is the type of the context key used to store the headers attached to downloads
+type contextKey string
+
+// Attaches headers to http downloads made with the returned context (e.g., credentials for a specific download).
+// Headers are applied after those returned by [HeaderFuncs].
+func WithHeaders(ctx context.Context, headers map[string]string) context.Context {
+	return context.WithValue(ctx, contextKey("headers"), headers)
+}
+
+// Downloader downloads a url to a writer
+type Downloader func(ctx context.Context, downloadUrl *url.URL, writer io.Writer) error
+
+// Downloaders maps url schemes to the [Downloader] for urls of that scheme.
+// Urls with other schemes are downloaded over http(s).
+var Downloaders = map[string]Downloader{}
+
+// RetryConfig is loaded from the environment and configures how failed downloads are retried
+type RetryConfig struct {
+	Attempts    int           `env:"DOWNLOAD_RETRY_ATTEMPTS" envDefault:"3"`
+	Backoff     time.Duration `env:"DOWNLOAD_RETRY_BACKOFF" envDefault:"1s"`
+	MaxBackoff  time.Duration `env:"DOWNLOAD_RETRY_MAX_BACKOFF" envDefault:"30s"`
+	StatusCodes []int         `env:"DOWNLOAD_RETRY_STATUS_CODES" envDefault:"408,429,500,502,503,504"`
+}
+
+// Returns the delay before the given (1-indexed) retry - doubling with every retry up to the maximum backoff.
+func (rc RetryConfig) getBackoff(retry int) time.Duration {
+	backoff := rc.Backoff
+	for range retry - 1 {
+		backoff *= 2
+		if backoff >= rc.MaxBackoff {
+			return rc.MaxBackoff
+		}
+	}
+	return min(backoff, rc.MaxBackoff)
+}
+
+// Determines whether a failed download is likely transient (i.e., a retryable status code or a network error) and should be retried.
+func (rc RetryConfig) isRetryable(err error) bool {
+	statusErr := &StatusError{}
+	if errors.As(err, &statusErr) {
+		return slices.Contains(rc.StatusCodes, statusErr.StatusCode)
+	}
+	blockedErr := &outbound.BlockedError{}
+	if errors.As(err, &blockedErr) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Downloads a url to the target path - retrying transient failures with exponential backoff (see [RetryConfig]).
+// Urls whose scheme is found in [Downloaders] are downloaded by the corresponding downloader.
+// Extends [helper.Download] by attaching headers from [HeaderFuncs] to http requests.
+// Progress is logged periodically - and the bandwidth of every download combined is capped (see [ProgressConfig]).
+// Returns an error if the download fails with a non-retryable error - or fails every attempt.
+func Download(ctx context.Context, downloadUrl string, dest string) error {
+	_, err := download(ctx, downloadUrl, dest, "")
+	return err
+}
+
+// Downloads a url to the target path (see [Download]).
+// If a validator is provided, http downloads are conditional - returning [errNotModified] if the content is unchanged.
+// Returns the validator of the downloaded content (empty if the content cannot be revalidated).
+// Returns an error if the download fails with a non-retryable error - or fails every attempt.
+func download(ctx context.Context, downloadUrl string, dest string, validator string) (string, error) {
+	config := RetryConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return "", err
+	}
+	for attempt := 1; ; attempt++ {
+		current, err := downloadOnce(ctx, downloadUrl, dest, validator)
+		if err == nil || attempt >= config.Attempts || !config.isRetryable(err) {
+			return current, err
+		}
+		backoff := config.getBackoff(attempt)
+		helper.Logger(ctx).Warn("download failed - retrying", "url", downloadUrl, "attempt", attempt, "backoff", backoff, "error", err.Error())
+		err = clock.Sleep(ctx, backoff)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// Performs a single attempt at downloading a url to the target path (see [download]).
+// Returns an error if the download fails.
+func downloadOnce(ctx context.Context, downloadUrl string, dest string, validator string) (string, error) {
+	parsed, err := url.Parse(downloadUrl)
+	if err != nil {
+		return "", err
+	}
+	downloader, ok := Downloaders[parsed.Scheme]
+	if !ok {
+		return downloadHttp(ctx, parsed, dest, validator)
+	}
+	handle, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	defer handle.Close()
+	helper.Logger(ctx).Info("download", "url", downloadUrl, "file", dest)
+	writer, err := newProgressWriter(ctx, downloadUrl, 0, 0, handle)
+	if err != nil {
+		return "", err
+	}
+	err = downloader(ctx, parsed, writer)
+	if err != nil {
+		return "", err
+	}
+	writer.done()
+	return "", nil
+}
+
+// partialDownload records the url (and the validator of the response) a partial download belongs to - allowing it to be resumed
+type partialDownload struct {
+	Url       string `json:"url"`
+	Validator string `json:"validator"`
+}
+
+// Returns the paths to the partial download of a url and its [partialDownload] record.
+// Partial downloads are kept in the data directory - as the file cache removes files it doesn't track from the cache directory.
+func getPartialDownloadPaths(ctx context.Context, downloadUrl string) (string, string) {
+	digest := sha256.Sum256([]byte(downloadUrl))
+	base := filepath.Join(helper.Dirs(ctx)["data"], ".partial-downloads", hex.EncodeToString(digest[:])[:16])
+	return base, fmt.Sprintf("%s.json", base)
+}
+
+// Returns the validator used to ensure a resumed download continues the same content (i.e., a strong ETag or Last-Modified).
+// Returns an empty string if the response cannot be resumed safely.
+func getResponseValidator(response *http.Response) string {
+	etag := response.Header.Get("ETag")
+	if etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return response.Header.Get("Last-Modified")
+}
+
+// Makes a request conditional on the content having changed since it was downloaded with the given validator (see [getResponseValidator]).
+// Does nothing if the validator is empty.
+func setConditionalHeaders(request *http.Request, validator string) {
+	switch {
+	case validator == "":
+	case strings.HasPrefix(validator, `"`):
+		request.Header.Set("If-None-Match", validator)
+	default:
+		request.Header.Set("If-Modified-Since", validator)
+	}
+}
+
+// Downloads an http(s) url to the target path - resuming a previous partial download of the url (across retries and restarts) with a Range request.
+// Partial downloads are only resumed if the server confirms the content is unchanged (via If-Range).
+// Otherwise, if a validator is provided, the request is conditional (via If-None-Match or If-Modified-Since).
+// Returns the validator of the downloaded content.
+// Returns [errNotModified] if the content matches the provided validator.
+// Returns an error if the download fails.
+func downloadHttp(ctx context.Context, downloadUrl *url.URL, dest string, validator string) (string, error) {
+	partialPath, recordPath := getPartialDownloadPaths(ctx, downloadUrl.String())
+	record := partialDownload{}
+	offset := int64(0)
+	info, err := os.Stat(partialPath)
+	if err == nil {
+		data, err := os.ReadFile(recordPath)
+		if err == nil && json.Unmarshal(data, &record) == nil && record.Url == downloadUrl.String() && record.Validator != "" {
+			offset = info.Size()
+		}
+	}
+	discard := func() error {
+		return errors.Join(os.RemoveAll(partialPath), os.RemoveAll(recordPath))
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadUrl.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	for _, headerFunc := range HeaderFuncs {
+		headers, err := headerFunc(ctx, downloadUrl)
+		if err != nil {
+			return "", err
+		}
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
+	}
+	headers, _ := ctx.Value(contextKey("headers")).(map[string]string)
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	if offset > 0 {
+		helper.Logger(ctx).Info("resume download", "url", downloadUrl.String(), "file", dest, "offset", offset)
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		request.Header.Set("If-Range", record.Validator)
+	} else {
+		helper.Logger(ctx).Info("download", "url", downloadUrl.String(), "file", dest)
+		setConditionalHeaders(request, validator)
+	}
+
+	response, err := outbound.Client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	flags := os.O_CREATE | os.O_WRONLY
+	current := record.Validator
+	switch {
+	case response.StatusCode == http.StatusPartialContent && offset > 0:
+		if !strings.HasPrefix(response.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return "", errors.Join(fmt.Errorf("unexpected content range %s resuming %s", response.Header.Get("Content-Range"), downloadUrl.String()), discard())
+		}
+		flags |= os.O_APPEND
+	case response.StatusCode == http.StatusOK:
+		// the server sent the full content (i.e., the partial download was stale or range requests are unsupported)
+		flags |= os.O_TRUNC
+		current = getResponseValidator(response)
+		err = os.MkdirAll(filepath.Dir(partialPath), 0755)
+		if err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(partialDownload{Url: downloadUrl.String(), Validator: current})
+		if err != nil {
+			return "", err
+		}
+		err = fsutil.WriteFileAtomic(recordPath, data)
+		if err != nil {
+			return "", err
+		}
+	case response.StatusCode == http.StatusNotModified && offset == 0 && validator != "":
+		return "", errNotModified
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		helper.Logger(ctx).Warn("partial download cannot be resumed - restarting download", "url", downloadUrl.String())
+		err = discard()
+		if err != nil {
+			return "", err
+		}
+		return downloadHttp(ctx, downloadUrl, dest, validator)
+	default:
+		// the partial download is kept - allowing it to be resumed once the (possibly transient) failure is resolved
+		return "", &StatusError{Method: http.MethodGet, StatusCode: response.StatusCode, Url: downloadUrl.String()}
+	}
+
+	handle, err := os.OpenFile(partialPath, flags, 0644)
+	if err != nil {
+		return "", err
+	}
+	resumed := int64(0)
+	if flags&os.O_APPEND != 0 {
+		resumed = offset
+	}
+	total := response.ContentLength
+	if total > 0 {
+		total += resumed
+	}
+	writer, err := newProgressWriter(ctx, downloadUrl.String(), resumed, total, handle)
+	if err != nil {
+		return "", errors.Join(err, handle.Close())
+	}
+	chunkSize := 1024 * 1024
+	_, err = io.CopyBuffer(writer, response.Body, make([]byte, chunkSize))
+	err = errors.Join(err, handle.Close())
+	if err != nil {
+		return "", err
+	}
+	writer.done()
+
+	// partial downloads may reside on a different filesystem than the target path
+	err = os.Rename(partialPath, dest)
+	if err != nil {
+		err = fsutil.CopyFile(partialPath, dest, 0644)
+		if err != nil {
+			return "", err
+		}
+	}
+	return current, discard()
+}
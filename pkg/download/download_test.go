@@ -0,0 +1,197 @@
+package download
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// content is served by the test servers
+var content = bytes.Repeat([]byte("single-player-tarkov "), 1024)
+
+func TestGetBackoff(t *testing.T) {
+	config := RetryConfig{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	tests := []struct {
+		retry    int
+		expected time.Duration
+	}{
+		{retry: 1, expected: time.Second},
+		{retry: 2, expected: 2 * time.Second},
+		{retry: 3, expected: 4 * time.Second},
+		{retry: 4, expected: 5 * time.Second},
+		{retry: 10, expected: 5 * time.Second},
+	}
+	for _, test := range tests {
+		backoff := config.getBackoff(test.retry)
+		if backoff != test.expected {
+			t.Errorf("retry %d: got %s, expected %s", test.retry, backoff, test.expected)
+		}
+	}
+}
+
+func TestDownloadRetry(t *testing.T) {
+	tests := []struct {
+		name             string
+		failures         int
+		status           int
+		expectedErr      bool
+		expectedRequests int32
+	}{
+		{name: "transient failures", failures: 2, status: http.StatusServiceUnavailable, expectedRequests: 3},
+		{name: "too many transient failures", failures: 3, status: http.StatusServiceUnavailable, expectedErr: true, expectedRequests: 3},
+		{name: "non-retryable status", failures: 1, status: http.StatusNotFound, expectedErr: true, expectedRequests: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("DOWNLOAD_RETRY_ATTEMPTS", "3")
+			t.Setenv("DOWNLOAD_RETRY_BACKOFF", "1ms")
+			ctx := newTestContext(t)
+			requests := atomic.Int32{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) <= int32(test.failures) {
+					w.WriteHeader(test.status)
+					return
+				}
+				w.Write(content)
+			}))
+			defer server.Close()
+			dest := filepath.Join(t.TempDir(), "download")
+			err := Download(ctx, server.URL, dest)
+			if test.expectedErr {
+				statusErr := &StatusError{}
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != test.status {
+					t.Fatalf("expected status error %d, got %v", test.status, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if requests.Load() != test.expectedRequests {
+				t.Errorf("made %d requests, expected %d", requests.Load(), test.expectedRequests)
+			}
+			if test.expectedErr {
+				return
+			}
+			data, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, content) {
+				t.Error("downloaded content differs")
+			}
+		})
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	tests := []struct {
+		name          string
+		validator     string
+		expectedRange string
+	}{
+		{name: "unchanged content", validator: `"v1"`, expectedRange: "bytes=100-"},
+		{name: "changed content", validator: `"v0"`, expectedRange: "bytes=100-"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			ranges := []string{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ranges = append(ranges, r.Header.Get("Range"))
+				w.Header().Set("ETag", `"v1"`)
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+			}))
+			defer server.Close()
+
+			// a previous attempt downloaded the first 100 bytes - of the content matching the validator
+			partialPath, recordPath := getPartialDownloadPaths(ctx, server.URL)
+			err := os.MkdirAll(filepath.Dir(partialPath), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			partial := content[:100]
+			if test.validator != `"v1"` {
+				partial = bytes.Repeat([]byte("x"), 100)
+			}
+			err = os.WriteFile(partialPath, partial, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			record, _ := json.Marshal(partialDownload{Url: server.URL, Validator: test.validator})
+			err = os.WriteFile(recordPath, record, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dest := filepath.Join(t.TempDir(), "download")
+			err = Download(ctx, server.URL, dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ranges) != 1 || ranges[0] != test.expectedRange {
+				t.Errorf("requested ranges %v, expected [%s]", ranges, test.expectedRange)
+			}
+			data, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, content) {
+				t.Error("downloaded content differs")
+			}
+			for _, path := range []string{partialPath, recordPath} {
+				_, err := os.Stat(path)
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("%s was not removed", path)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadConditional(t *testing.T) {
+	modified := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name              string
+		etag              string
+		validator         string
+		expectedValidator string
+		expectedErr       error
+	}{
+		{name: "no validator", etag: `"v1"`, expectedValidator: `"v1"`},
+		{name: "etag unchanged", etag: `"v1"`, validator: `"v1"`, expectedErr: errNotModified},
+		{name: "etag changed", etag: `"v2"`, validator: `"v1"`, expectedValidator: `"v2"`},
+		{name: "weak etag falls back to last modified", etag: `W/"v1"`, expectedValidator: modified.Format(http.TimeFormat)},
+		{name: "last modified unchanged", validator: modified.Format(http.TimeFormat), expectedErr: errNotModified},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.etag != "" {
+					w.Header().Set("ETag", test.etag)
+				}
+				http.ServeContent(w, r, "", modified, bytes.NewReader(content))
+			}))
+			defer server.Close()
+			dest := filepath.Join(t.TempDir(), "download")
+			parsed, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			validator, err := downloadHttp(ctx, parsed, dest, test.validator)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expectedErr)
+			}
+			if validator != test.expectedValidator {
+				t.Errorf("got validator %s, expected %s", validator, test.expectedValidator)
+			}
+		})
+	}
+}
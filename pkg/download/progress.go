@@ -0,0 +1,147 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/limits"
+)
+
+// Bandwidth is a number of bytes per second
+type Bandwidth int64
+
+// Parses a size (e.g., '512K' or '10M') into a [Bandwidth] - the bytes transferred per second.
+// Used to parse settings from the environment.
+func (b *Bandwidth) UnmarshalText(data []byte) error {
+	if len(data) == 0 {
+		*b = 0
+		return nil
+	}
+	value, err := limits.ParseMemory(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid bandwidth %s (expected a positive size per second like '512K' or '10M')", string(data))
+	}
+	*b = Bandwidth(value)
+	return nil
+}
+
+// ProgressConfig is loaded from the environment and configures how the progress of downloads is reported - and the bandwidth downloads may use
+type ProgressConfig struct {
+	BandwidthLimit Bandwidth     `env:"DOWNLOAD_BANDWIDTH_LIMIT"`
+	Interval       time.Duration `env:"DOWNLOAD_PROGRESS_INTERVAL" envDefault:"10s"`
+}
+
+// Formats a number of bytes as a human-readable quantity
+func formatBytes(bytes int64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1fGiB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1fMiB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.1fKiB", float64(bytes)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", bytes)
+	}
+}
+
+// bandwidthLimiter caps the combined bandwidth of every download in the process - by scheduling the bytes each download receives one after another
+type bandwidthLimiter struct {
+	mutex sync.Mutex
+	next  time.Time
+}
+
+// limiter is shared by every download - so that concurrent downloads (e.g., of mods) share the bandwidth limit
+var limiter = &bandwidthLimiter{}
+
+// Waits until a number of received bytes fits within the bandwidth limit.
+// Returns an error if the context is done while waiting.
+func (bl *bandwidthLimiter) wait(ctx context.Context, limit Bandwidth, count int) error {
+	bl.mutex.Lock()
+	now := clock.Get(ctx).Now()
+	if bl.next.Before(now) {
+		bl.next = now
+	}
+	bl.next = bl.next.Add(time.Duration(count) * time.Second / time.Duration(limit))
+	delay := bl.next.Sub(now)
+	bl.mutex.Unlock()
+	return clock.Sleep(ctx, delay)
+}
+
+// progressWriter reports the progress of a download at an interval (see [ProgressConfig]) - and holds it to the bandwidth limit
+type progressWriter struct {
+	config  ProgressConfig
+	ctx     context.Context
+	last    time.Time
+	offset  int64
+	start   time.Time
+	total   int64
+	url     string
+	writer  io.Writer
+	written int64
+}
+
+// Creates a [progressWriter] for a download of a url - writing to the given writer.
+// The offset is the number of bytes downloaded previously, and the total is zero or less if unknown.
+// Returns an error if the configuration cannot be parsed.
+func newProgressWriter(ctx context.Context, url string, offset int64, total int64, writer io.Writer) (*progressWriter, error) {
+	config := ProgressConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return nil, err
+	}
+	now := clock.Get(ctx).Now()
+	return &progressWriter{config: config, ctx: ctx, last: now, offset: offset, start: now, total: total, url: url, writer: writer}, nil
+}
+
+// Returns the average rate of the download (excluding bytes downloaded previously) in bytes per second
+func (pw *progressWriter) rate(now time.Time) int64 {
+	elapsed := now.Sub(pw.start)
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(pw.written) / elapsed.Seconds())
+}
+
+// Writes data to the underlying writer - logging the progress once the interval has passed and waiting for the bandwidth limit (if set).
+func (pw *progressWriter) Write(data []byte) (int, error) {
+	count, err := pw.writer.Write(data)
+	pw.written += int64(count)
+	if err != nil {
+		return count, err
+	}
+	if pw.config.BandwidthLimit > 0 {
+		err = limiter.wait(pw.ctx, pw.config.BandwidthLimit, count)
+		if err != nil {
+			return count, err
+		}
+	}
+	now := clock.Get(pw.ctx).Now()
+	if pw.config.Interval <= 0 || now.Sub(pw.last) < pw.config.Interval {
+		return count, nil
+	}
+	pw.last = now
+	downloaded := pw.offset + pw.written
+	rate := pw.rate(now)
+	attrs := []any{"url", pw.url, "downloaded", formatBytes(downloaded), "rate", fmt.Sprintf("%s/s", formatBytes(rate))}
+	if pw.total > 0 {
+		attrs = append(attrs, "total", formatBytes(pw.total), "percent", min(100, downloaded*100/pw.total))
+		if rate > 0 {
+			remaining := float64(max(0, pw.total-downloaded)) / float64(rate)
+			attrs = append(attrs, "eta", time.Duration(remaining*float64(time.Second)).Round(time.Second))
+		}
+	}
+	helper.Logger(pw.ctx).Info("download progress", attrs...)
+	return count, nil
+}
+
+// Logs the completion of the download - its size, duration and average rate.
+func (pw *progressWriter) done() {
+	now := clock.Get(pw.ctx).Now()
+	helper.Logger(pw.ctx).Info("downloaded", "url", pw.url, "size", formatBytes(pw.offset+pw.written), "duration", now.Sub(pw.start).Round(time.Millisecond), "rate", fmt.Sprintf("%s/s", formatBytes(pw.rate(now))))
+}
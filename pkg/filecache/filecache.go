@@ -0,0 +1,136 @@
+// Package filecache serializes access to the on-disk file cache - pruning it to a size and verifying its items against their recorded checksums.
+package filecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// lock serializes access to the file cache - the helper's file cache (and its on-disk manifest) is not safe for concurrent use
+var lock sync.Mutex
+
+// errCacheMiss is returned by the fetch callback used to probe the file cache for a key (see [Lookup])
+var errCacheMiss = errors.New("cache miss")
+
+// contextKey is the type of the context key used to record that the file cache is unusable
+type contextKey string
+
+// Checks that the file cache is usable.
+// The cache directory must be writable and the squashfs tools used to store cached files must be installed.
+// Returns an error describing why the file cache is unusable.
+func check(ctx context.Context) error {
+	dir, ok := helper.Dirs(ctx)["cache"]
+	if !ok {
+		return nil
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	handle, err := os.CreateTemp(dir, ".write-check.*")
+	if err != nil {
+		return err
+	}
+	handle.Close()
+	err = os.Remove(handle.Name())
+	if err != nil {
+		return err
+	}
+	for _, tool := range []string{"mksquashfs", "unsquashfs"} {
+		_, err := exec.LookPath(tool)
+		if err != nil {
+			return fmt.Errorf("%s unavailable: %w", tool, err)
+		}
+	}
+	return nil
+}
+
+// Verifies that the file cache is usable (if enabled).
+// If the cache directory is unusable, a warning is logged and the file cache is disabled for the returned context.
+func Prepare(ctx context.Context) context.Context {
+	if !helper.FileCacheEnabled(ctx) {
+		return ctx
+	}
+	err := check(ctx)
+	if err == nil {
+		return ctx
+	}
+	helper.Logger(ctx).Warn("file cache unusable - continuing without caching", "dir", helper.Dirs(ctx)["cache"], "error", err.Error())
+	return context.WithValue(ctx, contextKey("unusable"), true)
+}
+
+// Determines whether the file cache is enabled (see [helper.FileCacheEnabled]) and usable (see [Prepare]).
+func Enabled(ctx context.Context) bool {
+	unusable, _ := ctx.Value(contextKey("unusable")).(bool)
+	return helper.FileCacheEnabled(ctx) && !unusable
+}
+
+// Caches a function by key on-disk (see [helper.CacheFile]) - serialized with all other file cache operations.
+// Cached items are verified against the checksum recorded when they were written (see [Verify]) - corrupt items are re-fetched rather than used.
+// Once cached, the file cache is pruned to CACHE_SIZE_LIMIT (see [Prune]) - evicting the least recently used items.
+// If the file cache is unusable (see [Prepare]), the fetch callback populates the destination path directly.
+// Returns an error if any file cache operation fails.
+func Cache(ctx context.Context, key string, dest string, fetch func(dest string) error) error {
+	if helper.FileCacheEnabled(ctx) && !Enabled(ctx) {
+		helper.Logger(ctx).Info("file cache unusable - fetching directly", "key", key)
+		return fetch(dest)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if helper.FileCacheEnabled(ctx) {
+		err := verifyKey(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+	err := helper.CacheFile(ctx, key, dest, fetch)
+	if err != nil || !helper.FileCacheEnabled(ctx) {
+		return err
+	}
+	err = recordKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	enforceMaxSize(ctx, key)
+	return nil
+}
+
+// Retrieves a cached key into the destination path without populating the key on a cache miss.
+// Returns false if the key is not cached (or the file cache is disabled).
+// Returns an error if any file cache operation fails.
+func Lookup(ctx context.Context, key string, dest string) (bool, error) {
+	err := Cache(ctx, key, dest, func(dest string) error {
+		return errCacheMiss
+	})
+	if errors.Is(err, errCacheMiss) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Caches a function by key on-disk like [Cache] - but runs the prefetch callback (e.g., a download) outside of the file cache lock.
+// This allows slow, independent fetches to run concurrently while the file cache itself is only accessed serially.
+// On a cache miss, the prefetch callback populates a temporary directory which the fetch callback then uses to populate the cached path.
+// Returns an error if either callback fails.
+// Returns an error if any file cache operation fails.
+func CachePrefetched(ctx context.Context, key string, dest string, prefetch func(tempDir string) error, fetch func(tempDir string, dest string) error) error {
+	cached, err := Lookup(ctx, key, dest)
+	if cached || err != nil {
+		return err
+	}
+	return helper.CreateTempDir(ctx, func(tempDir string) error {
+		err := prefetch(tempDir)
+		if err != nil {
+			return err
+		}
+		return Cache(ctx, key, dest, func(dest string) error {
+			return fetch(tempDir, dest)
+		})
+	})
+}
@@ -0,0 +1,151 @@
+package filecache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// Item is an entry of the file cache - as recorded by the helper's file cache manifest
+type Item struct {
+	IsFile       bool      `json:"isFile"`
+	Key          string    `json:"key"`
+	LastAccessed time.Time `json:"lastAccessed"`
+	LastUuid     string    `json:"lastUuid"`
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+}
+
+// manifest is the helper's file cache manifest - tracking every [Item] of the file cache
+type manifest struct {
+	Contents map[string]Item `json:"contents"`
+	Version  string          `json:"version"`
+}
+
+// Returns the path to the helper's file cache manifest
+func getManifestPath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["cache"], "manifest.json")
+}
+
+// Loads the helper's file cache manifest - returning an empty manifest if the file cache has never been used.
+// Returns an error if the manifest cannot be read or parsed.
+func loadManifest(ctx context.Context) (manifest, error) {
+	data := manifest{Contents: map[string]Item{}}
+	content, err := os.ReadFile(getManifestPath(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return data, fmt.Errorf("parse %s: %w", getManifestPath(ctx), err)
+	}
+	if data.Contents == nil {
+		data.Contents = map[string]Item{}
+	}
+	return data, nil
+}
+
+// Returns the items of the file cache in the order they're evicted (see [Prune]).
+func sortItems(ctx context.Context, contents map[string]Item) []Item {
+	uuid := helper.Uuid(ctx)
+	items := []Item{}
+	for _, item := range contents {
+		items = append(items, item)
+	}
+	slices.SortFunc(items, func(a Item, b Item) int {
+		if (a.LastUuid == uuid) != (b.LastUuid == uuid) {
+			if a.LastUuid == uuid {
+				return 1
+			}
+			return -1
+		}
+		return a.LastAccessed.Compare(b.LastAccessed)
+	})
+	return items
+}
+
+// Lists the items of the file cache - in the order they're evicted (see [Prune]).
+// Returns an error if the file cache manifest cannot be read.
+func List(ctx context.Context) ([]Item, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	data, err := loadManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sortItems(ctx, data.Contents), nil
+}
+
+// Evicts the least recently used items (see [sortItems]) until the file cache fits within a size - never evicting the kept keys.
+// Must be called while holding [lock].
+// Returns the evicted items.
+// Returns an error if the file cache manifest cannot be read or written, or an item cannot be removed.
+func prune(ctx context.Context, maxSize int64, keep ...string) ([]Item, error) {
+	data, err := loadManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(0)
+	for _, item := range data.Contents {
+		size += item.Size
+	}
+	evicted := []Item{}
+	for _, item := range sortItems(ctx, data.Contents) {
+		if size <= maxSize {
+			break
+		}
+		if slices.Contains(keep, item.Key) {
+			continue
+		}
+		helper.Logger(ctx).Info("evict cache item", "key", item.Key, "size", item.Size, "last-accessed", item.LastAccessed.Format(time.RFC3339))
+		err := os.RemoveAll(item.Path)
+		if err != nil {
+			return evicted, err
+		}
+		delete(data.Contents, item.Key)
+		size -= item.Size
+		evicted = append(evicted, item)
+	}
+	if len(evicted) == 0 {
+		return evicted, nil
+	}
+	return evicted, helper.MarshalFile(ctx, data, getManifestPath(ctx))
+}
+
+// Evicts the least recently used items of the file cache until it fits within a size (in bytes) - items used by the current run are evicted last.
+// Returns the evicted items.
+// Returns an error if the file cache manifest cannot be read or written, or an item cannot be removed.
+func Prune(ctx context.Context, maxSize int64) ([]Item, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	return prune(ctx, maxSize)
+}
+
+// Returns the size (in bytes) the file cache is pruned to after every write (CACHE_SIZE_LIMIT) - or zero if unlimited.
+func GetMaxSize(ctx context.Context) int64 {
+	return int64(helper.FileCacheSizeLimit(ctx)) * 1000 * 1000
+}
+
+// Prunes the file cache to CACHE_SIZE_LIMIT (if set) after a write - never evicting the written key.
+// Must be called while holding [lock].
+// Failures to prune are logged rather than failing the write.
+func enforceMaxSize(ctx context.Context, key string) {
+	maxSize := GetMaxSize(ctx)
+	if maxSize == 0 {
+		return
+	}
+	_, err := prune(ctx, maxSize, key)
+	if err != nil {
+		helper.Logger(ctx).Warn("prune file cache failed", "error", err.Error())
+	}
+}
@@ -0,0 +1,97 @@
+package filecache
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	// items (of 10 bytes each) - 'current' was used by the current run
+	items := []struct {
+		key          string
+		lastAccessed time.Time
+		current      bool
+	}{
+		{key: "current", lastAccessed: now.Add(-3 * time.Hour), current: true},
+		{key: "oldest", lastAccessed: now.Add(-2 * time.Hour)},
+		{key: "newest", lastAccessed: now},
+		{key: "older", lastAccessed: now.Add(-time.Hour)},
+	}
+	tests := []struct {
+		name            string
+		maxSize         int64
+		keep            []string
+		expectedEvicted []string
+	}{
+		{name: "fits", maxSize: 40, expectedEvicted: []string{}},
+		{name: "least recently used first", maxSize: 25, expectedEvicted: []string{"oldest", "older"}},
+		{name: "current run last", maxSize: 5, expectedEvicted: []string{"oldest", "older", "newest", "current"}},
+		{name: "kept keys", maxSize: 15, keep: []string{"oldest"}, expectedEvicted: []string{"older", "newest", "current"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			data := manifest{Contents: map[string]Item{}, Version: "1"}
+			for _, item := range items {
+				path := filepath.Join(helper.Dirs(ctx)["cache"], item.key)
+				err := os.WriteFile(path, make([]byte, 10), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				uuid := "previous-run"
+				if item.current {
+					uuid = helper.Uuid(ctx)
+				}
+				data.Contents[item.key] = Item{IsFile: true, Key: item.key, LastAccessed: item.lastAccessed, LastUuid: uuid, Path: path, Size: 10}
+			}
+			err := helper.MarshalFile(ctx, data, getManifestPath(ctx))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			listed, err := List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			order := []string{}
+			for _, item := range listed {
+				order = append(order, item.Key)
+			}
+			expectedOrder := []string{"oldest", "older", "newest", "current"}
+			if !slices.Equal(order, expectedOrder) {
+				t.Errorf("listed %v, expected %v", order, expectedOrder)
+			}
+
+			lock.Lock()
+			evicted, err := prune(ctx, test.maxSize, test.keep...)
+			lock.Unlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys := []string{}
+			for _, item := range evicted {
+				keys = append(keys, item.Key)
+				_, err := os.Stat(item.Path)
+				if !os.IsNotExist(err) {
+					t.Errorf("evicted item %s still exists", item.Key)
+				}
+			}
+			if !slices.Equal(keys, test.expectedEvicted) {
+				t.Errorf("evicted %v, expected %v", keys, test.expectedEvicted)
+			}
+			remaining, err := List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(remaining) != len(items)-len(keys) {
+				t.Errorf("manifest holds %d items, expected %d", len(remaining), len(items)-len(keys))
+			}
+		})
+	}
+}
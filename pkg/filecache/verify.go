@@ -0,0 +1,185 @@
+package filecache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// Verification statuses of file cache items (see [Verify])
+const (
+	VerifyCorrupt  = "corrupt"
+	VerifyMissing  = "missing"
+	VerifyOk       = "ok"
+	VerifyRecorded = "recorded"
+)
+
+// VerifyResult is the outcome of verifying an item of the file cache (see [Verify])
+type VerifyResult struct {
+	Item   Item
+	Status string
+}
+
+// Returns the path to the checksums of the items of the file cache
+func getChecksumsPath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "cache-checksums.json")
+}
+
+// Loads the checksums recorded for the items of the file cache - keyed by key.
+// Returns an error if the checksums exist but cannot be read.
+func loadChecksums(ctx context.Context) (map[string]string, error) {
+	checksums := map[string]string{}
+	data, err := os.ReadFile(getChecksumsPath(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return checksums, nil
+	}
+	if err != nil {
+		return checksums, err
+	}
+	err = json.Unmarshal(data, &checksums)
+	return checksums, err
+}
+
+// Saves the checksums recorded for the items of the file cache, dropping those of evicted items.
+// Returns an error if the checksums cannot be written.
+func saveChecksums(ctx context.Context, checksums map[string]string, data manifest) error {
+	for key := range checksums {
+		_, ok := data.Contents[key]
+		if !ok {
+			delete(checksums, key)
+		}
+	}
+	content, err := json.MarshalIndent(checksums, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(getChecksumsPath(ctx), content)
+}
+
+// Verifies an item of the file cache against its recorded checksum - recording its checksum if none was recorded.
+// Corrupt and missing items are removed from the manifest (and their files from the cache directory) so that they're re-fetched on next use.
+// Must be called while holding [lock].
+// Returns an error if the item cannot be read or removed.
+func verifyItem(ctx context.Context, data manifest, checksums map[string]string, item Item) (string, error) {
+	_, err := os.Lstat(item.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		delete(data.Contents, item.Key)
+		return VerifyMissing, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	checksum, err := fsutil.HashFile(item.Path)
+	if err != nil {
+		return "", err
+	}
+	expected, ok := checksums[item.Key]
+	if !ok {
+		checksums[item.Key] = checksum
+		return VerifyRecorded, nil
+	}
+	if checksum == expected {
+		return VerifyOk, nil
+	}
+	helper.Logger(ctx).Warn("CORRUPT CACHE ITEM - removing it so that it's re-fetched", "key", item.Key, "path", item.Path, "checksum", checksum, "expected", expected)
+	err = os.RemoveAll(item.Path)
+	if err != nil {
+		return "", err
+	}
+	delete(data.Contents, item.Key)
+	return VerifyCorrupt, nil
+}
+
+// Verifies a key of the file cache (if cached) before it's used - removing it if it's corrupt so that it's re-fetched rather than installed.
+// Must be called while holding [lock].
+// Returns an error if the file cache manifest or checksums cannot be read or written.
+func verifyKey(ctx context.Context, key string) error {
+	data, err := loadManifest(ctx)
+	if err != nil {
+		return err
+	}
+	item, ok := data.Contents[key]
+	if !ok {
+		return nil
+	}
+	checksums, err := loadChecksums(ctx)
+	if err != nil {
+		return err
+	}
+	status, err := verifyItem(ctx, data, checksums, item)
+	if err != nil {
+		return err
+	}
+	if status == VerifyCorrupt || status == VerifyMissing {
+		err = helper.MarshalFile(ctx, data, getManifestPath(ctx))
+		if err != nil {
+			return err
+		}
+	}
+	return saveChecksums(ctx, checksums, data)
+}
+
+// Records the checksum of a key of the file cache once it's been written - unless a checksum was already recorded.
+// Must be called while holding [lock].
+// Returns an error if the file cache manifest or checksums cannot be read or written.
+func recordKey(ctx context.Context, key string) error {
+	data, err := loadManifest(ctx)
+	if err != nil {
+		return err
+	}
+	checksums, err := loadChecksums(ctx)
+	if err != nil {
+		return err
+	}
+	item, ok := data.Contents[key]
+	_, recorded := checksums[key]
+	if !ok || recorded {
+		return nil
+	}
+	checksums[key], err = fsutil.HashFile(item.Path)
+	if err != nil {
+		return err
+	}
+	return saveChecksums(ctx, checksums, data)
+}
+
+// Verifies every item of the file cache against the checksum recorded when it was written (see [Cache]).
+// Corrupt and missing items are removed, so that they're re-fetched on next use.
+// Items without a recorded checksum (i.e., cached by an older version) have their checksum recorded instead.
+// Returns the outcome of verifying each item.
+// Returns an error if the file cache manifest or checksums cannot be read or written.
+// Returns an error if an item cannot be read or removed.
+func Verify(ctx context.Context) ([]VerifyResult, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	data, err := loadManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := loadChecksums(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := []VerifyResult{}
+	removed := false
+	for _, item := range sortItems(ctx, data.Contents) {
+		status, err := verifyItem(ctx, data, checksums, item)
+		if err != nil {
+			return results, err
+		}
+		removed = removed || status == VerifyCorrupt || status == VerifyMissing
+		results = append(results, VerifyResult{Item: item, Status: status})
+	}
+	if removed {
+		err = helper.MarshalFile(ctx, data, getManifestPath(ctx))
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, saveChecksums(ctx, checksums, data)
+}
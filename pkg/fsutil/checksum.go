@@ -0,0 +1,155 @@
+package fsutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// Computes the sha256 checksum of a file, returned as a 'sha256:<hex>' string.
+// Returns an error if the file cannot be read.
+func HashFile(path string) (string, error) {
+	handle, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer handle.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, handle)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%s", hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+// Computes the checksums (see [HashFile]) of several files (relative to a root directory) in parallel.
+// Returns a map of file -> checksum - files that don't exist are omitted.
+// Returns an error if a file cannot be read.
+func HashFiles(root string, files []string) (map[string]string, error) {
+	checksums := map[string]string{}
+	errs := []error{}
+	lock := sync.Mutex{}
+	queue := make(chan string)
+	group := sync.WaitGroup{}
+	for range min(runtime.NumCPU(), len(files)) {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for file := range queue {
+				checksum, err := HashFile(filepath.Join(root, file))
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				lock.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					checksums[file] = checksum
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, file := range files {
+		queue <- file
+	}
+	close(queue)
+	group.Wait()
+	return checksums, errors.Join(errs...)
+}
+
+// Computes a checksum of a directory tree's regular files and their contents, returned as a 'sha256:<hex>' string.
+// The checksum of a file is its own checksum (see [HashFile]) - symlinks are resolved.
+// Returns an error if the tree cannot be walked or a file cannot be read.
+func HashTree(path string) (string, error) {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return HashFile(path)
+	}
+	files := []string{}
+	err = filepath.WalkDir(path, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		relPath, err := filepath.Rel(path, current)
+		if err != nil {
+			return err
+		}
+		files = append(files, relPath)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	checksums, err := HashFiles(path, files)
+	if err != nil {
+		return "", err
+	}
+	slices.Sort(files)
+	hash := sha256.New()
+	for _, file := range files {
+		fmt.Fprintf(hash, "%s\x00%s\n", filepath.ToSlash(file), checksums[file])
+	}
+	return fmt.Sprintf("sha256:%s", hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+// Normalizes a checksum into a 'sha256:<hex>' string.
+// Checksums without an algorithm prefix are assumed to be sha256.
+// Returns an error if the checksum uses an unsupported algorithm or is malformed.
+func NormalizeChecksum(checksum string) (string, error) {
+	algorithm, value, ok := strings.Cut(checksum, ":")
+	if !ok {
+		algorithm = "sha256"
+		value = checksum
+	}
+	if strings.ToLower(algorithm) != "sha256" {
+		return "", fmt.Errorf("unsupported checksum algorithm %s", algorithm)
+	}
+	value = strings.ToLower(value)
+	decoded, err := hex.DecodeString(value)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("malformed sha256 checksum %s", value)
+	}
+	return fmt.Sprintf("sha256:%s", value), nil
+}
+
+// Verifies that a file matches an expected checksum.
+// Does nothing if the expected checksum is empty.
+// Returns an error if the checksum does not match.
+func VerifyChecksum(ctx context.Context, path string, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	expected, err := NormalizeChecksum(expected)
+	if err != nil {
+		return err
+	}
+	actual, err := HashFile(path)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("checksum mismatch for %s (expected %s, got %s)", path, expected, actual)
+	}
+	helper.Logger(ctx).Info("checksum verified", "path", path, "checksum", actual)
+	return nil
+}
@@ -0,0 +1,104 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// digest is the sha256 digest of 'hello'
+const digest = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func TestNormalizeChecksum(t *testing.T) {
+	tests := []struct {
+		checksum    string
+		expected    string
+		expectedErr bool
+	}{
+		{checksum: digest, expected: "sha256:" + digest},
+		{checksum: "SHA256:" + strings.ToUpper(digest), expected: "sha256:" + digest},
+		{checksum: "md5:5d41402abc4b2a76b9719d911017c592", expectedErr: true},
+		{checksum: "sha256:abc", expectedErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.checksum, func(t *testing.T) {
+			normalized, err := NormalizeChecksum(test.checksum)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if normalized != test.expected {
+				t.Errorf("got %s, expected %s", normalized, test.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	tests := []struct {
+		name        string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "match", expected: digest},
+		{name: "unverified", expected: ""},
+		{name: "mismatch", expected: strings.Repeat("0", 64), expectedErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			path := filepath.Join(t.TempDir(), "file")
+			err := WriteFileAtomic(path, []byte("hello"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = VerifyChecksum(ctx, path, test.expected)
+			if (err != nil) != test.expectedErr {
+				t.Errorf("got %v, expected error: %t", err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestHashTree(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+	for _, root := range []string{first, second} {
+		err := os.MkdirAll(filepath.Join(root, "nested"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(root, "nested", "file"), []byte("hello"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	hashes := []string{}
+	for _, root := range []string{first, second} {
+		hash, err := HashTree(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if hashes[0] != hashes[1] {
+		t.Errorf("identical trees hash differently (%s, %s)", hashes[0], hashes[1])
+	}
+	err := os.WriteFile(filepath.Join(second, "nested", "file"), []byte("changed"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := HashTree(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == hashes[0] {
+		t.Error("changed tree hashes identically")
+	}
+}
@@ -0,0 +1,286 @@
+// Package fsutil provides filesystem helpers for copying, writing, checksumming and watching files.
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// Copies a single file from src to dest (creating parent directories as needed), preserving its mode.
+// Returns an error if the copy fails.
+func CopyFile(src string, dest string, mode fs.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+	srcHandle, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcHandle.Close()
+	err = os.RemoveAll(dest)
+	if err != nil {
+		return err
+	}
+	destHandle, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer destHandle.Close()
+	_, err = io.Copy(destHandle, srcHandle)
+	return err
+}
+
+// Copies the contents of the src directory into the dest directory, overwriting existing files.
+// Returns the copied files (and symlinks) relative to dest, sorted.
+// Returns an error if the copy fails.
+func CopyTree(ctx context.Context, src string, dest string) ([]string, error) {
+	helper.Logger(ctx).Info("copy tree", "src", src, "dest", dest)
+	files := []string{}
+	err := filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		destPath := filepath.Join(dest, relPath)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(destPath, 0755)
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			err = os.RemoveAll(destPath)
+			if err != nil {
+				return err
+			}
+			err = os.Symlink(target, destPath)
+			if err != nil {
+				return err
+			}
+		default:
+			err = CopyFile(path, destPath, info.Mode())
+			if err != nil {
+				return err
+			}
+		}
+		files = append(files, relPath)
+		return nil
+	})
+	slices.Sort(files)
+	return files, err
+}
+
+// Determines whether a file (relative to root) is reached through a symlinked directory.
+// Returns an error if a parent directory cannot be inspected.
+func isBeneathSymlink(root string, file string) (bool, error) {
+	dir := filepath.Dir(file)
+	for dir != "." && dir != string(filepath.Separator) {
+		info, err := os.Lstat(filepath.Join(root, dir))
+		if errors.Is(err, os.ErrNotExist) {
+			dir = filepath.Dir(dir)
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return true, nil
+		}
+		dir = filepath.Dir(dir)
+	}
+	return false, nil
+}
+
+// Removes the given files (relative to root), and then removes any parent directories left empty - stopping at root or at any of the kept directories.
+// Files reached through a symlinked directory (or since replaced by a directory) are skipped so that removals never reach outside of root.
+// Returns an error if a removal fails.
+func RemoveFiles(ctx context.Context, root string, files []string, keepDirs ...string) error {
+	dirs := map[string]bool{}
+	for _, file := range files {
+		beneathSymlink, err := isBeneathSymlink(root, file)
+		if err != nil {
+			return err
+		}
+		if beneathSymlink {
+			continue
+		}
+		path := filepath.Join(root, file)
+		info, err := os.Lstat(path)
+		if err == nil && info.IsDir() {
+			// the file has since been replaced by a directory (e.g., a symlink replaced by a copy) that is owned elsewhere
+			continue
+		}
+		err = os.Remove(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		dirs[filepath.Dir(path)] = true
+	}
+
+	keep := map[string]bool{filepath.Clean(root): true}
+	for _, keepDir := range keepDirs {
+		keep[filepath.Join(root, keepDir)] = true
+	}
+	// deepest directories first so that emptied parents are pruned too
+	sorted := helper.Map[string, bool](dirs).Keys()
+	slices.SortFunc(sorted, func(a string, b string) int {
+		return len(b) - len(a)
+	})
+	for _, dir := range sorted {
+		for !keep[dir] && len(dir) > len(root) {
+			entries, err := os.ReadDir(dir)
+			if errors.Is(err, os.ErrNotExist) {
+				dir = filepath.Dir(dir)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if len(entries) > 0 {
+				break
+			}
+			err = os.Remove(dir)
+			if err != nil {
+				return err
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+	return nil
+}
+
+// Writes a file by writing (and syncing) a temporary file which is then renamed over the destination.
+// Returns an error if any step fails.
+func WriteFileAtomic(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	handle, err := os.CreateTemp(filepath.Dir(path), fmt.Sprintf(".%s.*", filepath.Base(path)))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(handle.Name())
+	_, err = handle.Write(data)
+	if err == nil {
+		err = handle.Sync()
+	}
+	closeErr := handle.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(handle.Name(), path)
+}
+
+// Moves a file, directory or symlink from src to dest (creating parent directories as needed), replacing anything already at dest.
+// Falls back to copying src when src and dest are on different filesystems.
+// The copy is staged beside dest and renamed into place before src is removed.
+// Returns an error if the move fails.
+func MoveTree(ctx context.Context, src string, dest string) error {
+	err := os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(dest)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(src, dest)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	staging := filepath.Join(filepath.Dir(dest), fmt.Sprintf(".%s.moving", filepath.Base(dest)))
+	err = os.RemoveAll(staging)
+	if err != nil {
+		return err
+	}
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		err = os.Symlink(target, staging)
+		if err != nil {
+			return err
+		}
+	} else {
+		_, err = CopyTree(ctx, src, staging)
+		if err != nil {
+			return err
+		}
+	}
+	err = os.Rename(staging, dest)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// Recreates the src directory tree at dest with hard links - so that large trees (e.g., installed mods) are duplicated without copying their contents.
+// Files that cannot be linked (e.g., as src and dest are on different filesystems) are copied instead - symlinks are recreated.
+// Files are never modified in place by [CopyFile], so linked files are unaffected when their originals are later replaced.
+// Returns an error if dest already exists.
+// Returns an error if the tree cannot be recreated.
+func LinkTree(ctx context.Context, src string, dest string) error {
+	helper.Logger(ctx).Info("link tree", "src", src, "dest", dest)
+	_, err := os.Lstat(dest)
+	if err == nil {
+		return fmt.Errorf("link tree: %s already exists", dest)
+	}
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		destPath := filepath.Join(dest, relPath)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(destPath, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, destPath)
+		default:
+			err = os.Link(path, destPath)
+			if err == nil {
+				return nil
+			}
+			return CopyFile(path, destPath, info.Mode())
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Volume describes the filesystem holding a path
+type Volume struct {
+	// Device identifies the filesystem - paths with the same device share their free space
+	Device uint64
+	// Free is the space (in bytes) available to unprivileged users
+	Free int64
+}
+
+// Returns the filesystem holding a path (see [Volume]) - paths that don't exist yet are resolved to their nearest existing parent.
+// Returns an error if the filesystem cannot be inspected.
+func GetVolume(path string) (Volume, error) {
+	volume := Volume{}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return volume, err
+	}
+	info, err := os.Stat(path)
+	for errors.Is(err, os.ErrNotExist) && filepath.Dir(path) != path {
+		path = filepath.Dir(path)
+		info, err = os.Stat(path)
+	}
+	if err != nil {
+		return volume, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if ok {
+		volume.Device = uint64(stat.Dev)
+	}
+	fsStat := syscall.Statfs_t{}
+	err = syscall.Statfs(path, &fsStat)
+	if err != nil {
+		return volume, err
+	}
+	volume.Free = int64(fsStat.Bavail) * int64(fsStat.Bsize)
+	return volume, nil
+}
@@ -0,0 +1,72 @@
+package fsutil
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// WatchEvent is a change to a file within a watched directory (see [WatchDir])
+type WatchEvent struct {
+	// Name is the name of the changed file (relative to the watched directory)
+	Name string
+	// Removed is true if the file was deleted or moved out of the directory - otherwise the file was written (or moved into the directory)
+	Removed bool
+}
+
+// watchMask are the inotify events reported by [WatchDir] - files are reported once written and closed so that partial writes are never observed
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_DELETE | syscall.IN_MOVED_FROM
+
+// Watches a directory (but not its subdirectories) with inotify until the context is done.
+// Returns an error if the directory cannot be watched.
+// Returns an error if reading events fails.
+func WatchDir(ctx context.Context, dir string, handler func(event WatchEvent)) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	// a non-blocking file is registered with the runtime's poller - so that closing the file interrupts a pending read
+	file := os.NewFile(uintptr(fd), "inotify")
+	_, err = syscall.InotifyAddWatch(fd, dir, watchMask)
+	if err != nil {
+		file.Close()
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	helper.Logger(ctx).Info("watch directory", "path", dir)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		file.Close()
+	}()
+
+	buffer := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		count, err := file.Read(buffer)
+		if errors.Is(err, os.ErrClosed) && ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			mask := binary.NativeEndian.Uint32(buffer[offset+4:])
+			length := int(binary.NativeEndian.Uint32(buffer[offset+12:]))
+			name := strings.TrimRight(string(buffer[offset+syscall.SizeofInotifyEvent:offset+syscall.SizeofInotifyEvent+length]), "\x00")
+			offset += syscall.SizeofInotifyEvent + length
+			if name == "" || mask&syscall.IN_ISDIR != 0 {
+				continue
+			}
+			handler(WatchEvent{Name: name, Removed: mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0})
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Package jobs runs named units of work on demand and on schedules, persisting each job's most recent run.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// Job is a named unit of work - run on demand and (optionally) on a schedule (see [ParseSchedule])
+type Job struct {
+	// Jitter is the maximum random delay added to each scheduled run - spreading out jobs sharing a schedule
+	Jitter   time.Duration
+	Name     string
+	Run      func(ctx context.Context) error
+	Schedule string
+}
+
+// Jobs is a list of [Job]
+type Jobs []Job
+
+// Returns the job with the given name - or nil if no such job exists
+func (js Jobs) Get(name string) *Job {
+	for index := range js {
+		if js[index].Name == name {
+			return &js[index]
+		}
+	}
+	return nil
+}
+
+// State records the most recent run of a job - persisted in the data directory so that it survives restarts
+type State struct {
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	LastRun  time.Time     `json:"lastRun"`
+}
+
+// ErrRunning is returned when a job is run while a previous run (in this or another process) has not finished
+var ErrRunning = errors.New("job already running")
+
+// Returns the directory holding the state (and locks) of jobs
+func getJobsDir(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "jobs")
+}
+
+// Loads the state of a job's most recent run.
+// Returns nil if the job has never run.
+// Returns an error if the state exists but cannot be read.
+func LoadState(ctx context.Context, name string) (*State, error) {
+	data, err := os.ReadFile(filepath.Join(getJobsDir(ctx), fmt.Sprintf("%s.json", name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := State{}
+	err = json.Unmarshal(data, &state)
+	return &state, err
+}
+
+// Acquires an exclusive lock for a job - shared between processes - returning a function releasing the lock.
+// Returns [ErrRunning] if the lock is held elsewhere.
+// Returns an error if the lock file cannot be opened.
+func lock(ctx context.Context, name string) (func(), error) {
+	err := os.MkdirAll(getJobsDir(ctx), 0755)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := os.OpenFile(filepath.Join(getJobsDir(ctx), fmt.Sprintf("%s.lock", name)), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(handle.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		handle.Close()
+		return nil, ErrRunning
+	}
+	if err != nil {
+		handle.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(handle.Fd()), syscall.LOCK_UN)
+		handle.Close()
+	}, nil
+}
+
+// Runs a job once - holding the job's lock while it runs and recording the run's state afterwards.
+// Returns [ErrRunning] if the job is already running.
+// Returns an error if the job fails.
+// Returns an error if the job's state cannot be written.
+func Run(ctx context.Context, job Job) error {
+	unlock, err := lock(ctx, job.Name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	helper.Logger(ctx).Info("run job", "name", job.Name)
+	jobClock := clock.Get(ctx)
+	start := jobClock.Now()
+	runErr := job.Run(ctx)
+	state := State{Duration: jobClock.Now().Sub(start), LastRun: start}
+	if runErr != nil {
+		state.Error = runErr.Error()
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return errors.Join(runErr, err)
+	}
+	err = fsutil.WriteFileAtomic(filepath.Join(getJobsDir(ctx), fmt.Sprintf("%s.json", job.Name)), data)
+	return errors.Join(runErr, err)
+}
+
+// Returns the next time a scheduled job runs after the given time - or the zero time if the job is unscheduled.
+// Interval schedules resume from the job's last run (if known) - so that restarts don't postpone them. Missed runs are not caught up on.
+// Jitter is not included.
+// Returns an error if the job's schedule is malformed.
+func Next(ctx context.Context, job Job, after time.Time) (time.Time, error) {
+	if job.Schedule == "" {
+		return time.Time{}, nil
+	}
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	_, isInterval := schedule.(intervalSchedule)
+	if !isInterval {
+		return schedule.Next(after), nil
+	}
+	state, err := LoadState(ctx, job.Name)
+	if err != nil || state == nil {
+		return schedule.Next(after), err
+	}
+	next := schedule.Next(state.LastRun)
+	if next.Before(after) {
+		return schedule.Next(after), nil
+	}
+	return next, nil
+}
+
+// Runs a function while running scheduled jobs - and stops scheduling jobs once the function returns.
+// Jobs without a schedule are skipped.
+// Failed (and overlapping) runs are logged - the job runs again at its next scheduled time.
+// Returns an error if the function fails.
+func ScheduleWhile(ctx context.Context, jobs Jobs, run func() error) error {
+	scheduleCtx, cancel := context.WithCancel(ctx)
+	wg := sync.WaitGroup{}
+	for _, job := range jobs {
+		if job.Schedule == "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jobClock := clock.Get(scheduleCtx)
+			for {
+				next, err := Next(scheduleCtx, job, jobClock.Now())
+				if err != nil {
+					helper.Logger(ctx).Error("schedule job failed", "name", job.Name, "error", err.Error())
+					return
+				}
+				if next.IsZero() {
+					helper.Logger(ctx).Warn("job schedule never fires", "name", job.Name, "schedule", job.Schedule)
+					return
+				}
+				if job.Jitter > 0 {
+					next = next.Add(rand.N(job.Jitter))
+				}
+				helper.Logger(ctx).Info("scheduled job", "name", job.Name, "next", next)
+				err = clock.Sleep(scheduleCtx, next.Sub(jobClock.Now()))
+				if err != nil {
+					return
+				}
+				err = Run(scheduleCtx, job)
+				if errors.Is(err, ErrRunning) {
+					helper.Logger(ctx).Warn("job still running - skipping scheduled run", "name", job.Name)
+				} else if err != nil && !errors.Is(err, context.Canceled) {
+					helper.Logger(ctx).Warn("job failed", "name", job.Name, "error", err.Error())
+				}
+			}
+		}()
+	}
+
+	err := run()
+	cancel()
+	wg.Wait()
+	return err
+}
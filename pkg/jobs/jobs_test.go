@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		expectedError string
+	}{
+		{name: "success"},
+		{name: "failure", err: errors.New("boom"), expectedError: "boom"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			job := Job{Name: "job", Run: func(ctx context.Context) error {
+				// a run overlapping this one is rejected
+				err := Run(ctx, Job{Name: "job", Run: func(ctx context.Context) error { return nil }})
+				if !errors.Is(err, ErrRunning) {
+					t.Errorf("expected overlapping run to fail with ErrRunning, got %v", err)
+				}
+				return test.err
+			}}
+			err := Run(ctx, job)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got %v, expected %v", err, test.err)
+			}
+			state, err := LoadState(ctx, "job")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state == nil || state.LastRun.IsZero() || state.Error != test.expectedError {
+				t.Errorf("got state %+v, expected error %q", state, test.expectedError)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		schedule string
+		lastRun  time.Time
+		expected time.Time
+	}{
+		{name: "unscheduled", schedule: ""},
+		{name: "interval without runs", schedule: "6h", expected: now.Add(6 * time.Hour)},
+		{name: "interval resumes from last run", schedule: "6h", lastRun: now.Add(-time.Hour), expected: now.Add(5 * time.Hour)},
+		{name: "missed interval runs are skipped", schedule: "6h", lastRun: now.Add(-24 * time.Hour), expected: now.Add(6 * time.Hour)},
+		{name: "daily ignores last run", schedule: "04:00", lastRun: now.Add(-time.Hour), expected: time.Date(2025, 1, 2, 4, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			job := Job{Name: "job", Run: func(ctx context.Context) error { return nil }, Schedule: test.schedule}
+			if !test.lastRun.IsZero() {
+				data, err := json.Marshal(State{LastRun: test.lastRun})
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.MkdirAll(getJobsDir(ctx), 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.WriteFile(filepath.Join(getJobsDir(ctx), "job.json"), data, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			next, err := Next(ctx, job, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !next.Equal(test.expected) {
+				t.Errorf("got %s, expected %s", next, test.expected)
+			}
+		})
+	}
+}
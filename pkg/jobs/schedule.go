@@ -0,0 +1,228 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule determines when a scheduled job runs
+type Schedule interface {
+	// Returns the next time the schedule fires after the given time - or the zero time if it never fires
+	Next(after time.Time) time.Time
+}
+
+// intervalSchedule fires repeatedly with a fixed interval between runs (e.g., '6h')
+type intervalSchedule time.Duration
+
+// Returns the time an interval after the given time.
+// Implements [Schedule].
+func (is intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(is))
+}
+
+// dailySchedule fires once a day at a fixed time (e.g., '04:00')
+type dailySchedule struct {
+	hour   int
+	minute int
+}
+
+// Returns the next occurrence of the daily time after the given time.
+// Implements [Schedule].
+func (ds dailySchedule) Next(after time.Time) time.Time {
+	next := time.Date(after.Year(), after.Month(), after.Day(), ds.hour, ds.minute, 0, 0, after.Location())
+	if !next.After(after) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// cronSchedule fires at the times matching a (5-field) cron expression - each field is the set of matching values
+type cronSchedule struct {
+	minutes     map[int]bool
+	hours       map[int]bool
+	daysOfMonth map[int]bool
+	months      map[int]bool
+	daysOfWeek  map[int]bool
+	// anyDay is true if neither the day of month nor the day of week is restricted
+	anyDay bool
+	// bothDays is true if both the day of month and the day of week are restricted - in which case either matching is sufficient (as with cron)
+	bothDays bool
+}
+
+// cronDescriptors are the supported cron shorthands and the expressions they stand for
+var cronDescriptors = map[string]string{
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// Parses a single cron field (e.g., '*', '1,15', '9-17', '*/15', '0-30/10') into the set of values it matches.
+// Returns an error if the field is malformed or contains values outside of [low, high].
+func parseCronField(field string, low int, high int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			parsed, err := strconv.Atoi(stepPart)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid step %s", stepPart)
+			}
+			step = parsed
+		}
+		start, end := low, high
+		if rangePart != "*" {
+			startPart, endPart, isRange := strings.Cut(rangePart, "-")
+			parsed, err := strconv.Atoi(startPart)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %s", startPart)
+			}
+			start, end = parsed, parsed
+			if isRange {
+				parsed, err := strconv.Atoi(endPart)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %s", endPart)
+				}
+				end = parsed
+			} else if hasStep {
+				end = high
+			}
+		}
+		if start < low || end > high || start > end {
+			return nil, fmt.Errorf("%s out of range (%d-%d)", rangePart, low, high)
+		}
+		for value := start; value <= end; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+// Parses a (5-field) cron expression - 'minute hour day-of-month month day-of-week' - or a cron descriptor (e.g., '@daily').
+// Returns an error if the expression is malformed.
+func parseCronSchedule(expression string) (cronSchedule, error) {
+	descriptor, ok := cronDescriptors[expression]
+	if ok {
+		expression = descriptor
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("cron expression %s must have 5 fields", expression)
+	}
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := []map[int]bool{}
+	for index, field := range fields {
+		set, err := parseCronField(field, bounds[index][0], bounds[index][1])
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("cron expression %s: %w", expression, err)
+		}
+		sets = append(sets, set)
+	}
+	// sunday is both 0 and 7
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+	anyDayOfMonth := fields[2] == "*"
+	anyDayOfWeek := fields[4] == "*"
+	return cronSchedule{
+		minutes:     sets[0],
+		hours:       sets[1],
+		daysOfMonth: sets[2],
+		months:      sets[3],
+		daysOfWeek:  sets[4],
+		anyDay:      anyDayOfMonth && anyDayOfWeek,
+		bothDays:    !anyDayOfMonth && !anyDayOfWeek,
+	}, nil
+}
+
+// Determines whether the cron expression matches the day of the given time
+func (cs cronSchedule) matchesDay(t time.Time) bool {
+	if cs.anyDay {
+		return true
+	}
+	dayOfMonth := cs.daysOfMonth[t.Day()]
+	dayOfWeek := cs.daysOfWeek[int(t.Weekday())]
+	if cs.bothDays {
+		return dayOfMonth || dayOfWeek
+	}
+	return dayOfMonth && dayOfWeek
+}
+
+// daysInMonth is the number of days of each month (in a leap year)
+var daysInMonth = map[int]int{1: 31, 2: 29, 3: 31, 4: 30, 5: 31, 6: 30, 7: 31, 8: 31, 9: 30, 10: 31, 11: 30, 12: 31}
+
+// Determines whether the cron expression ever fires - i.e., whether a day of the month it matches exists in one of its months.
+// Expressions matching either the day of month or the day of week always fire, as every day of the week occurs in every month.
+func (cs cronSchedule) fires() bool {
+	if cs.anyDay || cs.bothDays {
+		return true
+	}
+	for month := range cs.months {
+		for day := range cs.daysOfMonth {
+			if day <= daysInMonth[month] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cronSearchLimit bounds how far into the future the next time a cron expression fires is searched for
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// Returns the next time (at minute granularity) matching the cron expression after the given time.
+// Implements [Schedule].
+func (cs cronSchedule) Next(after time.Time) time.Time {
+	location := after.Location()
+	next := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute()+1, 0, 0, location)
+	limit := after.Add(cronSearchLimit)
+	for next.Before(limit) {
+		switch {
+		case !cs.months[int(next.Month())]:
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, location)
+		case !cs.matchesDay(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, location)
+		case !cs.hours[next.Hour()]:
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, location)
+		case !cs.minutes[next.Minute()]:
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour(), next.Minute()+1, 0, 0, location)
+		case !next.After(after):
+			// wall clock times repeated when daylight saving time ends resolve to their first occurrence
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// Parses a schedule - either an interval (e.g., '6h'), a daily time (e.g., '04:00') or a cron expression (e.g., '0 4 * * *' or '@daily').
+// Returns an error if the schedule is malformed or never fires.
+func ParseSchedule(schedule string) (Schedule, error) {
+	interval, err := time.ParseDuration(schedule)
+	if err == nil {
+		if interval <= 0 {
+			return nil, fmt.Errorf("schedule interval must be positive (got %s)", schedule)
+		}
+		return intervalSchedule(interval), nil
+	}
+	daily, err := time.Parse("15:04", schedule)
+	if err == nil {
+		return dailySchedule{hour: daily.Hour(), minute: daily.Minute()}, nil
+	}
+	if !strings.HasPrefix(schedule, "@") && len(strings.Fields(schedule)) != 5 {
+		return nil, fmt.Errorf("invalid schedule %s (expected an interval like '6h', a daily time like '04:00' or a cron expression like '0 4 * * *')", schedule)
+	}
+	cron, err := parseCronSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
+	if !cron.fires() {
+		return nil, fmt.Errorf("cron expression %s never fires", schedule)
+	}
+	return cron, nil
+}
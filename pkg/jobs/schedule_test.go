@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	after := time.Date(2025, 3, 14, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		schedule    string
+		expected    time.Time
+		expectedErr bool
+	}{
+		{schedule: "6h", expected: after.Add(6 * time.Hour)},
+		{schedule: "04:00", expected: time.Date(2025, 3, 15, 4, 0, 0, 0, time.UTC)},
+		{schedule: "23:15", expected: time.Date(2025, 3, 14, 23, 15, 0, 0, time.UTC)},
+		{schedule: "0 4 * * *", expected: time.Date(2025, 3, 15, 4, 0, 0, 0, time.UTC)},
+		{schedule: "*/15 * * * *", expected: time.Date(2025, 3, 14, 10, 45, 0, 0, time.UTC)},
+		{schedule: "0 9-17 * * 1-5", expected: time.Date(2025, 3, 14, 11, 0, 0, 0, time.UTC)},
+		// 2025-03-14 is a friday - either day field matching is sufficient when both are restricted
+		{schedule: "0 0 1 * 0", expected: time.Date(2025, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{schedule: "@monthly", expected: time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{schedule: "0 0 * * 7", expected: time.Date(2025, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{schedule: "-1h", expectedErr: true},
+		{schedule: "soon", expectedErr: true},
+		{schedule: "60 * * * *", expectedErr: true},
+		{schedule: "0 0 31 2 *", expectedErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.schedule, func(t *testing.T) {
+			schedule, err := ParseSchedule(test.schedule)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := schedule.Next(after)
+			if !next.Equal(test.expected) {
+				t.Errorf("got %s, expected %s", next, test.expected)
+			}
+		})
+	}
+}
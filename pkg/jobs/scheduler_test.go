@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+)
+
+func TestScheduleWhile(t *testing.T) {
+	start := time.Date(2025, 1, 1, 3, 7, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		schedule string
+		// advances are the durations the clock is advanced by - each expected to run the job once
+		advances []time.Duration
+		expected []time.Time
+	}{
+		{
+			name:     "interval",
+			schedule: "1h",
+			advances: []time.Duration{time.Hour, time.Hour},
+			expected: []time.Time{start.Add(time.Hour), start.Add(2 * time.Hour)},
+		},
+		{
+			name:     "daily",
+			schedule: "04:00",
+			advances: []time.Duration{53 * time.Minute, 24 * time.Hour},
+			expected: []time.Time{time.Date(2025, 1, 1, 4, 0, 0, 0, time.UTC), time.Date(2025, 1, 2, 4, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:     "cron",
+			schedule: "*/15 * * * *",
+			advances: []time.Duration{8 * time.Minute, 15 * time.Minute},
+			expected: []time.Time{time.Date(2025, 1, 1, 3, 15, 0, 0, time.UTC), time.Date(2025, 1, 1, 3, 30, 0, 0, time.UTC)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := clock.NewFake(start)
+			ctx := clock.With(newTestContext(t), fake)
+			runs := make(chan time.Time)
+			job := Job{Name: "job", Schedule: test.schedule, Run: func(ctx context.Context) error {
+				runs <- clock.Get(ctx).Now()
+				return nil
+			}}
+			unscheduled := Job{Name: "unscheduled", Run: func(ctx context.Context) error {
+				t.Error("unscheduled job ran")
+				return nil
+			}}
+			err := ScheduleWhile(ctx, Jobs{job, unscheduled}, func() error {
+				for index, advance := range test.advances {
+					// the scheduler is waiting for the job's next run
+					fake.BlockUntil(1)
+					fake.Advance(advance - time.Second)
+					select {
+					case ran := <-runs:
+						t.Fatalf("job ran early at %s", ran)
+					default:
+					}
+					fake.Advance(time.Second)
+					ran := <-runs
+					if !ran.Equal(test.expected[index]) {
+						t.Errorf("run %d at %s, expected %s", index, ran, test.expected[index])
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			state, err := LoadState(ctx, job.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			last := test.expected[len(test.expected)-1]
+			if state == nil || !state.LastRun.Equal(last) {
+				t.Errorf("got state %+v, expected last run at %s", state, last)
+			}
+		})
+	}
+}
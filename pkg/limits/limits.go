@@ -0,0 +1,244 @@
+// Package limits runs the commands of heavyweight setup phases under optional cpu time, memory and wall clock limits.
+package limits
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// Limits are the resource limits of a setup phase - zero values are unlimited
+type Limits struct {
+	// Cpu is the cpu time each command of the phase (and its child processes) may consume
+	Cpu time.Duration
+	// Memory is the resident memory (in bytes) each command of the phase (and its child processes) may use
+	Memory int64
+	// Timeout is the wall clock time the entire phase may take
+	Timeout time.Duration
+}
+
+// ExceededError is returned when a command exceeds a limit of its phase
+type ExceededError struct {
+	Limit string
+	Phase string
+	Value string
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("setup phase %s exceeded its %s limit (%s)", e.Phase, e.Limit, e.Value)
+}
+
+// phase is the limited setup phase stored in the context
+type phase struct {
+	limits Limits
+	name   string
+}
+
+// contextKey is the type of the context key used to store the [phase]
+type contextKey string
+
+// Returns a context (and its cancel function) limiting the commands of a setup phase (see [Command]).
+// The phase's timeout applies to the returned context.
+func WithPhase(ctx context.Context, name string, limits Limits) (context.Context, context.CancelFunc) {
+	ctx = context.WithValue(ctx, contextKey("phase"), phase{limits: limits, name: name})
+	if limits.Timeout > 0 {
+		return context.WithTimeout(ctx, limits.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Parses a memory quantity - bytes with an optional (case-insensitive) unit suffix (e.g., '512M', '2GiB', '1.5g').
+// Returns an error if the quantity is malformed or not positive.
+func ParseMemory(quantity string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+		{"ki", 1 << 10}, {"mi", 1 << 20}, {"gi", 1 << 30},
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30},
+		{"b", 1},
+	}
+	normalized := strings.ToLower(strings.TrimSpace(quantity))
+	multiplier := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(normalized, unit.suffix) {
+			normalized = strings.TrimSuffix(normalized, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(normalized), 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid memory quantity %s (expected a positive size like '512M' or '2GiB')", quantity)
+	}
+	return int64(value * multiplier), nil
+}
+
+// Formats a number of bytes as a human-readable quantity
+func formatMemory(bytes int64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1fGiB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1fMiB", float64(bytes)/(1<<20))
+	default:
+		return fmt.Sprintf("%dB", bytes)
+	}
+}
+
+// clockTicks is the unit (per second) of the cpu times reported by /proc/<pid>/stat
+const clockTicks = 100
+
+// processUsage is the resource usage of a single process (read from /proc/<pid>/stat)
+type processUsage struct {
+	cpu    time.Duration
+	memory int64
+	ppid   int
+}
+
+// Returns the resource usage of every running process - keyed by pid.
+// Processes that exit while being read are skipped.
+func getProcessUsages() map[int]processUsage {
+	paths, _ := filepath.Glob("/proc/[0-9]*/stat")
+	usages := map[int]processUsage{}
+	for _, path := range paths {
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// fields following the (parenthesized) command name - starting with the process state (field 3)
+		_, stat, ok := strings.Cut(string(data), ") ")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(stat)
+		if len(fields) < 22 {
+			continue
+		}
+		usage := processUsage{}
+		usage.ppid, _ = strconv.Atoi(fields[1])
+		// user and system time of the process and of its exited (and waited for) children
+		for _, field := range fields[11:15] {
+			ticks, _ := strconv.ParseInt(field, 10, 64)
+			usage.cpu += time.Duration(ticks) * time.Second / clockTicks
+		}
+		pages, _ := strconv.ParseInt(fields[21], 10, 64)
+		usage.memory = pages * int64(os.Getpagesize())
+		usages[pid] = usage
+	}
+	return usages
+}
+
+// Returns a process and its (running) descendants - alongside their summed resident memory and cpu time.
+// Descendants are found by parent pid, so processes moving to another process group (e.g., 'timeout') are still included.
+func getTreeUsage(pid int) ([]int, int64, time.Duration) {
+	usages := getProcessUsages()
+	children := map[int][]int{}
+	for current, usage := range usages {
+		children[usage.ppid] = append(children[usage.ppid], current)
+	}
+	tree := []int{pid}
+	memory := int64(0)
+	cpu := time.Duration(0)
+	for index := 0; index < len(tree); index++ {
+		usage := usages[tree[index]]
+		memory += usage.memory
+		cpu += usage.cpu
+		tree = append(tree, children[tree[index]]...)
+	}
+	return tree, memory, cpu
+}
+
+// Runs an in-process step of the setup phase stored in the context (see [WithPhase]).
+// Only the phase's timeout applies to in-process steps.
+// The function must stop once its context is done.
+// Returns an [ExceededError] if the phase's timeout expires.
+// Returns an error if the function fails.
+func Run(ctx context.Context, run func(ctx context.Context) error) error {
+	err := run(ctx)
+	current, ok := ctx.Value(contextKey("phase")).(phase)
+	if ok && errors.Is(err, context.DeadlineExceeded) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &ExceededError{Limit: "time", Phase: current.name, Value: current.limits.Timeout.String()}
+	}
+	return err
+}
+
+// Runs a command - limited by the setup phase stored in the context (see [WithPhase]).
+// Commands run outside of a limited phase are run with [helper.Command].
+// The command (and its child processes) are killed once a limit is exceeded.
+// Supports the Cwd and Env options.
+// Returns an [ExceededError] if a limit is exceeded.
+// Returns an error if the command exits with a non-zero exit code.
+func Command(ctx context.Context, args []string, opts helper.CmdOpts) (string, error) {
+	current, ok := ctx.Value(contextKey("phase")).(phase)
+	if !ok || current.limits == (Limits{}) {
+		return helper.Command(ctx, args, opts).Run()
+	}
+	helper.Logger(ctx).Info("run command", "command", args, "phase", current.name)
+
+	stdout := strings.Builder{}
+	stderr := strings.Builder{}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = opts.Cwd
+	cmd.Env = opts.Env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// the command runs in its own process group - so that it can be killed alongside its child processes
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	err := cmd.Start()
+	if err != nil {
+		return "", err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var exceeded error
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for exceeded == nil {
+		select {
+		case err = <-done:
+			if err != nil {
+				helper.Logger(ctx).Warn("command failed", "cmd", args, "stderr", stderr.String())
+			}
+			return stdout.String(), err
+		case <-ctx.Done():
+			exceeded = ctx.Err()
+			if errors.Is(exceeded, context.DeadlineExceeded) {
+				exceeded = &ExceededError{Limit: "time", Phase: current.name, Value: current.limits.Timeout.String()}
+			}
+		case <-ticker.C:
+			_, memory, cpu := getTreeUsage(cmd.Process.Pid)
+			if current.limits.Memory > 0 && memory > current.limits.Memory {
+				exceeded = &ExceededError{Limit: "memory", Phase: current.name, Value: formatMemory(current.limits.Memory)}
+			} else if current.limits.Cpu > 0 && cpu > current.limits.Cpu {
+				exceeded = &ExceededError{Limit: "cpu time", Phase: current.name, Value: current.limits.Cpu.String()}
+			}
+		}
+	}
+	helper.Logger(ctx).Warn("killing command", "cmd", args, "reason", exceeded.Error())
+	tree, _, _ := getTreeUsage(cmd.Process.Pid)
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	for _, pid := range tree {
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+	<-done
+	return stdout.String(), exceeded
+}
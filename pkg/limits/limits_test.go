@@ -0,0 +1,89 @@
+package limits
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		quantity    string
+		expected    int64
+		expectedErr bool
+	}{
+		{quantity: "1024", expected: 1024},
+		{quantity: "512M", expected: 512 << 20},
+		{quantity: "2GiB", expected: 2 << 30},
+		{quantity: "1.5g", expected: 3 << 29},
+		{quantity: " 4 kb ", expected: 4 << 10},
+		{quantity: "10b", expected: 10},
+		{quantity: "", expectedErr: true},
+		{quantity: "0", expectedErr: true},
+		{quantity: "-1M", expectedErr: true},
+		{quantity: "lots", expectedErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.quantity, func(t *testing.T) {
+			value, err := ParseMemory(test.quantity)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d", value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != test.expected {
+				t.Errorf("got %d, expected %d", value, test.expected)
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		limits        Limits
+		args          []string
+		expectedLimit string
+	}{
+		{name: "within limits", limits: Limits{Timeout: 10 * time.Second}, args: []string{"true"}},
+		{name: "timeout", limits: Limits{Timeout: 100 * time.Millisecond}, args: []string{"sleep", "10"}, expectedLimit: "time"},
+		{name: "cpu time", limits: Limits{Cpu: 10 * time.Millisecond}, args: []string{"sh", "-c", "while :; do :; done"}, expectedLimit: "cpu time"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := WithPhase(newTestContext(t), "test", test.limits)
+			defer cancel()
+			_, err := Command(ctx, test.args, helper.CmdOpts{})
+			exceededErr := &ExceededError{}
+			if test.expectedLimit == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.As(err, &exceededErr) || exceededErr.Limit != test.expectedLimit || exceededErr.Phase != "test" {
+				t.Fatalf("expected the %s limit to be exceeded, got %v", test.expectedLimit, err)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := WithPhase(newTestContext(t), "test", Limits{Timeout: 10 * time.Millisecond})
+	defer cancel()
+	err := Run(ctx, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	exceededErr := &ExceededError{}
+	if !errors.As(err, &exceededErr) || exceededErr.Limit != "time" {
+		t.Fatalf("expected the time limit to be exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+// Package logstyle provides the console log styles of the entrypoint - plain text, json and a colorized 'pretty' style with phase banners.
+package logstyle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// Styles are the supported log styles
+var Styles = []string{"json", "pretty", "text"}
+
+// PhaseMessage is the message of records marking the start of a phase (see [Phase])
+const PhaseMessage = "begin phase"
+
+// Logs the start of a phase (e.g., building spt or installing mods) - rendered as a banner by the pretty style.
+func Phase(ctx context.Context, name string) {
+	helper.Logger(ctx).Info(PhaseMessage, "phase", name)
+}
+
+// Determines whether colors should be written to the given file - i.e., the file is a terminal and NO_COLOR is unset.
+func useColor(file *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Creates a log handler writing records to the given file in the given style.
+// Returns an error if the style is unknown.
+func NewHandler(style string, file *os.File) (slog.Handler, error) {
+	switch style {
+	case "", "text":
+		return slog.NewTextHandler(file, &slog.HandlerOptions{}), nil
+	case "json":
+		return slog.NewJSONHandler(file, &slog.HandlerOptions{}), nil
+	case "pretty":
+		return &prettyHandler{color: useColor(file), mutex: &sync.Mutex{}, writer: file}, nil
+	default:
+		return nil, fmt.Errorf("unknown log style %s (expected one of %v)", style, Styles)
+	}
+}
+
+// Replaces the handler of the logger stored in the context (see [helper.Logger]) with one writing in the given style to stderr.
+// The logger is modified in place - so that loggers already retrieved from the context use the style too.
+// Returns an error if the style is unknown.
+func Configure(ctx context.Context, style string) error {
+	handler, err := NewHandler(style, os.Stderr)
+	if err != nil {
+		return err
+	}
+	*helper.Logger(ctx) = *slog.New(handler)
+	return nil
+}
+
+// ansi escape sequences used by the pretty style
+const (
+	ansiBold   = "\033[1m"
+	ansiCyan   = "\033[36m"
+	ansiDim    = "\033[2m"
+	ansiRed    = "\033[31m"
+	ansiReset  = "\033[0m"
+	ansiYellow = "\033[33m"
+)
+
+// prettyMessageWidth is the width messages are padded to - so that the key-values of consecutive records line up
+const prettyMessageWidth = 32
+
+// prettyHandler is a [slog.Handler] writing human-friendly (and optionally colorized) records
+type prettyHandler struct {
+	attrs  []slog.Attr
+	color  bool
+	groups []string
+	mutex  *sync.Mutex
+	writer io.Writer
+}
+
+// Returns the text wrapped in the ansi style - or the unmodified text if colors are disabled
+func (ph *prettyHandler) paint(style string, text string) string {
+	if !ph.color {
+		return text
+	}
+	return style + text + ansiReset
+}
+
+// Enabled implements [slog.Handler] - records at info level and above are written
+func (ph *prettyHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo
+}
+
+// WithAttrs implements [slog.Handler]
+func (ph *prettyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *ph
+	clone.attrs = slices.Clone(ph.attrs)
+	for _, attr := range attrs {
+		clone.attrs = append(clone.attrs, ph.qualify(attr))
+	}
+	return &clone
+}
+
+// WithGroup implements [slog.Handler]
+func (ph *prettyHandler) WithGroup(name string) slog.Handler {
+	clone := *ph
+	clone.groups = append(slices.Clone(ph.groups), name)
+	return &clone
+}
+
+// Prefixes the key of an attribute with the handler's groups
+func (ph *prettyHandler) qualify(attr slog.Attr) slog.Attr {
+	if len(ph.groups) == 0 {
+		return attr
+	}
+	return slog.Attr{Key: strings.Join(append(slices.Clone(ph.groups), attr.Key), "."), Value: attr.Value}
+}
+
+// Appends the key-values of an attribute (flattening groups) to the builder
+func (ph *prettyHandler) writeAttr(builder *strings.Builder, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	key := attr.Key
+	if prefix != "" {
+		key = prefix + "." + key
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		for _, child := range attr.Value.Group() {
+			ph.writeAttr(builder, key, child)
+		}
+		return
+	}
+	value := attr.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = fmt.Sprintf("%q", value)
+	}
+	builder.WriteString(" ")
+	builder.WriteString(ph.paint(ansiDim, key+"="))
+	builder.WriteString(value)
+}
+
+// Handle implements [slog.Handler] - writing a record as a single (aligned) line, or as a banner if the record marks the start of a phase.
+func (ph *prettyHandler) Handle(ctx context.Context, record slog.Record) error {
+	builder := strings.Builder{}
+	timestamp := record.Time
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	if record.Message == PhaseMessage {
+		phase := ""
+		record.Attrs(func(attr slog.Attr) bool {
+			if attr.Key == "phase" {
+				phase = attr.Value.String()
+				return false
+			}
+			return true
+		})
+		banner := fmt.Sprintf("── %s ", phase)
+		banner += strings.Repeat("─", max(prettyMessageWidth+20-len([]rune(banner)), 3))
+		builder.WriteString("\n")
+		builder.WriteString(ph.paint(ansiDim, timestamp.Format("15:04:05")))
+		builder.WriteString(" ")
+		builder.WriteString(ph.paint(ansiBold+ansiCyan, banner))
+		builder.WriteString("\n")
+	} else {
+		level, levelStyle := "INFO ", ansiCyan
+		switch {
+		case record.Level >= slog.LevelError:
+			level, levelStyle = "ERROR", ansiRed
+		case record.Level >= slog.LevelWarn:
+			level, levelStyle = "WARN ", ansiYellow
+		}
+		attrs := strings.Builder{}
+		for _, attr := range ph.attrs {
+			ph.writeAttr(&attrs, "", attr)
+		}
+		record.Attrs(func(attr slog.Attr) bool {
+			ph.writeAttr(&attrs, "", ph.qualify(attr))
+			return true
+		})
+		message := record.Message
+		if attrs.Len() > 0 && len(message) < prettyMessageWidth {
+			message += strings.Repeat(" ", prettyMessageWidth-len(message))
+		}
+		if record.Level >= slog.LevelWarn {
+			message = ph.paint(ansiBold, message)
+		}
+		builder.WriteString(ph.paint(ansiDim, timestamp.Format("15:04:05")))
+		builder.WriteString(" ")
+		builder.WriteString(ph.paint(levelStyle, level))
+		builder.WriteString(" ")
+		builder.WriteString(message)
+		builder.WriteString(attrs.String())
+		builder.WriteString("\n")
+	}
+
+	ph.mutex.Lock()
+	defer ph.mutex.Unlock()
+	_, err := io.WriteString(ph.writer, builder.String())
+	return err
+}
@@ -0,0 +1,199 @@
+// Package outbound enforces the outbound request policy (NO_OUTBOUND) on http requests - and routes them through the configured proxy.
+package outbound
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// contextKey is the type of the context keys used to store outbound request settings
+type contextKey string
+
+// BlockedError is returned when an undeclared outbound request is blocked by NO_OUTBOUND=strict
+type BlockedError struct {
+	Url string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("outbound request to %s blocked (NO_OUTBOUND=strict)", e.Url)
+}
+
+// Stores the outbound request policy (the value of NO_OUTBOUND) in the context.
+// Returns an error if the policy is unknown.
+func WithPolicy(ctx context.Context, policy string) (context.Context, error) {
+	if policy != "" && policy != "strict" {
+		return ctx, fmt.Errorf("unknown outbound policy %s", policy)
+	}
+	return context.WithValue(ctx, contextKey("policy"), policy), nil
+}
+
+// Marks outbound requests made with the returned context as declared (i.e., explicitly requested by the configuration - such as a mod download).
+// The reason is reported alongside each declared request.
+func Declare(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, contextKey("declared"), reason)
+}
+
+// Stores an explicit proxy (the value of DOWNLOAD_PROXY) in the context - overriding the proxy configured by HTTP_PROXY/HTTPS_PROXY.
+// Does nothing if the proxy is empty.
+// Returns an error if the proxy is not a valid url.
+func WithProxy(ctx context.Context, proxy string) (context.Context, error) {
+	if proxy == "" {
+		return ctx, nil
+	}
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil || proxyUrl.Scheme == "" || proxyUrl.Host == "" {
+		return ctx, fmt.Errorf("invalid proxy url %s", proxy)
+	}
+	return context.WithValue(ctx, contextKey("proxy"), proxyUrl), nil
+}
+
+// Returns the environment passing the explicit proxy (see [WithProxy]) to commands making their own outbound requests.
+// Returns nil (i.e., the inherited environment) if no explicit proxy is configured.
+func CommandEnv(ctx context.Context) []string {
+	proxyUrl, ok := ctx.Value(contextKey("proxy")).(*url.URL)
+	if !ok {
+		return nil
+	}
+	env := os.Environ()
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+		env = append(env, fmt.Sprintf("%s=%s", name, proxyUrl.String()))
+	}
+	return env
+}
+
+// Determines whether a host is excluded from proxying by NO_PROXY.
+// Entries are hosts (matching the host and its subdomains), domains with a leading '.' (matching subdomains) or '*' (matching all hosts).
+func isNoProxyHost(host string) bool {
+	noProxy := os.Getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entryHost, _, err := net.SplitHostPort(entry); err == nil {
+			entry = entryHost
+		}
+		switch {
+		case entry == "":
+		case entry == "*":
+			return true
+		case strings.HasPrefix(entry, "."):
+			if strings.HasSuffix(host, entry) {
+				return true
+			}
+		case host == entry || strings.HasSuffix(host, fmt.Sprintf(".%s", entry)):
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the proxy for a request - the explicit proxy (see [WithProxy]), or else the proxy of the environment.
+// Local hosts and hosts excluded by NO_PROXY are never proxied.
+// Implements [http.Transport.Proxy].
+func getProxy(request *http.Request) (*url.URL, error) {
+	proxyUrl, ok := request.Context().Value(contextKey("proxy")).(*url.URL)
+	if !ok {
+		return http.ProxyFromEnvironment(request)
+	}
+	host := strings.ToLower(request.URL.Hostname())
+	if isLoopbackHost(host) || isNoProxyHost(host) {
+		return nil, nil
+	}
+	return proxyUrl, nil
+}
+
+// Determines whether a host refers to the local machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Checks whether an outbound request to the given url is permitted.
+// Requests to loopback addresses and declared requests (see [Declare]) are always permitted.
+// All other requests are permitted unless the policy is 'strict' - in which case they are reported and blocked.
+// Returns an error if the request is blocked.
+func check(ctx context.Context, requestUrl *url.URL) error {
+	if isLoopbackHost(requestUrl.Hostname()) {
+		return nil
+	}
+	reason, declared := ctx.Value(contextKey("declared")).(string)
+	if declared {
+		helper.Logger(ctx).Debug("declared outbound request", "url", requestUrl.String(), "reason", reason)
+		return nil
+	}
+	policy, _ := ctx.Value(contextKey("policy")).(string)
+	if policy != "strict" {
+		return nil
+	}
+	helper.Logger(ctx).Warn("blocked undeclared outbound request", "url", requestUrl.String())
+	return &BlockedError{Url: requestUrl.String()}
+}
+
+// transport is an [http.RoundTripper] enforcing the outbound request policy on every request (including redirects).
+// Requests to loopback addresses are made by the loopback transport - if set.
+type transport struct {
+	base     http.RoundTripper
+	loopback http.RoundTripper
+}
+
+func (t *transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	err := check(request.Context(), request.URL)
+	if err != nil {
+		return nil, err
+	}
+	if t.loopback != nil && isLoopbackHost(request.URL.Hostname()) {
+		return t.loopback.RoundTrip(request)
+	}
+	return t.base.RoundTrip(request)
+}
+
+// Client is the http client shared by all requests made by the entrypoint.
+// Requests must be created with a context (see [http.NewRequestWithContext]) so that the outbound request policy can be enforced.
+var Client = &http.Client{
+	Transport: &transport{base: newBaseTransport()},
+}
+
+// LocalClient is the http client used for requests that usually target the local machine (e.g., health probes of the server).
+// Certificates of loopback addresses aren't verified, as spt serves a self-signed certificate - other requests are made as by [Client].
+var LocalClient = &http.Client{
+	Transport: &transport{base: newBaseTransport(), loopback: newLoopbackTransport()},
+}
+
+// Returns the transport underlying [Client] - the default transport with proxies resolved per-request (see [getProxy])
+func newBaseTransport() http.RoundTripper {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.Proxy = getProxy
+	return base
+}
+
+// Returns the transport used by [LocalClient] for loopback addresses - never proxied, without certificate verification or keep-alives
+func newLoopbackTransport() http.RoundTripper {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.DisableKeepAlives = true
+	base.Proxy = nil
+	base.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return base
+}
+
+// Opens a connection to an address - enforcing the outbound request policy (see [Declare]).
+// Returns an error if the connection is blocked or cannot be opened.
+func Dial(ctx context.Context, network string, addr string) (net.Conn, error) {
+	err := check(ctx, &url.URL{Scheme: network, Host: addr})
+	if err != nil {
+		return nil, err
+	}
+	dialer := net.Dialer{}
+	return dialer.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,163 @@
+package outbound
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		declared    bool
+		url         string
+		expectedErr bool
+	}{
+		{name: "permissive", url: "https://example.com/mod.zip"},
+		{name: "strict", policy: "strict", url: "https://example.com/mod.zip", expectedErr: true},
+		{name: "strict declared", policy: "strict", declared: true, url: "https://example.com/mod.zip"},
+		{name: "strict loopback", policy: "strict", url: "http://127.0.0.1:6969/launcher/ping"},
+		{name: "strict localhost", policy: "strict", url: "http://localhost:6969/launcher/ping"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, err := WithPolicy(newTestContext(t), test.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.declared {
+				ctx = Declare(ctx, "test")
+			}
+			requestUrl, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = check(ctx, requestUrl)
+			blockedErr := &BlockedError{}
+			if test.expectedErr != errors.As(err, &blockedErr) {
+				t.Errorf("got error %v, expected blocked: %t", err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	_, err := WithPolicy(newTestContext(t), "lenient")
+	if err == nil {
+		t.Error("expected unknown policy to fail")
+	}
+}
+
+func TestWithProxy(t *testing.T) {
+	tests := []struct {
+		proxy       string
+		expectedErr bool
+	}{
+		{proxy: ""},
+		{proxy: "http://proxy:3128"},
+		{proxy: "proxy:3128", expectedErr: true},
+		{proxy: "http://", expectedErr: true},
+	}
+	for _, test := range tests {
+		_, err := WithProxy(newTestContext(t), test.proxy)
+		if (err != nil) != test.expectedErr {
+			t.Errorf("%q: got error %v, expected error: %t", test.proxy, err, test.expectedErr)
+		}
+	}
+}
+
+func TestGetProxy(t *testing.T) {
+	t.Setenv("NO_PROXY", "internal.example, .corp, registry:5000")
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{url: "https://example.com/mod.zip", expected: "http://proxy:3128"},
+		{url: "https://internal.example/mod.zip"},
+		{url: "https://mods.internal.example/mod.zip"},
+		{url: "https://git.corp/spt.git"},
+		{url: "https://registry/v2/"},
+		{url: "http://127.0.0.1:6969/"},
+		{url: "http://localhost:6969/"},
+	}
+	ctx, err := WithProxy(newTestContext(t), "http://proxy:3128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proxyUrl, err := getProxy(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proxy := ""
+		if proxyUrl != nil {
+			proxy = proxyUrl.String()
+		}
+		if proxy != test.expected {
+			t.Errorf("%s: got proxy %q, expected %q", test.url, proxy, test.expected)
+		}
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	ctx := newTestContext(t)
+	if CommandEnv(ctx) != nil {
+		t.Error("expected the inherited environment without an explicit proxy")
+	}
+	ctx, err := WithProxy(ctx, "http://proxy:3128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := CommandEnv(ctx)
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+		if !slices.Contains(env, name+"=http://proxy:3128") {
+			t.Errorf("environment lacks %s", name)
+		}
+	}
+}
+
+func TestLocalClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	ctx := newTestContext(t)
+	for _, test := range []struct {
+		name        string
+		client      *http.Client
+		expectedErr bool
+	}{
+		{name: "client", client: Client, expectedErr: true},
+		{name: "local client", client: LocalClient},
+	} {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := test.client.Do(request)
+		if err == nil {
+			response.Body.Close()
+		}
+		if (err != nil) != test.expectedErr {
+			t.Errorf("%s: got error %v, expected error: %t", test.name, err, test.expectedErr)
+		}
+	}
+}
+
+func TestDial(t *testing.T) {
+	ctx, err := WithPolicy(newTestContext(t), "strict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Dial(ctx, "tcp", "example.com:443")
+	blockedErr := &BlockedError{}
+	if !errors.As(err, &blockedErr) {
+		t.Errorf("got error %v, expected blocked", err)
+	}
+}
@@ -0,0 +1,207 @@
+package patch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// Patch is a json patch (see [helper.JsonPatch]) or a merge patch (see [mergeAt]) - optionally only applied when its conditions hold
+type Patch struct {
+	Op    string     `json:"op"`
+	Path  string     `json:"path"`
+	Value any        `json:"value,omitempty"`
+	When  *Condition `json:"when,omitempty"`
+	// IfExists is a json pointer that must resolve within the file for the patch to apply
+	IfExists string `json:"ifExists,omitempty"`
+	// IfValueEquals maps json pointers to the values the file must hold at them for the patch to apply
+	IfValueEquals map[string]any `json:"ifValueEquals,omitempty"`
+	// SkipIfMissingFile skips the patch (rather than failing) if the file it targets doesn't exist (see [SkipMissingFiles])
+	SkipIfMissingFile bool `json:"skipIfMissingFile,omitempty"`
+	// Priority orders the patches of a file - patches with lower priorities apply first (see [Order])
+	Priority int `json:"priority,omitempty"`
+}
+
+// Expands references to environment variables within the patch's value (see [expandValue]).
+// Returns an error if a referenced variable is unset.
+func (p Patch) expand() (Patch, error) {
+	value, err := expandValue(p.Value, os.LookupEnv)
+	if err != nil {
+		return Patch{}, fmt.Errorf("patch %s %s: %w", p.Op, p.Path, err)
+	}
+	p.Value = value
+	return p, nil
+}
+
+// Converts the patch into a [helper.JsonPatch] - dropping its conditions.
+// References to environment variables are expected to have been expanded already (see [Patch.expand]).
+func (p Patch) jsonPatch() helper.JsonPatch {
+	return helper.JsonPatch{Op: p.Op, Path: p.Path, Value: p.Value}
+}
+
+// Validates the patch's conditions.
+// Returns an error if its condition is invalid (see [Condition.validate]) or if a json pointer of its file conditions is invalid.
+func (p Patch) validate() error {
+	if p.When != nil {
+		err := p.When.validate()
+		if err != nil {
+			return err
+		}
+	}
+	pointers := helper.Map[string, any](p.IfValueEquals).Keys()
+	if p.IfExists != "" {
+		pointers = append(pointers, p.IfExists)
+	}
+	for _, pointer := range pointers {
+		if pointer != "" && !strings.HasPrefix(pointer, "/") {
+			return fmt.Errorf("invalid json pointer %q (expected '' or a path starting with '/')", pointer)
+		}
+	}
+	return nil
+}
+
+// Determines whether the patch has conditions evaluated against the file it targets (see [Patch.evaluate])
+func (p Patch) hasFileConditions() bool {
+	return p.IfExists != "" || len(p.IfValueEquals) > 0
+}
+
+// Evaluates the patch's file conditions against the document it's applied to - as patched by the patches preceding it.
+// Returns a description of the unmet requirement - or an empty string if the conditions hold.
+func (p Patch) evaluate(document map[string]any) string {
+	if p.IfExists != "" {
+		_, err := resolvePointer(document, p.IfExists)
+		if err != nil {
+			return fmt.Sprintf("requires %s to exist", p.IfExists)
+		}
+	}
+	pointers := helper.Map[string, any](p.IfValueEquals).Keys()
+	slices.Sort(pointers)
+	for _, pointer := range pointers {
+		expected := p.IfValueEquals[pointer]
+		encoded, _ := json.Marshal(expected)
+		value, err := resolvePointer(document, pointer)
+		if err != nil || !reflect.DeepEqual(value, expected) {
+			return fmt.Sprintf("requires %s to equal %s", pointer, encoded)
+		}
+	}
+	return ""
+}
+
+// Condition restricts a [Patch] to the servers it applies to - so that one set of patches can serve several spt versions and mod sets
+type Condition struct {
+	// Mods lists mods that must be installed - or, if prefixed with '!', must not be installed
+	Mods []string `json:"mods,omitempty"`
+	// Spt is the (npm-style) spt version range the patch applies to (e.g., '>=3.10.0')
+	Spt string `json:"spt,omitempty"`
+}
+
+// Validates the condition.
+// Returns an error if the spt version range cannot be parsed or a mod name is empty.
+func (c Condition) validate() error {
+	if c.Spt != "" {
+		_, err := semver.NewConstraint(c.Spt)
+		if err != nil {
+			return fmt.Errorf("invalid spt version range %s: %w", c.Spt, err)
+		}
+	}
+	for _, mod := range c.Mods {
+		if strings.TrimPrefix(mod, "!") == "" {
+			return fmt.Errorf("invalid mod condition %q", mod)
+		}
+	}
+	return nil
+}
+
+// Target describes the server patches are applied to - evaluated against the conditions of patches (see [Condition])
+type Target struct {
+	// Mods are the names the installed mods are known by (e.g., their configured names and package names)
+	Mods []string
+	// SptVersion is the spt version of the server
+	SptVersion string
+}
+
+// Determines whether a mod is installed on the target - mod names are compared case-insensitively
+func (t Target) hasMod(name string) bool {
+	return slices.ContainsFunc(t.Mods, func(mod string) bool {
+		return strings.EqualFold(mod, name)
+	})
+}
+
+// Evaluates the condition against a target.
+// Returns a description of the unmet requirement - or an empty string if the condition holds.
+// Returns an error if the condition or the target's spt version cannot be parsed.
+func (c Condition) evaluate(target Target) (string, error) {
+	if c.Spt != "" {
+		constraint, err := semver.NewConstraint(c.Spt)
+		if err != nil {
+			return "", fmt.Errorf("invalid spt version range %s: %w", c.Spt, err)
+		}
+		version, err := semver.NewVersion(target.SptVersion)
+		if err != nil {
+			return "", fmt.Errorf("spt version %s cannot be compared against %s: %w", target.SptVersion, c.Spt, err)
+		}
+		if !constraint.Check(version) {
+			return fmt.Sprintf("requires spt %s", c.Spt), nil
+		}
+	}
+	for _, mod := range c.Mods {
+		name, absent := strings.CutPrefix(mod, "!")
+		if target.hasMod(name) == absent {
+			if absent {
+				return fmt.Sprintf("requires mod %s to be absent", name), nil
+			}
+			return fmt.Sprintf("requires mod %s", name), nil
+		}
+	}
+	return "", nil
+}
+
+// Selects the patches whose conditions hold for a target - skipped patches are logged, and files left without patches are dropped.
+// Returns an error if a condition cannot be evaluated.
+func Filter(ctx context.Context, configPatches ConfigPatches, target Target) (ConfigPatches, error) {
+	filtered := ConfigPatches{}
+	for relPath, patches := range configPatches {
+		for _, patch := range patches {
+			if patch.When != nil {
+				unmet, err := patch.When.evaluate(target)
+				if err != nil {
+					return nil, fmt.Errorf("%s: patch %s %s: %w", relPath, patch.Op, patch.Path, err)
+				}
+				if unmet != "" {
+					helper.Logger(ctx).Info("skip config patch", "path", relPath, "op", patch.Op, "pointer", patch.Path, "reason", unmet)
+					continue
+				}
+			}
+			filtered[relPath] = append(filtered[relPath], patch)
+		}
+	}
+	return filtered, nil
+}
+
+// Drops the patches that opt out of failing when the file they target is missing from the root directory (see [Patch.SkipIfMissingFile]).
+// Skipped patches are logged, and files left without patches are dropped.
+// Glob targets are expected to have been expanded already (see [Expand]).
+func SkipMissingFiles(ctx context.Context, root string, configPatches ConfigPatches) ConfigPatches {
+	kept := ConfigPatches{}
+	for relPath, patches := range configPatches {
+		_, err := os.Stat(filepath.Join(root, relPath))
+		missing := errors.Is(err, os.ErrNotExist)
+		for _, patch := range patches {
+			if missing && patch.SkipIfMissingFile {
+				helper.Logger(ctx).Info("skip config patch", "path", relPath, "op", patch.Op, "pointer", patch.Path, "reason", "file not found")
+				continue
+			}
+			kept[relPath] = append(kept[relPath], patch)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,59 @@
+package patch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// Determines whether a config patch target is a glob (see [filepath.Match]) rather than the path of a single file
+func isGlob(relPath string) bool {
+	return strings.ContainsAny(relPath, "*?[")
+}
+
+// Expands glob targets (e.g., 'user/mods/*/config/config.json') into the files they match within the root directory (see [filepath.Glob]).
+// The patches of globs matching a file are applied before the patches targeting the file by its path.
+// Globs matching no files are logged (e.g., as the mods they target aren't installed) - directories are never matched.
+// Returns an error if a glob is malformed or the root directory cannot be read.
+func Expand(ctx context.Context, root string, configPatches ConfigPatches) (ConfigPatches, error) {
+	globs := []string{}
+	expanded := ConfigPatches{}
+	for relPath, patches := range configPatches {
+		if isGlob(relPath) {
+			globs = append(globs, relPath)
+			continue
+		}
+		expanded[relPath] = patches
+	}
+	slices.Sort(globs)
+	slices.Reverse(globs)
+	for _, glob := range globs {
+		matches, err := filepath.Glob(filepath.Join(root, glob))
+		if err != nil {
+			return nil, err
+		}
+		count := 0
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			relPath, err := filepath.Rel(root, match)
+			if err != nil {
+				return nil, err
+			}
+			expanded[relPath] = slices.Concat(configPatches[glob], expanded[relPath])
+			count++
+		}
+		if count == 0 {
+			helper.Logger(ctx).Warn("config patch target matches no files", "glob", glob)
+			continue
+		}
+		helper.Logger(ctx).Info("expand config patch target", "glob", glob, "count", count)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,67 @@
+package patch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// variableRegexp matches references ('${NAME}') and escaped references ('$${NAME}') to environment variables
+var variableRegexp = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Expands references to environment variables (i.e., '${NAME}') within the strings of a patch value - recursing into objects and arrays.
+// Expanded values are always strings - a value of '${PORT}' yields the string '7000' rather than a number.
+// Returns an error if a referenced variable is unset.
+func expandValue(value any, lookup func(name string) (string, bool)) (any, error) {
+	switch typed := value.(type) {
+	case string:
+		unset := []string{}
+		expanded := variableRegexp.ReplaceAllStringFunc(typed, func(reference string) string {
+			if strings.HasPrefix(reference, "$$") {
+				return reference[1:]
+			}
+			name := reference[2 : len(reference)-1]
+			resolved, ok := lookup(name)
+			if !ok {
+				unset = append(unset, name)
+			}
+			return resolved
+		})
+		if len(unset) > 0 {
+			return nil, fmt.Errorf("unset environment variable(s) %s", strings.Join(unset, ", "))
+		}
+		return expanded, nil
+	case map[string]any:
+		expanded := map[string]any{}
+		for key, item := range typed {
+			var err error
+			expanded[key], err = expandValue(item, lookup)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return expanded, nil
+	case []any:
+		expanded := make([]any, len(typed))
+		for index, item := range typed {
+			var err error
+			expanded[index], err = expandValue(item, lookup)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return expanded, nil
+	default:
+		return value, nil
+	}
+}
+
+// Determines whether the value of a patch references environment variables (see [expandValue])
+func (p Patch) ReferencesVariables() bool {
+	referenced := false
+	_, _ = expandValue(p.Value, func(name string) (string, bool) {
+		referenced = true
+		return "", true
+	})
+	return referenced
+}
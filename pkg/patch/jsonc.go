@@ -0,0 +1,168 @@
+package patch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// jsoncExtensions are the extensions of config files parsed as JSONC (see [stripJsonc])
+var jsoncExtensions = []string{".json", ".jsonc", ".json5"}
+
+// Determines whether a config file is parsed as JSONC (see [jsoncExtensions])
+func isJsonc(path string) bool {
+	return slices.Contains(jsoncExtensions, strings.ToLower(filepath.Ext(path)))
+}
+
+// jsoncDocument is a parsed JSONC document (see [stripJsonc])
+type jsoncDocument struct {
+	// Data is the document as standard JSON
+	Data []byte
+	// Header holds the comments preceding the document (e.g., a description of the config file) - kept when the document is written (see [writeJsonc])
+	Header []byte
+	// Dropped is set if the document holds comments beyond its header - which are lost when the document is written
+	Dropped bool
+}
+
+// Converts JSONC (JSON with '//' and '/* */' comments and trailing commas) into standard JSON.
+// Comments and trailing commas are replaced by spaces (newlines are kept) - so that the positions of syntax errors are unchanged.
+func stripJsonc(data []byte) jsoncDocument {
+	document := jsoncDocument{Data: slices.Clone(data)}
+	stripped := document.Data
+	blank := func(start int, end int) {
+		for index := start; index < end; index++ {
+			if stripped[index] != '\n' {
+				stripped[index] = ' '
+			}
+		}
+	}
+	// the header ends at the first character that isn't whitespace or part of a comment
+	headerEnd := -1
+	inString := false
+	for index := 0; index < len(stripped); index++ {
+		char := stripped[index]
+		switch {
+		case inString:
+			if char == '\\' {
+				index++
+			} else if char == '"' {
+				inString = false
+			}
+			continue
+		case char == '/' && index+1 < len(stripped) && stripped[index+1] == '/':
+			end := bytes.IndexByte(stripped[index:], '\n')
+			if end == -1 {
+				end = len(stripped)
+			} else {
+				end += index
+			}
+			if headerEnd != -1 {
+				document.Dropped = true
+			}
+			blank(index, end)
+			index = end - 1
+			continue
+		case char == '/' && index+1 < len(stripped) && stripped[index+1] == '*':
+			end := bytes.Index(stripped[index+2:], []byte("*/"))
+			if end == -1 {
+				end = len(stripped)
+			} else {
+				end += index + 4
+			}
+			if headerEnd != -1 {
+				document.Dropped = true
+			}
+			blank(index, end)
+			index = end - 1
+			continue
+		}
+		if headerEnd == -1 && !strings.ContainsRune(" \t\r\n", rune(char)) {
+			headerEnd = index
+		}
+		if char == '"' {
+			inString = true
+		}
+	}
+	if headerEnd > 0 {
+		header := bytes.TrimSpace(data[:headerEnd])
+		if len(header) > 0 {
+			document.Header = append(header, '\n')
+		}
+	}
+
+	// with comments blanked, a comma is trailing if the next non-whitespace character closes an object or array
+	inString = false
+	for index := 0; index < len(stripped); index++ {
+		char := stripped[index]
+		if inString {
+			if char == '\\' {
+				index++
+			} else if char == '"' {
+				inString = false
+			}
+			continue
+		}
+		if char == '"' {
+			inString = true
+			continue
+		}
+		if char != ',' {
+			continue
+		}
+		next := bytes.TrimLeft(stripped[index+1:], " \t\r\n")
+		if len(next) > 0 && (next[0] == '}' || next[0] == ']') {
+			stripped[index] = ' '
+		}
+	}
+	return document
+}
+
+// Reads a config file into the provided pointer.
+// JSON files are parsed leniently (see [stripJsonc]), other files are read with [helper.UnmarshalFile].
+// Returns the parsed JSONC document (or nil, for other files).
+// Returns an error if the file cannot be read or parsed.
+func readConfigFile(ctx context.Context, path string, data any) (*jsoncDocument, error) {
+	if !isJsonc(path) {
+		return nil, helper.UnmarshalFile(ctx, path, data)
+	}
+	helper.Logger(ctx).Info("unmarshal file", "path", path)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	document := stripJsonc(raw)
+	return &document, json.Unmarshal(document.Data, data)
+}
+
+// Unmarshals a config file into the provided pointer - tolerating comments and trailing commas within JSON files (see [stripJsonc]).
+// Returns an error if the file cannot be read or parsed.
+func UnmarshalFile(ctx context.Context, path string, data any) error {
+	_, err := readConfigFile(ctx, path, data)
+	return err
+}
+
+// Writes a config file read by [readConfigFile].
+// Plain JSON files (i.e., '.json' files without comments) are written as compact JSON with [helper.MarshalFile] - as are other files.
+// Otherwise, the file is written as indented JSON following its header - comments beyond the header are lost, which is logged.
+// Returns an error if the file cannot be written.
+func writeConfigFile(ctx context.Context, path string, document *jsoncDocument, data any) error {
+	if document == nil || (strings.ToLower(filepath.Ext(path)) == ".json" && len(document.Header) == 0 && !document.Dropped) {
+		return helper.MarshalFile(ctx, data, path)
+	}
+	if document.Dropped {
+		helper.Logger(ctx).Warn("comments within patched config file are not preserved - only its leading comments are kept", "path", path)
+	}
+	helper.Logger(ctx).Info("marshal file", "path", path)
+	encoded, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(path, slices.Concat(document.Header, encoded, []byte("\n")))
+}
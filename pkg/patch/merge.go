@@ -0,0 +1,134 @@
+package patch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// mergeOp is the op of patches merging their value into the document (see [mergeAt]) - rather than applying a json patch
+const mergeOp = "merge"
+
+// Merges a merge patch (RFC 7386) into a value - objects are merged recursively, null members remove members and any other value replaces the target.
+// Returns the merged value - objects of the target are modified in place.
+func mergePatch(target any, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// Merges a merge patch (see [mergePatch]) into the value a json pointer references within a document.
+// The referenced value is created if its parent object lacks it.
+// Returns an error if the pointer references a missing array element or traverses a non-container value.
+// Returns an error if the document itself would be replaced by a non-object.
+func mergeAt(document map[string]any, pointer string, patch any) error {
+	if pointer == "" {
+		merged, ok := mergePatch(document, patch).(map[string]any)
+		if !ok {
+			return fmt.Errorf("cannot replace the document with a non-object")
+		}
+		for key := range document {
+			_, ok := merged[key]
+			if !ok {
+				delete(document, key)
+			}
+		}
+		for key, value := range merged {
+			document[key] = value
+		}
+		return nil
+	}
+	tokens, err := splitPointer(pointer)
+	if err != nil {
+		return err
+	}
+	parent := any(document)
+	for _, token := range tokens[:len(tokens)-1] {
+		child, err := getChild(parent, token)
+		if err != nil {
+			return err
+		}
+		parent = child
+	}
+	last := tokens[len(tokens)-1]
+	switch typed := parent.(type) {
+	case map[string]any:
+		typed[last] = mergePatch(typed[last], patch)
+	case []any:
+		index, err := strconv.Atoi(last)
+		if err != nil || index < 0 || index >= len(typed) {
+			return fmt.Errorf("no array element %s", last)
+		}
+		typed[index] = mergePatch(typed[index], patch)
+	default:
+		return fmt.Errorf("cannot merge into a non-container value")
+	}
+	return nil
+}
+
+// Returns the member (or array element) of a container value referenced by a json pointer token.
+// Returns an error if the member is missing or the value isn't a container.
+func getChild(parent any, token string) (any, error) {
+	switch typed := parent.(type) {
+	case map[string]any:
+		child, ok := typed[token]
+		if !ok {
+			return nil, fmt.Errorf("no member %s", token)
+		}
+		return child, nil
+	case []any:
+		index, err := strconv.Atoi(token)
+		if err != nil || index < 0 || index >= len(typed) {
+			return nil, fmt.Errorf("no array element %s", token)
+		}
+		return typed[index], nil
+	default:
+		return nil, fmt.Errorf("cannot traverse a non-container value at %s", token)
+	}
+}
+
+// Splits a (non-empty) json pointer into its (unescaped) reference tokens.
+// Returns an error if the pointer doesn't start with '/'.
+func splitPointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid json pointer %s", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for index, token := range tokens {
+		tokens[index] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// Returns the value a json pointer references within a document - an empty pointer references the document itself.
+// Returns an error if the pointer is invalid or doesn't resolve.
+func resolvePointer(document map[string]any, pointer string) (any, error) {
+	if pointer == "" {
+		return document, nil
+	}
+	tokens, err := splitPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	value := any(document)
+	for _, token := range tokens {
+		value, err = getChild(value, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,293 @@
+// Package patch applies json patches to config files and selects the patches whose conditions hold for a server.
+package patch
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigPatches are a map of relative file path (or glob - see [Expand]) -> a list of json patches to apply (see [Patch])
+type ConfigPatches map[string][]Patch
+
+// Parses config patches from JSON or YAML.
+// Returns an error if the data cannot be parsed.
+// Returns an error if a target is a malformed glob or the conditions of a patch are invalid.
+func Parse(data []byte) (ConfigPatches, error) {
+	if !json.Valid(data) {
+		document := any(nil)
+		err := yaml.Unmarshal(data, &document)
+		if err != nil {
+			return nil, err
+		}
+		data, err = json.Marshal(document)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported yaml: %w", err)
+		}
+	}
+	parsed := map[string][]Patch{}
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return nil, err
+	}
+	for relPath, patches := range parsed {
+		_, err := filepath.Match(relPath, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", relPath, err)
+		}
+		for _, patch := range patches {
+			err := patch.validate()
+			if err != nil {
+				return nil, fmt.Errorf("%s: patch %s %s: %w", relPath, patch.Op, patch.Path, err)
+			}
+		}
+	}
+	return ConfigPatches(parsed), nil
+}
+
+// Parses a string (JSON or YAML - see [Parse]) into a [ConfigPatches] object.
+// Used to parse settings from the environment.
+func (cps *ConfigPatches) UnmarshalText(data []byte) error {
+	parsed, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	*cps = parsed
+	return nil
+}
+
+// Loads config patches from a (JSON or YAML) file - see [Parse].
+// Returns an error if the file cannot be read or parsed.
+func Load(ctx context.Context, path string) (ConfigPatches, error) {
+	helper.Logger(ctx).Info("load config patches", "path", path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("config patches %s: %w", path, err)
+	}
+	return parsed, nil
+}
+
+// patchFileExtensions are the extensions of the files loaded from a directory of config patches (see [LoadDir])
+var patchFileExtensions = []string{".json", ".yaml", ".yml"}
+
+// Loads the config patches of the files within a directory (see [Load]), merged in the lexical order of their names.
+// Only the files directly within the directory with a json or yaml extension are loaded.
+// Hidden entries (e.g., the '..data' links of kubernetes ConfigMap volumes) are ignored.
+// Returns an error if the directory cannot be read or a file cannot be loaded.
+func LoadDir(ctx context.Context, dir string) (ConfigPatches, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	loaded := []ConfigPatches{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || !slices.Contains(patchFileExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		configPatches, err := Load(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, configPatches)
+	}
+	return Merge(loaded...), nil
+}
+
+// Merges several [ConfigPatches] objects into a single one.
+func Merge(maps ...ConfigPatches) ConfigPatches {
+	data := ConfigPatches{}
+	for _, currMap := range maps {
+		for k, v := range currMap {
+			_, ok := data[k]
+			if !ok {
+				data[k] = []Patch{}
+			}
+			data[k] = append(data[k], v...)
+		}
+	}
+	return data
+}
+
+// Orders the patches of each file by their priority (see [Patch.Priority]).
+// Patches of equal priority keep the order they were merged in (see [Merge]).
+func Order(configPatches ConfigPatches) ConfigPatches {
+	ordered := ConfigPatches{}
+	for relPath, patches := range configPatches {
+		ordered[relPath] = slices.Clone(patches)
+		slices.SortStableFunc(ordered[relPath], func(a Patch, b Patch) int {
+			return cmp.Compare(a.Priority, b.Priority)
+		})
+	}
+	return ordered
+}
+
+// Applies patches to a document (of a file, relative to the root directory) in order.
+// Patches with file conditions are skipped unless their conditions hold for the document as patched so far.
+// References to environment variables are expected to have been expanded already (see [Patch.expand]).
+// Returns an error if a patch fails to apply.
+func applyPatches(ctx context.Context, relPath string, data map[string]any, patches []Patch) error {
+	pending := []helper.JsonPatch{}
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		err := helper.ApplyJsonPatches(ctx, &data, pending...)
+		pending = []helper.JsonPatch{}
+		return err
+	}
+	skipped := 0
+	defer func() {
+		if skipped > 0 {
+			helper.Logger(ctx).Info("skip config patches whose file conditions don't hold", "count", skipped, "path", relPath)
+		}
+	}()
+	for _, patch := range patches {
+		if patch.hasFileConditions() {
+			err := flush()
+			if err != nil {
+				return err
+			}
+			unmet := patch.evaluate(data)
+			if unmet != "" {
+				helper.Logger(ctx).Debug("skip config patch", "path", relPath, "op", patch.Op, "pointer", patch.Path, "reason", unmet)
+				skipped++
+				continue
+			}
+		}
+		if patch.Op != mergeOp {
+			pending = append(pending, patch.jsonPatch())
+			continue
+		}
+		err := flush()
+		if err != nil {
+			return err
+		}
+		err = mergeAt(data, patch.Path, patch.Value)
+		if err != nil {
+			return fmt.Errorf("patch %s %s: %w", patch.Op, patch.Path, err)
+		}
+	}
+	return flush()
+}
+
+// Applies config patches to files located in the root directory.
+// Server conditions are expected to have been evaluated already (see [Filter]).
+// Besides json patch ops, patches can merge their value into the file (op 'merge' - see [mergeAt]).
+// Each file is snapshotted into the snapshot directory (at the same relative path) prior to being patched.
+// Patches are always applied to a file's pristine contents, so that ops such as 'add /list/-' don't stack across boots.
+// A file is left untouched if it and its patches are unchanged since it was last patched (see [appliedFile]).
+// A file that changed since it was last patched has drifted, and its current contents become its pristine contents.
+// JSON files may contain comments and trailing commas (see [stripJsonc]) - their leading comments are preserved (see [writeConfigFile]).
+// References to environment variables within patch values are expanded as patches are applied (see [expandValue]).
+// Returns an error if a referenced environment variable is unset.
+// Returns an error if a file cannot be read, snapshotted, patched or written.
+func Apply(ctx context.Context, root string, snapshotDir string, configPatches ConfigPatches) error {
+	state, err := loadState(snapshotDir)
+	if err != nil {
+		return err
+	}
+	for relPath, patches := range configPatches {
+		helper.Logger(ctx).Info("apply config patch", "count", len(patches), "path", relPath)
+		expanded := []Patch{}
+		for _, patch := range patches {
+			patch, err := patch.expand()
+			if err != nil {
+				return fmt.Errorf("%s: %w", relPath, err)
+			}
+			expanded = append(expanded, patch)
+		}
+		checksum, err := checksumPatches(expanded)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(root, relPath)
+		snapshot := filepath.Join(snapshotDir, relPath)
+		record, patchedBefore := state[relPath]
+		if isUnchanged(root, snapshotDir, relPath, state) {
+			if record.Patches == checksum {
+				helper.Logger(ctx).Info("config patches already applied", "path", relPath)
+				continue
+			}
+		} else {
+			if patchedBefore {
+				helper.Logger(ctx).Warn("config file changed since it was patched - patching its current contents", "path", relPath)
+			}
+			pristine, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			err = fsutil.WriteFileAtomic(snapshot, pristine)
+			if err != nil {
+				return err
+			}
+		}
+
+		data := map[string]any{}
+		document, err := readConfigFile(ctx, snapshot, &data)
+		if err != nil {
+			return err
+		}
+		err = applyPatches(ctx, relPath, data, expanded)
+		if err != nil {
+			return fmt.Errorf("%s: %w", relPath, err)
+		}
+		err = writeConfigFile(ctx, path, document, data)
+		if err != nil {
+			return err
+		}
+		patched, err := fsutil.HashFile(path)
+		if err != nil {
+			return err
+		}
+		pristine, err := fsutil.HashFile(snapshot)
+		if err != nil {
+			return err
+		}
+		state[relPath] = appliedFile{Patched: patched, Patches: checksum, Pristine: pristine}
+		err = saveState(snapshotDir, state)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Applies patches to a document (e.g., a file not managed by [Apply]) in order.
+// Returns an error if a referenced environment variable is unset or a patch fails to apply.
+func ApplyDocument(ctx context.Context, relPath string, data map[string]any, patches []Patch) error {
+	expanded := []Patch{}
+	for _, patch := range patches {
+		patch, err := patch.expand()
+		if err != nil {
+			return fmt.Errorf("%s: %w", relPath, err)
+		}
+		expanded = append(expanded, patch)
+	}
+	err := applyPatches(ctx, relPath, data, expanded)
+	if err != nil {
+		return fmt.Errorf("%s: %w", relPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package patch
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	expected := ConfigPatches{
+		"SPT_Data/Server/configs/http.json": []Patch{
+			{Op: "replace", Path: "/port", Value: float64(7000)},
+			{Op: "add", Path: "/list/-", Value: map[string]any{"enabled": true}, Priority: 10},
+		},
+	}
+	tests := []struct {
+		name        string
+		data        string
+		expectedErr bool
+	}{
+		{name: "json", data: `{"SPT_Data/Server/configs/http.json": [{"op": "replace", "path": "/port", "value": 7000}, {"op": "add", "path": "/list/-", "value": {"enabled": true}, "priority": 10}]}`},
+		{name: "yaml", data: "SPT_Data/Server/configs/http.json:\n- op: replace\n  path: /port\n  value: 7000\n- op: add\n  path: /list/-\n  value:\n    enabled: true\n  priority: 10\n"},
+		{name: "malformed", data: "{", expectedErr: true},
+		{name: "malformed glob", data: `{"configs/[.json": []}`, expectedErr: true},
+		{name: "invalid condition", data: `{"http.json": [{"op": "replace", "path": "/port", "value": 1, "when": {"spt": "not a range"}}]}`, expectedErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := Parse([]byte(test.data))
+			if test.expectedErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed, expected) {
+				t.Errorf("got %#v, expected %#v", parsed, expected)
+			}
+		})
+	}
+}
+
+func TestMergeOrder(t *testing.T) {
+	first := ConfigPatches{
+		"a.json": []Patch{{Op: "replace", Path: "/1"}, {Op: "replace", Path: "/2", Priority: 5}},
+	}
+	second := ConfigPatches{
+		"a.json": []Patch{{Op: "replace", Path: "/3", Priority: -1}, {Op: "replace", Path: "/4"}},
+		"b.json": []Patch{{Op: "replace", Path: "/5"}},
+	}
+	tests := []struct {
+		name     string
+		patches  ConfigPatches
+		expected map[string][]string
+	}{
+		{name: "merge", patches: Merge(first, second), expected: map[string][]string{"a.json": {"/1", "/2", "/3", "/4"}, "b.json": {"/5"}}},
+		{name: "order", patches: Order(Merge(first, second)), expected: map[string][]string{"a.json": {"/3", "/1", "/4", "/2"}, "b.json": {"/5"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			paths := map[string][]string{}
+			for relPath, patches := range test.patches {
+				for _, patch := range patches {
+					paths[relPath] = append(paths[relPath], patch.Path)
+				}
+			}
+			if !reflect.DeepEqual(paths, test.expected) {
+				t.Errorf("got %v, expected %v", paths, test.expected)
+			}
+		})
+	}
+	if len(first["a.json"]) != 2 {
+		t.Error("merge modified its input")
+	}
+}
+
+// Writes a config file (relative to the root directory).
+func writeConfig(t *testing.T, root string, relPath string, data any) {
+	t.Helper()
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Dir(filepath.Join(root, relPath)), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(root, relPath), encoded, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Reads a config file (relative to the root directory).
+func readConfig(t *testing.T, ctx context.Context, root string, relPath string) map[string]any {
+	t.Helper()
+	data := map[string]any{}
+	err := UnmarshalFile(ctx, filepath.Join(root, relPath), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestApply(t *testing.T) {
+	relPath := "configs/core.json"
+	stock := map[string]any{"list": []any{"a"}, "port": float64(6969)}
+	patches := ConfigPatches{relPath: []Patch{
+		{Op: "add", Path: "/list/-", Value: "b"},
+		{Op: "replace", Path: "/port", Value: float64(7000)},
+	}}
+	patched := map[string]any{"list": []any{"a", "b"}, "port": float64(7000)}
+	tests := []struct {
+		name string
+		// modify runs between two applications of the patches
+		modify   func(t *testing.T, ctx context.Context, root string, snapshotDir string)
+		patches  ConfigPatches
+		expected map[string]any
+		// expectedPristine is the contents of the file's snapshot once patched again
+		expectedPristine map[string]any
+	}{
+		{
+			name:             "idempotent",
+			modify:           func(t *testing.T, ctx context.Context, root string, snapshotDir string) {},
+			patches:          patches,
+			expected:         patched,
+			expectedPristine: stock,
+		},
+		{
+			name:             "changed patches apply to pristine contents",
+			modify:           func(t *testing.T, ctx context.Context, root string, snapshotDir string) {},
+			patches:          ConfigPatches{relPath: []Patch{{Op: "add", Path: "/list/-", Value: "c"}}},
+			expected:         map[string]any{"list": []any{"a", "c"}, "port": float64(6969)},
+			expectedPristine: stock,
+		},
+		{
+			name: "drifted file is patched from its current contents",
+			modify: func(t *testing.T, ctx context.Context, root string, snapshotDir string) {
+				writeConfig(t, root, relPath, map[string]any{"list": []any{"z"}, "port": float64(1)})
+			},
+			patches:          patches,
+			expected:         map[string]any{"list": []any{"z", "b"}, "port": float64(7000)},
+			expectedPristine: map[string]any{"list": []any{"z"}, "port": float64(1)},
+		},
+		{
+			name: "reset restores pristine contents",
+			modify: func(t *testing.T, ctx context.Context, root string, snapshotDir string) {
+				err := Reset(ctx, root, snapshotDir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data := readConfig(t, ctx, root, relPath)
+				if !reflect.DeepEqual(data, stock) {
+					t.Errorf("reset file holds %v, expected %v", data, stock)
+				}
+			},
+			patches:          patches,
+			expected:         patched,
+			expectedPristine: stock,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			root := t.TempDir()
+			snapshotDir := t.TempDir()
+			writeConfig(t, root, relPath, stock)
+			err := Apply(ctx, root, snapshotDir, patches)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.modify(t, ctx, root, snapshotDir)
+			err = Apply(ctx, root, snapshotDir, test.patches)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := readConfig(t, ctx, root, relPath)
+			if !reflect.DeepEqual(data, test.expected) {
+				t.Errorf("patched file holds %v, expected %v", data, test.expected)
+			}
+			pristine := readConfig(t, ctx, snapshotDir, relPath)
+			if !reflect.DeepEqual(pristine, test.expectedPristine) {
+				t.Errorf("snapshot holds %v, expected %v", pristine, test.expectedPristine)
+			}
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	stock := map[string]any{"port": float64(6969)}
+	tests := []struct {
+		name string
+		// drift modifies the file after it was patched
+		drift    bool
+		expected map[string]any
+	}{
+		{name: "unchanged file", expected: stock},
+		{name: "drifted file is left as is", drift: true, expected: map[string]any{"port": float64(1)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			root := t.TempDir()
+			snapshotDir := t.TempDir()
+			writeConfig(t, root, "a.json", stock)
+			writeConfig(t, root, "b.json", stock)
+			patches := []Patch{{Op: "replace", Path: "/port", Value: float64(7000)}}
+			err := Apply(ctx, root, snapshotDir, ConfigPatches{"a.json": patches, "b.json": patches})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.drift {
+				writeConfig(t, root, "a.json", map[string]any{"port": float64(1)})
+			}
+			err = Restore(ctx, root, snapshotDir, []string{"b.json"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := readConfig(t, ctx, root, "a.json")
+			if !reflect.DeepEqual(data, test.expected) {
+				t.Errorf("restored file holds %v, expected %v", data, test.expected)
+			}
+			data = readConfig(t, ctx, root, "b.json")
+			if data["port"] != float64(7000) {
+				t.Errorf("file still patched holds %v", data)
+			}
+			snapshots, err := Snapshots(snapshotDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(snapshots, []string{"b.json"}) {
+				t.Errorf("got snapshots %v, expected [b.json]", snapshots)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package patch
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// schemaFiles are the bundled schemas of spt's config files - named after the config files they describe (see [getSchema])
+//
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// schemaDataDirs are the directories (relative to the spt path) holding spt's configs - releases prior to 3.9.0 kept their data beneath 'Aki_Data'
+var schemaDataDirs = []string{"SPT_Data", "Aki_Data"}
+
+// schema is the subset of JSON Schema used to describe config files (see [schemaFiles]) - types, properties, array items, enums and numeric bounds
+type schema struct {
+	AdditionalProperties *additionalProperties `json:"additionalProperties,omitempty"`
+	Description          string                `json:"description,omitempty"`
+	Enum                 []any                 `json:"enum,omitempty"`
+	Items                *schema               `json:"items,omitempty"`
+	Maximum              *float64              `json:"maximum,omitempty"`
+	Minimum              *float64              `json:"minimum,omitempty"`
+	Properties           map[string]*schema    `json:"properties,omitempty"`
+	Type                 string                `json:"type,omitempty"`
+}
+
+// additionalProperties describes the members of an object not listed by its schema's properties
+type additionalProperties struct {
+	Allowed bool
+	Schema  *schema
+}
+
+// Parses 'additionalProperties' - a boolean or a schema.
+// Returns an error if the data is neither.
+func (ap *additionalProperties) UnmarshalJSON(data []byte) error {
+	allowed := false
+	err := json.Unmarshal(data, &allowed)
+	if err == nil {
+		ap.Allowed = allowed
+		return nil
+	}
+	ap.Allowed = true
+	ap.Schema = &schema{}
+	return json.Unmarshal(data, ap.Schema)
+}
+
+// Returns the bundled schema of a config file (relative to the spt path) - or nil if the file has no bundled schema.
+// Returns an error if the bundled schema cannot be parsed.
+func getSchema(relPath string) (*schema, error) {
+	relPath = path.Clean(strings.ReplaceAll(relPath, "\\", "/"))
+	name := ""
+	for _, dataDir := range schemaDataDirs {
+		configName, ok := strings.CutPrefix(relPath, path.Join(dataDir, "Server/configs")+"/")
+		if ok && !strings.Contains(configName, "/") {
+			name = configName
+		}
+	}
+	if name == "" {
+		return nil, nil
+	}
+	data, err := schemaFiles.ReadFile(path.Join("schemas", name))
+	if err != nil {
+		return nil, nil
+	}
+	parsed := &schema{}
+	err = json.Unmarshal(data, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", name, err)
+	}
+	return parsed, nil
+}
+
+// Returns the JSON Schema type name of a parsed json value
+func getSchemaType(value any) string {
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if typed == math.Trunc(typed) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// Computes the edit distance between two strings
+func getEditDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for index := range previous {
+		previous[index] = index
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// Returns the known key closest to an unknown key (e.g., the key a misspelled key was meant to be) - or an empty string if no known key is close.
+func getClosestKey(key string, known []string) string {
+	closest := ""
+	distance := 3
+	for _, candidate := range known {
+		candidateDistance := getEditDistance(strings.ToLower(key), strings.ToLower(candidate))
+		if candidateDistance < distance {
+			closest = candidate
+			distance = candidateDistance
+		}
+	}
+	return closest
+}
+
+// Checks a (patched) value at a json pointer against a schema - comparing it against its stock (i.e., unpatched) value, if it has one.
+// Only the changes patches made are checked - values equal to their stock values are skipped.
+// Unknown members are only reported if the stock value lacks them.
+// Returns a problem for each violation of the schema (with the pointer of the violating value as its path).
+func (s *schema) check(pointer string, value any, stock any, hasStock bool) []Problem {
+	if hasStock && reflect.DeepEqual(value, stock) {
+		return nil
+	}
+	problem := func(format string, args ...any) []Problem {
+		return []Problem{{Path: pointer, Message: fmt.Sprintf("schema: %s", fmt.Sprintf(format, args...))}}
+	}
+	actual := getSchemaType(value)
+	if s.Type != "" && s.Type != actual && !(s.Type == "number" && actual == "integer") {
+		return problem("expected %s, got %s", s.Type, actual)
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(allowed any) bool { return reflect.DeepEqual(allowed, value) }) {
+		encoded, _ := json.Marshal(s.Enum)
+		return problem("expected one of %s", encoded)
+	}
+	number, isNumber := value.(float64)
+	if isNumber && s.Minimum != nil && number < *s.Minimum {
+		return problem("expected at least %v, got %v", *s.Minimum, number)
+	}
+	if isNumber && s.Maximum != nil && number > *s.Maximum {
+		return problem("expected at most %v, got %v", *s.Maximum, number)
+	}
+
+	problems := []Problem{}
+	switch typed := value.(type) {
+	case map[string]any:
+		stockObject, _ := stock.(map[string]any)
+		known := append(helper.Map[string, *schema](s.Properties).Keys(), helper.Map[string, any](stockObject).Keys()...)
+		keys := helper.Map[string, any](typed).Keys()
+		slices.Sort(keys)
+		for _, key := range keys {
+			childPointer := fmt.Sprintf("%s/%s", pointer, strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1"))
+			childStock, childHasStock := stockObject[key]
+			childSchema, ok := s.Properties[key]
+			if !ok && s.AdditionalProperties != nil {
+				if !s.AdditionalProperties.Allowed && !childHasStock {
+					message := fmt.Sprintf("schema: unknown key %q", key)
+					closest := getClosestKey(key, known)
+					if closest != "" {
+						message = fmt.Sprintf("%s (did you mean %q?)", message, closest)
+					}
+					problems = append(problems, Problem{Path: childPointer, Message: message})
+					continue
+				}
+				childSchema = s.AdditionalProperties.Schema
+			}
+			if childSchema == nil {
+				continue
+			}
+			problems = append(problems, childSchema.check(childPointer, typed[key], childStock, childHasStock)...)
+		}
+	case []any:
+		if s.Items == nil {
+			break
+		}
+		stockArray, _ := stock.([]any)
+		for index, item := range typed {
+			hasItemStock := index < len(stockArray)
+			itemStock := any(nil)
+			if hasItemStock {
+				itemStock = stockArray[index]
+			}
+			problems = append(problems, s.Items.check(fmt.Sprintf("%s/%d", pointer, index), item, itemStock, hasItemStock)...)
+		}
+	}
+	return problems
+}
+
+// Checks the changes patches made to a config file (relative to the spt path) against its bundled schema (see [getSchema]).
+// Returns no problems if the file has no bundled schema.
+// Returns an error if the bundled schema cannot be parsed.
+func checkSchema(relPath string, patched map[string]any, stock map[string]any) ([]Problem, error) {
+	fileSchema, err := getSchema(relPath)
+	if err != nil || fileSchema == nil {
+		return nil, err
+	}
+	problems := fileSchema.check("", patched, stock, true)
+	for index := range problems {
+		problems[index].File = relPath
+	}
+	return problems, nil
+}
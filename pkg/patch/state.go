@@ -0,0 +1,200 @@
+package patch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// stateFile is the file (within the snapshot directory) recording the patches applied to each file (see [appliedFile])
+const stateFile = ".applied.json"
+
+// appliedFile records the patches applied to a file - so that the file can be re-patched from its pristine contents on the next boot (see [Apply])
+type appliedFile struct {
+	// Patched is the checksum of the file once patched - a file whose checksum differs has changed since (e.g., an SPT or mod update replaced it)
+	Patched string `json:"patched"`
+	// Patches is the checksum of the applied patches (see [checksumPatches])
+	Patches string `json:"patches"`
+	// Pristine is the checksum of the file before it was patched (i.e., its snapshot)
+	Pristine string `json:"pristine"`
+}
+
+// Computes the checksum of a set of expanded patches (see [Patch.expand]).
+// Returns an error if the patches cannot be marshalled.
+func checksumPatches(patches []Patch) (string, error) {
+	data, err := json.Marshal(patches)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// Computes the checksum of an expanded patch (see [Patch.expand]).
+// Returns an error if a referenced environment variable is unset.
+func (p Patch) Checksum() (string, error) {
+	expanded, err := p.expand()
+	if err != nil {
+		return "", err
+	}
+	return checksumPatches([]Patch{expanded})
+}
+
+// Loads the patches applied to files snapshotted in the snapshot directory (see [appliedFile]).
+// Returns an error if the state file cannot be read or parsed.
+func loadState(snapshotDir string) (map[string]appliedFile, error) {
+	state := map[string]appliedFile{}
+	data, err := os.ReadFile(filepath.Join(snapshotDir, stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return state, json.Unmarshal(data, &state)
+}
+
+// Writes the patches applied to files snapshotted in the snapshot directory (see [loadState]).
+// Returns an error if the state file cannot be written.
+func saveState(snapshotDir string, state map[string]appliedFile) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(filepath.Join(snapshotDir, stateFile), data)
+}
+
+// Determines whether a file (located in the root directory) is unchanged since it was last patched.
+// Returns false if the file was never patched, if it or its snapshot no longer exists or if it drifted.
+func isUnchanged(root string, snapshotDir string, relPath string, state map[string]appliedFile) bool {
+	record, ok := state[relPath]
+	if !ok {
+		return false
+	}
+	current, err := fsutil.HashFile(filepath.Join(root, relPath))
+	if err != nil || current != record.Patched {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(snapshotDir, relPath))
+	return err == nil
+}
+
+// Returns the path holding the pristine contents of a file (located in the root directory).
+// This is the file's snapshot if the file is unchanged (see [isUnchanged]), or else the file itself.
+func getPristinePath(root string, snapshotDir string, relPath string, state map[string]appliedFile) string {
+	if isUnchanged(root, snapshotDir, relPath, state) {
+		return filepath.Join(snapshotDir, relPath)
+	}
+	return filepath.Join(root, relPath)
+}
+
+// Lists the files (relative to the root directory) snapshotted in the snapshot directory as they were patched (see [Apply]) - sorted.
+// Returns an error if the state file cannot be read.
+func Snapshots(snapshotDir string) ([]string, error) {
+	state, err := loadState(snapshotDir)
+	if err != nil {
+		return nil, err
+	}
+	relPaths := helper.Map[string, appliedFile](state).Keys()
+	slices.Sort(relPaths)
+	return relPaths, nil
+}
+
+// Restores the pristine contents of previously patched files (located in the root directory) that aren't listed in the patched files.
+// Files that changed since they were patched (see [isUnchanged]) are left as they are, which is logged.
+// Returns an error if a file cannot be restored or if the state file cannot be read or written.
+func Restore(ctx context.Context, root string, snapshotDir string, patched []string) error {
+	state, err := loadState(snapshotDir)
+	if err != nil {
+		return err
+	}
+	relPaths := helper.Map[string, appliedFile](state).Keys()
+	slices.Sort(relPaths)
+	for _, relPath := range relPaths {
+		if slices.Contains(patched, relPath) {
+			continue
+		}
+		snapshot := filepath.Join(snapshotDir, relPath)
+		if isUnchanged(root, snapshotDir, relPath, state) {
+			helper.Logger(ctx).Info("restore config file no longer patched", "path", relPath)
+			data, err := os.ReadFile(snapshot)
+			if err != nil {
+				return err
+			}
+			err = fsutil.WriteFileAtomic(filepath.Join(root, relPath), data)
+			if err != nil {
+				return err
+			}
+		} else {
+			helper.Logger(ctx).Warn("config file no longer patched changed since it was patched - leaving it as is", "path", relPath)
+		}
+		err := os.Remove(snapshot)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		delete(state, relPath)
+		err = saveState(snapshotDir, state)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reads the pristine contents of a file (located in the root directory) into the provided pointer (see [getPristinePath]).
+// Returns an error if the file cannot be read or parsed.
+func ReadPristine(ctx context.Context, root string, snapshotDir string, relPath string, data any) error {
+	state, err := loadState(snapshotDir)
+	if err != nil {
+		return err
+	}
+	_, err = readConfigFile(ctx, getPristinePath(root, snapshotDir, relPath, state), data)
+	return err
+}
+
+// Restores the pristine contents of every patched file (located in the root directory) that is unchanged since it was patched.
+// Patches are re-applied from the pristine contents afterwards (see [Apply]).
+// Files that changed since they were patched are left as they are - they're detected as drifted when patches are applied.
+// Returns an error if a file cannot be restored or if the state file cannot be read or written.
+func Reset(ctx context.Context, root string, snapshotDir string) error {
+	state, err := loadState(snapshotDir)
+	if err != nil {
+		return err
+	}
+	relPaths := helper.Map[string, appliedFile](state).Keys()
+	slices.Sort(relPaths)
+	for _, relPath := range relPaths {
+		if !isUnchanged(root, snapshotDir, relPath, state) {
+			continue
+		}
+		helper.Logger(ctx).Info("restore pristine config file", "path", relPath)
+		path := filepath.Join(root, relPath)
+		data, err := os.ReadFile(filepath.Join(snapshotDir, relPath))
+		if err != nil {
+			return err
+		}
+		err = fsutil.WriteFileAtomic(path, data)
+		if err != nil {
+			return err
+		}
+		pristine, err := fsutil.HashFile(path)
+		if err != nil {
+			return err
+		}
+		// the file is unchanged (it holds its pristine contents) but no patches are applied - so that they're re-applied
+		state[relPath] = appliedFile{Patched: pristine, Pristine: pristine}
+		err = saveState(snapshotDir, state)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
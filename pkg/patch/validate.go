@@ -0,0 +1,126 @@
+package patch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// patchOps are the ops a [Patch] can use - json patch ops (without 'move' and 'copy', as patches have no 'from') and merge patches (see [mergeOp])
+var patchOps = []string{"add", "remove", "replace", "test", mergeOp}
+
+// Problem is a reason config patches cannot be applied (see [Validate])
+type Problem struct {
+	// File is the file (relative to the root directory) the patch targets
+	File string
+	// Op and Path identify the patch - both are empty for problems with the file itself
+	Op      string
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Op == "" && p.Path != "" {
+		return fmt.Sprintf("%s: %s: %s", p.File, p.Path, p.Message)
+	}
+	if p.Op == "" {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+	return fmt.Sprintf("%s: patch %s %s: %s", p.File, p.Op, p.Path, p.Message)
+}
+
+// Checks that a patch is well formed - that its op is known, its path is a json pointer and it has a value (if its op requires one).
+// Returns a description of the problem - or an empty string if the patch is well formed.
+func checkPatch(patch Patch) string {
+	if !slices.Contains(patchOps, patch.Op) {
+		return fmt.Sprintf("unknown op %q (expected one of %s)", patch.Op, strings.Join(patchOps, ", "))
+	}
+	if patch.Path != "" && !strings.HasPrefix(patch.Path, "/") {
+		return fmt.Sprintf("invalid json pointer %q (expected '' or a path starting with '/')", patch.Path)
+	}
+	if patch.Op != "remove" && patch.Value == nil {
+		return "missing value"
+	}
+	return ""
+}
+
+// Checks that config patches can be applied to files located in the root directory - without modifying the files.
+// Patches are checked against the pristine contents of files they were previously applied to (see [getPristinePath]).
+// Every file must exist and parse, and every patch must be well formed and apply in order.
+// Patches that fail are skipped, so that later patches are still checked.
+// The patched contents of spt's config files are then checked against their bundled schemas (see [checkSchema]).
+// Glob targets are expected to have been expanded already (see [Expand]) - as conditions are expected to have been evaluated (see [Filter]).
+// Returns every problem found - sorted by file.
+func Validate(ctx context.Context, root string, snapshotDir string, configPatches ConfigPatches) []Problem {
+	problems := []Problem{}
+	state, err := loadState(snapshotDir)
+	if err != nil {
+		helper.Logger(ctx).Warn("applied config patches unknown - checking patches against current files", "error", err.Error())
+		state = map[string]appliedFile{}
+	}
+	relPaths := helper.Map[string, []Patch](configPatches).Keys()
+	slices.Sort(relPaths)
+	for _, relPath := range relPaths {
+		expanded := []Patch{}
+		for _, patch := range configPatches[relPath] {
+			message := checkPatch(patch)
+			if message != "" {
+				problems = append(problems, Problem{File: relPath, Op: patch.Op, Path: patch.Path, Message: message})
+				expanded = append(expanded, Patch{})
+				continue
+			}
+			expandedPatch, err := patch.expand()
+			if err != nil {
+				problems = append(problems, Problem{File: relPath, Op: patch.Op, Path: patch.Path, Message: errors.Unwrap(err).Error()})
+				expandedPatch = patch
+			}
+			expanded = append(expanded, expandedPatch)
+		}
+
+		pristinePath := getPristinePath(root, snapshotDir, relPath, state)
+		data := map[string]any{}
+		_, err := readConfigFile(ctx, pristinePath, &data)
+		if errors.Is(err, os.ErrNotExist) {
+			problems = append(problems, Problem{File: relPath, Message: "file not found"})
+			continue
+		}
+		if err != nil {
+			problems = append(problems, Problem{File: relPath, Message: fmt.Sprintf("unreadable: %s", err.Error())})
+			continue
+		}
+		for index, expandedPatch := range expanded {
+			if expandedPatch.Op == "" {
+				// already reported as malformed
+				continue
+			}
+			if expandedPatch.hasFileConditions() && expandedPatch.evaluate(data) != "" {
+				// skipped when applied
+				continue
+			}
+			err := applyPatches(ctx, relPath, data, []Patch{expandedPatch})
+			if err != nil {
+				patch := configPatches[relPath][index]
+				problems = append(problems, Problem{File: relPath, Op: patch.Op, Path: patch.Path, Message: strings.TrimPrefix(err.Error(), fmt.Sprintf("patch %s %s: ", patch.Op, patch.Path))})
+			}
+		}
+
+		stock := map[string]any{}
+		_, err = readConfigFile(ctx, pristinePath, &stock)
+		if err != nil {
+			problems = append(problems, Problem{File: relPath, Message: fmt.Sprintf("unreadable: %s", err.Error())})
+			continue
+		}
+		schemaProblems, err := checkSchema(relPath, data, stock)
+		if err != nil {
+			problems = append(problems, Problem{File: relPath, Message: err.Error()})
+			continue
+		}
+		problems = append(problems, schemaProblems...)
+	}
+	return problems
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+	"github.com/benfiola/single-player-tarkov/pkg/patch"
+)
+
+// ServerPortConfig is loaded from the environment and configures how a server port that is already in use is handled (see [ResolveServerPort])
+type ServerPortConfig struct {
+	Fallback      bool   `env:"SERVER_PORT_FALLBACK"`
+	FallbackRange int    `env:"SERVER_PORT_FALLBACK_RANGE" envDefault:"100"`
+	Webhook       string `env:"SERVER_PORT_WEBHOOK"`
+}
+
+// httpConfigPath is the path (relative to the spt path) of the server's http config holding the server port
+const httpConfigPath = "SPT_Data/Server/configs/http.json"
+
+// ServerPortStatus describes the port the server was started on (see [getServerPortStatusPath])
+type ServerPortStatus struct {
+	Configured int  `json:"configured"`
+	Fallback   bool `json:"fallback"`
+	Port       int  `json:"port"`
+}
+
+// Returns the path to the server port status (see [ServerPortStatus])
+func getServerPortStatusPath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "server-port.json")
+}
+
+// Sets the port in the server's http config for the duration of the server's initialization (see [getInitializationPort]).
+// Returns an error if the http config cannot be read or written.
+func setServerPort(ctx context.Context, port int) error {
+	path := filepath.Join(helper.Dirs(ctx)["spt"], httpConfigPath)
+	data := map[string]any{}
+	err := helper.UnmarshalFile(ctx, path, &data)
+	if err != nil {
+		return err
+	}
+	err = helper.ApplyJsonPatches(ctx, &data, helper.JsonPatch{Op: "replace", Path: "/port", Value: port})
+	if err != nil {
+		return err
+	}
+	return helper.MarshalFile(ctx, data, path)
+}
+
+// Re-applies the config patches of the server's http config (see [patch.Apply]) - including the fallback port patch.
+// Patching through [patch.Apply] keeps the applied patches recorded, so that the port is reverted once the fallback is no longer needed.
+// Returns an error if the patches cannot be resolved or applied.
+func applyServerPortPatches(ctx context.Context, config EntrypointConfig) error {
+	configPatches, err := getSetupConfigPatches(ctx, config)
+	if err != nil {
+		return err
+	}
+	configPatches, err = resolveConfigPatches(ctx, config.SptVersion, configPatches)
+	if err != nil {
+		return err
+	}
+	return patch.Apply(ctx, helper.Dirs(ctx)["spt"], getStockConfigPath(ctx, ""), patch.ConfigPatches{httpConfigPath: configPatches[httpConfigPath]})
+}
+
+// Finds the first port following a port (within a range) that can be bound.
+// Returns an error if no port within the range can be bound.
+func findFreePort(ctx context.Context, port int, count int) (int, error) {
+	for candidate := port + 1; candidate <= port+count && candidate <= 65535; candidate++ {
+		err := CheckPortAvailable(ctx, candidate)
+		if err == nil {
+			return candidate, nil
+		}
+	}
+	return 0, fmt.Errorf("no free port within %d ports of %d", count, port)
+}
+
+// Returns the port the server is initialized on (see [InitializeServer]) - SPT's default port, unless it is in use and SERVER_PORT_FALLBACK is set.
+// In that case, the next free port is set in the http config until the returned function is called.
+// Returns an error if the port is in use (and no free port is found).
+// Returns an error if the http config cannot be read or written.
+func getInitializationPort(ctx context.Context) (int, func() error, error) {
+	port := 6969
+	restore := func() error { return nil }
+	err := CheckPortAvailable(ctx, port)
+	if err == nil || !errors.Is(err, syscall.EADDRINUSE) {
+		return port, restore, err
+	}
+	portConfig := ServerPortConfig{}
+	parseErr := helper.ParseEnv(ctx, &portConfig)
+	if parseErr != nil {
+		return 0, restore, parseErr
+	}
+	if !portConfig.Fallback {
+		return 0, restore, err
+	}
+	free, freeErr := findFreePort(ctx, port, portConfig.FallbackRange)
+	if freeErr != nil {
+		return 0, restore, errors.Join(err, freeErr)
+	}
+	path := filepath.Join(helper.Dirs(ctx)["spt"], httpConfigPath)
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return 0, restore, err
+	}
+	helper.Logger(ctx).Info("initialize server on the next free port", "port", free, "in-use", port)
+	restore = func() error {
+		return fsutil.WriteFileAtomic(path, original)
+	}
+	return free, restore, setServerPort(ctx, free)
+}
+
+// Ensures the server port (see [getServerPort]) can be bound prior to launching the server.
+// If the port is in use and SERVER_PORT_FALLBACK is set, the next free port (within SERVER_PORT_FALLBACK_RANGE) is selected instead.
+// The selected port is patched into the http config (see [applyServerPortPatches]) and the returned configuration.
+// The chosen port is logged, written to the data directory and posted to SERVER_PORT_WEBHOOK (if set).
+// Returns an error if the port is in use (and no free port is found).
+// Returns an error if the http config cannot be patched.
+func ResolveServerPort(ctx context.Context, config EntrypointConfig) (EntrypointConfig, error) {
+	portConfig := ServerPortConfig{}
+	err := helper.ParseEnv(ctx, &portConfig)
+	if err != nil {
+		return config, err
+	}
+	if portConfig.FallbackRange <= 0 {
+		return config, fmt.Errorf("invalid SERVER_PORT_FALLBACK_RANGE %d", portConfig.FallbackRange)
+	}
+	port := getServerPort(config)
+	status := ServerPortStatus{Configured: port, Port: port}
+	err = CheckPortAvailable(ctx, port)
+	if err != nil {
+		if !portConfig.Fallback || !errors.Is(err, syscall.EADDRINUSE) {
+			return config, err
+		}
+		free, freeErr := findFreePort(ctx, port, portConfig.FallbackRange)
+		if freeErr != nil {
+			return config, errors.Join(err, freeErr)
+		}
+		// the fallback port applies last - overriding ports set by other patches
+		config.ConfigPatches = patch.Merge(config.ConfigPatches, patch.ConfigPatches{
+			httpConfigPath: []patch.Patch{{Op: "replace", Path: "/port", Value: float64(free), Priority: math.MaxInt}},
+		})
+		err = applyServerPortPatches(ctx, config)
+		if err != nil {
+			return config, err
+		}
+		status = ServerPortStatus{Configured: port, Fallback: true, Port: free}
+	}
+
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err == nil {
+		err = fsutil.WriteFileAtomic(getServerPortStatusPath(ctx), data)
+	}
+	if err != nil {
+		helper.Logger(ctx).Warn("write server port status failed", "error", err.Error())
+	}
+	if !status.Fallback {
+		return config, nil
+	}
+	summary := fmt.Sprintf("server port %d is in use - the server is listening on port %d instead", status.Configured, status.Port)
+	helper.Logger(ctx).Warn(summary, "configured", status.Configured, "port", status.Port)
+	if portConfig.Webhook == "" {
+		return config, nil
+	}
+	payload := map[string]any{"content": summary, "text": summary, "configured": status.Configured, "port": status.Port}
+	err = PostJson(outbound.Declare(ctx, "post server port to webhook"), portConfig.Webhook, payload)
+	if err != nil {
+		helper.Logger(ctx).Warn("post server port to webhook failed", "error", err.Error())
+	}
+	return config, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/patch"
+)
+
+// PresetsConfig is loaded from the environment and selects the gameplay presets applied to the server (see [presets])
+type PresetsConfig struct {
+	Presets []string `env:"PRESETS"`
+}
+
+// preset is a curated set of config patches applying a common gameplay tweak
+type preset struct {
+	// Description summarizes the tweak
+	Description string
+	// Patches returns the preset's patches - targeting files beneath the data directory (see [getSptDataDir]).
+	// Patches are skipped where an spt version lacks a setting (see [patch.Patch.IfExists]).
+	Patches func(dataDir string) patch.ConfigPatches
+}
+
+// presetBossSpawnLimit is the number of boss spawns per map a preset patches
+const presetBossSpawnLimit = 64
+
+// presetTraderIds are the ids of the traders insuring items
+var presetTraderIds = map[string]string{
+	"prapor":    "54cb50c76803fa8b248b4571",
+	"therapist": "54cb57776803fa99248b456e",
+}
+
+// Returns a patch replacing a value - only where the value exists (see [patch.Patch.IfExists])
+func replaceExisting(pointer string, value any) patch.Patch {
+	return patch.Patch{Op: "replace", Path: pointer, Value: value, IfExists: pointer}
+}
+
+// presets are the presets selectable via PRESETS - keyed by name
+var presets = map[string]preset{
+	"boss-spawn-100": {
+		Description: "every boss (and boss-led wave, such as raiders and rogues) spawns every raid",
+		Patches: func(dataDir string) patch.ConfigPatches {
+			patches := []patch.Patch{}
+			for index := range presetBossSpawnLimit {
+				patches = append(patches, replaceExisting(fmt.Sprintf("/BossLocationSpawn/%d/BossChance", index), 100))
+			}
+			return patch.ConfigPatches{
+				path.Join(dataDir, "Server/database/locations/*/base.json"): patches,
+			}
+		},
+	},
+	"hardcore": {
+		Description: "the flea market is disabled and insured items are never returned",
+		Patches: func(dataDir string) patch.ConfigPatches {
+			return patch.ConfigPatches{
+				path.Join(dataDir, "Server/database/globals.json"): {
+					replaceExisting("/config/RagFair/enabled", false),
+				},
+				path.Join(dataDir, "Server/configs/insurance.json"): {
+					replaceExisting(fmt.Sprintf("/returnChancePercent/%s", presetTraderIds["prapor"]), 0),
+					replaceExisting(fmt.Sprintf("/returnChancePercent/%s", presetTraderIds["therapist"]), 0),
+				},
+			}
+		},
+	},
+	"longer-raids": {
+		Description: "raids last 2 hours on every map",
+		Patches: func(dataDir string) patch.ConfigPatches {
+			return patch.ConfigPatches{
+				path.Join(dataDir, "Server/database/locations/*/base.json"): {
+					replaceExisting("/EscapeTimeLimit", 120),
+				},
+			}
+		},
+	},
+	"no-flea-restrictions": {
+		Description: "the flea market is available from level 1 and every item can be sold on it",
+		Patches: func(dataDir string) patch.ConfigPatches {
+			return patch.ConfigPatches{
+				path.Join(dataDir, "Server/database/globals.json"): {
+					replaceExisting("/config/RagFair/minUserLevel", 1),
+				},
+				path.Join(dataDir, "Server/configs/ragfair.json"): {
+					replaceExisting("/dynamic/blacklist/enableBsgList", false),
+				},
+			}
+		},
+	},
+}
+
+// Returns the names of the known presets - sorted
+func getPresetNames() []string {
+	names := helper.Map[string, preset](presets).Keys()
+	slices.Sort(names)
+	return names
+}
+
+// Returns the config patches of the selected presets (see [presets]) for the given spt version.
+// Returns an error if a preset is unknown.
+// Returns an error if the spt version is not covered by a data directory.
+func getPresetPatches(ctx context.Context, sptVersion string, config PresetsConfig) (patch.ConfigPatches, error) {
+	if len(config.Presets) == 0 {
+		return patch.ConfigPatches{}, nil
+	}
+	for _, name := range config.Presets {
+		_, ok := presets[name]
+		if !ok {
+			return nil, &UserError{
+				Hint:    fmt.Sprintf("set PRESETS to a comma-separated list of known presets (%s)", strings.Join(getPresetNames(), ", ")),
+				Message: fmt.Sprintf("unknown preset %s", name),
+			}
+		}
+	}
+	dataDir, err := getSptDataDir(sptVersion)
+	if err != nil {
+		return nil, err
+	}
+	selected := []patch.ConfigPatches{}
+	for _, name := range config.Presets {
+		helper.Logger(ctx).Info("apply preset", "name", name, "description", presets[name].Description)
+		selected = append(selected, presets[name].Patches(dataDir))
+	}
+	return patch.Merge(selected...), nil
+}
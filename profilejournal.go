@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+)
+
+// profileJournalLimit is the number of changes kept in the profile journal - older changes are discarded when the server starts
+const profileJournalLimit = 1000
+
+// ProfileChange is an entry of the profile journal - a profile written (or deleted) by the server
+type ProfileChange struct {
+	Delta    int64     `json:"delta"`
+	Event    string    `json:"event"`
+	Profile  string    `json:"profile"`
+	Size     int64     `json:"size"`
+	Time     time.Time `json:"time"`
+	Username string    `json:"username,omitempty"`
+}
+
+// Returns the directory holding the server's profiles (within the data directory - see [Setup])
+func getProfilesDir(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "user", "profiles")
+}
+
+// Returns the path to the profile journal - a json document per line, one per [ProfileChange]
+func getProfileJournalPath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "profile-journal.jsonl")
+}
+
+// Returns the username of the account owning a profile - or an empty string if the profile cannot be read.
+func readProfileUsername(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	profile := struct {
+		Info struct {
+			Username string `json:"username"`
+		} `json:"info"`
+	}{}
+	_ = json.Unmarshal(data, &profile)
+	return profile.Info.Username
+}
+
+// Loads the changes recorded in the profile journal - oldest first.
+// Returns an empty list if the journal does not exist.
+// Lines that cannot be parsed (e.g., a line partially written when the container stopped) are skipped.
+// Returns an error if the journal cannot be read.
+func LoadProfileJournal(ctx context.Context) ([]ProfileChange, error) {
+	changes := []ProfileChange{}
+	handle, err := os.Open(getProfileJournalPath(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return changes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+	scanner := bufio.NewScanner(handle)
+	for scanner.Scan() {
+		change := ProfileChange{}
+		err := json.Unmarshal(scanner.Bytes(), &change)
+		if err != nil {
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes, scanner.Err()
+}
+
+// Discards all but the most recent changes of the profile journal (see [profileJournalLimit]).
+// Returns an error if the journal cannot be read or rewritten.
+func trimProfileJournal(ctx context.Context) error {
+	changes, err := LoadProfileJournal(ctx)
+	if err != nil || len(changes) <= profileJournalLimit {
+		return err
+	}
+	builder := strings.Builder{}
+	for _, change := range changes[len(changes)-profileJournalLimit:] {
+		data, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+		builder.Write(data)
+		builder.WriteString("\n")
+	}
+	return fsutil.WriteFileAtomic(getProfileJournalPath(ctx), []byte(builder.String()))
+}
+
+// Appends a change to the profile journal.
+// Returns an error if the journal cannot be written.
+func appendProfileJournal(ctx context.Context, change ProfileChange) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	handle, err := os.OpenFile(getProfileJournalPath(ctx), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = handle.Write(append(data, '\n'))
+	return errors.Join(err, handle.Close())
+}
+
+// profileJournal records the changes made to the server's profiles as they're observed
+type profileJournal struct {
+	ctx   context.Context
+	sizes map[string]int64
+}
+
+// Records a change to a file within the profiles directory - files other than profiles are ignored.
+func (pj *profileJournal) handle(event fsutil.WatchEvent) {
+	profile, ok := strings.CutSuffix(event.Name, ".json")
+	if !ok {
+		return
+	}
+	path := filepath.Join(getProfilesDir(pj.ctx), event.Name)
+	change := ProfileChange{Event: "save", Profile: profile, Time: clock.Get(pj.ctx).Now()}
+	if event.Removed {
+		change.Event = "delete"
+	} else {
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		change.Size = info.Size()
+		change.Username = readProfileUsername(path)
+	}
+	change.Delta = change.Size - pj.sizes[event.Name]
+	pj.sizes[event.Name] = change.Size
+	helper.Logger(pj.ctx).Info(fmt.Sprintf("profile %s", change.Event), "profile", change.Profile, "username", change.Username, "size", change.Size, "delta", change.Delta)
+	err := appendProfileJournal(pj.ctx, change)
+	if err != nil {
+		helper.Logger(pj.ctx).Warn("write profile journal failed", "error", err.Error())
+	}
+}
+
+// Runs a function while recording every profile the server writes (or deletes) to the profile journal.
+// Runs the function alone if enabled is false.
+// Failures to watch the profiles directory are logged rather than stopping the server.
+// Returns an error if the function fails.
+func WatchProfilesWhile(ctx context.Context, enabled bool, run func() error) error {
+	if !enabled {
+		return run()
+	}
+	dir := getProfilesDir(ctx)
+	journal := &profileJournal{ctx: ctx, sizes: map[string]int64{}}
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = trimProfileJournal(ctx)
+	}
+	if err != nil {
+		helper.Logger(ctx).Warn("profile journal unavailable", "error", err.Error())
+		return run()
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err == nil {
+			journal.sizes[entry.Name()] = info.Size()
+		}
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	watched := make(chan error, 1)
+	go func() {
+		watched <- fsutil.WatchDir(watchCtx, dir, journal.handle)
+	}()
+	runErr := run()
+	cancel()
+	watchErr := <-watched
+	if watchErr != nil {
+		helper.Logger(ctx).Warn("watch profiles failed", "error", watchErr.Error())
+	}
+	return runErr
+}
+
+// Prints when each profile was last saved (see [WatchProfilesWhile]), alongside its size and number of saves.
+// Returns an error if the profile journal cannot be read.
+func Profiles(ctx context.Context, args ...string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: profiles")
+	}
+	changes, err := LoadProfileJournal(ctx)
+	if err != nil {
+		return err
+	}
+	last := map[string]ProfileChange{}
+	saves := map[string]int{}
+	for _, change := range changes {
+		last[change.Profile] = change
+		if change.Event == "save" {
+			saves[change.Profile] += 1
+		}
+	}
+	profiles := helper.Map[string, ProfileChange](last).Keys()
+	entries, _ := os.ReadDir(getProfilesDir(ctx))
+	for _, entry := range entries {
+		profile, ok := strings.CutSuffix(entry.Name(), ".json")
+		if ok && !slices.Contains(profiles, profile) {
+			profiles = append(profiles, profile)
+		}
+	}
+	slices.Sort(profiles)
+
+	now := clock.Get(ctx).Now()
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "PROFILE\tUSERNAME\tLAST CHANGE\tSIZE\tDELTA\tSAVES")
+	for _, profile := range profiles {
+		change, ok := last[profile]
+		if !ok {
+			fmt.Fprintf(writer, "%s\t-\tnever (since journal started)\t-\t-\t0\n", profile)
+			continue
+		}
+		username := change.Username
+		if username == "" {
+			username = "-"
+		}
+		when := fmt.Sprintf("%s %s (%s ago)", change.Event, change.Time.Format(time.RFC3339), now.Sub(change.Time).Round(time.Second))
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%+d\t%d\n", profile, username, when, change.Size, change.Delta, saves[profile])
+	}
+	return writer.Flush()
+}
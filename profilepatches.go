@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/patch"
+)
+
+// ProfilePatchesConfig is loaded from the environment and configures the patches applied to profiles (see [ApplyProfilePatches])
+type ProfilePatchesConfig struct {
+	ProfilePatches patch.ConfigPatches `env:"PROFILE_PATCHES"`
+}
+
+// profileBackupLimit is the number of profile backups kept in the data directory (see [ApplyProfilePatches])
+const profileBackupLimit = 10
+
+// Returns the path recording the profile patches applied to each profile (see [ApplyProfilePatches])
+func getProfilePatchesStatePath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "profile-patches.json")
+}
+
+// Returns the directory holding the backups of profiles taken before they're patched (see [ApplyProfilePatches])
+func getProfileBackupsDir(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "profile-backups")
+}
+
+// Loads the profile patches applied to each profile - a map of profile file -> checksums of the applied patches.
+// Returns an empty map if no profile patches have been applied.
+// Returns an error if the file cannot be read or parsed.
+func loadAppliedProfilePatches(ctx context.Context) (map[string][]string, error) {
+	applied := map[string][]string{}
+	data, err := os.ReadFile(getProfilePatchesStatePath(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return applied, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return applied, json.Unmarshal(data, &applied)
+}
+
+// Removes all but the most recent profile backups (see [profileBackupLimit]).
+// Returns an error if the backups cannot be listed or removed.
+func pruneProfileBackups(ctx context.Context) error {
+	dir := getProfileBackupsDir(ctx)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	backups := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			backups = append(backups, entry.Name())
+		}
+	}
+	slices.Sort(backups)
+	for len(backups) > profileBackupLimit {
+		err := os.RemoveAll(filepath.Join(dir, backups[0]))
+		if err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Patches a profile (relative to the profiles directory) - backing it up into the backup directory first.
+// Returns an error if the profile cannot be read, backed up, patched or written.
+func patchProfile(ctx context.Context, relPath string, backupDir string, patches []patch.Patch) error {
+	path := filepath.Join(getProfilesDir(ctx), relPath)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	err = fsutil.WriteFileAtomic(filepath.Join(backupDir, relPath), raw)
+	if err != nil {
+		return err
+	}
+	data := map[string]any{}
+	err = json.Unmarshal(raw, &data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", relPath, err)
+	}
+	err = patch.ApplyDocument(ctx, relPath, data, patches)
+	if err != nil {
+		return err
+	}
+	patched, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(path, patched)
+}
+
+// Applies profile patches to the profiles in the profiles directory (see [getProfilesDir]).
+// Profiles are targeted by their file name (e.g., '<id>.json') or a glob (e.g., '*.json').
+// Unlike config patches, each patch is applied to each profile once - changed patches are applied anew.
+// Patches whose conditions don't hold are reconsidered on the next boot.
+// Each patched profile is backed up first (see [getProfileBackupsDir]) - backups beyond the most recent are removed (see [profileBackupLimit]).
+// Profiles are patched one at a time - failures are handled by the 'patch' step policy (see [runStep]).
+// Returns an error if the patches cannot be resolved.
+// Returns an error if a profile fails to be patched.
+// Returns an error if the applied patches cannot be recorded.
+func ApplyProfilePatches(ctx context.Context, sptVersion string, profilePatches patch.ConfigPatches) error {
+	if len(profilePatches) == 0 {
+		return nil
+	}
+	target, err := getPatchTarget(ctx, sptVersion)
+	if err != nil {
+		return err
+	}
+	profilePatches, err = patch.Filter(ctx, profilePatches, target)
+	if err != nil {
+		return err
+	}
+	profilePatches, err = patch.Expand(ctx, getProfilesDir(ctx), profilePatches)
+	if err != nil {
+		return err
+	}
+	profilePatches = patch.Order(patch.SkipMissingFiles(ctx, getProfilesDir(ctx), profilePatches))
+	applied, err := loadAppliedProfilePatches(ctx)
+	if err != nil {
+		return err
+	}
+
+	backupDir := filepath.Join(getProfileBackupsDir(ctx), fmt.Sprintf("%s-%s", clock.Get(ctx).Now().Format("20060102-150405"), GetRunId()))
+	relPaths := helper.Map[string, []patch.Patch](profilePatches).Keys()
+	slices.Sort(relPaths)
+	for _, relPath := range relPaths {
+		pending := []patch.Patch{}
+		checksums := []string{}
+		for _, profilePatch := range profilePatches[relPath] {
+			checksum, err := profilePatch.Checksum()
+			if err != nil {
+				return fmt.Errorf("%s: %w", relPath, err)
+			}
+			if slices.Contains(applied[relPath], checksum) {
+				continue
+			}
+			pending = append(pending, profilePatch)
+			checksums = append(checksums, checksum)
+		}
+		if len(pending) == 0 {
+			helper.Logger(ctx).Info("profile patches already applied", "profile", relPath)
+			continue
+		}
+		helper.Logger(ctx).Info("apply profile patches", "count", len(pending), "profile", relPath)
+		err := runStep(ctx, "patch", func() error {
+			return patchProfile(ctx, relPath, backupDir, pending)
+		})
+		if err != nil && !ignoreStepError(ctx, err, "profile", relPath) {
+			return err
+		}
+		if err != nil {
+			continue
+		}
+		applied[relPath] = append(applied[relPath], checksums...)
+		data, err := json.MarshalIndent(applied, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = fsutil.WriteFileAtomic(getProfilePatchesStatePath(ctx), data)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = pruneProfileBackups(ctx)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
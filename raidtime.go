@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"path"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/patch"
+)
+
+// RaidTimeConfig is loaded from the environment and configures the in-game (raid) time
+type RaidTimeConfig struct {
+	Align bool `env:"RAID_TIME_ALIGN"`
+}
+
+// raidTimeOffset is added by spt to the accelerated real time when computing the in-game time (i.e., in-game time is moscow time)
+const raidTimeOffset = 3 * time.Hour
+
+// raidTimeDefaultAcceleration is spt's default acceleration - in-game time passes 7 times faster than real time
+const raidTimeDefaultAcceleration = 7
+
+// raidTimeMaxAcceleration is the largest acceleration considered when aligning the raid time (an in-game day every real hour)
+const raidTimeMaxAcceleration = 24
+
+// Returns the in-game time of day (since in-game midnight) at a real time, computed like spt.
+func getRaidTimeOfDay(t time.Time, acceleration int) time.Duration {
+	day := 24 * time.Hour
+	// whole real days are whole in-game days (the acceleration is a whole number) - only the real time of day matters
+	realTimeOfDay := time.Duration(t.UnixMilli()%day.Milliseconds()) * time.Millisecond
+	return (raidTimeOffset + realTimeOfDay*time.Duration(acceleration)) % day
+}
+
+// Returns the acceleration (up to [raidTimeMaxAcceleration]) that brings in-game midnight closest to a real time.
+// Also returns how far the in-game time at the real time is from in-game midnight - zero if the acceleration aligns them exactly.
+// As the acceleration is a whole number, in-game midnight then recurs at the real time every day.
+func getAlignedRaidAcceleration(t time.Time) (int, time.Duration) {
+	day := 24 * time.Hour
+	distance := func(acceleration int) time.Duration {
+		timeOfDay := getRaidTimeOfDay(t, acceleration)
+		return min(timeOfDay, day-timeOfDay)
+	}
+	preference := func(acceleration int) int {
+		return max(acceleration-raidTimeDefaultAcceleration, raidTimeDefaultAcceleration-acceleration)
+	}
+	best := raidTimeDefaultAcceleration
+	for acceleration := 1; acceleration <= raidTimeMaxAcceleration; acceleration++ {
+		switch {
+		case distance(acceleration) < distance(best):
+			best = acceleration
+		case distance(acceleration) == distance(best) && preference(acceleration) < preference(best):
+			best = acceleration
+		}
+	}
+	return best, distance(best)
+}
+
+// Returns the config patches aligning in-game midnight with the next local midnight (see [getAlignedRaidAcceleration]).
+// Timezones whose offset cannot be aligned exactly are aligned as closely as possible - and logged as a warning.
+// Returns an error if the spt version is not covered by a data directory.
+func getRaidTimePatches(ctx context.Context, sptVersion string, config RaidTimeConfig) (patch.ConfigPatches, error) {
+	if !config.Align {
+		return patch.ConfigPatches{}, nil
+	}
+	dataDir, err := getSptDataDir(sptVersion)
+	if err != nil {
+		return nil, err
+	}
+	now := clock.Get(ctx).Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	acceleration, drift := getAlignedRaidAcceleration(midnight)
+	dayLength := (24 * time.Hour / time.Duration(acceleration)).Round(time.Second)
+	raidTime := time.Time{}.Add(getRaidTimeOfDay(midnight, acceleration)).Format("15:04")
+	if drift == 0 {
+		helper.Logger(ctx).Info("align raid time with local midnight", "acceleration", acceleration, "day", dayLength, "timezone", now.Location().String())
+	} else {
+		helper.Logger(ctx).Warn("raid time cannot be aligned exactly with local midnight in this timezone - using the closest alignment", "acceleration", acceleration, "day", dayLength, "raid-time-at-midnight", raidTime, "timezone", now.Location().String())
+	}
+	return patch.ConfigPatches{
+		path.Join(dataDir, "Server/configs/weather.json"): []patch.Patch{{Op: "replace", Path: "/acceleration", Value: acceleration}},
+	}, nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+
+	"github.com/google/uuid"
+)
+
+// Ensures the run id (the RUN_ID environment variable) is set - generating one if it wasn't provided.
+// The run id is passed through the environment so that it survives the entrypoint re-launching itself.
+func initRunId() {
+	if os.Getenv("RUN_ID") != "" {
+		return
+	}
+	os.Setenv("RUN_ID", uuid.NewString())
+}
+
+// Returns the run id - identifying a single start of the container.
+// Used to correlate logs, journal entries and support bundles across restarts.
+func GetRunId() string {
+	return os.Getenv("RUN_ID")
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/download"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+)
+
+// S3Config is loaded from the environment and configures access to S3 (or an S3-compatible object store)
+type S3Config struct {
+	AccessKeyId     string `env:"AWS_ACCESS_KEY_ID"`
+	EndpointUrl     string `env:"AWS_ENDPOINT_URL"`
+	Region          string `env:"AWS_REGION" envDefault:"us-east-1"`
+	SecretAccessKey string `env:"AWS_SECRET_ACCESS_KEY"`
+	SessionToken    string `env:"AWS_SESSION_TOKEN"`
+}
+
+// s3ListResult is the response of the S3 ListObjectsV2 API
+type s3ListResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// S3Client is a minimal client for the S3 API signing requests with AWS Signature Version 4
+type S3Client struct {
+	ctx    context.Context
+	config S3Config
+}
+
+// Creates an [S3Client] configured from the environment.
+// Returns an error if the environment cannot be parsed.
+// Returns an error if credentials are missing.
+func NewS3Client(ctx context.Context) (*S3Client, error) {
+	config := S3Config{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return nil, err
+	}
+	if config.AccessKeyId == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("s3 requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return &S3Client{ctx: ctx, config: config}, nil
+}
+
+// Encodes a string as required by AWS Signature Version 4 - escaping everything except unreserved characters (and optionally '/').
+func awsUriEncode(value string, encodeSlash bool) string {
+	builder := strings.Builder{}
+	for _, char := range []byte(value) {
+		switch {
+		case 'A' <= char && char <= 'Z', 'a' <= char && char <= 'z', '0' <= char && char <= '9', char == '-', char == '_', char == '.', char == '~':
+			builder.WriteByte(char)
+		case char == '/' && !encodeSlash:
+			builder.WriteByte(char)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", char)
+		}
+	}
+	return builder.String()
+}
+
+// Computes an HMAC-SHA256 digest
+func hmacSha256(key []byte, data string) []byte {
+	hash := hmac.New(sha256.New, key)
+	hash.Write([]byte(data))
+	return hash.Sum(nil)
+}
+
+// Returns the url of an object (or of the bucket, if key is empty).
+// Custom endpoints (e.g., MinIO) are addressed path-style - AWS is addressed virtual-hosted-style.
+func (sc *S3Client) getUrl(bucket string, key string) (*url.URL, error) {
+	path := fmt.Sprintf("/%s", key)
+	endpoint := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, sc.config.Region)
+	if sc.config.EndpointUrl != "" {
+		endpoint = strings.TrimSuffix(sc.config.EndpointUrl, "/")
+		path = fmt.Sprintf("/%s%s", bucket, path)
+		if key == "" {
+			path = fmt.Sprintf("/%s", bucket)
+		}
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	parsed.Path = path
+	parsed.RawPath = awsUriEncode(path, false)
+	return parsed, nil
+}
+
+// Signs a request with AWS Signature Version 4 using the given payload hash.
+func (sc *S3Client) sign(request *http.Request, now time.Time, payloadHash string) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	request.Header.Set("X-Amz-Date", amzDate)
+	if sc.config.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", sc.config.SessionToken)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for key := range request.Header {
+		lower := strings.ToLower(key)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(request.Header.Get(key))
+		}
+	}
+	headerNames := helper.Map[string, string](headers).Keys()
+	slices.Sort(headerNames)
+	canonicalHeaders := strings.Builder{}
+	for _, name := range headerNames {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	query := request.URL.Query()
+	queryKeys := helper.Map[string, []string](query).Keys()
+	slices.Sort(queryKeys)
+	queryParts := []string{}
+	for _, key := range queryKeys {
+		for _, value := range query[key] {
+			queryParts = append(queryParts, fmt.Sprintf("%s=%s", awsUriEncode(key, true), awsUriEncode(value, true)))
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		strings.Join(queryParts, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, sc.config.Region)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(canonicalRequestHash[:])}, "\n")
+
+	key := hmacSha256([]byte(fmt.Sprintf("AWS4%s", sc.config.SecretAccessKey)), date)
+	key = hmacSha256(key, sc.config.Region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", sc.config.AccessKeyId, scope, signedHeaders, signature))
+}
+
+// Performs a signed request against the S3 API.
+// Returns an error if the request fails.
+// Returns an error if the response status code is not expected.
+func (sc *S3Client) do(method string, bucket string, key string, query url.Values, body io.Reader, size int64, expected ...int) (*http.Response, error) {
+	requestUrl, err := sc.getUrl(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	requestUrl.RawQuery = query.Encode()
+	request, err := http.NewRequestWithContext(sc.ctx, method, requestUrl.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.ContentLength = size
+	}
+	// the payload is left unsigned so that request bodies can be streamed
+	sc.sign(request, clock.Get(sc.ctx).Now(), "UNSIGNED-PAYLOAD")
+	response, err := outbound.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(expected, response.StatusCode) {
+		response.Body.Close()
+		return nil, &download.StatusError{Method: method, StatusCode: response.StatusCode, Url: fmt.Sprintf("s3://%s/%s", bucket, key)}
+	}
+	return response, nil
+}
+
+// Lists the keys of all objects in a bucket beneath a prefix.
+// Returns an error if the request fails.
+func (sc *S3Client) ListObjects(bucket string, prefix string) ([]string, error) {
+	keys := []string{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		response, err := sc.do(http.MethodGet, bucket, "", query, nil, 0, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		result := s3ListResult{}
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, content := range result.Contents {
+			keys = append(keys, content.Key)
+		}
+		if !result.IsTruncated {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Downloads an object to the given writer.
+// Returns an error if the request fails.
+func (sc *S3Client) GetObject(bucket string, key string, writer io.Writer) error {
+	response, err := sc.do(http.MethodGet, bucket, key, nil, nil, 0, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, err = io.Copy(writer, response.Body)
+	return err
+}
+
+// Uploads an object of the given size from the given reader.
+// Returns an error if the request fails.
+func (sc *S3Client) PutObject(bucket string, key string, reader io.Reader, size int64) error {
+	response, err := sc.do(http.MethodPut, bucket, key, nil, reader, size, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// Deletes an object.
+// Returns an error if the request fails.
+func (sc *S3Client) DeleteObject(bucket string, key string) error {
+	response, err := sc.do(http.MethodDelete, bucket, key, nil, nil, 0, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// Downloads an object referenced by an 's3://bucket/key' url.
+// Credentials are read from the standard AWS environment variables (see [S3Config]).
+// Returns an error if the download fails.
+func downloadS3Object(ctx context.Context, downloadUrl *url.URL, writer io.Writer) error {
+	client, err := NewS3Client(ctx)
+	if err != nil {
+		return err
+	}
+	return client.GetObject(downloadUrl.Host, strings.TrimPrefix(downloadUrl.Path, "/"), writer)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/patch"
+)
+
+// SettingsConfig is loaded from the environment and configures common server settings (see [getSettingsPatches])
+type SettingsConfig struct {
+	AiDifficulty       string  `env:"AI_DIFFICULTY"`
+	LootMultiplier     float64 `env:"MAX_LOOT_MULTIPLIER" envDefault:"1"`
+	RaidTimeMultiplier float64 `env:"RAID_TIME_MULTIPLIER" envDefault:"1"`
+}
+
+// aiDifficulties are the difficulties spt can assign pmc bots - 'asonline' uses the difficulty selected in the client's raid settings
+var aiDifficulties = []string{"asonline", "easy", "normal", "hard", "impossible", "random"}
+
+// Returns the patches multiplying the stock loose and static loot multipliers of every map by a multiplier.
+// Returns an error if the location config cannot be read.
+func getLootMultiplierPatches(ctx context.Context, dataDir string, multiplier float64) (patch.ConfigPatches, error) {
+	relPath := path.Join(dataDir, "Server/configs/location.json")
+	data := struct {
+		LooseLootMultiplier  map[string]float64 `json:"looseLootMultiplier"`
+		StaticLootMultiplier map[string]float64 `json:"staticLootMultiplier"`
+	}{}
+	err := patch.ReadPristine(ctx, helper.Dirs(ctx)["spt"], getStockConfigPath(ctx, ""), relPath, &data)
+	if err != nil {
+		return nil, err
+	}
+	multipliers := map[string]map[string]float64{"looseLootMultiplier": data.LooseLootMultiplier, "staticLootMultiplier": data.StaticLootMultiplier}
+	patches := []patch.Patch{}
+	for _, key := range []string{"looseLootMultiplier", "staticLootMultiplier"} {
+		locations := helper.Map[string, float64](multipliers[key]).Keys()
+		slices.Sort(locations)
+		for _, location := range locations {
+			patches = append(patches, patch.Patch{Op: "replace", Path: fmt.Sprintf("/%s/%s", key, location), Value: multipliers[key][location] * multiplier})
+		}
+	}
+	return patch.ConfigPatches{relPath: patches}, nil
+}
+
+// Returns the patches multiplying the stock raid time (in minutes - rounded, and at least a minute) of every map by a multiplier.
+// Returns an error if a map's base config cannot be read.
+func getRaidTimeMultiplierPatches(ctx context.Context, dataDir string, multiplier float64) (patch.ConfigPatches, error) {
+	root := helper.Dirs(ctx)["spt"]
+	paths, err := filepath.Glob(filepath.Join(root, dataDir, "Server", "database", "locations", "*", "base.json"))
+	if err != nil {
+		return nil, err
+	}
+	configPatches := patch.ConfigPatches{}
+	for _, basePath := range paths {
+		relPath, err := filepath.Rel(root, basePath)
+		if err != nil {
+			return nil, err
+		}
+		data := struct {
+			EscapeTimeLimit *float64 `json:"EscapeTimeLimit"`
+		}{}
+		err = patch.ReadPristine(ctx, root, getStockConfigPath(ctx, ""), relPath, &data)
+		if err != nil {
+			return nil, err
+		}
+		if data.EscapeTimeLimit == nil {
+			continue
+		}
+		minutes := max(math.Round(*data.EscapeTimeLimit*multiplier), 1)
+		configPatches[relPath] = []patch.Patch{{Op: "replace", Path: "/EscapeTimeLimit", Value: minutes}}
+	}
+	return configPatches, nil
+}
+
+// Returns the config patches applying common server settings to the data directory of the given spt version (see [getSptDataDir]).
+// Multipliers are applied to spt's stock values (see [patch.ReadPristine]).
+// Settings left unset (or at a multiplier of 1) produce no patches.
+// Returns an error if a setting is invalid.
+// Returns an error if the spt version is not covered by a data directory.
+// Returns an error if the stock values cannot be read.
+func getSettingsPatches(ctx context.Context, sptVersion string, config SettingsConfig) (patch.ConfigPatches, error) {
+	aiDifficulty := strings.ToLower(config.AiDifficulty)
+	if aiDifficulty != "" && !slices.Contains(aiDifficulties, aiDifficulty) {
+		return nil, &UserError{
+			Hint:    fmt.Sprintf("set AI_DIFFICULTY to one of %s", strings.Join(aiDifficulties, ", ")),
+			Message: fmt.Sprintf("unknown ai difficulty %s", config.AiDifficulty),
+		}
+	}
+	multipliers := map[string]float64{"MAX_LOOT_MULTIPLIER": config.LootMultiplier, "RAID_TIME_MULTIPLIER": config.RaidTimeMultiplier}
+	for _, name := range []string{"MAX_LOOT_MULTIPLIER", "RAID_TIME_MULTIPLIER"} {
+		multiplier := multipliers[name]
+		if multiplier <= 0 {
+			return nil, &UserError{
+				Hint:    fmt.Sprintf("set %s to a positive number (e.g., 1.5) - or 1 to keep spt's defaults", name),
+				Message: fmt.Sprintf("invalid %s %v", name, multiplier),
+			}
+		}
+	}
+	if aiDifficulty == "" && config.LootMultiplier == 1 && config.RaidTimeMultiplier == 1 {
+		return patch.ConfigPatches{}, nil
+	}
+	dataDir, err := getSptDataDir(sptVersion)
+	if err != nil {
+		return nil, err
+	}
+	merged := []patch.ConfigPatches{}
+	if aiDifficulty != "" {
+		merged = append(merged, patch.ConfigPatches{
+			path.Join(dataDir, "Server/configs/pmc.json"): []patch.Patch{{Op: "replace", Path: "/difficulty", Value: aiDifficulty}},
+		})
+	}
+	if config.LootMultiplier != 1 {
+		lootPatches, err := getLootMultiplierPatches(ctx, dataDir, config.LootMultiplier)
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, lootPatches)
+	}
+	if config.RaidTimeMultiplier != 1 {
+		raidTimePatches, err := getRaidTimeMultiplierPatches(ctx, dataDir, config.RaidTimeMultiplier)
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, raidTimePatches)
+	}
+	return patch.Merge(merged...), nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+	"golang.org/x/mod/semver"
+)
+
+// sptVersionSelectorRegexp matches spt version selectors - 'latest', or a version with a wildcard final component (e.g., '3.10.x', '3.x')
+var sptVersionSelectorRegexp = regexp.MustCompile(`^(latest|([0-9]+\.){1,2}x)$`)
+
+// SptVersionPin records the release version an spt version selector (see [isSptVersionSelector]) resolved to
+type SptVersionPin struct {
+	Pinned    time.Time `json:"pinned"`
+	Repo      string    `json:"repo"`
+	Requested string    `json:"requested"`
+	Resolved  string    `json:"resolved"`
+}
+
+// Returns the path to the spt version pin
+func getSptVersionPinPath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], "spt-version.json")
+}
+
+// Determines whether an spt version (SPT_VERSION) is a selector (e.g., 'latest' or '3.10.x')
+func isSptVersionSelector(version string) bool {
+	return sptVersionSelectorRegexp.MatchString(version)
+}
+
+// Determines whether a stable release version (e.g., '3.10.5' - but not '3.10.5-beta') matches an spt version selector (see [isSptVersionSelector])
+func matchesSptVersionSelector(selector string, version string) bool {
+	if !isSptReleaseVersion(version) || semver.Prerelease(fmt.Sprintf("v%s", version)) != "" {
+		return false
+	}
+	if selector == "latest" {
+		return true
+	}
+	return strings.HasPrefix(version, strings.TrimSuffix(selector, "x"))
+}
+
+// Resolves an spt version selector (see [isSptVersionSelector]) into the newest matching stable release version.
+// Returns an error if the repository's tags cannot be listed.
+// Returns an error if no tag matches the selector.
+func resolveSptVersionSelector(ctx context.Context, repo string, selector string) (string, error) {
+	helper.Logger(ctx).Info("list spt tags", "repo", repo, "selector", selector)
+	output, err := helper.Command(ctx, []string{"git", "ls-remote", "--tags", "--refs", repo}, helper.CmdOpts{Env: outbound.CommandEnv(ctx)}).Run()
+	if err != nil {
+		return "", err
+	}
+	resolved := ""
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		_, ref, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		tag := strings.TrimPrefix(ref, "refs/tags/")
+		if !matchesSptVersionSelector(selector, tag) {
+			continue
+		}
+		if resolved == "" || semver.Compare(fmt.Sprintf("v%s", tag), fmt.Sprintf("v%s", resolved)) == 1 {
+			resolved = tag
+		}
+	}
+	if resolved == "" {
+		return "", &UserError{
+			Hint:    "set SPT_VERSION to 'latest', a selector matching a released version (e.g., '3.10.x') or an explicit version",
+			Message: fmt.Sprintf("no spt release in %s matches %s", repo, selector),
+		}
+	}
+	return resolved, nil
+}
+
+// Loads the spt version pin (a json document - see [SptVersionPin]).
+// Returns nil if the pin does not exist.
+// Returns an error if the pin exists but cannot be parsed.
+func loadSptVersionPin(ctx context.Context) (*SptVersionPin, error) {
+	data, err := os.ReadFile(getSptVersionPinPath(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pin := &SptVersionPin{}
+	err = json.Unmarshal(data, pin)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", getSptVersionPinPath(ctx), err)
+	}
+	return pin, nil
+}
+
+// Pins an spt version selector (see [isSptVersionSelector]) to a release version.
+// The selector in the configuration is replaced with the version.
+// The version is resolved once (see [resolveSptVersionSelector]) and recorded in the data directory (see [SptVersionPin]).
+// The recorded version is used until SPT_VERSION_BUMP is set, or until SPT_VERSION or SPT_REPO_URL change.
+// Versions that aren't selectors are returned unchanged.
+// Returns an error if the selector cannot be resolved.
+// Returns an error if the pin cannot be read or written.
+func PinSptVersion(ctx context.Context, config EntrypointConfig) (EntrypointConfig, error) {
+	if !isSptVersionSelector(config.SptVersion) {
+		return config, nil
+	}
+	installConfig := SptInstallConfig{}
+	err := helper.ParseEnv(ctx, &installConfig)
+	if err != nil {
+		return config, err
+	}
+	pin, err := loadSptVersionPin(ctx)
+	if err != nil {
+		return config, err
+	}
+	if pin != nil && pin.Requested == config.SptVersion && pin.Repo == installConfig.RepoUrl && !config.SptVersionBump {
+		helper.Logger(ctx).Info("spt version pinned", "selector", config.SptVersion, "version", pin.Resolved, "pinned", pin.Pinned.Format(time.RFC3339))
+		config.SptVersion = pin.Resolved
+		return config, nil
+	}
+	version, err := resolveSptVersionSelector(ctx, installConfig.RepoUrl, config.SptVersion)
+	if err != nil {
+		return config, err
+	}
+	if pin != nil && pin.Requested == config.SptVersion && pin.Resolved != version {
+		helper.Logger(ctx).Info("bump spt version", "selector", config.SptVersion, "previous", pin.Resolved, "version", version)
+	} else {
+		helper.Logger(ctx).Info("resolved spt version selector", "selector", config.SptVersion, "version", version)
+	}
+	data, err := json.MarshalIndent(SptVersionPin{Pinned: clock.Get(ctx).Now().UTC(), Repo: installConfig.RepoUrl, Requested: config.SptVersion, Resolved: version}, "", "  ")
+	if err != nil {
+		return config, err
+	}
+	err = fsutil.WriteFileAtomic(getSptVersionPinPath(ctx), data)
+	if err != nil {
+		return config, err
+	}
+	config.SptVersion = version
+	return config, nil
+}
+
+// Returns the release version an spt version selector is pinned to (see [PinSptVersion]) without resolving it.
+// Returns an error if the selector has not been pinned (i.e., spt has not been set up with it).
+func getPinnedSptVersion(ctx context.Context, selector string) (string, error) {
+	pin, err := loadSptVersionPin(ctx)
+	if err != nil {
+		return "", err
+	}
+	if pin == nil || pin.Requested != selector {
+		return "", fmt.Errorf("spt version %s not pinned in %s (has 'init' been run?)", selector, getSptVersionPinPath(ctx))
+	}
+	return pin.Resolved, nil
+}
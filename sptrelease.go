@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/archive"
+	"github.com/benfiola/single-player-tarkov/pkg/download"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+)
+
+// SptInstallConfig is loaded from the environment and selects how spt is installed (see [InstallSpt])
+type SptInstallConfig struct {
+	Mode            string `env:"SPT_INSTALL_MODE"`
+	ReleaseChecksum string `env:"SPT_RELEASE_CHECKSUM"`
+	ReleaseUrl      string `env:"SPT_RELEASE_URL"`
+	RepoUrl         string `env:"SPT_REPO_URL" envDefault:"https://github.com/sp-tarkov/server"`
+}
+
+// sptInstallModes are the supported values of SPT_INSTALL_MODE
+var sptInstallModes = []string{"build", "release"}
+
+// Returns the install mode - SPT_INSTALL_MODE, defaulting to 'release' if SPT_RELEASE_URL is set (and 'build' otherwise).
+// Returns an error if the mode is unknown, or if the release mode is selected without a release url.
+func (sic SptInstallConfig) getMode() (string, error) {
+	mode := sic.Mode
+	if mode == "" {
+		mode = "build"
+		if sic.ReleaseUrl != "" {
+			mode = "release"
+		}
+	}
+	if !slices.Contains(sptInstallModes, mode) {
+		return "", &UserError{
+			Hint:    fmt.Sprintf("set SPT_INSTALL_MODE to one of %s", strings.Join(sptInstallModes, ", ")),
+			Message: fmt.Sprintf("unknown spt install mode %s", mode),
+		}
+	}
+	if mode == "release" && sic.ReleaseUrl == "" {
+		return "", &UserError{
+			Hint:    "set SPT_RELEASE_URL to the url of a prebuilt server archive (e.g., 'https://example.com/spt-{version}.tar.gz')",
+			Message: "spt install mode release requires a release url",
+		}
+	}
+	return mode, nil
+}
+
+// Returns the url of the prebuilt server archive of an spt version - SPT_RELEASE_URL, with '{version}' replaced by the version
+func (sic SptInstallConfig) getReleaseUrl(version string) string {
+	return strings.ReplaceAll(sic.ReleaseUrl, "{version}", version)
+}
+
+// Returns the file cache key of a prebuilt release - keyed by its version, url and checksum
+func (sic SptInstallConfig) getReleaseCacheKey(version string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s", sic.getReleaseUrl(version), sic.ReleaseChecksum)))
+	return fmt.Sprintf("spt-%s-release-%s", cacheKeyRegexp.ReplaceAllString(version, "-"), hex.EncodeToString(sum[:])[:12])
+}
+
+// Finds the directory holding the server binary within an extracted release.
+// Returns an error if the release contains no server binary.
+func findSptReleaseRoot(dir string) (string, error) {
+	candidates := []string{dir}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		candidates = append(candidates, filepath.Join(dir, entries[0].Name()))
+	}
+	for _, candidate := range candidates {
+		_, err := os.Stat(getServerBin(candidate))
+		if err == nil {
+			return candidate, nil
+		}
+	}
+	return "", &UserError{
+		Hint:    "ensure SPT_RELEASE_URL points to an archive of an spt server directory (containing SPT.Server.exe or SPT.Server at its root)",
+		Message: "spt release contains no server binary",
+	}
+}
+
+// Verifies that the server binary of a release is an ELF executable.
+// Returns an error if the binary cannot be read or isn't an ELF executable.
+func verifySptReleaseBinary(serverBin string) error {
+	handle, err := os.Open(serverBin)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	header := make([]byte, 4)
+	_, err = io.ReadFull(handle, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if bytes.Equal(header, []byte("\x7fELF")) {
+		return nil
+	}
+	message := "spt release server binary is not a linux executable"
+	if bytes.HasPrefix(header, []byte("MZ")) {
+		message = "spt release server binary is a windows executable"
+	}
+	return &UserError{
+		Hint:    "host an spt server built for linux (e.g., the spt directory of a server built by this image, without mods) - or unset SPT_RELEASE_URL to build spt from source",
+		Message: message,
+	}
+}
+
+// Downloads the prebuilt server archive of an spt version (see [SptInstallConfig.getReleaseUrl]) and extracts it to the destination.
+// Checks beforehand that there's enough disk space to download it (see [CheckDiskSpace]).
+// The server binary must run on linux (see [verifySptReleaseBinary]).
+// Download failures are handled by the 'download' step policy (see [runStep]).
+// Returns an error if the archive cannot be downloaded or extracted.
+// Returns an error if the archive does not match the checksum.
+// Returns an error if the archive contains no linux server binary.
+func installSptRelease(ctx context.Context, config SptInstallConfig, version string, dest string) error {
+	err := CheckDiskSpace(ctx, "download spt", map[string]string{os.TempDir(): "spt-install", dest: "spt-install"})
+	if err != nil {
+		return err
+	}
+	releaseUrl := config.getReleaseUrl(version)
+	return helper.CreateTempDir(ctx, func(tempDir string) error {
+		helper.Logger(ctx).Info("download spt release", "version", version, "url", redactEnv("SPT_RELEASE_URL", releaseUrl))
+		releaseArchive := filepath.Join(tempDir, "spt-release")
+		err := runStep(ctx, "download", func() error {
+			return download.DownloadCached(outbound.Declare(ctx, "download spt release"), releaseUrl, releaseArchive)
+		})
+		if err != nil {
+			return err
+		}
+		err = fsutil.VerifyChecksum(ctx, releaseArchive, config.ReleaseChecksum)
+		if err != nil {
+			return err
+		}
+		releasePath := filepath.Join(tempDir, "release")
+		err = archive.Extract(ctx, releaseArchive, releasePath)
+		if err != nil {
+			return err
+		}
+		releaseRoot, err := findSptReleaseRoot(releasePath)
+		if err != nil {
+			return err
+		}
+		err = verifySptReleaseBinary(getServerBin(releaseRoot))
+		if err != nil {
+			return err
+		}
+		// the release is copied (rather than moved) as the destination is the (existing) spt directory when the file cache is bypassed
+		_, err = fsutil.CopyTree(ctx, releaseRoot, dest)
+		if err != nil {
+			return err
+		}
+		return writeCoreManifest(ctx, releaseRoot, dest)
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+)
+
+// sptServerBins are the names of the server binary within an spt installation
+var sptServerBins = []string{"SPT.Server.exe", "SPT.Server"}
+
+// sptDotnetProject is the project (relative to the checkout) published to build a .NET server
+const sptDotnetProject = "SPTarkov.Server/SPTarkov.Server.csproj"
+
+// Returns the path of the server binary within an spt installation (see [sptServerBins]).
+func getServerBin(dir string) string {
+	for _, name := range sptServerBins {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if err == nil {
+			return filepath.Join(dir, name)
+		}
+	}
+	return filepath.Join(dir, sptServerBins[0])
+}
+
+// sptDataDir is where an spt version range keeps the server's configs and database
+type sptDataDir struct {
+	// Constraint is the (npm-style) spt version range using the directory
+	Constraint string
+	// Dir is the path (relative to the spt path) of the directory
+	Dir string
+}
+
+// sptDataDirs are the data directories of spt versions - the first directory whose constraint matches is used.
+// Releases prior to 3.9.0 kept their data beneath 'Aki_Data'.
+var sptDataDirs = []sptDataDir{
+	{Constraint: ">=3.9.0-0", Dir: "SPT_Data"},
+	{Constraint: "<3.9.0-0", Dir: "Aki_Data"},
+}
+
+// Returns the path (relative to the spt path) of the data directory of the given spt version (see [sptDataDirs]).
+// Returns an error if the spt version is not covered by a data directory.
+func getSptDataDir(sptVersion string) (string, error) {
+	for _, dataDir := range sptDataDirs {
+		ok, err := satisfiesConstraint(sptVersion, dataDir.Constraint)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return dataDir.Dir, nil
+		}
+	}
+	return "", fmt.Errorf("no data directory known for spt %s", sptVersion)
+}
+
+// Detects the server type of an spt checkout.
+// Returns 'node' if the checkout holds an npm project and 'dotnet' if it holds the .NET server project (see [sptDotnetProject]).
+// Returns an error if the checkout holds neither.
+func detectSptServerType(checkout string) (string, error) {
+	_, err := os.Stat(filepath.Join(checkout, "project", "package.json"))
+	if err == nil {
+		return "node", nil
+	}
+	_, err = os.Stat(filepath.Join(checkout, filepath.FromSlash(sptDotnetProject)))
+	if err == nil {
+		return "dotnet", nil
+	}
+	return "", &UserError{
+		Hint:    "ensure SPT_VERSION (and SPT_REPO_URL) refer to an spt server checkout - node servers hold 'project/package.json', .NET servers hold 'SPTarkov.Server/SPTarkov.Server.csproj'",
+		Message: "spt checkout is neither a node nor a .NET server",
+	}
+}
+
+// Returns the name of the binary a .NET project publishes - its 'AssemblyName' property, defaulting to the project's file name.
+// Returns an error if the project cannot be read or parsed.
+func getDotnetAssemblyName(project string) (string, error) {
+	data, err := os.ReadFile(project)
+	if err != nil {
+		return "", err
+	}
+	parsed := struct {
+		PropertyGroups []struct {
+			AssemblyName string `xml:"AssemblyName"`
+		} `xml:"PropertyGroup"`
+	}{}
+	err = xml.Unmarshal(data, &parsed)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", project, err)
+	}
+	for _, group := range parsed.PropertyGroups {
+		if group.AssemblyName != "" {
+			return group.AssemblyName, nil
+		}
+	}
+	return strings.TrimSuffix(filepath.Base(project), filepath.Ext(project)), nil
+}
+
+// Returns the commands building an spt checkout of a server type (see [detectSptServerType]) and the path they build to.
+// Node servers are built with npm ('build:release'), .NET servers are published (self-contained, for linux) with the .NET sdk.
+func getSptBuildCommands(serverType string, checkout string) ([]Command, string) {
+	if serverType == "dotnet" {
+		buildPath := filepath.Join(checkout, "build")
+		return []Command{
+			{Args: []string{"git", "lfs", "pull"}, Opts: helper.CmdOpts{Cwd: checkout}},
+			{Args: []string{"dotnet", "publish", filepath.FromSlash(sptDotnetProject), "--configuration", "Release", "--runtime", "linux-x64", "--self-contained", "--output", buildPath}, Opts: helper.CmdOpts{Cwd: checkout}},
+		}, buildPath
+	}
+	projectPath := filepath.Join(checkout, "project")
+	return []Command{
+		{Args: []string{"git", "lfs", "pull"}, Opts: helper.CmdOpts{Cwd: checkout}},
+		{Args: []string{"npm", "install"}, Opts: helper.CmdOpts{Cwd: projectPath}},
+		{Args: []string{"npm", "run", "build:release"}, Opts: helper.CmdOpts{Cwd: projectPath}},
+	}, filepath.Join(projectPath, "build")
+}
+
+// Ensures a published .NET server is run as 'SPT.Server' (see [getServerBin]).
+// Returns an error if the published server contains no binary.
+func normalizeDotnetServerBin(ctx context.Context, checkout string, buildPath string) error {
+	name, err := getDotnetAssemblyName(filepath.Join(checkout, filepath.FromSlash(sptDotnetProject)))
+	if err != nil {
+		return err
+	}
+	published := filepath.Join(buildPath, name)
+	_, err = os.Stat(published)
+	if err != nil {
+		return fmt.Errorf("published .NET server binary %s not found: %w", published, err)
+	}
+	serverBin := filepath.Join(buildPath, sptServerBins[1])
+	if published == serverBin {
+		return nil
+	}
+	helper.Logger(ctx).Info("rename .NET server binary", "from", name, "to", sptServerBins[1])
+	return os.Rename(published, serverBin)
+}
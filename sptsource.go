@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+	"golang.org/x/mod/semver"
+)
+
+// defaultSptRepoUrl is the repository spt is built from unless SPT_REPO_URL points to a fork
+const defaultSptRepoUrl = "https://github.com/sp-tarkov/server"
+
+// gitAbbreviatedCommitRegexp matches an (optionally abbreviated) git commit hash
+var gitAbbreviatedCommitRegexp = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// cacheKeyRegexp matches the characters of a ref that are replaced within file cache keys (e.g., the '/' of 'feature/x')
+var cacheKeyRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Determines whether an spt version (SPT_VERSION) is a release version (e.g., '3.10.5') rather than a git ref
+func isSptReleaseVersion(version string) bool {
+	return semver.IsValid(fmt.Sprintf("v%s", version))
+}
+
+// Resolves a git ref (a branch, tag or commit) of the spt repository into a commit.
+// Refs that aren't found but look like (abbreviated) commits are returned as-is.
+// Returns an error if the ref cannot be found.
+func resolveSptRef(ctx context.Context, repo string, ref string) (string, error) {
+	if gitCommitRegexp.MatchString(ref) {
+		return ref, nil
+	}
+	helper.Logger(ctx).Info("resolve spt ref", "repo", repo, "ref", ref)
+	output, err := helper.Command(ctx, []string{"git", "ls-remote", repo, ref, fmt.Sprintf("%s^{}", ref)}, helper.CmdOpts{Env: outbound.CommandEnv(ctx)}).Run()
+	if err != nil {
+		return "", err
+	}
+	commit := ""
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		hash, name, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		// annotated tags are listed twice - the peeled ('^{}') entry references the tagged commit rather than the tag object
+		if commit == "" || strings.HasSuffix(name, "^{}") {
+			commit = hash
+		}
+	}
+	if commit != "" {
+		return commit, nil
+	}
+	if gitAbbreviatedCommitRegexp.MatchString(ref) {
+		return ref, nil
+	}
+	return "", &UserError{
+		Hint:    "set SPT_VERSION to a release version (e.g., 3.10.5) - or a tag, branch or commit of SPT_REPO_URL",
+		Message: fmt.Sprintf("spt ref %s not found in %s", ref, repo),
+	}
+}
+
+// Returns the file cache key of an spt build - and the ref checked out to build it.
+// Builds of forks are additionally keyed by repository, and builds of other refs by the commit they resolve to.
+// Returns an error if the ref cannot be resolved.
+func (sic SptInstallConfig) getBuildCacheKey(ctx context.Context, version string) (string, string, error) {
+	key := fmt.Sprintf("spt-%s", cacheKeyRegexp.ReplaceAllString(version, "-"))
+	if sic.RepoUrl != defaultSptRepoUrl {
+		sum := sha256.Sum256([]byte(sic.RepoUrl))
+		key = fmt.Sprintf("%s-repo-%s", key, hex.EncodeToString(sum[:])[:12])
+	}
+	if isSptReleaseVersion(version) {
+		return key, version, nil
+	}
+	commit, err := resolveSptRef(ctx, sic.RepoUrl, version)
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("%s-%s", key, commit[:min(12, len(commit))]), commit, nil
+}
+
+// Detects the version of a checkout of the spt repository from its project's package.json.
+// Returns an empty string if the version cannot be detected.
+func detectSptCheckoutVersion(ctx context.Context, checkout string) string {
+	project := struct {
+		Version string `json:"version"`
+	}{}
+	err := helper.UnmarshalFile(ctx, filepath.Join(checkout, "project", "package.json"), &project)
+	if err != nil || !isSptReleaseVersion(project.Version) {
+		return ""
+	}
+	return project.Version
+}
+
+// Resolves the spt version of the configuration into a release version.
+// Selectors (e.g., 'latest') resolve to their pinned version, and git refs to the version of the installed server.
+// Returns an error if SPT_VERSION is a selector that has not been pinned.
+// Returns an error if SPT_VERSION is a git ref and the installed server's version cannot be detected.
+func ResolveSptVersion(ctx context.Context, config EntrypointConfig) (EntrypointConfig, error) {
+	if isSptVersionSelector(config.SptVersion) {
+		version, err := getPinnedSptVersion(ctx, config.SptVersion)
+		if err != nil {
+			return config, err
+		}
+		config.SptVersion = version
+	}
+	if config.SptVersion == "" || isSptReleaseVersion(config.SptVersion) {
+		return config, nil
+	}
+	version, err := detectSptVersion(ctx, helper.Dirs(ctx)["spt"])
+	if err != nil {
+		return config, fmt.Errorf("detect version of spt ref %s: %w", config.SptVersion, err)
+	}
+	helper.Logger(ctx).Info("resolved spt version", "ref", config.SptVersion, "version", version)
+	config.SptVersion = version
+	return config, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/limits"
+)
+
+// stepLimitPhases are the setup phases that can be limited
+var stepLimitPhases = []string{"mod-build", "mod-extract", "spt-build"}
+
+// StepLimit configures the resource limits of a setup phase (see [limits.Limits])
+type StepLimit struct {
+	Cpu     string `json:"cpu,omitempty"`
+	Memory  string `json:"memory,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Converts the step limit into [limits.Limits].
+// Returns an error if a limit is malformed.
+func (sl StepLimit) parse() (limits.Limits, error) {
+	parsed := limits.Limits{}
+	var err error
+	if sl.Cpu != "" {
+		parsed.Cpu, err = time.ParseDuration(sl.Cpu)
+		if err != nil {
+			return parsed, fmt.Errorf("invalid cpu limit %s", sl.Cpu)
+		}
+	}
+	if sl.Memory != "" {
+		parsed.Memory, err = limits.ParseMemory(sl.Memory)
+		if err != nil {
+			return parsed, err
+		}
+	}
+	if sl.Timeout != "" {
+		parsed.Timeout, err = time.ParseDuration(sl.Timeout)
+		if err != nil {
+			return parsed, fmt.Errorf("invalid timeout %s", sl.Timeout)
+		}
+	}
+	return parsed, nil
+}
+
+// StepLimits is a map of setup phase (see [stepLimitPhases]) -> [StepLimit]
+type StepLimits map[string]StepLimit
+
+// Parses a string into a [StepLimits] object - validating phases and limits.
+// Used to parse settings from the environment.
+func (sl *StepLimits) UnmarshalText(data []byte) error {
+	parsed := map[string]StepLimit{}
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return err
+	}
+	for name, stepLimit := range parsed {
+		if !slices.Contains(stepLimitPhases, name) {
+			return fmt.Errorf("unknown setup phase %s (expected one of %v)", name, stepLimitPhases)
+		}
+		_, err := stepLimit.parse()
+		if err != nil {
+			return fmt.Errorf("setup phase %s: %w", name, err)
+		}
+	}
+	*sl = StepLimits(parsed)
+	return nil
+}
+
+// StepLimitsConfig is loaded from the environment and configures the resource limits of setup phases
+type StepLimitsConfig struct {
+	Limits StepLimits `env:"STEP_LIMITS"`
+}
+
+// Returns a context (and its cancel function) running the commands of a setup phase under its configured limits (see [limits.WithPhase]).
+// Returns an error if STEP_LIMITS is malformed.
+func withStepLimits(ctx context.Context, phase string) (context.Context, context.CancelFunc, error) {
+	config := StepLimitsConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return nil, nil, err
+	}
+	phaseLimits, err := config.Limits[phase].parse()
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := limits.WithPhase(ctx, phase, phaseLimits)
+	return ctx, cancel, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+)
+
+// stepPolicySteps are the pipeline steps whose failures are handled by a [StepPolicy]
+var stepPolicySteps = []string{"chown", "download", "extract", "patch"}
+
+// stepPolicyActions are the ways a [StepPolicy] handles a failed step
+var stepPolicyActions = []string{"abort", "retry", "warn"}
+
+// StepPolicy determines how failures of a pipeline step are handled - aborting (the default), retrying or logging a warning and continuing
+type StepPolicy struct {
+	Action  string `json:"action"`
+	Delay   string `json:"delay,omitempty"`
+	Retries int    `json:"retries,omitempty"`
+}
+
+// Returns the number of attempts made at a step (and the delay between them) under the policy.
+// Returns an error if the policy is malformed.
+func (sp StepPolicy) attempts() (int, time.Duration, error) {
+	if sp.Action != "" && !slices.Contains(stepPolicyActions, sp.Action) {
+		return 0, 0, fmt.Errorf("unknown action %s (expected one of %v)", sp.Action, stepPolicyActions)
+	}
+	if sp.Retries < 0 {
+		return 0, 0, fmt.Errorf("retries must not be negative (got %d)", sp.Retries)
+	}
+	delay := 5 * time.Second
+	if sp.Delay != "" {
+		parsed, err := time.ParseDuration(sp.Delay)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("invalid delay %s", sp.Delay)
+		}
+		delay = parsed
+	}
+	if sp.Action != "retry" {
+		return 1, delay, nil
+	}
+	if sp.Retries == 0 {
+		return 4, delay, nil
+	}
+	return sp.Retries + 1, delay, nil
+}
+
+// StepPolicies is a map of pipeline step (see [stepPolicySteps]) -> [StepPolicy]
+type StepPolicies map[string]StepPolicy
+
+// Parses a string into a [StepPolicies] object - validating steps and policies.
+// Used to parse settings from the environment.
+func (sp *StepPolicies) UnmarshalText(data []byte) error {
+	parsed := map[string]StepPolicy{}
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return err
+	}
+	for name, policy := range parsed {
+		if !slices.Contains(stepPolicySteps, name) {
+			return fmt.Errorf("unknown pipeline step %s (expected one of %v)", name, stepPolicySteps)
+		}
+		_, _, err := policy.attempts()
+		if err != nil {
+			return fmt.Errorf("pipeline step %s: %w", name, err)
+		}
+	}
+	*sp = StepPolicies(parsed)
+	return nil
+}
+
+// StepPoliciesConfig is loaded from the environment and configures how failures of pipeline steps are handled
+type StepPoliciesConfig struct {
+	Policies StepPolicies `env:"STEP_POLICIES"`
+}
+
+// StepError is returned when a pipeline step fails (after exhausting its retries) - recording the policy of the step
+type StepError struct {
+	Err    error
+	Policy StepPolicy
+	Step   string
+}
+
+func (e *StepError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// Runs a pipeline step - retrying it (with a delay between attempts) if its policy (see [StepPolicy]) retries failures.
+// Returns a [StepError] if every attempt fails.
+// Returns an error if STEP_POLICIES is malformed.
+func runStep(ctx context.Context, step string, run func() error) error {
+	config := StepPoliciesConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	policy := config.Policies[step]
+	attempts, delay, err := policy.attempts()
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err = run()
+		if err == nil || errors.Is(err, context.Canceled) {
+			return err
+		}
+		if attempt >= attempts {
+			return &StepError{Err: err, Policy: policy, Step: step}
+		}
+		helper.Logger(ctx).Warn("pipeline step failed - retrying", "step", step, "attempt", attempt, "attempts", attempts, "delay", delay, "error", err.Error())
+		err = clock.Sleep(ctx, delay)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Determines whether a failed pipeline step (see [runStep]) is ignored by its policy - logging a warning if so.
+// Errors not caused by a pipeline step are never ignored.
+func ignoreStepError(ctx context.Context, err error, attrs ...any) bool {
+	stepErr := &StepError{}
+	if !errors.As(err, &stepErr) || stepErr.Policy.Action != "warn" {
+		return false
+	}
+	attrs = append([]any{"step", stepErr.Step, "error", stepErr.Err.Error()}, attrs...)
+	helper.Logger(ctx).Warn("pipeline step failed - continuing", attrs...)
+	return true
+}
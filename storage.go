@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/fsutil"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+)
+
+// Storage is a durable store for the contents of the data directory (e.g., profiles).
+// Keys are slash-separated paths relative to the data directory.
+type Storage interface {
+	// Lists the keys of all stored files
+	List(ctx context.Context) ([]string, error)
+	// Downloads a stored file to a local path
+	Get(ctx context.Context, key string, dest string) error
+	// Uploads a local file
+	Put(ctx context.Context, key string, src string) error
+	// Deletes a stored file
+	Delete(ctx context.Context, key string) error
+}
+
+// localStorage implements [Storage] using a directory on local disk (e.g., a mounted network share)
+type localStorage struct {
+	root string
+}
+
+func (ls *localStorage) List(ctx context.Context) ([]string, error) {
+	keys := []string{}
+	err := filepath.WalkDir(ls.root, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == ls.root {
+			return filepath.SkipDir
+		}
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(ls.root, path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(relPath))
+		return nil
+	})
+	return keys, err
+}
+
+// Returns the path of a stored file within the storage directory.
+// Returns an error if the key leads outside of the storage directory.
+func (ls *localStorage) path(key string) (string, error) {
+	local := filepath.FromSlash(key)
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("stored key %s leads outside of the storage directory", key)
+	}
+	return filepath.Join(ls.root, local), nil
+}
+
+func (ls *localStorage) Get(ctx context.Context, key string, dest string) error {
+	path, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return fsutil.CopyFile(path, dest, info.Mode())
+}
+
+func (ls *localStorage) Put(ctx context.Context, key string, src string) error {
+	path, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	return fsutil.CopyFile(src, path, info.Mode())
+}
+
+func (ls *localStorage) Delete(ctx context.Context, key string) error {
+	_, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	return fsutil.RemoveFiles(ctx, ls.root, []string{key})
+}
+
+// s3Storage implements [Storage] using an S3 bucket (and an optional key prefix)
+type s3Storage struct {
+	bucket string
+	prefix string
+}
+
+// Creates an [S3Client] whose requests are declared outbound requests
+func (ss *s3Storage) client(ctx context.Context) (*S3Client, error) {
+	return NewS3Client(outbound.Declare(ctx, "storage"))
+}
+
+func (ss *s3Storage) List(ctx context.Context) ([]string, error) {
+	client, err := ss.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := client.ListObjects(ss.bucket, ss.prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, object := range objects {
+		if strings.HasSuffix(object, "/") {
+			continue
+		}
+		keys = append(keys, strings.TrimPrefix(object, ss.prefix))
+	}
+	return keys, nil
+}
+
+func (ss *s3Storage) Get(ctx context.Context, key string, dest string) error {
+	client, err := ss.client(ctx)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+	handle, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	return client.GetObject(ss.bucket, ss.prefix+key, handle)
+}
+
+func (ss *s3Storage) Put(ctx context.Context, key string, src string) error {
+	client, err := ss.client(ctx)
+	if err != nil {
+		return err
+	}
+	handle, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	info, err := handle.Stat()
+	if err != nil {
+		return err
+	}
+	return client.PutObject(ss.bucket, ss.prefix+key, handle, info.Size())
+}
+
+func (ss *s3Storage) Delete(ctx context.Context, key string) error {
+	client, err := ss.client(ctx)
+	if err != nil {
+		return err
+	}
+	return client.DeleteObject(ss.bucket, ss.prefix+key)
+}
+
+// storageFactories maps a storage url scheme to a function creating the [Storage] it refers to
+var storageFactories = map[string]func(ctx context.Context, storageUrl *url.URL) (Storage, error){
+	"file": func(ctx context.Context, storageUrl *url.URL) (Storage, error) {
+		return &localStorage{root: storageUrl.Path}, nil
+	},
+	"s3": func(ctx context.Context, storageUrl *url.URL) (Storage, error) {
+		prefix := strings.TrimPrefix(storageUrl.Path, "/")
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix = fmt.Sprintf("%s/", prefix)
+		}
+		return &s3Storage{bucket: storageUrl.Host, prefix: prefix}, nil
+	},
+}
+
+// Creates the [Storage] referenced by a storage url (e.g., 's3://bucket/prefix' or 'file:///backups/spt').
+// Returns nil if the url is empty - in which case the data directory is the only copy of the data.
+// Returns an error if the url is malformed or its scheme is unsupported.
+func NewStorage(ctx context.Context, storageUrl string) (Storage, error) {
+	if storageUrl == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(storageUrl)
+	if err != nil {
+		return nil, err
+	}
+	factory, ok := storageFactories[parsed.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage url %s", storageUrl)
+	}
+	return factory(ctx, parsed)
+}
+
+// storageState maps keys to the checksum of the file when it was last synced with storage
+type storageState map[string]string
+
+// Returns the path to the file tracking the storage sync state
+func getStorageStatePath(ctx context.Context) string {
+	return filepath.Join(helper.Dirs(ctx)["data"], ".storage-state.json")
+}
+
+// Loads the storage sync state.
+// Returns an empty state if nothing has been synced.
+// Returns an error if the state exists but cannot be read.
+func loadStorageState(ctx context.Context) (storageState, error) {
+	state := storageState{}
+	data, err := os.ReadFile(getStorageStatePath(ctx))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// Persists the storage sync state
+func saveStorageState(ctx context.Context, state storageState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(getStorageStatePath(ctx), data)
+}
+
+// storageExcludedPaths are the entries at the root of the data directory that are never synced with storage - bulky files that are re-created or re-fetched, and host-specific status files
+var storageExcludedPaths = []string{
+	"adopted-mods",
+	"client-mods",
+	"client-mods.zip",
+	"disabled-mods",
+	"gc-quarantine",
+	"health.json",
+	"profile-backups",
+	"server-port.json",
+	"uploads",
+}
+
+// Lists the keys of files in the data directory that are synced with storage.
+// Hidden entries at the root of the data directory (e.g., the journal and the storage state) and excluded entries (see [storageExcludedPaths]) are not synced.
+func listStorableFiles(ctx context.Context) ([]string, error) {
+	dataDir := helper.Dirs(ctx)["data"]
+	keys := []string{}
+	err := filepath.WalkDir(dataDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dataDir, path)
+		if err != nil {
+			return err
+		}
+		if relPath != "." && filepath.Dir(relPath) == "." && (strings.HasPrefix(relPath, ".") || slices.Contains(storageExcludedPaths, relPath)) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		keys = append(keys, filepath.ToSlash(relPath))
+		return nil
+	})
+	slices.Sort(keys)
+	return keys, err
+}
+
+// Restores the data directory from storage - downloading stored files missing from the data directory.
+// Local files that were previously synced are kept (as they are either unchanged, or newer and not yet pushed).
+// Local files that were never synced are replaced by their stored counterpart.
+// Returns an error if storage cannot be listed, a stored key leads outside of the data directory or a file cannot be downloaded.
+func PullStorage(ctx context.Context, storage Storage) error {
+	helper.Logger(ctx).Info("pull storage")
+	state, err := loadStorageState(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := storage.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		local := filepath.FromSlash(key)
+		if !filepath.IsLocal(local) {
+			return fmt.Errorf("stored key %s leads outside of the data directory", key)
+		}
+		dest := filepath.Join(helper.Dirs(ctx)["data"], local)
+		checksum, err := fsutil.HashFile(dest)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		synced, ok := state[key]
+		if err == nil && ok {
+			if checksum != synced {
+				helper.Logger(ctx).Warn("local file changed since last sync - keeping local file", "key", key)
+			}
+			continue
+		}
+		helper.Logger(ctx).Info("download stored file", "key", key)
+		err = storage.Get(ctx, key, dest)
+		if err != nil {
+			return err
+		}
+		state[key], err = fsutil.HashFile(dest)
+		if err != nil {
+			return err
+		}
+	}
+	return saveStorageState(ctx, state)
+}
+
+// Persists the data directory to storage - uploading files changed since they were last synced and deleting stored files removed locally.
+// Returns an error if a file cannot be uploaded or deleted.
+func PushStorage(ctx context.Context, storage Storage) error {
+	state, err := loadStorageState(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := listStorableFiles(ctx)
+	if err != nil {
+		return err
+	}
+	changed := 0
+	for _, key := range keys {
+		src := filepath.Join(helper.Dirs(ctx)["data"], filepath.FromSlash(key))
+		checksum, err := fsutil.HashFile(src)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if checksum == state[key] {
+			continue
+		}
+		helper.Logger(ctx).Info("upload stored file", "key", key)
+		err = storage.Put(ctx, key, src)
+		if err != nil {
+			return err
+		}
+		state[key] = checksum
+		changed++
+	}
+	for _, key := range helper.Map[string, string](state).Keys() {
+		if slices.Contains(keys, key) {
+			continue
+		}
+		helper.Logger(ctx).Info("delete stored file", "key", key)
+		err = storage.Delete(ctx, key)
+		if err != nil {
+			return err
+		}
+		delete(state, key)
+		changed++
+	}
+	if changed > 0 {
+		helper.Logger(ctx).Info("pushed storage", "changed", changed)
+	}
+	return saveStorageState(ctx, state)
+}
+
+// Runs a function and pushes the data directory to storage after the function returns.
+// Periodic pushes while the function runs are performed by the 'storage-push' job (see [GetJobs]).
+// Returns an error if the function fails.
+// Returns an error if the final push fails.
+func SyncStorageWhile(ctx context.Context, storage Storage, run func() error) error {
+	runErr := run()
+	pushErr := PushStorage(ctx, storage)
+	return errors.Join(runErr, pushErr)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/clock"
+	"github.com/benfiola/single-player-tarkov/pkg/patch"
+)
+
+// supportBundleLogLimit is the maximum number of bytes (from the end of each file) included for each log file
+const supportBundleLogLimit = 1024 * 1024
+
+// secretEnvRegexp matches the names of environment variables whose values are redacted from support bundles
+var secretEnvRegexp = regexp.MustCompile(`(?i)(AUTH|CREDENTIALS|KEY|PASSWORD|SECRET|TOKEN)`)
+
+// urlCredentialsRegexp matches credentials embedded in urls (i.e., userinfo and query strings) - which are redacted from support bundles
+var urlCredentialsRegexp = regexp.MustCompile(`(://[^/@\s,]+@|\?[^\s,#]*)`)
+
+// Redacts the value of an environment variable for inclusion in a support bundle.
+// Secrets are redacted entirely - credentials embedded in urls (e.g., signed download urls) are removed.
+func redactEnv(name string, value string) string {
+	if secretEnvRegexp.MatchString(name) && value != "" {
+		return "REDACTED"
+	}
+	return urlCredentialsRegexp.ReplaceAllStringFunc(value, func(match string) string {
+		if strings.HasPrefix(match, "?") {
+			return "?REDACTED"
+		}
+		return "://REDACTED@"
+	})
+}
+
+// Escapes a key for use within a JSON pointer
+func escapeJsonPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// configDiff is a difference between the stock and current contents of a config file (see [diffJson])
+type configDiff struct {
+	Current any
+	Op      string
+	Path    string
+	Stock   any
+}
+
+// Formats the difference as the operation transforming the stock value into the current value
+func (cd configDiff) String() string {
+	switch cd.Op {
+	case "remove":
+		return fmt.Sprintf("remove %s", cd.Path)
+	case "add":
+		return fmt.Sprintf("add %s: %s", cd.Path, formatJson(cd.Current))
+	default:
+		return fmt.Sprintf("replace %s: %s -> %s", cd.Path, formatJson(cd.Stock), formatJson(cd.Current))
+	}
+}
+
+// Compares two JSON documents - returning a difference per changed value (identified by a JSON pointer).
+func diffJson(path string, stock any, current any) []configDiff {
+	stockMap, stockOk := stock.(map[string]any)
+	currentMap, currentOk := current.(map[string]any)
+	if stockOk && currentOk {
+		keys := append(helper.Map[string, any](stockMap).Keys(), helper.Map[string, any](currentMap).Keys()...)
+		slices.Sort(keys)
+		diffs := []configDiff{}
+		for _, key := range slices.Compact(keys) {
+			childPath := fmt.Sprintf("%s/%s", path, escapeJsonPointer(key))
+			stockValue, inStock := stockMap[key]
+			currentValue, inCurrent := currentMap[key]
+			switch {
+			case !inCurrent:
+				diffs = append(diffs, configDiff{Op: "remove", Path: childPath, Stock: stockValue})
+			case !inStock:
+				diffs = append(diffs, configDiff{Current: currentValue, Op: "add", Path: childPath})
+			default:
+				diffs = append(diffs, diffJson(childPath, stockValue, currentValue)...)
+			}
+		}
+		return diffs
+	}
+	stockList, stockOk := stock.([]any)
+	currentList, currentOk := current.([]any)
+	if stockOk && currentOk && len(stockList) == len(currentList) {
+		diffs := []configDiff{}
+		for index := range stockList {
+			diffs = append(diffs, diffJson(fmt.Sprintf("%s/%d", path, index), stockList[index], currentList[index])...)
+		}
+		return diffs
+	}
+	if reflect.DeepEqual(stock, current) {
+		return nil
+	}
+	return []configDiff{{Current: current, Op: "replace", Path: path, Stock: stock}}
+}
+
+// Formats a value as (compact) JSON for display
+func formatJson(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+// Compares each patched config file against its stock snapshot, redacting values set from environment variables.
+// Returns an error if the config patches cannot be loaded.
+// Returns an error if a snapshot or config file cannot be read.
+func getConfigDiffs(ctx context.Context) (string, error) {
+	config := EntrypointConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return "", err
+	}
+	config, err = LoadConfigPatches(ctx, config)
+	if err != nil {
+		return "", err
+	}
+	configPatches, err := patch.Expand(ctx, helper.Dirs(ctx)["spt"], config.ConfigPatches)
+	if err != nil {
+		return "", err
+	}
+	relPaths, err := patch.Snapshots(getStockConfigPath(ctx, ""))
+	if err != nil {
+		return "", err
+	}
+	builder := strings.Builder{}
+	for _, relPath := range relPaths {
+		diffs, err := diffConfigFile(ctx, relPath)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&builder, "--- %s\n", filepath.ToSlash(relPath))
+		for _, diff := range redactConfigDiffs(diffs, configPatches[relPath]) {
+			fmt.Fprintf(&builder, "%s\n", diff)
+		}
+		fmt.Fprintln(&builder)
+	}
+	return builder.String(), nil
+}
+
+// supportBundle writes files into a support bundle archive
+type supportBundle struct {
+	created time.Time
+	writer  *zip.Writer
+}
+
+// Creates a (compressed) file in the bundle
+func (sb *supportBundle) create(name string) (io.Writer, error) {
+	return sb.writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: sb.created})
+}
+
+// Adds a file with the given contents to the bundle
+func (sb *supportBundle) add(name string, data []byte) error {
+	writer, err := sb.create(name)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+// Adds a file from disk to the bundle - including at most the last limit bytes (if limit is positive).
+// Files that don't exist are skipped.
+func (sb *supportBundle) addFile(name string, path string, limit int64) error {
+	handle, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	info, err := handle.Stat()
+	if err != nil {
+		return err
+	}
+	if limit > 0 && info.Size() > limit {
+		_, err = handle.Seek(-limit, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+	}
+	writer, err := sb.create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, handle)
+	return err
+}
+
+// Adds the files within a directory on disk to the bundle (beneath the given prefix) - see [supportBundle.addFile].
+// Missing directories are skipped.
+func (sb *supportBundle) addDir(prefix string, dir string, limit int64) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == dir {
+			return filepath.SkipDir
+		}
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return sb.addFile(fmt.Sprintf("%s/%s", prefix, filepath.ToSlash(relPath)), path, limit)
+	})
+}
+
+// Gathers diagnostic information into a single archive to attach to bug reports.
+// The bundle contains system information, the redacted configuration, the mod inventory, config diffs, the journal, the run history and server logs.
+// Writes to the given path (default: 'support-bundle.zip').
+// Returns an error if the bundle cannot be written.
+func SupportBundle(ctx context.Context, args ...string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: support-bundle [output]")
+	}
+	output := "support-bundle.zip"
+	if len(args) == 1 {
+		output = args[0]
+	}
+	handle, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	bundle := &supportBundle{created: clock.Get(ctx).Now(), writer: zip.NewWriter(handle)}
+	sptDir := helper.Dirs(ctx)["spt"]
+	dataDir := helper.Dirs(ctx)["data"]
+
+	system := strings.Builder{}
+	fmt.Fprintf(&system, "entrypoint version: %s\n", strings.TrimSpace(helper.Version(ctx)))
+	fmt.Fprintf(&system, "go version: %s\n", runtime.Version())
+	fmt.Fprintf(&system, "platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&system, "run id: %s\n", GetRunId())
+	fmt.Fprintf(&system, "time: %s\n", bundle.created.Format(time.RFC3339))
+	err = bundle.add("system.txt", []byte(system.String()))
+	if err != nil {
+		return err
+	}
+
+	effective := GetEffectiveEnv()
+	env := strings.Builder{}
+	names := helper.Map[string, string](effective).Keys()
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(&env, "%s=%s\n", name, redactEnv(name, effective[name]))
+	}
+	err = bundle.add("config/env.txt", []byte(env.String()))
+	if err != nil {
+		return err
+	}
+
+	diffs, err := getConfigDiffs(ctx)
+	if err != nil {
+		helper.Logger(ctx).Warn("config diffs unavailable", "error", err.Error())
+		diffs = fmt.Sprintf("config diffs unavailable: %s\n", err.Error())
+	}
+	err = bundle.add("config/diffs.txt", []byte(diffs))
+	if err != nil {
+		return err
+	}
+
+	files := map[string]string{
+		"journal.json":        getJournalPath(ctx),
+		"mods/installed.json": getInstalledModsPath(ctx),
+		"mods/inventory.json": getModInventoryPath(ctx),
+		"mods/licenses.json":  filepath.Join(dataDir, "mod-licenses.json"),
+		"mods/order.json":     filepath.Join(sptDir, "user", "mods", "order.json"),
+		"run-history.json":    getRunHistoryPath(ctx),
+		"storage-state.json":  getStorageStatePath(ctx),
+	}
+	fileNames := helper.Map[string, string](files).Keys()
+	slices.Sort(fileNames)
+	for _, name := range fileNames {
+		err = bundle.addFile(name, files[name], 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = bundle.addDir("logs", filepath.Join(sptDir, "user", "logs"), supportBundleLogLimit)
+	if err != nil {
+		return err
+	}
+
+	err = bundle.writer.Close()
+	if err != nil {
+		return err
+	}
+	helper.Logger(ctx).Info("wrote support bundle", "path", output)
+	return nil
+}
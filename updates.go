@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/outbound"
+	"golang.org/x/mod/semver"
+)
+
+// UpdatesConfig is loaded from the environment and configures mod update checks
+type UpdatesConfig struct {
+	Webhook string `env:"CHECK_UPDATES_WEBHOOK"`
+}
+
+// ModUpdate is the result of checking a configured mod for a newer version
+type ModUpdate struct {
+	Error     string `json:"error,omitempty"`
+	Installed string `json:"installed"`
+	Latest    string `json:"latest"`
+	Name      string `json:"name"`
+	Source    string `json:"source"`
+	Status    string `json:"status"`
+}
+
+// Returns the latest published version of a mod - or an empty string if the mod's source (e.g., a plain url) publishes no versions.
+// Returns an error if the mod's source cannot be queried.
+func getLatestModVersion(ctx context.Context, mod Mod) (string, error) {
+	scheme, _, _ := strings.Cut(mod.Url, ":")
+	name, _ := parseModSpec(mod)
+	switch scheme {
+	case "forge":
+		client, err := NewForgeClient(ctx)
+		if err != nil {
+			return "", err
+		}
+		forgeMod, err := client.FindMod(name)
+		if err != nil {
+			return "", err
+		}
+		versions, err := client.ListModVersions(forgeMod)
+		if err != nil {
+			return "", err
+		}
+		latest, err := selectForgeModVersion(versions, "")
+		return latest.Version, err
+	case "github":
+		resolved, err := ResolveGithubMod(ctx, Mod{Name: mod.Name, Url: fmt.Sprintf("github:%s@latest", name)})
+		return resolved.Version, err
+	default:
+		return "", nil
+	}
+}
+
+// Determines whether the latest version of a mod is newer than its installed version.
+// Versions that aren't semantic versions are newer whenever they differ.
+func isNewerVersion(latest string, installed string) bool {
+	latest = fmt.Sprintf("v%s", strings.TrimPrefix(latest, "v"))
+	installed = fmt.Sprintf("v%s", strings.TrimPrefix(installed, "v"))
+	if semver.IsValid(latest) && semver.IsValid(installed) {
+		return semver.Compare(latest, installed) > 0
+	}
+	return latest != installed
+}
+
+// Checks configured mods whose source publishes versions (forge: and github: mods) for versions newer than the installed versions.
+// Mods that cannot be checked are reported with an error rather than failing the check.
+// Returns an error if the installed mods cannot be read.
+func CheckModUpdates(ctx context.Context, mods []Mod) ([]ModUpdate, error) {
+	installed, err := LoadInstalledMods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	updates := []ModUpdate{}
+	for _, mod := range mods {
+		scheme, _, _ := strings.Cut(mod.Url, ":")
+		if scheme != "forge" && scheme != "github" {
+			continue
+		}
+		update := ModUpdate{Installed: installed[mod.Name].Version, Name: mod.Name, Source: mod.Url}
+		update.Latest, err = getLatestModVersion(outbound.Declare(ctx, fmt.Sprintf("check mod %s for updates", mod.Name)), mod)
+		switch {
+		case err != nil:
+			update.Error = err.Error()
+			update.Status = "error"
+		case update.Installed == "":
+			update.Status = "not installed"
+		case isNewerVersion(update.Latest, update.Installed):
+			update.Status = "update available"
+		default:
+			update.Status = "up to date"
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+// Checks the configured mods for updates (see [CheckModUpdates]).
+// Available updates are logged and posted to CHECK_UPDATES_WEBHOOK (if set).
+// The webhook receives a json object with the summary (as both 'content' and 'text' - as expected by Discord and Slack) and the list of updates.
+// Returns an error if the configured mods cannot be determined or checked.
+// Returns an error if the webhook request fails.
+func ReportModUpdates(ctx context.Context, config EntrypointConfig) ([]ModUpdate, error) {
+	updatesConfig := UpdatesConfig{}
+	err := helper.ParseEnv(ctx, &updatesConfig)
+	if err != nil {
+		return nil, err
+	}
+	mods, err := GetConfiguredMods(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	updates, err := CheckModUpdates(ctx, mods)
+	if err != nil {
+		return nil, err
+	}
+
+	available := []string{}
+	for _, update := range updates {
+		switch update.Status {
+		case "update available":
+			helper.Logger(ctx).Warn("mod update available", "name", update.Name, "installed", update.Installed, "latest", update.Latest)
+			available = append(available, fmt.Sprintf("%s %s -> %s", update.Name, update.Installed, update.Latest))
+		case "error":
+			helper.Logger(ctx).Warn("mod update check failed", "name", update.Name, "error", update.Error)
+		}
+	}
+	helper.Logger(ctx).Info("checked mods for updates", "checked", len(updates), "available", len(available))
+	if len(available) == 0 || updatesConfig.Webhook == "" {
+		return updates, nil
+	}
+	summary := fmt.Sprintf("%d mod update(s) available: %s", len(available), strings.Join(available, ", "))
+	payload := map[string]any{"content": summary, "text": summary, "updates": updates}
+	err = PostJson(outbound.Declare(ctx, "post mod updates to webhook"), updatesConfig.Webhook, payload)
+	return updates, err
+}
+
+// Checks the configured mods for updates (see [ReportModUpdates]) and prints a report.
+// Returns an error if the check fails.
+func CheckUpdates(ctx context.Context, args ...string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: check-updates")
+	}
+	config := EntrypointConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	updates, err := ReportModUpdates(ctx, config)
+	if err != nil {
+		return err
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tSOURCE\tINSTALLED\tLATEST\tSTATUS")
+	for _, update := range updates {
+		installed, latest := update.Installed, update.Latest
+		if installed == "" {
+			installed = "-"
+		}
+		if latest == "" {
+			latest = "-"
+		}
+		status := update.Status
+		if update.Error != "" {
+			status = fmt.Sprintf("%s (%s)", status, update.Error)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", update.Name, update.Source, installed, latest, status)
+	}
+	return writer.Flush()
+}
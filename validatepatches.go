@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	helper "github.com/benfiola/game-server-helper/pkg"
+	"github.com/benfiola/single-player-tarkov/pkg/patch"
+)
+
+// Implements the 'validate-patches' subcommand - checking the config patches applied during setup without modifying any files.
+// Every problem found is listed.
+// Patches are resolved as they are during setup (see [resolveConfigPatches]) - so the server should have been set up, with its mods installed.
+// Returns an error if the arguments are invalid.
+// Returns an error if the config patches cannot be loaded or resolved.
+// Returns an error if problems were found.
+func ValidatePatches(ctx context.Context, args ...string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: validate-patches")
+	}
+	config := EntrypointConfig{}
+	err := helper.ParseEnv(ctx, &config)
+	if err != nil {
+		return err
+	}
+	config, err = LoadConfigPatches(ctx, config)
+	if err != nil {
+		return err
+	}
+	config, err = ResolveSptVersion(ctx, config)
+	if err != nil {
+		return err
+	}
+	configPatches, err := getSetupConfigPatches(ctx, config)
+	if err != nil {
+		return err
+	}
+	configPatches, err = resolveConfigPatches(ctx, config.SptVersion, configPatches)
+	if err != nil {
+		return err
+	}
+	problems := patch.Validate(ctx, helper.Dirs(ctx)["spt"], getStockConfigPath(ctx, ""), configPatches)
+	count := 0
+	for _, patches := range configPatches {
+		count += len(patches)
+	}
+	if len(problems) == 0 {
+		fmt.Fprintf(os.Stdout, "%d patch(es) of %d file(s) valid\n", count, len(configPatches))
+		return nil
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "FILE\tOP\tPATH\tPROBLEM")
+	for _, problem := range problems {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", problem.File, problem.Op, problem.Path, problem.Message)
+	}
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%d problem(s) found in %d patch(es) of %d file(s)", len(problems), count, len(configPatches))
+}